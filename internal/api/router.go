@@ -12,14 +12,16 @@ type Router struct {
 	engine       *gin.Engine
 	adminHandler *handlers.AdminHandler
 	proxyHandler *handlers.ProxyHandler
+	userAuth     gin.HandlerFunc
 }
 
 // NewRouter 创建路由器
-func NewRouter(engine *gin.Engine, adminHandler *handlers.AdminHandler, proxyHandler *handlers.ProxyHandler) *Router {
+func NewRouter(engine *gin.Engine, adminHandler *handlers.AdminHandler, proxyHandler *handlers.ProxyHandler, userAuth gin.HandlerFunc) *Router {
 	return &Router{
 		engine:       engine,
 		adminHandler: adminHandler,
 		proxyHandler: proxyHandler,
+		userAuth:     userAuth,
 	}
 }
 
@@ -38,18 +40,36 @@ func (r *Router) Setup() {
 	{
 		admin.POST("/channels", r.adminHandler.AddChannel)
 		admin.GET("/channels", r.adminHandler.ListChannels)
+		admin.GET("/channels/health", r.adminHandler.ChannelHealth)
+		admin.PATCH("/channels/:id", r.adminHandler.UpdateChannel)
 		admin.DELETE("/channels/:id", r.adminHandler.DeleteChannel)
+		admin.POST("/channels/:id/enable", r.adminHandler.EnableChannel)
+		admin.POST("/channels/:id/disable", r.adminHandler.DisableChannel)
+		admin.POST("/channels/:id/test", r.adminHandler.TestChannel)
+		admin.PUT("/channels/:id/models", r.adminHandler.UpdateChannelModels)
+		admin.GET("/channels/:id/leases", r.adminHandler.ListChannelLeases)
+		admin.DELETE("/channels/:id/leases", r.adminHandler.ResetChannelLeases)
+		admin.GET("/channels/:id/keys", r.adminHandler.ListChannelKeys)
+		admin.POST("/channels/:id/keys", r.adminHandler.AddChannelKey)
+		admin.DELETE("/channels/:id/keys/:key_id", r.adminHandler.RetireChannelKey)
+		admin.POST("/channels/:id/keys/:key_id/enable", r.adminHandler.EnableChannelKey)
 		admin.POST("/recharge", r.adminHandler.Recharge)
 		admin.GET("/monitor", r.adminHandler.Monitor)
 	}
 
 	// 用户API路由(需要API Key认证)
-	// 注意: UserAuth中间件需要在app初始化时传入
-	api := r.engine.Group("/api/v1")
+	api := r.engine.Group("/api/v1", r.userAuth)
 	{
-		// 文本对话(同步)
+		// 模型列表
+		api.GET("/models", r.proxyHandler.ListModels)
+		api.GET("/models/:model", r.proxyHandler.RetrieveModel)
+
+		// 文本对话(同步/流式)
 		api.POST("/chat/completions", r.proxyHandler.ChatCompletions)
 
+		// 文本向量化
+		api.POST("/embeddings", r.proxyHandler.Embeddings)
+
 		// 图片生成(异步)
 		api.POST("/images/generations", r.proxyHandler.ImageGeneration)
 
@@ -62,4 +82,22 @@ func (r *Router) Setup() {
 		// 余额查询
 		api.GET("/balance", r.proxyHandler.GetBalance)
 	}
+
+	// 第三方SDK兼容路由(需要API Key认证)
+	compat := r.engine.Group("/v1", r.userAuth)
+	{
+		// OpenAI 模型列表
+		compat.GET("/models", r.proxyHandler.ListModels)
+		compat.GET("/models/:model", r.proxyHandler.RetrieveModel)
+
+		// Anthropic Messages API
+		compat.POST("/messages", r.proxyHandler.Messages)
+	}
+
+	// Gemini API 兼容路由(需要API Key认证)
+	// 路径形如 /v1beta/models/{model}:generateContent,模型与方法由处理器解析
+	gemini := r.engine.Group("/v1beta", r.userAuth)
+	{
+		gemini.POST("/models/:action", r.proxyHandler.GenerateContent)
+	}
 }
@@ -9,6 +9,7 @@ import (
 	"github.com/869413421/transit/internal/database"
 	"github.com/869413421/transit/internal/database/migrate"
 	"github.com/869413421/transit/internal/handlers"
+	"github.com/869413421/transit/internal/middleware"
 	"github.com/869413421/transit/internal/repository"
 	"github.com/869413421/transit/internal/services"
 	"github.com/869413421/transit/pkg/billing"
@@ -16,6 +17,8 @@ import (
 	"github.com/869413421/transit/pkg/logger"
 	"github.com/869413421/transit/pkg/poller"
 	"github.com/869413421/transit/pkg/pool"
+	"github.com/869413421/transit/pkg/prober"
+	"github.com/869413421/transit/pkg/secret"
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -72,18 +75,82 @@ func (a *App) Start() error {
 	logger.Info("Redis 连接成功")
 
 	// 4. 初始化持久层 (Repositories)
-	channelRepo := repository.NewChannelRepository(a.db)
 	userRepo := repository.NewUserRepository(a.db)
 	taskRepo := repository.NewTaskRepository(a.db)
+	userAPIKeyRepo := repository.NewUserAPIKeyRepository(a.db)
+
+	// 渠道密钥加密落库,主密钥轮换后启动时用新主密钥重新加密
+	cipher, err := secret.NewCipher(a.cfg.Security.MasterKey, a.cfg.Security.PreviousMasterKeys)
+	if err != nil {
+		return fmt.Errorf("初始化密钥加密失败: %w", err)
+	}
+	if !cipher.Enabled() {
+		logger.Warn("未配置 security.master_key,渠道密钥将以明文存储")
+	}
+	baseChannelRepo := repository.NewChannelRepository(a.db, cipher)
+	reencrypted, err := baseChannelRepo.ReencryptKeys(context.Background())
+	if err != nil {
+		return fmt.Errorf("重新加密渠道密钥失败: %w", err)
+	}
+	if reencrypted > 0 && cipher.Enabled() {
+		logger.Info("渠道密钥已重新加密", zap.Int("count", reencrypted))
+	} else if reencrypted > 0 {
+		logger.Info("渠道密钥已还原为明文", zap.Int("count", reencrypted))
+	}
+
+	// 渠道读取走进程内缓存,写入后经 Redis pub/sub 通知所有实例刷新
+	channelRepo := repository.NewChannelCache(baseChannelRepo, a.redis, a.cfg.Cache.RefreshInterval)
+	if err := channelRepo.Refresh(context.Background()); err != nil {
+		return fmt.Errorf("加载渠道缓存失败: %w", err)
+	}
+	go channelRepo.Start(context.Background())
 
 	// 5. 初始化基础设施层
-	redisPool := pool.NewRedisPool(a.redis)
+	var adaptive *pool.AdaptiveLimit
+	if a.cfg.Pool.Adaptive.Enabled {
+		adaptive = &pool.AdaptiveLimit{
+			Floor:            a.cfg.Pool.Adaptive.Floor,
+			Increase:         a.cfg.Pool.Adaptive.Increase,
+			DecreaseFactor:   a.cfg.Pool.Adaptive.DecreaseFactor,
+			LatencyThreshold: a.cfg.Pool.Adaptive.LatencyThreshold,
+		}
+	}
+	redisPool := pool.NewRedisPool(a.redis, a.cfg.Pool.LeaseTTL, adaptive)
 	billingService := billing.NewService(a.redis)
 
 	// 6. 初始化业务逻辑层 (Services)
 	channelService := services.NewChannelService(channelRepo, redisPool)
 	taskService := services.NewTaskService(taskRepo)
-	selector := loadbalancer.NewSelector(channelRepo, redisPool)
+	breaker := loadbalancer.NewCircuitBreaker(
+		a.redis,
+		a.cfg.Breaker.FailureThreshold,
+		a.cfg.Breaker.Cooldown,
+		a.cfg.Breaker.HalfOpenProbes,
+	)
+	health := loadbalancer.NewHealthTracker(
+		a.redis,
+		a.cfg.Health.UnhealthyThreshold,
+		a.cfg.Health.Interval,
+	)
+	strategies, err := loadbalancer.NewStrategies(a.cfg.LB.Strategy, a.cfg.Models.LBStrategies(), redisPool)
+	if err != nil {
+		return fmt.Errorf("初始化负载均衡策略失败: %w", err)
+	}
+	var queue *loadbalancer.WaitQueue
+	if a.cfg.Queue.Enabled {
+		queue = loadbalancer.NewWaitQueue(a.redis, a.cfg.Queue.MaxSize, a.cfg.Queue.Timeout, a.cfg.Queue.PollInterval)
+	}
+	var rateLimits *loadbalancer.RateLimitTracker
+	if a.cfg.RateLimit.Enabled {
+		rateLimits = loadbalancer.NewRateLimitTracker(a.redis,
+			a.cfg.RateLimit.LowRatio, a.cfg.RateLimit.DefaultCooldown, a.cfg.RateLimit.MaxCooldown,
+		)
+	}
+	keys := loadbalancer.NewKeyRotator(a.redis, channelRepo, a.cfg.Keys.RejectionThreshold)
+	selector := loadbalancer.NewSelector(channelRepo, redisPool, breaker, health, strategies, queue, rateLimits, keys)
+
+	// 探测器同时供管理接口测试渠道使用,未启用健康探测时不启动定期探测
+	channelProber := prober.NewProber(channelRepo, health, keys, &a.cfg.Models, a.cfg.Health)
 
 	// 7. 初始化接口层 (Handlers)
 	adminHandler := handlers.NewAdminHandler(
@@ -92,6 +159,11 @@ func (a *App) Start() error {
 		userRepo,
 		billingService,
 		redisPool,
+		breaker,
+		health,
+		queue,
+		rateLimits,
+		channelProber,
 	)
 
 	proxyHandler := handlers.NewProxyHandler(
@@ -107,17 +179,26 @@ func (a *App) Start() error {
 	}
 	engine := gin.New()
 
-	// 添加用户认证中间件到API路由
 	engine.Use(gin.Logger(), gin.Recovery())
 
-	router := api.NewRouter(engine, adminHandler, proxyHandler)
+	// 用户认证中间件仅作用于用户API路由
+	router := api.NewRouter(engine, adminHandler, proxyHandler, middleware.UserAuth(userAPIKeyRepo))
 	router.Setup()
 
 	// 9. 启动后台任务轮询器
 	poller := poller.NewPoller(taskService, channelRepo, selector, billingService)
 	go poller.Start(context.Background())
 
-	// 10. 启动 HTTP 服务
+	// 10. 启动过期租约回收器
+	reaper := pool.NewReaper(redisPool, channelRepo, a.cfg.Pool.ReapInterval)
+	go reaper.Start(context.Background())
+
+	// 11. 启动渠道健康探测器
+	if a.cfg.Health.Enabled {
+		go channelProber.Start(context.Background())
+	}
+
+	// 12. 启动 HTTP 服务
 	addr := ":" + a.cfg.Server.Port
 	logger.Info("服务器正在启动", zap.String("address", addr), zap.String("environment", a.cfg.Server.Environment))
 	return engine.Run(addr)
@@ -2,17 +2,28 @@ package config
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 // Config 应用配置结构
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Database DatabaseConfig `mapstructure:"database"`
-	Redis    RedisConfig    `mapstructure:"redis"`
-	Admin    AdminConfig    `mapstructure:"admin"`
-	Models   ModelsConfig   // 模型配置,单独加载
+	Server    ServerConfig    `mapstructure:"server"`
+	Database  DatabaseConfig  `mapstructure:"database"`
+	Redis     RedisConfig     `mapstructure:"redis"`
+	Admin     AdminConfig     `mapstructure:"admin"`
+	Security  SecurityConfig  `mapstructure:"security"`
+	Keys      KeysConfig      `mapstructure:"channel_keys"`
+	Pool      PoolConfig      `mapstructure:"pool"`
+	Cache     CacheConfig     `mapstructure:"channel_cache"`
+	Retry     RetryConfig     `mapstructure:"retry"`
+	Breaker   BreakerConfig   `mapstructure:"circuit_breaker"`
+	Health    HealthConfig    `mapstructure:"health_check"`
+	LB        LBConfig        `mapstructure:"load_balancing"`
+	Queue     QueueConfig     `mapstructure:"queue"`
+	RateLimit RateLimitConfig `mapstructure:"rate_limit"`
+	Models    ModelsConfig    // 模型配置,单独加载
 }
 
 // ServerConfig 服务器配置
@@ -43,6 +54,87 @@ type AdminConfig struct {
 	Token string `mapstructure:"token"` // 管理员 API Token
 }
 
+// SecurityConfig 渠道密钥加密配置
+type SecurityConfig struct {
+	MasterKey          string   `mapstructure:"master_key"`           // 加密渠道密钥的主密钥,为空时明文存储
+	PreviousMasterKeys []string `mapstructure:"previous_master_keys"` // 轮换前的主密钥,仅用于解密旧密文
+}
+
+// KeysConfig 渠道密钥配置
+type KeysConfig struct {
+	RejectionThreshold int `mapstructure:"rejection_threshold"` // 上游连续以 401/403 拒绝达到该次数后停用密钥,0 表示不自动停用
+}
+
+// PoolConfig 渠道并发位配置
+type PoolConfig struct {
+	LeaseTTL     time.Duration  `mapstructure:"lease_ttl"`     // 并发位租约有效期,需大于最长的同步请求耗时
+	ReapInterval time.Duration  `mapstructure:"reap_interval"` // 过期租约回收周期
+	Adaptive     AdaptiveConfig `mapstructure:"adaptive"`
+}
+
+// AdaptiveConfig 自适应并发上限(AIMD)配置
+type AdaptiveConfig struct {
+	Enabled          bool          `mapstructure:"enabled"`
+	Floor            int           `mapstructure:"floor"`             // 初始及最低有效上限
+	Increase         float64       `mapstructure:"increase"`          // 每轮成功请求增加的并发数
+	DecreaseFactor   float64       `mapstructure:"decrease_factor"`   // 429 或超时后有效上限乘以该系数
+	LatencyThreshold time.Duration `mapstructure:"latency_threshold"` // 成功请求耗时超过该值时不增长,0 表示不考虑耗时
+}
+
+// CacheConfig 渠道缓存配置
+type CacheConfig struct {
+	RefreshInterval time.Duration `mapstructure:"refresh_interval"` // 定期全量刷新周期,变更通知丢失时兜底
+}
+
+// RetryConfig 跨渠道重试配置
+type RetryConfig struct {
+	MaxAttempts            int           `mapstructure:"max_attempts"`              // 最大尝试次数(含首次),1 表示不重试
+	RetryStatusCodes       []int         `mapstructure:"retry_status_codes"`        // 可重试的上游 HTTP 状态码
+	RetryOnTimeout         bool          `mapstructure:"retry_on_timeout"`          // 上游超时是否重试
+	RetryOnConnectionError bool          `mapstructure:"retry_on_connection_error"` // 连接失败是否重试
+	InitialBackoff         time.Duration `mapstructure:"initial_backoff"`           // 首次重试前的等待时间
+	MaxBackoff             time.Duration `mapstructure:"max_backoff"`               // 等待时间上限
+}
+
+// BreakerConfig 渠道熔断配置
+type BreakerConfig struct {
+	FailureThreshold int           `mapstructure:"failure_threshold"` // 触发熔断的连续失败次数,0 表示不启用
+	Cooldown         time.Duration `mapstructure:"cooldown"`          // 熔断冷却时间,结束后进入半开状态
+	HalfOpenProbes   int           `mapstructure:"half_open_probes"`  // 半开状态下放行的探测请求数
+}
+
+// HealthConfig 渠道健康探测配置
+type HealthConfig struct {
+	Enabled            bool          `mapstructure:"enabled"`
+	Interval           time.Duration `mapstructure:"interval"`            // 探测周期
+	Timeout            time.Duration `mapstructure:"timeout"`             // 单次探测超时时间
+	Model              string        `mapstructure:"model"`               // 探测使用的文本模型
+	Prompt             string        `mapstructure:"prompt"`              // 探测消息内容
+	UnhealthyThreshold int           `mapstructure:"unhealthy_threshold"` // 判定为不健康的连续失败次数
+}
+
+// LBConfig 负载均衡配置
+// 按模型覆盖的策略在 models.yaml 中通过模型的 lb_strategy 配置
+type LBConfig struct {
+	Strategy string `mapstructure:"strategy"` // 全局默认策略: weighted_random, least_inflight, ewma_latency, consistent_hash
+}
+
+// QueueConfig 渠道满载时的等待队列配置
+type QueueConfig struct {
+	Enabled      bool          `mapstructure:"enabled"`
+	MaxSize      int           `mapstructure:"max_size"`      // 每个模型队列的最大长度
+	Timeout      time.Duration `mapstructure:"timeout"`       // 最长等待时间
+	PollInterval time.Duration `mapstructure:"poll_interval"` // 检查空闲并发位的间隔
+}
+
+// RateLimitConfig 上游限流感知配置
+type RateLimitConfig struct {
+	Enabled         bool          `mapstructure:"enabled"`
+	LowRatio        float64       `mapstructure:"low_ratio"`        // 剩余配额占比低于该值时渠道排到同优先级最后
+	DefaultCooldown time.Duration `mapstructure:"default_cooldown"` // 上游未给出重置时间时的冷却时间
+	MaxCooldown     time.Duration `mapstructure:"max_cooldown"`     // 冷却时间上限
+}
+
 // Load 加载配置
 func Load() (*Config, error) {
 	viper.SetConfigName("config")
@@ -53,6 +145,40 @@ func Load() (*Config, error) {
 	// 读取配置文件（可选）
 	_ = viper.ReadInConfig()
 
+	// 默认值
+	viper.SetDefault("channel_keys.rejection_threshold", 3)
+	viper.SetDefault("pool.lease_ttl", "10m")
+	viper.SetDefault("pool.reap_interval", "30s")
+	viper.SetDefault("pool.adaptive.enabled", false)
+	viper.SetDefault("pool.adaptive.floor", 4)
+	viper.SetDefault("pool.adaptive.increase", 1)
+	viper.SetDefault("pool.adaptive.decrease_factor", 0.5)
+	viper.SetDefault("pool.adaptive.latency_threshold", "30s")
+	viper.SetDefault("channel_cache.refresh_interval", "60s")
+	viper.SetDefault("retry.max_attempts", 3)
+	viper.SetDefault("retry.retry_status_codes", []int{429, 500, 502, 503, 504})
+	viper.SetDefault("retry.retry_on_timeout", true)
+	viper.SetDefault("retry.retry_on_connection_error", true)
+	viper.SetDefault("retry.initial_backoff", "200ms")
+	viper.SetDefault("retry.max_backoff", "2s")
+	viper.SetDefault("circuit_breaker.failure_threshold", 5)
+	viper.SetDefault("circuit_breaker.cooldown", "30s")
+	viper.SetDefault("circuit_breaker.half_open_probes", 1)
+	viper.SetDefault("load_balancing.strategy", "weighted_random")
+	viper.SetDefault("queue.enabled", false)
+	viper.SetDefault("queue.max_size", 1000)
+	viper.SetDefault("queue.timeout", "30s")
+	viper.SetDefault("queue.poll_interval", "100ms")
+	viper.SetDefault("rate_limit.enabled", true)
+	viper.SetDefault("rate_limit.low_ratio", 0.1)
+	viper.SetDefault("rate_limit.default_cooldown", "5s")
+	viper.SetDefault("rate_limit.max_cooldown", "60s")
+	viper.SetDefault("health_check.enabled", false)
+	viper.SetDefault("health_check.interval", "60s")
+	viper.SetDefault("health_check.timeout", "15s")
+	viper.SetDefault("health_check.prompt", "ping")
+	viper.SetDefault("health_check.unhealthy_threshold", 3)
+
 	// 绑定环境变量
 	viper.AutomaticEnv()
 	viper.BindEnv("server.port", "SERVER_PORT")
@@ -65,6 +191,10 @@ func Load() (*Config, error) {
 	viper.BindEnv("redis.addr", "REDIS_ADDR")
 	viper.BindEnv("redis.password", "REDIS_PASSWORD")
 	viper.BindEnv("admin.token", "ADMIN_TOKEN")
+	viper.BindEnv("security.master_key", "MASTER_KEY")
+	viper.BindEnv("security.previous_master_keys", "PREVIOUS_MASTER_KEYS")
+	viper.BindEnv("retry.max_attempts", "RETRY_MAX_ATTEMPTS")
+	viper.BindEnv("health_check.enabled", "HEALTH_CHECK_ENABLED")
 
 	var cfg Config
 	if err := viper.Unmarshal(&cfg); err != nil {
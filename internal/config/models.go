@@ -4,17 +4,35 @@ package config
 type ModelConfig struct {
 	Name                   string  `mapstructure:"name"`
 	UpstreamName           string  `mapstructure:"upstream_name"`
-	Type                   string  `mapstructure:"type"` // sync, async
-	PricePer1KInputTokens  float64 `mapstructure:"price_per_1k_input_tokens"`
+	Type                   string  `mapstructure:"type"`                      // sync, async
+	PricePer1KInputTokens  float64 `mapstructure:"price_per_1k_input_tokens"` // 文本与向量模型按输入 Token 计费
 	PricePer1KOutputTokens float64 `mapstructure:"price_per_1k_output_tokens"`
 	PricePerGeneration     float64 `mapstructure:"price_per_generation"`
+	PricePerInputImage     float64 `mapstructure:"price_per_input_image"` // 多模态输入中每张图片的附加费用
+	Description            string  `mapstructure:"description"`
+	LBStrategy             string  `mapstructure:"lb_strategy"` // 负载均衡策略,为空时使用全局默认策略
+}
+
+// 模型分类
+const (
+	CategoryText      = "text"
+	CategoryImage     = "image"
+	CategoryVideo     = "video"
+	CategoryEmbedding = "embedding"
+)
+
+// ModelEntry 带分类的模型配置
+type ModelEntry struct {
+	Category string
+	*ModelConfig
 }
 
 // ModelsConfig 模型配置集合
 type ModelsConfig struct {
-	Text  []ModelConfig `mapstructure:"text"`
-	Image []ModelConfig `mapstructure:"image"`
-	Video []ModelConfig `mapstructure:"video"`
+	Text      []ModelConfig `mapstructure:"text"`
+	Image     []ModelConfig `mapstructure:"image"`
+	Video     []ModelConfig `mapstructure:"video"`
+	Embedding []ModelConfig `mapstructure:"embedding"`
 }
 
 // AllModels 所有模型配置
@@ -22,7 +40,37 @@ type AllModels struct {
 	Models ModelsConfig `mapstructure:"models"`
 }
 
-// GetModelByName 根据名称获取模型配置
+// List 按 text、image、video、embedding 的顺序返回全部模型配置
+func (m *ModelsConfig) List() []ModelEntry {
+	var entries []ModelEntry
+	for _, group := range []struct {
+		category string
+		models   []ModelConfig
+	}{
+		{CategoryText, m.Text},
+		{CategoryImage, m.Image},
+		{CategoryVideo, m.Video},
+		{CategoryEmbedding, m.Embedding},
+	} {
+		for i := range group.models {
+			entries = append(entries, ModelEntry{Category: group.category, ModelConfig: &group.models[i]})
+		}
+	}
+	return entries
+}
+
+// LBStrategies 返回配置了负载均衡策略的模型名到策略名的映射
+func (m *ModelsConfig) LBStrategies() map[string]string {
+	strategies := make(map[string]string)
+	for _, entry := range m.List() {
+		if entry.LBStrategy != "" {
+			strategies[entry.Name] = entry.LBStrategy
+		}
+	}
+	return strategies
+}
+
+// GetModelByName 根据名称获取文本、图片或视频模型配置,向量模型只能通过 GetEmbeddingModel 获取
 func (m *ModelsConfig) GetModelByName(name string) *ModelConfig {
 	// 在文本模型中查找
 	for i := range m.Text {
@@ -44,3 +92,13 @@ func (m *ModelsConfig) GetModelByName(name string) *ModelConfig {
 	}
 	return nil
 }
+
+// GetEmbeddingModel 根据名称获取向量模型配置,非向量模型返回 nil
+func (m *ModelsConfig) GetEmbeddingModel(name string) *ModelConfig {
+	for i := range m.Embedding {
+		if m.Embedding[i].Name == name {
+			return &m.Embedding[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package config
+
+import "testing"
+
+func TestGetModelByNameExcludesEmbeddings(t *testing.T) {
+	m := &ModelsConfig{
+		Text:      []ModelConfig{{Name: "gpt-4o"}},
+		Video:     []ModelConfig{{Name: "veo3.1-fast"}},
+		Embedding: []ModelConfig{{Name: "text-embedding-3-small"}},
+	}
+
+	if cfg := m.GetModelByName("veo3.1-fast"); cfg == nil || cfg.Name != "veo3.1-fast" {
+		t.Fatalf("GetModelByName(veo3.1-fast) = %+v", cfg)
+	}
+	// 向量模型不能用于对话、图片与视频接口
+	if cfg := m.GetModelByName("text-embedding-3-small"); cfg != nil {
+		t.Fatalf("GetModelByName(text-embedding-3-small) = %+v, want nil", cfg)
+	}
+	if cfg := m.GetEmbeddingModel("text-embedding-3-small"); cfg == nil {
+		t.Fatal("GetEmbeddingModel(text-embedding-3-small) = nil")
+	}
+	if cfg := m.GetEmbeddingModel("gpt-4o"); cfg != nil {
+		t.Fatalf("GetEmbeddingModel(gpt-4o) = %+v, want nil", cfg)
+	}
+}
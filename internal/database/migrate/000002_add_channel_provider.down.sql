@@ -0,0 +1,3 @@
+-- 回滚渠道供应商类型
+
+ALTER TABLE channels DROP COLUMN IF EXISTS provider;
@@ -0,0 +1,3 @@
+-- 渠道增加上游供应商类型,历史渠道默认使用 APIMart 适配器
+
+ALTER TABLE channels ADD COLUMN IF NOT EXISTS provider VARCHAR(32) NOT NULL DEFAULT 'apimart';
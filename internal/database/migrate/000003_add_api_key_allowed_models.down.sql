@@ -0,0 +1,3 @@
+-- 回滚用户 API Key 可用模型白名单
+
+ALTER TABLE user_api_keys DROP COLUMN IF EXISTS allowed_models;
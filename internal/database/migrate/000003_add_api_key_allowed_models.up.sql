@@ -0,0 +1,3 @@
+-- 用户 API Key 增加可用模型白名单,为空表示可使用全部模型
+
+ALTER TABLE user_api_keys ADD COLUMN IF NOT EXISTS allowed_models TEXT[] NOT NULL DEFAULT '{}';
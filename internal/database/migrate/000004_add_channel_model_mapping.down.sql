@@ -0,0 +1,3 @@
+-- 回滚渠道模型名映射
+
+ALTER TABLE channels DROP COLUMN IF EXISTS model_mapping;
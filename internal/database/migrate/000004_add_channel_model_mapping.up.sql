@@ -0,0 +1,3 @@
+-- 渠道增加模型名映射,键为对外模型名,值为该渠道上游使用的模型名
+
+ALTER TABLE channels ADD COLUMN IF NOT EXISTS model_mapping JSONB NOT NULL DEFAULT '{}';
@@ -0,0 +1,3 @@
+-- 回滚渠道可服务的模型列表
+
+ALTER TABLE channels DROP COLUMN IF EXISTS models;
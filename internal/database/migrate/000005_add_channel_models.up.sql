@@ -0,0 +1,3 @@
+-- 渠道增加可服务的模型列表,支持通配符(如 gemini-*),为空表示可服务全部模型
+
+ALTER TABLE channels ADD COLUMN IF NOT EXISTS models TEXT[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,3 @@
+-- 回滚渠道优先级
+
+ALTER TABLE channels DROP COLUMN IF EXISTS priority;
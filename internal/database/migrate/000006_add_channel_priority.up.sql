@@ -0,0 +1,3 @@
+-- 渠道增加优先级,数值越大越优先;同一优先级内按负载均衡策略选择,高优先级全部不可用时才降级到下一级
+
+ALTER TABLE channels ADD COLUMN IF NOT EXISTS priority INTEGER NOT NULL DEFAULT 0;
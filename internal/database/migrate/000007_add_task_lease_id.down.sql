@@ -0,0 +1,3 @@
+-- 回滚任务并发位租约 ID
+
+ALTER TABLE tasks DROP COLUMN IF EXISTS lease_id;
@@ -0,0 +1,3 @@
+-- 任务记录占用的渠道并发位租约 ID,任务结束时据此释放,轮询期间据此续约
+
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS lease_id VARCHAR(36) NOT NULL DEFAULT '';
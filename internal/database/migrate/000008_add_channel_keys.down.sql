@@ -0,0 +1,23 @@
+-- 回滚渠道多密钥,每个渠道保留最早添加的可用密钥
+-- 旧版本只能读取明文密钥,回滚前需把 security.master_key 移入 previous_master_keys 并重启一次,
+-- 启动时密钥被还原为明文;仍有密文时回滚失败,避免把密文写入旧版本的 secret_key
+
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM channel_keys WHERE secret_key LIKE 'enc:v1:%') THEN
+        RAISE EXCEPTION 'channel_keys contains encrypted secrets, store them as plaintext before rolling back';
+    END IF;
+END $$;
+
+ALTER TABLE channels ADD COLUMN IF NOT EXISTS secret_key TEXT NOT NULL DEFAULT '';
+
+UPDATE channels c SET secret_key = k.secret_key
+FROM (
+    SELECT DISTINCT ON (channel_id) channel_id, secret_key
+    FROM channel_keys
+    ORDER BY channel_id, is_active DESC, created_at
+) k
+WHERE c.id = k.channel_id;
+
+ALTER TABLE channels DROP COLUMN IF EXISTS key_strategy;
+DROP TABLE IF EXISTS channel_keys;
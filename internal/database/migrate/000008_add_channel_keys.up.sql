@@ -0,0 +1,20 @@
+-- 渠道支持多个上游密钥,按轮询或最少使用选择;返回 401/403 的密钥自动停用,其余密钥继续服务
+
+CREATE TABLE IF NOT EXISTS channel_keys (
+    id VARCHAR(36) PRIMARY KEY,
+    channel_id VARCHAR(36) NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+    secret_key TEXT NOT NULL,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    disabled_reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_channel_keys_channel_id ON channel_keys(channel_id);
+
+-- 迁移已有渠道的单个密钥
+INSERT INTO channel_keys (id, channel_id, secret_key, created_at, updated_at)
+SELECT gen_random_uuid()::text, id, secret_key, created_at, updated_at FROM channels WHERE secret_key <> '';
+
+ALTER TABLE channels DROP COLUMN IF EXISTS secret_key;
+ALTER TABLE channels ADD COLUMN IF NOT EXISTS key_strategy VARCHAR(20) NOT NULL DEFAULT 'round_robin';
@@ -1,7 +1,10 @@
 package handlers
 
 import (
+	"errors"
+	"io"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/869413421/transit/internal/config"
@@ -9,8 +12,11 @@ import (
 	"github.com/869413421/transit/internal/repository"
 	"github.com/869413421/transit/internal/services"
 	"github.com/869413421/transit/pkg/billing"
+	"github.com/869413421/transit/pkg/loadbalancer"
 	"github.com/869413421/transit/pkg/logger"
 	"github.com/869413421/transit/pkg/pool"
+	"github.com/869413421/transit/pkg/prober"
+	"github.com/869413421/transit/pkg/upstream"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
@@ -23,6 +29,11 @@ type AdminHandler struct {
 	userRepo       repository.UserRepository
 	billing        *billing.Service
 	pool           *pool.RedisPool
+	breaker        *loadbalancer.CircuitBreaker
+	health         *loadbalancer.HealthTracker
+	queue          *loadbalancer.WaitQueue        // 未启用等待队列时为 nil
+	rateLimits     *loadbalancer.RateLimitTracker // 未启用上游限流感知时为 nil
+	prober         *prober.Prober
 }
 
 // NewAdminHandler 创建管理处理器
@@ -32,6 +43,11 @@ func NewAdminHandler(
 	userRepo repository.UserRepository,
 	billing *billing.Service,
 	pool *pool.RedisPool,
+	breaker *loadbalancer.CircuitBreaker,
+	health *loadbalancer.HealthTracker,
+	queue *loadbalancer.WaitQueue,
+	rateLimits *loadbalancer.RateLimitTracker,
+	prober *prober.Prober,
 ) *AdminHandler {
 	return &AdminHandler{
 		cfg:            cfg,
@@ -39,6 +55,11 @@ func NewAdminHandler(
 		userRepo:       userRepo,
 		billing:        billing,
 		pool:           pool,
+		breaker:        breaker,
+		health:         health,
+		queue:          queue,
+		rateLimits:     rateLimits,
+		prober:         prober,
 	}
 }
 
@@ -62,7 +83,7 @@ func (h *AdminHandler) AdminAuth() gin.HandlerFunc {
 // @Accept json
 // @Produce json
 // @Security AdminToken
-// @Param channel body object{name=string,secret_key=string,base_url=string,max_concurrency=int,weight=int} true "渠道信息"
+// @Param channel body object{name=string,secret_key=string,secret_keys=[]string,key_strategy=string,base_url=string,provider=string,models=[]string,model_mapping=object,max_concurrency=int,weight=int,priority=int} true "渠道信息"
 // @Success 200 {object} object{message=string,channel=models.Channel}
 // @Failure 400 {object} object{error=string}
 // @Failure 401 {object} object{error=string}
@@ -70,11 +91,17 @@ func (h *AdminHandler) AdminAuth() gin.HandlerFunc {
 // @Router /admin/channels [post]
 func (h *AdminHandler) AddChannel(c *gin.Context) {
 	var req struct {
-		Name           string `json:"name" binding:"required"`
-		SecretKey      string `json:"secret_key" binding:"required"`
-		BaseURL        string `json:"base_url"`
-		MaxConcurrency int    `json:"max_concurrency"`
-		Weight         int    `json:"weight"`
+		Name           string            `json:"name" binding:"required"`
+		SecretKey      string            `json:"secret_key"`
+		SecretKeys     []string          `json:"secret_keys"`  // 同一上游账号的多个密钥,与 secret_key 合并
+		KeyStrategy    string            `json:"key_strategy"` // round_robin(默认)或 least_used
+		BaseURL        string            `json:"base_url"`
+		Provider       string            `json:"provider"`
+		Models         []string          `json:"models"`
+		ModelMapping   map[string]string `json:"model_mapping"`
+		MaxConcurrency int               `json:"max_concurrency"`
+		Weight         int               `json:"weight"`
+		Priority       int               `json:"priority"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -82,18 +109,58 @@ func (h *AdminHandler) AddChannel(c *gin.Context) {
 		return
 	}
 
+	if req.Provider == "" {
+		req.Provider = upstream.DefaultProvider
+	}
+	if !upstream.IsProviderRegistered(req.Provider) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Unknown provider: " + req.Provider,
+			"providers": upstream.ProviderTypes(),
+		})
+		return
+	}
+
+	if err := models.ValidateModelPatterns(req.Models); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	secretKeys := req.SecretKeys
+	if req.SecretKey != "" {
+		secretKeys = append([]string{req.SecretKey}, secretKeys...)
+	}
+	if len(secretKeys) == 0 || slices.Contains(secretKeys, "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one non-empty secret key is required"})
+		return
+	}
+
+	if req.KeyStrategy == "" {
+		req.KeyStrategy = loadbalancer.KeyStrategyRoundRobin
+	}
+	if !loadbalancer.IsKeyStrategy(req.KeyStrategy) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown key strategy: " + req.KeyStrategy})
+		return
+	}
+
 	now := time.Now()
 	channel := &models.Channel{
 		ID:             uuid.New().String(),
 		Name:           req.Name,
-		SecretKey:      req.SecretKey,
 		BaseURL:        req.BaseURL,
+		Provider:       req.Provider,
+		Models:         req.Models,
+		ModelMapping:   req.ModelMapping,
 		MaxConcurrency: req.MaxConcurrency,
 		Weight:         req.Weight,
+		Priority:       req.Priority,
+		KeyStrategy:    req.KeyStrategy,
 		IsActive:       true,
 		CreatedAt:      now,
 		UpdatedAt:      now,
 	}
+	for _, secretKey := range secretKeys {
+		channel.Keys = append(channel.Keys, newChannelKey(channel.ID, secretKey, now))
+	}
 
 	if channel.MaxConcurrency == 0 {
 		channel.MaxConcurrency = 200
@@ -156,6 +223,533 @@ func (h *AdminHandler) DeleteChannel(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Channel deleted successfully"})
 }
 
+// UpdateChannelModels 设置渠道可服务的模型
+// @Summary 设置渠道模型
+// @Description 设置渠道可服务的模型名或通配符(如 gemini-*),空列表表示可服务全部模型
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security AdminToken
+// @Param id path string true "渠道 ID"
+// @Param models body object{models=[]string} true "模型列表"
+// @Success 200 {object} object{message=string,channel=models.Channel}
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /admin/channels/{id}/models [put]
+func (h *AdminHandler) UpdateChannelModels(c *gin.Context) {
+	var req struct {
+		Models []string `json:"models"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := models.ValidateModelPatterns(req.Models); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id := c.Param("id")
+	channel, err := h.channelService.Get(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+		return
+	}
+
+	channel.Models = req.Models
+	channel.UpdatedAt = time.Now()
+	if err := h.channelService.Update(c.Request.Context(), channel); err != nil {
+		logger.Error("Failed to update channel", zap.String("id", id), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update channel"})
+		return
+	}
+
+	logger.Info("Channel models updated", zap.String("id", id), zap.Strings("models", req.Models))
+	c.JSON(http.StatusOK, gin.H{"message": "Channel models updated successfully", "channel": channel})
+}
+
+// UpdateChannel 部分更新渠道
+// @Summary 更新渠道
+// @Description 部分更新渠道配置,只修改请求中出现的字段;密钥通过 /admin/channels/{id}/keys 管理
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security AdminToken
+// @Param id path string true "渠道 ID"
+// @Param channel body object{name=string,base_url=string,models=[]string,model_mapping=object,max_concurrency=int,weight=int,priority=int,key_strategy=string,is_active=bool} true "需要更新的字段"
+// @Success 200 {object} object{message=string,channel=models.Channel}
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /admin/channels/{id} [patch]
+func (h *AdminHandler) UpdateChannel(c *gin.Context) {
+	var req struct {
+		Name           *string            `json:"name"`
+		BaseURL        *string            `json:"base_url"`
+		Models         *[]string          `json:"models"`
+		ModelMapping   *map[string]string `json:"model_mapping"`
+		MaxConcurrency *int               `json:"max_concurrency"`
+		Weight         *int               `json:"weight"`
+		Priority       *int               `json:"priority"`
+		KeyStrategy    *string            `json:"key_strategy"`
+		IsActive       *bool              `json:"is_active"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id := c.Param("id")
+	channel, err := h.channelService.Get(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+		return
+	}
+
+	if req.Name != nil {
+		if *req.Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Name must not be empty"})
+			return
+		}
+		channel.Name = *req.Name
+	}
+	if req.BaseURL != nil {
+		channel.BaseURL = *req.BaseURL
+	}
+	if req.Models != nil {
+		if err := models.ValidateModelPatterns(*req.Models); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		channel.Models = *req.Models
+	}
+	if req.ModelMapping != nil {
+		channel.ModelMapping = *req.ModelMapping
+	}
+	if req.MaxConcurrency != nil {
+		if *req.MaxConcurrency <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "max_concurrency must be positive"})
+			return
+		}
+		channel.MaxConcurrency = *req.MaxConcurrency
+	}
+	if req.Weight != nil {
+		if *req.Weight < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "weight must not be negative"})
+			return
+		}
+		channel.Weight = *req.Weight
+	}
+	if req.Priority != nil {
+		channel.Priority = *req.Priority
+	}
+	if req.KeyStrategy != nil {
+		if !loadbalancer.IsKeyStrategy(*req.KeyStrategy) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown key strategy: " + *req.KeyStrategy})
+			return
+		}
+		channel.KeyStrategy = *req.KeyStrategy
+	}
+	if req.IsActive != nil {
+		channel.IsActive = *req.IsActive
+	}
+
+	channel.UpdatedAt = time.Now()
+	if err := h.channelService.Update(c.Request.Context(), channel); err != nil {
+		logger.Error("Failed to update channel", zap.String("id", id), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update channel"})
+		return
+	}
+
+	logger.Info("Channel updated", zap.String("id", id))
+	c.JSON(http.StatusOK, gin.H{"message": "Channel updated successfully", "channel": channel})
+}
+
+// EnableChannel 启用渠道
+// @Summary 启用渠道
+// @Description 启用渠道,使其重新参与负载均衡
+// @Tags Admin
+// @Produce json
+// @Security AdminToken
+// @Param id path string true "渠道 ID"
+// @Success 200 {object} object{message=string,channel=models.Channel}
+// @Failure 401 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /admin/channels/{id}/enable [post]
+func (h *AdminHandler) EnableChannel(c *gin.Context) {
+	h.setChannelActive(c, true)
+}
+
+// DisableChannel 停用渠道
+// @Summary 停用渠道
+// @Description 停用渠道,停止为其分配新请求;已在进行的请求与异步任务不受影响
+// @Tags Admin
+// @Produce json
+// @Security AdminToken
+// @Param id path string true "渠道 ID"
+// @Success 200 {object} object{message=string,channel=models.Channel}
+// @Failure 401 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /admin/channels/{id}/disable [post]
+func (h *AdminHandler) DisableChannel(c *gin.Context) {
+	h.setChannelActive(c, false)
+}
+
+// setChannelActive 设置渠道的启用状态
+func (h *AdminHandler) setChannelActive(c *gin.Context, active bool) {
+	id := c.Param("id")
+	channel, err := h.channelService.Get(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+		return
+	}
+
+	channel.IsActive = active
+	channel.UpdatedAt = time.Now()
+	if err := h.channelService.Update(c.Request.Context(), channel); err != nil {
+		logger.Error("Failed to update channel", zap.String("id", id), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update channel"})
+		return
+	}
+
+	message := "Channel disabled successfully"
+	if active {
+		message = "Channel enabled successfully"
+	}
+	logger.Info("Channel active state changed", zap.String("id", id), zap.Bool("active", active))
+	c.JSON(http.StatusOK, gin.H{"message": message, "channel": channel})
+}
+
+// TestChannel 测试渠道
+// @Summary 测试渠道
+// @Description 通过渠道适配器发送一次 max_tokens=1 的实时文本对话请求,返回耗时与错误;不占用并发位、不计费、不影响健康状态
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security AdminToken
+// @Param id path string true "渠道 ID"
+// @Param request body object{model=string} false "测试模型,为空时使用健康探测模型或渠道声明的第一个文本模型"
+// @Success 200 {object} object{channel_id=string,result=prober.TestResult}
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Router /admin/channels/{id}/test [post]
+func (h *AdminHandler) TestChannel(c *gin.Context) {
+	var req struct {
+		Model string `json:"model"`
+	}
+	// 请求体可选
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id := c.Param("id")
+	channel, err := h.channelService.Get(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+		return
+	}
+
+	if req.Model != "" && !channel.ServesModel(req.Model) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Channel does not serve model: " + req.Model})
+		return
+	}
+
+	result := h.prober.Test(c.Request.Context(), channel, req.Model)
+	logger.Info("Channel tested",
+		zap.String("id", id),
+		zap.String("model", result.Model),
+		zap.Bool("success", result.Success),
+		zap.Int64("latency_ms", result.LatencyMs),
+	)
+	c.JSON(http.StatusOK, gin.H{"channel_id": id, "result": result})
+}
+
+// ListChannelKeys 列出渠道的上游密钥
+// @Summary 查看渠道密钥
+// @Description 列出渠道的全部上游密钥及其启用状态、停用原因
+// @Tags Admin
+// @Produce json
+// @Security AdminToken
+// @Param id path string true "渠道 ID"
+// @Success 200 {object} object{channel_id=string,key_strategy=string,keys=[]models.ChannelKey}
+// @Failure 401 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Router /admin/channels/{id}/keys [get]
+func (h *AdminHandler) ListChannelKeys(c *gin.Context) {
+	id := c.Param("id")
+	channel, err := h.channelService.Get(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"channel_id":   id,
+		"key_strategy": channel.KeyStrategy,
+		"keys":         channel.Keys,
+	})
+}
+
+// AddChannelKey 为渠道添加上游密钥
+// @Summary 添加渠道密钥
+// @Description 为渠道添加一个上游密钥,不影响渠道的权重、模型与统计
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security AdminToken
+// @Param id path string true "渠道 ID"
+// @Param key body object{secret_key=string} true "密钥"
+// @Success 200 {object} object{message=string,key=models.ChannelKey}
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /admin/channels/{id}/keys [post]
+func (h *AdminHandler) AddChannelKey(c *gin.Context) {
+	var req struct {
+		SecretKey string `json:"secret_key" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id := c.Param("id")
+	if _, err := h.channelService.Get(c.Request.Context(), id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+		return
+	}
+
+	key := newChannelKey(id, req.SecretKey, time.Now())
+	if err := h.channelService.AddKey(c.Request.Context(), &key); err != nil {
+		logger.Error("Failed to add channel key", zap.String("id", id), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add channel key"})
+		return
+	}
+
+	logger.Info("Channel key added", zap.String("id", id), zap.String("key_id", key.ID))
+	c.JSON(http.StatusOK, gin.H{"message": "Channel key added successfully", "key": key})
+}
+
+// RetireChannelKey 移除渠道的上游密钥
+// @Summary 移除渠道密钥
+// @Description 移除渠道的一个上游密钥,渠道至少保留一个可用密钥
+// @Tags Admin
+// @Produce json
+// @Security AdminToken
+// @Param id path string true "渠道 ID"
+// @Param key_id path string true "密钥 ID"
+// @Success 200 {object} object{message=string}
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /admin/channels/{id}/keys/{key_id} [delete]
+func (h *AdminHandler) RetireChannelKey(c *gin.Context) {
+	id := c.Param("id")
+	keyID := c.Param("key_id")
+	channel, err := h.channelService.Get(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+		return
+	}
+
+	key := channel.FindKey(keyID)
+	if key == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Channel key not found"})
+		return
+	}
+	if key.IsActive && len(channel.ActiveKeys()) == 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot retire the last active key of a channel"})
+		return
+	}
+
+	if err := h.channelService.DeleteKey(c.Request.Context(), id, keyID); err != nil {
+		logger.Error("Failed to retire channel key", zap.String("id", id), zap.String("key_id", keyID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retire channel key"})
+		return
+	}
+
+	logger.Info("Channel key retired", zap.String("id", id), zap.String("key_id", keyID))
+	c.JSON(http.StatusOK, gin.H{"message": "Channel key retired successfully"})
+}
+
+// EnableChannelKey 重新启用渠道的上游密钥
+// @Summary 启用渠道密钥
+// @Description 重新启用被停用的渠道密钥并清除停用原因
+// @Tags Admin
+// @Produce json
+// @Security AdminToken
+// @Param id path string true "渠道 ID"
+// @Param key_id path string true "密钥 ID"
+// @Success 200 {object} object{message=string,key=models.ChannelKey}
+// @Failure 401 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /admin/channels/{id}/keys/{key_id}/enable [post]
+func (h *AdminHandler) EnableChannelKey(c *gin.Context) {
+	id := c.Param("id")
+	keyID := c.Param("key_id")
+	channel, err := h.channelService.Get(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+		return
+	}
+
+	key := channel.FindKey(keyID)
+	if key == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Channel key not found"})
+		return
+	}
+
+	key.IsActive = true
+	key.DisabledReason = ""
+	key.UpdatedAt = time.Now()
+	if err := h.channelService.UpdateKey(c.Request.Context(), key); err != nil {
+		logger.Error("Failed to enable channel key", zap.String("id", id), zap.String("key_id", keyID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable channel key"})
+		return
+	}
+
+	logger.Info("Channel key enabled", zap.String("id", id), zap.String("key_id", keyID))
+	c.JSON(http.StatusOK, gin.H{"message": "Channel key enabled successfully", "key": key})
+}
+
+// newChannelKey 创建一个启用状态的渠道密钥
+func newChannelKey(channelID, secretKey string, now time.Time) models.ChannelKey {
+	return models.ChannelKey{
+		ID:        uuid.New().String(),
+		ChannelID: channelID,
+		SecretKey: secretKey,
+		IsActive:  true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// ChannelHealth 渠道健康探测结果
+// @Summary 渠道健康状态
+// @Description 查看各激活渠道最近一次健康探测的状态、耗时与失败原因
+// @Tags Admin
+// @Produce json
+// @Security AdminToken
+// @Success 200 {object} object{channels=[]object}
+// @Failure 401 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /admin/channels/health [get]
+func (h *AdminHandler) ChannelHealth(c *gin.Context) {
+	channels, err := h.channelService.GetAll(c.Request.Context())
+	if err != nil {
+		logger.Error("Failed to fetch channels", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch channels"})
+		return
+	}
+
+	results := make([]map[string]interface{}, 0)
+	for _, ch := range channels {
+		if !ch.IsActive {
+			continue
+		}
+
+		health, err := h.health.Health(c.Request.Context(), ch.ID)
+		if err != nil {
+			logger.Error("Failed to fetch channel health", zap.String("channel_id", ch.ID), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch channel health"})
+			return
+		}
+
+		results = append(results, map[string]interface{}{
+			"id":     ch.ID,
+			"name":   ch.Name,
+			"health": health,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"channels": results})
+}
+
+// ListChannelLeases 查看渠道并发位租约
+// @Summary 查看渠道租约
+// @Description 列出渠道当前的并发位租约及到期时间,已到期但尚未回收的租约标记为 expired
+// @Tags Admin
+// @Produce json
+// @Security AdminToken
+// @Param id path string true "渠道 ID"
+// @Success 200 {object} object{channel_id=string,concurrency=int,max=int,leases=[]pool.Lease}
+// @Failure 401 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /admin/channels/{id}/leases [get]
+func (h *AdminHandler) ListChannelLeases(c *gin.Context) {
+	id := c.Param("id")
+	channel, err := h.channelService.Get(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+		return
+	}
+
+	leases, err := h.pool.Leases(c.Request.Context(), id)
+	if err != nil {
+		logger.Error("Failed to fetch channel leases", zap.String("id", id), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch channel leases"})
+		return
+	}
+
+	var active int
+	for _, lease := range leases {
+		if !lease.Expired {
+			active++
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"channel_id":  id,
+		"concurrency": active,
+		"max":         channel.MaxConcurrency,
+		"leases":      leases,
+	})
+}
+
+// ResetChannelLeases 清空渠道并发位租约
+// @Summary 重置渠道租约
+// @Description 清空渠道的全部并发位租约;仍在运行的异步任务会在下次轮询时重新获取并发位,渠道已满时不再占用
+// @Tags Admin
+// @Produce json
+// @Security AdminToken
+// @Param id path string true "渠道 ID"
+// @Success 200 {object} object{message=string,released=int}
+// @Failure 401 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /admin/channels/{id}/leases [delete]
+func (h *AdminHandler) ResetChannelLeases(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := h.channelService.Get(c.Request.Context(), id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+		return
+	}
+
+	released, err := h.pool.Reset(c.Request.Context(), id)
+	if err != nil {
+		logger.Error("Failed to reset channel leases", zap.String("id", id), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset channel leases"})
+		return
+	}
+
+	logger.Warn("Channel leases reset", zap.String("id", id), zap.Int64("released", released))
+	c.JSON(http.StatusOK, gin.H{"message": "Channel leases reset successfully", "released": released})
+}
+
 // Recharge 用户充值
 // @Summary 用户充值
 // @Description 为指定用户账户充值
@@ -194,11 +788,11 @@ func (h *AdminHandler) Recharge(c *gin.Context) {
 
 // Monitor 系统监控
 // @Summary 系统监控
-// @Description 查看全站实时并发水位和渠道负载状况
+// @Description 查看全站实时并发水位、渠道负载、熔断与健康探测状态,以及各模型等待队列的排队数与等待时间
 // @Tags Admin
 // @Produce json
 // @Security AdminToken
-// @Success 200 {object} object{total_concurrency=int,channels=[]object,status=string}
+// @Success 200 {object} object{total_concurrency=int,channels=[]object,queues=object,status=string}
 // @Failure 401 {object} object{error=string}
 // @Failure 500 {object} object{error=string}
 // @Router /admin/monitor [get]
@@ -210,7 +804,7 @@ func (h *AdminHandler) Monitor(c *gin.Context) {
 		return
 	}
 
-	var totalConcurrency int
+	var totalConcurrency, openChannels, unhealthyChannels int
 	channelStats := make([]map[string]interface{}, 0)
 
 	for _, ch := range channels {
@@ -219,23 +813,69 @@ func (h *AdminHandler) Monitor(c *gin.Context) {
 		}
 		totalConcurrency += ch.CurrentConcurrency
 
+		// 使用率按有效并发上限计算,未启用自适应并发时即 MaxConcurrency
 		usage := float64(0)
-		if ch.MaxConcurrency > 0 {
-			usage = float64(ch.CurrentConcurrency) / float64(ch.MaxConcurrency) * 100
+		if ch.ConcurrencyLimit > 0 {
+			usage = float64(ch.CurrentConcurrency) / float64(ch.ConcurrencyLimit) * 100
 		}
 
-		channelStats = append(channelStats, map[string]interface{}{
+		breaker, err := h.breaker.State(c.Request.Context(), ch.ID)
+		if err != nil {
+			logger.Warn("Failed to fetch circuit breaker state", zap.String("channel_id", ch.ID), zap.Error(err))
+		} else if breaker.State != loadbalancer.BreakerClosed {
+			openChannels++
+		}
+
+		health, err := h.health.Health(c.Request.Context(), ch.ID)
+		if err != nil {
+			logger.Warn("Failed to fetch channel health", zap.String("channel_id", ch.ID), zap.Error(err))
+		} else if health.Status == loadbalancer.HealthUnhealthy {
+			unhealthyChannels++
+		}
+
+		stat := map[string]interface{}{
 			"id":          ch.ID,
 			"name":        ch.Name,
 			"concurrency": ch.CurrentConcurrency,
 			"max":         ch.MaxConcurrency,
+			"limit":       ch.ConcurrencyLimit,
 			"usage":       usage,
-		})
+			"breaker":     breaker,
+			"health":      health,
+		}
+		if h.rateLimits != nil {
+			rateLimit, err := h.rateLimits.State(c.Request.Context(), ch.ID)
+			if err != nil {
+				logger.Warn("Failed to fetch channel rate limit", zap.String("channel_id", ch.ID), zap.Error(err))
+			}
+			stat["rate_limit"] = rateLimit
+		}
+		channelStats = append(channelStats, stat)
+	}
+
+	// 存在熔断、半开或探测不健康的渠道时整体状态降级
+	status := "healthy"
+	if openChannels > 0 || unhealthyChannels > 0 {
+		status = "degraded"
+	}
+
+	// 各模型等待队列的排队数与等待时间
+	queueStats := make(map[string]*loadbalancer.QueueStats)
+	if h.queue != nil {
+		for _, entry := range h.cfg.Models.List() {
+			stats, err := h.queue.Stats(c.Request.Context(), entry.Name)
+			if err != nil {
+				logger.Warn("Failed to fetch wait queue stats", zap.String("model", entry.Name), zap.Error(err))
+				continue
+			}
+			queueStats[entry.Name] = stats
+		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"total_concurrency": totalConcurrency,
 		"channels":          channelStats,
-		"status":            "healthy",
+		"queues":            queueStats,
+		"status":            status,
 	})
 }
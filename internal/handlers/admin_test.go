@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/869413421/transit/internal/config"
+	"github.com/869413421/transit/internal/models"
+	"github.com/869413421/transit/internal/services"
+	"github.com/869413421/transit/pkg/loadbalancer"
+	"github.com/869413421/transit/pkg/prober"
+	"github.com/869413421/transit/pkg/upstream"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// stubChannelService 内存渠道服务,记录更新后的渠道
+type stubChannelService struct {
+	services.ChannelService
+	channels    map[string]*models.Channel
+	updates     int
+	updatedKeys []models.ChannelKey
+	keyRepo     *stubChannelRepo // 密钥轮换器使用的渠道仓储
+}
+
+func (s *stubChannelService) Get(ctx context.Context, id string) (*models.Channel, error) {
+	channel, ok := s.channels[id]
+	if !ok {
+		return nil, errors.New("channel not found")
+	}
+	copied := *channel
+	return &copied, nil
+}
+
+func (s *stubChannelService) Update(ctx context.Context, channel *models.Channel) error {
+	s.channels[channel.ID] = channel
+	s.updates++
+	return nil
+}
+
+func (s *stubChannelService) UpdateKey(ctx context.Context, key *models.ChannelKey) error {
+	s.updatedKeys = append(s.updatedKeys, *key)
+	return nil
+}
+
+// newAdminTestRouter 创建注册渠道管理接口的路由,密钥被拒绝一次即会被停用
+func newAdminTestRouter(t *testing.T, channels ...*models.Channel) (*gin.Engine, *stubChannelService) {
+	t.Helper()
+	service := &stubChannelService{channels: make(map[string]*models.Channel)}
+	for _, ch := range channels {
+		service.channels[ch.ID] = ch
+	}
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	service.keyRepo = &stubChannelRepo{channels: channels}
+	probe := prober.NewProber(nil, nil, loadbalancer.NewKeyRotator(client, service.keyRepo, 1), &config.ModelsConfig{
+		Text: []config.ModelConfig{{Name: "gpt-4o"}},
+	}, config.HealthConfig{Timeout: 5 * time.Second, Prompt: "ping"})
+	h := NewAdminHandler(&config.Config{}, service, nil, nil, nil, nil, nil, nil, nil, probe)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.PATCH("/admin/channels/:id", h.UpdateChannel)
+	router.POST("/admin/channels/:id/enable", h.EnableChannel)
+	router.POST("/admin/channels/:id/disable", h.DisableChannel)
+	router.POST("/admin/channels/:id/test", h.TestChannel)
+	router.POST("/admin/channels/:id/keys/:key_id/enable", h.EnableChannelKey)
+	return router, service
+}
+
+func serveAdmin(router *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return rec
+}
+
+func TestUpdateChannelPartial(t *testing.T) {
+	router, service := newAdminTestRouter(t, &models.Channel{
+		ID: "ch-1", Name: "primary", Weight: 10, MaxConcurrency: 50, Models: []string{"gpt-4o"}, IsActive: true,
+	})
+
+	rec := serveAdmin(router, http.MethodPatch, "/admin/channels/ch-1", `{"weight":0,"priority":2}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body.String())
+	}
+	// 只修改请求中出现的字段,显式的零值同样生效
+	channel := service.channels["ch-1"]
+	if channel.Weight != 0 || channel.Priority != 2 {
+		t.Fatalf("channel = %+v, want weight 0 and priority 2", channel)
+	}
+	if channel.Name != "primary" || channel.MaxConcurrency != 50 || len(channel.Models) != 1 || !channel.IsActive {
+		t.Fatalf("channel = %+v, want other fields unchanged", channel)
+	}
+}
+
+func TestUpdateChannelValidation(t *testing.T) {
+	router, service := newAdminTestRouter(t, &models.Channel{ID: "ch-1", Name: "primary", Weight: 10, MaxConcurrency: 50})
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"empty name", `{"name":""}`},
+		{"zero concurrency", `{"max_concurrency":0}`},
+		{"negative weight", `{"weight":-1}`},
+		{"unknown key strategy", `{"key_strategy":"random"}`},
+		{"bad model pattern", `{"models":["gpt-["]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := serveAdmin(router, http.MethodPatch, "/admin/channels/ch-1", tt.body); rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400", rec.Code)
+			}
+		})
+	}
+	if service.updates != 0 {
+		t.Fatalf("channel updated %d times by invalid requests", service.updates)
+	}
+	if rec := serveAdmin(router, http.MethodPatch, "/admin/channels/missing", `{"weight":1}`); rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown channel status = %d, want 404", rec.Code)
+	}
+}
+
+func TestSetChannelActive(t *testing.T) {
+	router, service := newAdminTestRouter(t, &models.Channel{ID: "ch-1", IsActive: true})
+
+	if rec := serveAdmin(router, http.MethodPost, "/admin/channels/ch-1/disable", ""); rec.Code != http.StatusOK || service.channels["ch-1"].IsActive {
+		t.Fatalf("disable status = %d, active = %v", rec.Code, service.channels["ch-1"].IsActive)
+	}
+	if rec := serveAdmin(router, http.MethodPost, "/admin/channels/ch-1/enable", ""); rec.Code != http.StatusOK || !service.channels["ch-1"].IsActive {
+		t.Fatalf("enable status = %d, active = %v", rec.Code, service.channels["ch-1"].IsActive)
+	}
+	if rec := serveAdmin(router, http.MethodPost, "/admin/channels/missing/enable", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown channel status = %d, want 404", rec.Code)
+	}
+}
+
+func TestTestChannel(t *testing.T) {
+	var status int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			io.WriteString(w, `{"error":{"message":"upstream failure"}}`)
+			return
+		}
+		io.WriteString(w, `{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"p"},"finish_reason":"length"}]}`)
+	}))
+	defer server.Close()
+
+	router, service := newAdminTestRouter(t, &models.Channel{
+		ID:       "ch-1",
+		BaseURL:  server.URL,
+		Provider: upstream.ProviderOpenAI,
+		Models:   []string{"gpt-*", "gpt-4o"},
+		Keys:     []models.ChannelKey{{ID: "k0", SecretKey: "sk-test", IsActive: true}},
+	})
+
+	testChannel := func(body string) prober.TestResult {
+		t.Helper()
+		rec := serveAdmin(router, http.MethodPost, "/admin/channels/ch-1/test", body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", rec.Code, rec.Body.String())
+		}
+		var resp struct {
+			ChannelID string            `json:"channel_id"`
+			Result    prober.TestResult `json:"result"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		return resp.Result
+	}
+
+	// 请求体可省略,使用渠道声明的文本模型
+	status = http.StatusOK
+	if result := testChannel(""); !result.Success || result.Model != "gpt-4o" || result.KeyID != "k0" {
+		t.Fatalf("result = %+v, want success with gpt-4o and k0", result)
+	}
+
+	status = http.StatusServiceUnavailable
+	if result := testChannel(`{"model":"gpt-4o"}`); result.Success || result.StatusCode != http.StatusServiceUnavailable || result.Error == "" {
+		t.Fatalf("result = %+v, want the upstream failure", result)
+	}
+
+	// 手动测试不会停用被上游拒绝的密钥
+	status = http.StatusUnauthorized
+	if result := testChannel(""); result.StatusCode != http.StatusUnauthorized || len(service.keyRepo.updatedKeys) != 0 {
+		t.Fatalf("result = %+v with key updates %+v, want the key left active", result, service.keyRepo.updatedKeys)
+	}
+
+	if rec := serveAdmin(router, http.MethodPost, "/admin/channels/ch-1/test", `{"model":"claude-3"}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("unserved model status = %d, want 400", rec.Code)
+	}
+	if service.updates != 0 {
+		t.Fatal("testing a channel modified it")
+	}
+}
+
+func TestEnableChannelKey(t *testing.T) {
+	router, service := newAdminTestRouter(t, &models.Channel{ID: "ch-1", Keys: []models.ChannelKey{
+		{ID: "k0", ChannelID: "ch-1", IsActive: false, DisabledReason: "upstream returned 401"},
+	}})
+
+	if rec := serveAdmin(router, http.MethodPost, "/admin/channels/ch-1/keys/k0/enable", ""); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body.String())
+	}
+	// 重新启用并清除停用原因
+	if len(service.updatedKeys) != 1 || !service.updatedKeys[0].IsActive || service.updatedKeys[0].DisabledReason != "" {
+		t.Fatalf("UpdateKey() calls = %+v, want k0 enabled", service.updatedKeys)
+	}
+	if rec := serveAdmin(router, http.MethodPost, "/admin/channels/ch-1/keys/missing/enable", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown key status = %d, want 404", rec.Code)
+	}
+}
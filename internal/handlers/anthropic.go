@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/869413421/transit/pkg/logger"
+	"github.com/869413421/transit/pkg/upstream"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Messages Anthropic Messages API 兼容入口
+// @Summary Anthropic 消息
+// @Description 兼容 Anthropic Messages API,转换为内部文本对话请求后转发,stream=true 时以 Anthropic SSE 事件返回
+// @Tags Proxy
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body upstream.AnthropicMessagesRequest true "消息请求"
+// @Success 200 {object} upstream.AnthropicMessagesResponse
+// @Failure 400 {object} upstream.AnthropicErrorResponse
+// @Failure 401 {object} object{error=string}
+// @Failure 500 {object} upstream.AnthropicErrorResponse
+// @Router /v1/messages [post]
+func (h *ProxyHandler) Messages(c *gin.Context) {
+	// 解析请求
+	var req upstream.AnthropicMessagesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		anthropicError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+	chatReq := req.ToChatCompletionRequest()
+
+	// 校验模型与余额并选择渠道
+	route, routeErr := h.routeChat(c, chatReq)
+	if routeErr != nil {
+		anthropicError(c, routeErr.status, routeErr.message)
+		return
+	}
+	defer h.releaseChat(c, route)
+
+	// 流式请求单独处理
+	if chatReq.Stream {
+		h.streamAnthropicMessages(c, route, chatReq)
+		return
+	}
+
+	// 转发请求
+	startTime := time.Now()
+	var resp *upstream.ChatCompletionResponse
+	err := h.withFailover(c, route, func(ctx context.Context) (err error) {
+		resp, err = route.adapter.ChatCompletion(ctx, chatReq)
+		return err
+	})
+	if err != nil {
+		logger.Error("Upstream request failed",
+			zap.String("channel_id", route.channel.ID),
+			zap.Error(err),
+		)
+		anthropicError(c, http.StatusInternalServerError, "Upstream request failed")
+		return
+	}
+
+	// 按实际用量扣费
+	actualCost := h.chargeUsage(c.Request.Context(), route.userID, route.modelCfg, resp.Usage, upstream.CountInputImages(chatReq.Messages))
+
+	logger.Info("Anthropic messages success",
+		zap.String("user_id", route.userID),
+		zap.String("model", chatReq.Model),
+		zap.Int("total_tokens", resp.Usage.TotalTokens),
+		zap.Float64("cost", actualCost),
+		zap.Duration("latency", time.Since(startTime)),
+	)
+
+	c.JSON(http.StatusOK, upstream.NewAnthropicMessagesResponse(resp, req.Model))
+}
+
+// streamAnthropicMessages 将上游流式数据块转换为 Anthropic SSE 事件
+func (h *ProxyHandler) streamAnthropicMessages(c *gin.Context, route *chatRoute, req *upstream.ChatCompletionRequest) {
+	startTime := time.Now()
+	var stream *upstream.ChatCompletionStream
+	err := h.withFailover(c, route, func(ctx context.Context) (err error) {
+		stream, err = route.adapter.ChatCompletionStream(ctx, req)
+		return err
+	})
+	if err != nil {
+		logger.Error("Upstream stream request failed",
+			zap.String("channel_id", route.channel.ID),
+			zap.Error(err),
+		)
+		anthropicError(c, http.StatusInternalServerError, "Upstream request failed")
+		return
+	}
+	defer stream.Close()
+
+	w := newAnthropicStreamWriter(c, req)
+	startSSE(c)
+	result := pumpChatStream(stream, req, func(chunk *upstream.ChatCompletionChunk, raw []byte) error {
+		return w.writeChunk(chunk)
+	})
+	w.finish(result)
+
+	h.finishChatStream(c, route, req, result, startTime)
+}
+
+// anthropicStreamWriter 将 OpenAI 流式数据块重新组织为 Anthropic SSE 事件
+// 事件顺序: message_start, (content_block_start, content_block_delta..., content_block_stop)..., message_delta, message_stop
+// 文本与每个工具调用各占一个内容块,按出现顺序编号
+type anthropicStreamWriter struct {
+	c          *gin.Context
+	req        *upstream.ChatCompletionRequest
+	started    bool
+	blockIndex int // 当前内容块序号
+	blockType  string
+	toolIndex  int // 当前 tool_use 块对应的上游 tool_calls 序号
+}
+
+// newAnthropicStreamWriter 创建 Anthropic SSE 事件写出器
+func newAnthropicStreamWriter(c *gin.Context, req *upstream.ChatCompletionRequest) *anthropicStreamWriter {
+	return &anthropicStreamWriter{c: c, req: req, blockIndex: -1}
+}
+
+// startMessage 写出 message_start,在收到首个数据块时调用,以便沿用上游的消息 ID
+func (w *anthropicStreamWriter) startMessage(id string) error {
+	w.started = true
+	return writeSSEEvent(w.c, "message_start", gin.H{
+		"type": "message_start",
+		"message": upstream.AnthropicMessagesResponse{
+			ID:      upstream.AnthropicMessageID(id),
+			Type:    "message",
+			Role:    "assistant",
+			Model:   w.req.Model,
+			Content: []upstream.AnthropicContentBlock{},
+			Usage: upstream.AnthropicUsage{
+				InputTokens: upstream.EstimatePromptTokens(w.req.Messages),
+			},
+		},
+	})
+}
+
+// stopBlock 关闭当前内容块
+func (w *anthropicStreamWriter) stopBlock() error {
+	if w.blockType == "" {
+		return nil
+	}
+	w.blockType = ""
+	return writeSSEEvent(w.c, "content_block_stop", gin.H{"type": "content_block_stop", "index": w.blockIndex})
+}
+
+// startBlock 关闭当前内容块并开启新的内容块
+func (w *anthropicStreamWriter) startBlock(typ string, block gin.H) error {
+	if err := w.stopBlock(); err != nil {
+		return err
+	}
+	w.blockIndex++
+	w.blockType = typ
+	return writeSSEEvent(w.c, "content_block_start", gin.H{
+		"type":          "content_block_start",
+		"index":         w.blockIndex,
+		"content_block": block,
+	})
+}
+
+// writeDelta 写出当前内容块的增量
+func (w *anthropicStreamWriter) writeDelta(delta gin.H) error {
+	return writeSSEEvent(w.c, "content_block_delta", gin.H{
+		"type":  "content_block_delta",
+		"index": w.blockIndex,
+		"delta": delta,
+	})
+}
+
+// writeChunk 将一个上游数据块转换为 Anthropic 事件
+func (w *anthropicStreamWriter) writeChunk(chunk *upstream.ChatCompletionChunk) error {
+	if !w.started {
+		if err := w.startMessage(chunk.ID); err != nil {
+			return err
+		}
+	}
+
+	for _, choice := range chunk.Choices {
+		if text := choice.Delta.Content.Text(); text != "" {
+			if w.blockType != "text" {
+				if err := w.startBlock("text", gin.H{"type": "text", "text": ""}); err != nil {
+					return err
+				}
+			}
+			if err := w.writeDelta(gin.H{"type": "text_delta", "text": text}); err != nil {
+				return err
+			}
+		}
+
+		// 工具调用: 新的调用开启 tool_use 块,参数片段以 input_json_delta 写出
+		for i, call := range choice.Delta.ToolCalls {
+			index := i
+			if call.Index != nil {
+				index = *call.Index
+			}
+			if w.blockType != "tool_use" || index != w.toolIndex {
+				w.toolIndex = index
+				if err := w.startBlock("tool_use", gin.H{
+					"type":  "tool_use",
+					"id":    call.ID,
+					"name":  call.Function.Name,
+					"input": gin.H{},
+				}); err != nil {
+					return err
+				}
+			}
+			if call.Function.Arguments != "" {
+				if err := w.writeDelta(gin.H{"type": "input_json_delta", "partial_json": call.Function.Arguments}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// finish 流结束后写出收尾事件,流中断且客户端仍在连接时写出 error 事件
+func (w *anthropicStreamWriter) finish(result *chatStreamResult) {
+	if result.err != nil {
+		if w.c.Request.Context().Err() == nil {
+			writeSSEEvent(w.c, "error", upstream.AnthropicErrorResponse{
+				Type:  "error",
+				Error: upstream.AnthropicErrorDetail{Type: "api_error", Message: "Upstream stream interrupted"},
+			})
+		}
+		return
+	}
+
+	if !w.started {
+		w.startMessage("")
+	}
+	w.stopBlock()
+	writeSSEEvent(w.c, "message_delta", gin.H{
+		"type": "message_delta",
+		"delta": gin.H{
+			"stop_reason":   upstream.AnthropicStopReason(result.finishReason),
+			"stop_sequence": nil,
+		},
+		"usage": upstream.AnthropicUsage{
+			InputTokens:  result.usage.PromptTokens,
+			OutputTokens: result.usage.CompletionTokens,
+		},
+	})
+	writeSSEEvent(w.c, "message_stop", gin.H{"type": "message_stop"})
+}
+
+// anthropicError 以 Anthropic 错误格式响应
+func anthropicError(c *gin.Context, status int, message string) {
+	c.JSON(status, upstream.AnthropicErrorResponse{
+		Type: "error",
+		Error: upstream.AnthropicErrorDetail{
+			Type:    anthropicErrorType(status),
+			Message: message,
+		},
+	})
+}
+
+// anthropicErrorType 将 HTTP 状态码映射为 Anthropic 错误类型
+func anthropicErrorType(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "invalid_request_error"
+	case http.StatusUnauthorized:
+		return "authentication_error"
+	case http.StatusPaymentRequired:
+		return "billing_error"
+	case http.StatusForbidden:
+		return "permission_error"
+	case http.StatusNotFound:
+		return "not_found_error"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case http.StatusServiceUnavailable:
+		return "overloaded_error"
+	default:
+		return "api_error"
+	}
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/869413421/transit/pkg/upstream"
+	"github.com/gin-gonic/gin"
+)
+
+// sseEvent 解析后的 SSE 事件
+type sseEvent struct {
+	name string
+	data map[string]interface{}
+}
+
+// runAnthropicStream 将 OpenAI 格式的 SSE 文本转换为 Anthropic 事件并解析输出
+func runAnthropicStream(t *testing.T, body string) []sseEvent {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+
+	req := &upstream.ChatCompletionRequest{
+		Model:    "claude-3",
+		Messages: []upstream.Message{{Role: "user", Content: upstream.NewTextContent("hi")}},
+	}
+	w := newAnthropicStreamWriter(c, req)
+	result := pumpChatStream(newTestStream(body), req, func(chunk *upstream.ChatCompletionChunk, raw []byte) error {
+		return w.writeChunk(chunk)
+	})
+	w.finish(result)
+
+	var events []sseEvent
+	for _, frame := range strings.Split(strings.TrimSpace(rec.Body.String()), "\n\n") {
+		var event sseEvent
+		for _, line := range strings.Split(frame, "\n") {
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				event.name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event.data); err != nil {
+					t.Fatalf("invalid event data %q: %v", line, err)
+				}
+			}
+		}
+		if event.data["type"] != event.name {
+			t.Fatalf("event %q carries type %v", event.name, event.data["type"])
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// eventNames 返回事件类型序列,内容块事件附带序号
+func eventNames(events []sseEvent) []string {
+	names := make([]string, 0, len(events))
+	for _, event := range events {
+		name := event.name
+		if index, ok := event.data["index"].(float64); ok {
+			name += "#" + strconv.Itoa(int(index))
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestAnthropicStreamTextAndToolUse(t *testing.T) {
+	events := runAnthropicStream(t,
+		"data: {\"id\":\"chatcmpl-abc\",\"model\":\"m\",\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"Let me \"}}]}\n\n"+
+			"data: {\"id\":\"chatcmpl-abc\",\"model\":\"m\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"check.\"}}]}\n\n"+
+			"data: {\"id\":\"chatcmpl-abc\",\"model\":\"m\",\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":0,\"id\":\"call_1\",\"type\":\"function\",\"function\":{\"name\":\"get_weather\",\"arguments\":\"\"}}]}}]}\n\n"+
+			"data: {\"id\":\"chatcmpl-abc\",\"model\":\"m\",\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"{\\\"city\\\":\\\"Paris\\\"}\"}}]}}]}\n\n"+
+			"data: {\"id\":\"chatcmpl-abc\",\"model\":\"m\",\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":1,\"id\":\"call_2\",\"type\":\"function\",\"function\":{\"name\":\"get_time\",\"arguments\":\"{}\"}}]}}]}\n\n"+
+			"data: {\"id\":\"chatcmpl-abc\",\"model\":\"m\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"tool_calls\"}],\"usage\":{\"prompt_tokens\":12,\"completion_tokens\":7,\"total_tokens\":19}}\n\n"+
+			"data: [DONE]\n\n",
+	)
+
+	want := []string{
+		"message_start",
+		"content_block_start#0", "content_block_delta#0", "content_block_delta#0", "content_block_stop#0",
+		"content_block_start#1", "content_block_delta#1", "content_block_stop#1",
+		"content_block_start#2", "content_block_delta#2", "content_block_stop#2",
+		"message_delta", "message_stop",
+	}
+	if got := eventNames(events); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("events = %v\nwant     %v", got, want)
+	}
+
+	message := events[0].data["message"].(map[string]interface{})
+	if message["id"] != "msg_abc" || message["model"] != "claude-3" {
+		t.Fatalf("message_start = %v", message)
+	}
+
+	toolStart := events[5].data["content_block"].(map[string]interface{})
+	if toolStart["type"] != "tool_use" || toolStart["id"] != "call_1" || toolStart["name"] != "get_weather" {
+		t.Fatalf("tool_use block = %v", toolStart)
+	}
+	delta := events[6].data["delta"].(map[string]interface{})
+	if delta["type"] != "input_json_delta" || delta["partial_json"] != `{"city":"Paris"}` {
+		t.Fatalf("input_json_delta = %v", delta)
+	}
+
+	messageDelta := events[11].data
+	if stop := messageDelta["delta"].(map[string]interface{})["stop_reason"]; stop != "tool_use" {
+		t.Fatalf("stop_reason = %v, want tool_use", stop)
+	}
+	usage := messageDelta["usage"].(map[string]interface{})
+	if usage["input_tokens"] != float64(12) || usage["output_tokens"] != float64(7) {
+		t.Fatalf("usage = %v", usage)
+	}
+}
+
+func TestAnthropicStreamEmpty(t *testing.T) {
+	events := runAnthropicStream(t, "data: [DONE]\n\n")
+
+	want := "message_start,message_delta,message_stop"
+	if got := strings.Join(eventNames(events), ","); got != want {
+		t.Fatalf("events = %s, want %s", got, want)
+	}
+	if stop := events[1].data["delta"].(map[string]interface{})["stop_reason"]; stop != "end_turn" {
+		t.Fatalf("stop_reason = %v, want end_turn", stop)
+	}
+}
+
+func TestAnthropicStreamInterrupted(t *testing.T) {
+	events := runAnthropicStream(t,
+		"data: {\"id\":\"1\",\"model\":\"m\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"partial\"}}]}\n\n"+
+			"data: {broken\n\n",
+	)
+
+	want := "message_start,content_block_start#0,content_block_delta#0,error"
+	if got := strings.Join(eventNames(events), ","); got != want {
+		t.Fatalf("events = %s, want %s", got, want)
+	}
+}
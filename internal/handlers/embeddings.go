@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/869413421/transit/pkg/logger"
+	"github.com/869413421/transit/pkg/upstream"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Embeddings 文本向量化
+// @Summary 文本向量化
+// @Description 向量化API,兼容OpenAI格式,按输入 Token 数计费
+// @Tags Proxy
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body upstream.EmbeddingRequest true "向量化请求"
+// @Success 200 {object} upstream.EmbeddingResponse
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 402 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /api/v1/embeddings [post]
+func (h *ProxyHandler) Embeddings(c *gin.Context) {
+	// 解析请求
+	var req upstream.EmbeddingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+	if req.Input.Len() == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: input is required"})
+		return
+	}
+
+	// 仅允许向量模型
+	modelCfg := h.cfg.Models.GetEmbeddingModel(req.Model)
+	if modelCfg == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported embedding model: " + req.Model})
+		return
+	}
+	if !modelAllowed(c, req.Model) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Model not allowed for this API key: " + req.Model})
+		return
+	}
+
+	// 按估算的输入 Token 数检查余额并选择渠道
+	estimatedTokens := req.Input.EstimateTokens()
+	estimatedCost := float64(estimatedTokens) * modelCfg.PricePer1KInputTokens / 1000
+	route, routeErr := h.routeModel(c, modelCfg, estimatedCost)
+	if routeErr != nil {
+		c.JSON(routeErr.status, gin.H{"error": routeErr.message})
+		return
+	}
+	defer h.releaseChat(c, route)
+
+	// 转发请求
+	startTime := time.Now()
+	var resp *upstream.EmbeddingResponse
+	err := h.withFailover(c, route, func(ctx context.Context) (err error) {
+		resp, err = route.adapter.Embeddings(ctx, &req)
+		return err
+	})
+	if err != nil {
+		logger.Error("Upstream request failed",
+			zap.String("channel_id", route.channel.ID),
+			zap.Error(err),
+		)
+		if errors.Is(err, upstream.ErrUnsupportedOperation) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Operation not supported by upstream: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Upstream request failed"})
+		return
+	}
+
+	// 按实际输入 Token 数扣费,上游未返回用量时使用估算值
+	promptTokens := resp.Usage.PromptTokens
+	if promptTokens == 0 {
+		promptTokens = estimatedTokens
+	}
+	actualCost := h.chargeUsage(c.Request.Context(), route.userID, route.modelCfg, upstream.Usage{
+		PromptTokens: promptTokens,
+		TotalTokens:  promptTokens,
+	}, 0)
+
+	logger.Info("Embeddings success",
+		zap.String("user_id", route.userID),
+		zap.String("model", req.Model),
+		zap.Int("inputs", req.Input.Len()),
+		zap.Int("prompt_tokens", promptTokens),
+		zap.Float64("cost", actualCost),
+		zap.Duration("latency", time.Since(startTime)),
+	)
+
+	c.JSON(http.StatusOK, resp)
+}
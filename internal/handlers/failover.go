@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/869413421/transit/pkg/logger"
+	"github.com/869413421/transit/pkg/upstream"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// withFailover 调用上游,失败且符合重试策略时切换渠道重试
+// 切换时先经 Selector 选出未尝试过的渠道,再释放失败渠道的并发位,route 始终指向当前持有并发位的渠道;
+// 没有可切换的渠道时返回最后一次上游错误。每次调用结果都会上报给熔断器,上游响应中的限流信息上报给限流感知,
+// 被上游以 401/403 拒绝的密钥会被停用;
+// call 需使用传入的 ctx 调用适配器,以便记录限流响应头。call 内只做转发,计费由调用方在成功后进行,保证只计费一次
+func (h *ProxyHandler) withFailover(c *gin.Context, route *chatRoute, call func(ctx context.Context) error) error {
+	ctx := c.Request.Context()
+	tried := []string{route.channel.ID}
+
+	for attempt := 1; ; attempt++ {
+		callCtx, rateLimit := upstream.WithRateLimitCapture(ctx)
+		startTime := time.Now()
+		err := call(callCtx)
+		// 客户端主动断开导致的失败不归因于渠道
+		if ctx.Err() == nil {
+			h.selector.ReportResult(context.WithoutCancel(ctx), route.channel, route.keyID, time.Since(startTime), err)
+		}
+		h.selector.ReportRateLimit(context.WithoutCancel(ctx), route.channel.ID, rateLimit.Last())
+		h.selector.ReportKeyResult(context.WithoutCancel(ctx), route.channel.ID, route.keyID, err)
+		if !h.retry.ShouldRetry(err, attempt) || ctx.Err() != nil {
+			return err
+		}
+
+		logger.Warn("Upstream request failed, failing over",
+			zap.String("channel_id", route.channel.ID),
+			zap.String("model", route.modelCfg.Name),
+			zap.Int("attempt", attempt),
+			zap.Error(err),
+		)
+
+		if !sleepContext(ctx, h.retry.Backoff(attempt)) {
+			return err
+		}
+
+		channel, leaseID, selectErr := h.selector.SelectChannel(ctx, route.modelCfg.Name, route.userID, tried...)
+		if selectErr != nil {
+			logger.Warn("No channel to fail over to", zap.String("model", route.modelCfg.Name), zap.Error(selectErr))
+			return err
+		}
+		adapter, keyID, adapterErr := h.channelAdapter(ctx, channel, route.modelCfg)
+		if adapterErr != nil {
+			h.selector.ReleaseChannel(context.WithoutCancel(ctx), channel.ID, leaseID)
+			logger.Error("Failed to create provider", zap.String("channel_id", channel.ID), zap.Error(adapterErr))
+			return err
+		}
+
+		h.selector.ReleaseChannel(context.WithoutCancel(ctx), route.channel.ID, route.leaseID)
+		route.channel = channel
+		route.leaseID = leaseID
+		route.keyID = keyID
+		route.adapter = adapter
+		tried = append(tried, channel.ID)
+	}
+}
+
+// sleepContext 等待指定时间,上下文取消时提前返回 false
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
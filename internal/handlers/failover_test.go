@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/869413421/transit/internal/config"
+	"github.com/869413421/transit/internal/models"
+	"github.com/869413421/transit/pkg/loadbalancer"
+	"github.com/869413421/transit/pkg/logger"
+	"github.com/869413421/transit/pkg/pool"
+	"github.com/869413421/transit/pkg/upstream"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestMain(m *testing.M) {
+	if err := logger.Init("production"); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// failoverFixture 使用 miniredis 并发池与固定渠道的故障转移测试环境
+type failoverFixture struct {
+	handler *ProxyHandler
+	client  *redis.Client
+	pool    *pool.RedisPool
+	repo    *stubChannelRepo
+	route   *chatRoute
+}
+
+// newFailoverFixture 创建故障转移测试环境,route 初始持有第一个渠道的并发位
+func newFailoverFixture(t *testing.T, maxAttempts int, channels ...*models.Channel) *failoverFixture {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	redisPool := pool.NewRedisPool(client, time.Minute, nil)
+
+	cfg := &config.Config{Retry: config.RetryConfig{
+		MaxAttempts:      maxAttempts,
+		RetryStatusCodes: []int{http.StatusServiceUnavailable},
+	}}
+	breaker := loadbalancer.NewCircuitBreaker(client, 5, time.Minute, 1)
+	health := loadbalancer.NewHealthTracker(client, 3, time.Minute)
+	strategies, err := loadbalancer.NewStrategies(loadbalancer.StrategyWeightedRandom, nil, redisPool)
+	if err != nil {
+		t.Fatalf("NewStrategies: %v", err)
+	}
+	repo := &stubChannelRepo{channels: channels}
+	selector := loadbalancer.NewSelector(repo, redisPool, breaker, health, strategies, nil, nil, loadbalancer.NewKeyRotator(client, repo, 2))
+
+	leaseID, err := redisPool.Acquire(context.Background(), channels[0].ID, channels[0].MaxConcurrency)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	return &failoverFixture{
+		handler: NewProxyHandler(cfg, selector, nil, nil),
+		client:  client,
+		pool:    redisPool,
+		repo:    repo,
+		route: &chatRoute{
+			modelCfg: &config.ModelConfig{Name: "gpt-4o"},
+			channel:  channels[0],
+			leaseID:  leaseID,
+			keyID:    channels[0].Keys[0].ID,
+		},
+	}
+}
+
+// concurrency 返回渠道当前占用的并发位
+func (f *failoverFixture) concurrency(t *testing.T, channelID string) int {
+	t.Helper()
+	n, err := f.pool.GetConcurrency(context.Background(), channelID)
+	if err != nil {
+		t.Fatalf("GetConcurrency: %v", err)
+	}
+	return n
+}
+
+// run 以 errs 依次作为每次上游调用的结果执行 withFailover,返回各次调用所用的渠道与结果
+func (f *failoverFixture) run(errs ...error) ([]string, error) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+
+	var used []string
+	err := f.handler.withFailover(c, f.route, func(ctx context.Context) error {
+		used = append(used, f.route.channel.ID)
+		err := errs[0]
+		errs = errs[1:]
+		return err
+	})
+	return used, err
+}
+
+func newFailoverChannel(id string) *models.Channel {
+	return &models.Channel{ID: id, IsActive: true, Weight: 1, MaxConcurrency: 10, Keys: []models.ChannelKey{
+		{ID: id + "-key", ChannelID: id, SecretKey: "sk-" + id, IsActive: true},
+	}}
+}
+
+func TestWithFailoverSwitchesChannel(t *testing.T) {
+	f := newFailoverFixture(t, 3, newFailoverChannel("ch-a"), newFailoverChannel("ch-b"))
+
+	used, err := f.run(&upstream.APIError{StatusCode: http.StatusServiceUnavailable}, nil)
+	if err != nil {
+		t.Fatalf("withFailover() = %v, want nil after failover", err)
+	}
+	if len(used) != 2 || used[0] != "ch-a" || used[1] != "ch-b" {
+		t.Fatalf("channels used = %v, want [ch-a ch-b]", used)
+	}
+	// route 指向新渠道,失败渠道的并发位已释放
+	if f.route.channel.ID != "ch-b" || f.route.adapter == nil {
+		t.Fatalf("route = %+v, want switched to ch-b", f.route)
+	}
+	if a, b := f.concurrency(t, "ch-a"), f.concurrency(t, "ch-b"); a != 0 || b != 1 {
+		t.Fatalf("concurrency = %d/%d, want 0/1", a, b)
+	}
+}
+
+func TestWithFailoverExcludesTriedChannels(t *testing.T) {
+	f := newFailoverFixture(t, 5, newFailoverChannel("ch-a"), newFailoverChannel("ch-b"))
+
+	unavailable := &upstream.APIError{StatusCode: http.StatusServiceUnavailable}
+	used, err := f.run(unavailable, unavailable, nil)
+	// 两个渠道都失败后没有可切换的渠道,返回最后一次上游错误,不再重试已失败的渠道
+	if !errors.Is(err, unavailable) {
+		t.Fatalf("withFailover() = %v, want the last upstream error", err)
+	}
+	if len(used) != 2 || used[0] == used[1] {
+		t.Fatalf("channels used = %v, want each channel once", used)
+	}
+	// 只有 route 当前指向的渠道仍持有并发位,由调用方释放
+	if a, b := f.concurrency(t, "ch-a"), f.concurrency(t, "ch-b"); a != 0 || b != 1 || f.route.channel.ID != "ch-b" {
+		t.Fatalf("concurrency = %d/%d on route %s, want only ch-b held", a, b, f.route.channel.ID)
+	}
+}
+
+func TestWithFailoverNonRetriable(t *testing.T) {
+	f := newFailoverFixture(t, 3, newFailoverChannel("ch-a"), newFailoverChannel("ch-b"))
+
+	badRequest := &upstream.APIError{StatusCode: http.StatusBadRequest}
+	used, err := f.run(badRequest)
+	if !errors.Is(err, badRequest) || len(used) != 1 {
+		t.Fatalf("withFailover() = %v after %v, want the error without retry", err, used)
+	}
+	if f.route.channel.ID != "ch-a" || f.concurrency(t, "ch-a") != 1 {
+		t.Fatal("non-retriable error switched channels or released the slot")
+	}
+}
+
+func TestWithFailoverDisablesRejectedKey(t *testing.T) {
+	f := newFailoverFixture(t, 1, newFailoverChannel("ch-a"))
+
+	// 连续被拒绝达到阈值后才停用密钥
+	unauthorized := &upstream.APIError{StatusCode: http.StatusUnauthorized}
+	if _, err := f.run(unauthorized); !errors.Is(err, unauthorized) || len(f.repo.updatedKeys) != 0 {
+		t.Fatalf("withFailover() = %v with %d key updates, want the error below threshold", err, len(f.repo.updatedKeys))
+	}
+	if _, err := f.run(unauthorized); !errors.Is(err, unauthorized) {
+		t.Fatalf("withFailover() = %v, want the upstream error", err)
+	}
+	// 被拒绝的密钥停用并记录原因
+	updated := f.repo.updatedKeys
+	if len(updated) != 1 || updated[0].ID != "ch-a-key" || updated[0].IsActive || updated[0].DisabledReason == "" {
+		t.Fatalf("UpdateKey() calls = %+v, want ch-a-key disabled", updated)
+	}
+}
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/869413421/transit/pkg/logger"
+	"github.com/869413421/transit/pkg/upstream"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// GenerateContent Gemini generateContent / streamGenerateContent 兼容入口
+// @Summary Gemini 内容生成
+// @Description 兼容 Gemini API,路径形如 /v1beta/models/{model}:generateContent 或 :streamGenerateContent(alt=sse 时以 SSE 返回,否则以 JSON 数组流式返回)
+// @Tags Proxy
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param action path string true "模型与方法,如 gemini-3-flash-preview:generateContent"
+// @Param request body upstream.GeminiGenerateContentRequest true "内容生成请求"
+// @Success 200 {object} upstream.GeminiGenerateContentResponse
+// @Failure 400 {object} upstream.GeminiErrorResponse
+// @Failure 401 {object} object{error=string}
+// @Failure 500 {object} upstream.GeminiErrorResponse
+// @Router /v1beta/models/{action} [post]
+func (h *ProxyHandler) GenerateContent(c *gin.Context) {
+	// 解析路径中的模型与方法
+	action := c.Param("action")
+	sep := strings.LastIndex(action, ":")
+	if sep <= 0 {
+		geminiError(c, http.StatusNotFound, "Unknown action: "+action)
+		return
+	}
+	model, method := action[:sep], action[sep+1:]
+
+	var stream bool
+	switch method {
+	case "generateContent":
+	case "streamGenerateContent":
+		stream = true
+	default:
+		geminiError(c, http.StatusNotFound, "Unsupported method: "+method)
+		return
+	}
+
+	// 解析请求
+	var req upstream.GeminiGenerateContentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		geminiError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+	chatReq := req.ToChatCompletionRequest(model)
+	chatReq.Stream = stream
+
+	// 校验模型与余额并选择渠道
+	route, routeErr := h.routeChat(c, chatReq)
+	if routeErr != nil {
+		geminiError(c, routeErr.status, routeErr.message)
+		return
+	}
+	defer h.releaseChat(c, route)
+
+	// 流式请求单独处理
+	if stream {
+		h.streamGenerateContent(c, route, chatReq, c.Query("alt") == "sse")
+		return
+	}
+
+	// 转发请求
+	startTime := time.Now()
+	var resp *upstream.ChatCompletionResponse
+	err := h.withFailover(c, route, func(ctx context.Context) (err error) {
+		resp, err = route.adapter.ChatCompletion(ctx, chatReq)
+		return err
+	})
+	if err != nil {
+		logger.Error("Upstream request failed",
+			zap.String("channel_id", route.channel.ID),
+			zap.Error(err),
+		)
+		geminiError(c, http.StatusInternalServerError, "Upstream request failed")
+		return
+	}
+
+	// 按实际用量扣费
+	actualCost := h.chargeUsage(c.Request.Context(), route.userID, route.modelCfg, resp.Usage, upstream.CountInputImages(chatReq.Messages))
+
+	logger.Info("Gemini generate content success",
+		zap.String("user_id", route.userID),
+		zap.String("model", model),
+		zap.Int("total_tokens", resp.Usage.TotalTokens),
+		zap.Float64("cost", actualCost),
+		zap.Duration("latency", time.Since(startTime)),
+	)
+
+	c.JSON(http.StatusOK, upstream.NewGeminiGenerateContentResponse(resp, model))
+}
+
+// streamGenerateContent 将上游流式数据块转换为 Gemini 流式响应
+// sse 为 true 时每个数据块作为一个 SSE 事件写出,否则按 Gemini 默认行为逐步写出一个 JSON 数组;
+// 结束块会等待用量汇总后附带 usageMetadata 写出;工具调用增量拼接完整后随结束块以 functionCall 写出
+func (h *ProxyHandler) streamGenerateContent(c *gin.Context, route *chatRoute, req *upstream.ChatCompletionRequest, sse bool) {
+	startTime := time.Now()
+	var stream *upstream.ChatCompletionStream
+	err := h.withFailover(c, route, func(ctx context.Context) (err error) {
+		stream, err = route.adapter.ChatCompletionStream(ctx, req)
+		return err
+	})
+	if err != nil {
+		logger.Error("Upstream stream request failed",
+			zap.String("channel_id", route.channel.ID),
+			zap.Error(err),
+		)
+		geminiError(c, http.StatusInternalServerError, "Upstream request failed")
+		return
+	}
+	defer stream.Close()
+
+	if sse {
+		startSSE(c)
+	} else {
+		c.Header("Content-Type", "application/json")
+		c.Status(http.StatusOK)
+	}
+
+	written := 0
+	write := func(payload interface{}) error {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		if sse {
+			written++
+			return writeSSEData(c, data)
+		}
+
+		prefix := ",\r\n"
+		if written == 0 {
+			prefix = "["
+		}
+		written++
+		if _, err := fmt.Fprintf(c.Writer, "%s%s", prefix, data); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	}
+
+	var (
+		final     *upstream.GeminiGenerateContentResponse
+		toolCalls upstream.ToolCallAccumulator
+	)
+	result := pumpChatStream(stream, req, func(chunk *upstream.ChatCompletionChunk, raw []byte) error {
+		for _, choice := range chunk.Choices {
+			toolCalls.Add(choice.Delta.ToolCalls)
+		}
+		out := upstream.NewGeminiStreamChunk(chunk, req.Model)
+		if out == nil {
+			return nil
+		}
+		for _, candidate := range out.Candidates {
+			if candidate.FinishReason != "" {
+				final = out
+				return nil
+			}
+		}
+		return write(out)
+	})
+
+	if result.err != nil {
+		if c.Request.Context().Err() == nil {
+			write(upstream.GeminiErrorResponse{Error: upstream.GeminiErrorDetail{
+				Code:    http.StatusInternalServerError,
+				Message: "Upstream stream interrupted",
+				Status:  "INTERNAL",
+			}})
+		}
+	} else {
+		if final == nil {
+			final = &upstream.GeminiGenerateContentResponse{
+				Candidates: []upstream.GeminiCandidate{{
+					Content:      upstream.GeminiContent{Role: "model", Parts: []upstream.GeminiPart{{Text: ""}}},
+					FinishReason: upstream.GeminiFinishReason(result.finishReason),
+				}},
+				ModelVersion: req.Model,
+			}
+			if final.Candidates[0].FinishReason == "" {
+				final.Candidates[0].FinishReason = "STOP"
+			}
+		}
+		if calls := toolCalls.Calls(); len(calls) > 0 {
+			candidate := &final.Candidates[0]
+			parts := upstream.NewGeminiFunctionCallParts(calls)
+			if text := candidate.Content.Text(); text != "" {
+				parts = append([]upstream.GeminiPart{{Text: text}}, parts...)
+			}
+			candidate.Content.Parts = parts
+		}
+		final.UsageMetadata = &upstream.GeminiUsageMetadata{
+			PromptTokenCount:     result.usage.PromptTokens,
+			CandidatesTokenCount: result.usage.CompletionTokens,
+			TotalTokenCount:      result.usage.TotalTokens,
+		}
+		write(final)
+	}
+
+	if !sse {
+		if written == 0 {
+			fmt.Fprint(c.Writer, "[")
+		}
+		fmt.Fprint(c.Writer, "]")
+		c.Writer.Flush()
+	}
+
+	h.finishChatStream(c, route, req, result, startTime)
+}
+
+// geminiError 以 Gemini 错误格式响应
+func geminiError(c *gin.Context, status int, message string) {
+	c.JSON(status, upstream.GeminiErrorResponse{
+		Error: upstream.GeminiErrorDetail{
+			Code:    status,
+			Message: message,
+			Status:  geminiErrorStatus(status),
+		},
+	})
+}
+
+// geminiErrorStatus 将 HTTP 状态码映射为 Google API 错误状态
+func geminiErrorStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "INVALID_ARGUMENT"
+	case http.StatusUnauthorized:
+		return "UNAUTHENTICATED"
+	case http.StatusPaymentRequired:
+		return "FAILED_PRECONDITION"
+	case http.StatusForbidden:
+		return "PERMISSION_DENIED"
+	case http.StatusNotFound:
+		return "NOT_FOUND"
+	case http.StatusTooManyRequests:
+		return "RESOURCE_EXHAUSTED"
+	case http.StatusServiceUnavailable:
+		return "UNAVAILABLE"
+	default:
+		return "INTERNAL"
+	}
+}
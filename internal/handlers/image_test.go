@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/869413421/transit/internal/config"
+	"github.com/869413421/transit/internal/models"
+	"github.com/869413421/transit/internal/services"
+	"github.com/869413421/transit/pkg/billing"
+	"github.com/869413421/transit/pkg/upstream"
+	"github.com/gin-gonic/gin"
+)
+
+// stubTaskService 记录任务入库请求的任务服务,err 不为空时入库失败
+type stubTaskService struct {
+	services.TaskService
+	err        error
+	resultURLs []string
+}
+
+func (s *stubTaskService) CreateTask(ctx context.Context, userID, channelID, leaseID, taskType, modelName, upstreamTaskID string, cost float64) (*models.Task, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &models.Task{ID: "task-1", LeaseID: leaseID, UpstreamTaskID: upstreamTaskID}, nil
+}
+
+func (s *stubTaskService) CreateCompletedTask(ctx context.Context, userID, channelID, modelName, resultURL string, cost float64) (*models.Task, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	s.resultURLs = append(s.resultURLs, resultURL)
+	return &models.Task{ID: "task-1"}, nil
+}
+
+// newImageTestFixture 创建带任务服务与计费服务的测试环境
+// 未指定渠道时使用单个默认渠道
+func newImageTestFixture(t *testing.T, tasks *stubTaskService, channels ...*models.Channel) *failoverFixture {
+	t.Helper()
+	if len(channels) == 0 {
+		channels = []*models.Channel{newFailoverChannel("ch-a")}
+	}
+	f := newFailoverFixture(t, 1, channels...)
+	f.handler.taskService = tasks
+	f.handler.billing = billing.NewService(f.client)
+	return f
+}
+
+// runSyncImage 以同步图片结果调用 completeSyncImage 并返回响应
+func (f *failoverFixture) runSyncImage(t *testing.T, resp *upstream.ImageGenerationResponse) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/images/generations", nil)
+	f.handler.completeSyncImage(c, "user-1", f.route, "dall-e-3", 0.04, resp)
+	return rec
+}
+
+func TestCompleteSyncImageStoresOnlyURLs(t *testing.T) {
+	tasks := &stubTaskService{}
+	f := newImageTestFixture(t, tasks)
+
+	rec := f.runSyncImage(t, &upstream.ImageGenerationResponse{
+		Status: "completed",
+		Images: []upstream.ImageData{{B64JSON: "aGVsbG8="}},
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body.String())
+	}
+	// 仅有 base64 数据时不入库图片地址,响应中也不返回 result_url
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if _, ok := body["result_url"]; ok || body["task_id"] != "task-1" {
+		t.Fatalf("response = %v", body)
+	}
+	if len(tasks.resultURLs) != 1 || tasks.resultURLs[0] != "" {
+		t.Fatalf("stored result URLs = %q, want none", tasks.resultURLs)
+	}
+	if n := f.concurrency(t, "ch-a"); n != 0 {
+		t.Fatalf("concurrency = %d, want the slot released", n)
+	}
+}
+
+func TestCompleteSyncImageTaskFailure(t *testing.T) {
+	f := newImageTestFixture(t, &stubTaskService{err: errors.New("database unavailable")})
+
+	rec := f.runSyncImage(t, &upstream.ImageGenerationResponse{
+		Status: "completed",
+		Images: []upstream.ImageData{{URL: "https://example.com/a.png"}},
+	})
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", rec.Code)
+	}
+	// 任务无法入库时退还预扣的费用,并发位同样释放
+	if balance, err := f.handler.billing.GetBalance(context.Background(), "user-1"); err != nil || balance != 0.04 {
+		t.Fatalf("balance = %v, %v; want the cost refunded", balance, err)
+	}
+	if n := f.concurrency(t, "ch-a"); n != 0 {
+		t.Fatalf("concurrency = %d, want the slot released", n)
+	}
+}
+
+// asyncProvider 异步生成图片与视频的测试适配器
+type asyncProvider struct {
+	upstream.Provider
+}
+
+func (p *asyncProvider) ImageGeneration(ctx context.Context, req *upstream.ImageGenerationRequest) (*upstream.ImageGenerationResponse, error) {
+	return &upstream.ImageGenerationResponse{TaskID: "upstream-1", Status: "pending"}, nil
+}
+
+func (p *asyncProvider) VideoGeneration(ctx context.Context, req *upstream.VideoGenerationRequest) (*upstream.VideoGenerationResponse, error) {
+	return &upstream.VideoGenerationResponse{TaskID: "upstream-1", Status: "pending"}, nil
+}
+
+func init() {
+	upstream.RegisterProvider("test-async", func(baseURL, apiKey string) upstream.Provider {
+		return &asyncProvider{}
+	})
+}
+
+func TestAsyncGenerationTaskFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		body string
+	}{
+		{"image", "/v1/images/generations", `{"model":"async-image","prompt":"cat"}`},
+		{"video", "/v1/videos/generations", `{"model":"async-video","prompt":"cat"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channel := newFailoverChannel("ch-a")
+			channel.Provider = "test-async"
+			f := newImageTestFixture(t, &stubTaskService{err: errors.New("database unavailable")}, channel)
+			f.handler.cfg.Models = config.ModelsConfig{
+				Image: []config.ModelConfig{{Name: "async-image", Type: "async", PricePerGeneration: 0.5}},
+				Video: []config.ModelConfig{{Name: "async-video", Type: "async", PricePerGeneration: 0.5}},
+			}
+			ctx := context.Background()
+			if err := f.handler.billing.Recharge(ctx, "user-1", 1); err != nil {
+				t.Fatalf("Recharge: %v", err)
+			}
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(func(c *gin.Context) { c.Set("user_id", "user-1") })
+			router.POST("/v1/images/generations", f.handler.ImageGeneration)
+			router.POST("/v1/videos/generations", f.handler.VideoGeneration)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)))
+
+			if rec.Code != http.StatusInternalServerError {
+				t.Fatalf("status = %d, body %s; want 500", rec.Code, rec.Body.String())
+			}
+			// 任务无法入库时退还预扣的费用并释放本次请求的并发位
+			if balance, err := f.handler.billing.GetBalance(ctx, "user-1"); err != nil || balance != 1 {
+				t.Fatalf("balance = %v, %v; want the cost refunded", balance, err)
+			}
+			if n := f.concurrency(t, "ch-a"); n != 1 {
+				t.Fatalf("concurrency = %d, want only the fixture's lease held", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/869413421/transit/internal/config"
+	"github.com/869413421/transit/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ModelObject OpenAI 格式的模型信息,附带 Transit 扩展字段
+type ModelObject struct {
+	ID      string           `json:"id"`
+	Object  string           `json:"object"`
+	Created int64            `json:"created"`
+	OwnedBy string           `json:"owned_by"`
+	Transit TransitModelInfo `json:"transit"`
+}
+
+// TransitModelInfo Transit 扩展的模型元数据
+type TransitModelInfo struct {
+	Category    string       `json:"category"` // text, image, video, embedding
+	Type        string       `json:"type"`     // sync, async
+	Description string       `json:"description,omitempty"`
+	Pricing     ModelPricing `json:"pricing"`
+}
+
+// ModelPricing 模型价格,未配置的计费项不返回
+type ModelPricing struct {
+	Per1KInputTokens  float64 `json:"per_1k_input_tokens,omitempty"`
+	Per1KOutputTokens float64 `json:"per_1k_output_tokens,omitempty"`
+	PerGeneration     float64 `json:"per_generation,omitempty"`
+	PerInputImage     float64 `json:"per_input_image,omitempty"`
+}
+
+// newModelObject 由模型配置生成模型信息
+func newModelObject(entry config.ModelEntry) ModelObject {
+	return ModelObject{
+		ID:      entry.Name,
+		Object:  "model",
+		OwnedBy: "transit",
+		Transit: TransitModelInfo{
+			Category:    entry.Category,
+			Type:        entry.Type,
+			Description: entry.Description,
+			Pricing: ModelPricing{
+				Per1KInputTokens:  entry.PricePer1KInputTokens,
+				Per1KOutputTokens: entry.PricePer1KOutputTokens,
+				PerGeneration:     entry.PricePerGeneration,
+				PerInputImage:     entry.PricePerInputImage,
+			},
+		},
+	}
+}
+
+// availableModels 返回当前 API Key 可用且有渠道可以路由的模型
+func (h *ProxyHandler) availableModels(c *gin.Context) ([]ModelObject, error) {
+	data := make([]ModelObject, 0)
+	for _, entry := range h.cfg.Models.List() {
+		if !modelAllowed(c, entry.Name) {
+			continue
+		}
+		routable, err := h.selector.CanRoute(c.Request.Context(), entry.Name)
+		if err != nil {
+			return nil, err
+		}
+		if routable {
+			data = append(data, newModelObject(entry))
+		}
+	}
+	return data, nil
+}
+
+// ListModels 模型列表
+// @Summary 模型列表
+// @Description 兼容 OpenAI 格式,返回当前 API Key 可用且有渠道可以路由的模型,transit 字段包含分类、同步/异步类型与价格
+// @Tags Proxy
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} object{object=string,data=[]ModelObject}
+// @Failure 401 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /v1/models [get]
+func (h *ProxyHandler) ListModels(c *gin.Context) {
+	data, err := h.availableModels(c)
+	if err != nil {
+		logger.Error("Failed to list models", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list models"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"object": "list",
+		"data":   data,
+	})
+}
+
+// RetrieveModel 模型详情
+// @Summary 模型详情
+// @Description 兼容 OpenAI 格式,模型不存在或当前 API Key 不可用时返回 404
+// @Tags Proxy
+// @Produce json
+// @Security BearerAuth
+// @Param model path string true "模型名称"
+// @Success 200 {object} ModelObject
+// @Failure 401 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /v1/models/{model} [get]
+func (h *ProxyHandler) RetrieveModel(c *gin.Context) {
+	data, err := h.availableModels(c)
+	if err != nil {
+		logger.Error("Failed to list models", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list models"})
+		return
+	}
+
+	name := c.Param("model")
+	for _, model := range data {
+		if model.ID == name {
+			c.JSON(http.StatusOK, model)
+			return
+		}
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "Model not found: " + name})
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/869413421/transit/internal/config"
+	"github.com/869413421/transit/internal/models"
+	"github.com/869413421/transit/internal/repository"
+	"github.com/869413421/transit/pkg/loadbalancer"
+	"github.com/gin-gonic/gin"
+)
+
+// stubChannelRepo 返回固定渠道列表的渠道仓储
+type stubChannelRepo struct {
+	repository.ChannelRepository
+	channels    []*models.Channel
+	updatedKeys []models.ChannelKey
+}
+
+func (r *stubChannelRepo) FindAll(ctx context.Context) ([]*models.Channel, error) {
+	return r.channels, nil
+}
+
+func (r *stubChannelRepo) FindByID(ctx context.Context, id string) (*models.Channel, error) {
+	for _, ch := range r.channels {
+		if ch.ID == id {
+			return ch, nil
+		}
+	}
+	return nil, errors.New("channel not found")
+}
+
+func (r *stubChannelRepo) UpdateKey(ctx context.Context, key *models.ChannelKey) error {
+	r.updatedKeys = append(r.updatedKeys, *key)
+	return nil
+}
+
+// newModelsTestHandler 创建使用测试模型配置与渠道的处理器
+func newModelsTestHandler(channels ...*models.Channel) *ProxyHandler {
+	cfg := &config.Config{Models: config.ModelsConfig{
+		Text:      []config.ModelConfig{{Name: "gpt-4o", Type: "sync", PricePer1KInputTokens: 0.005, PricePer1KOutputTokens: 0.015}},
+		Image:     []config.ModelConfig{{Name: "dall-e-3", Type: "sync", PricePerGeneration: 0.04}},
+		Embedding: []config.ModelConfig{{Name: "text-embedding-3-small", Type: "sync", PricePer1KInputTokens: 0.00002}},
+	}}
+	selector := loadbalancer.NewSelector(&stubChannelRepo{channels: channels}, nil, nil, nil, nil, nil, nil, nil)
+	return NewProxyHandler(cfg, selector, nil, nil)
+}
+
+// newModelsChannel 创建带一个可用密钥的渠道
+func newModelsChannel(id string, active bool, models ...string) *models.Channel {
+	channel := newFailoverChannel(id)
+	channel.IsActive = active
+	channel.Models = models
+	return channel
+}
+
+// serveModels 以指定的模型白名单请求模型接口
+func serveModels(t *testing.T, h *ProxyHandler, path string, allowedModels []string) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("allowed_models", allowedModels)
+	})
+	router.GET("/v1/models", h.ListModels)
+	router.GET("/v1/models/:model", h.RetrieveModel)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+// listModelIDs 解析模型列表响应中的模型 ID
+func listModelIDs(t *testing.T, rec *httptest.ResponseRecorder) []string {
+	t.Helper()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Object string        `json:"object"`
+		Data   []ModelObject `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if resp.Object != "list" {
+		t.Fatalf("object = %q, want list", resp.Object)
+	}
+	ids := make([]string, 0, len(resp.Data))
+	for _, model := range resp.Data {
+		ids = append(ids, model.ID)
+	}
+	return ids
+}
+
+func TestListModels(t *testing.T) {
+	h := newModelsTestHandler(newModelsChannel("ch-1", true))
+
+	ids := listModelIDs(t, serveModels(t, h, "/v1/models", nil))
+	want := []string{"gpt-4o", "dall-e-3", "text-embedding-3-small"}
+	if len(ids) != len(want) {
+		t.Fatalf("models = %v, want %v", ids, want)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Fatalf("models = %v, want %v", ids, want)
+		}
+	}
+
+	// 白名单只保留允许的模型
+	if ids := listModelIDs(t, serveModels(t, h, "/v1/models", []string{"dall-e-3"})); len(ids) != 1 || ids[0] != "dall-e-3" {
+		t.Fatalf("models with allowlist = %v, want [dall-e-3]", ids)
+	}
+}
+
+func TestListModelsWithoutActiveChannels(t *testing.T) {
+	h := newModelsTestHandler(newModelsChannel("ch-1", false))
+	if ids := listModelIDs(t, serveModels(t, h, "/v1/models", nil)); len(ids) != 0 {
+		t.Fatalf("models = %v, want none without active channels", ids)
+	}
+}
+
+func TestRetrieveModel(t *testing.T) {
+	h := newModelsTestHandler(newModelsChannel("ch-1", true))
+
+	rec := serveModels(t, h, "/v1/models/gpt-4o", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body.String())
+	}
+	var model ModelObject
+	if err := json.Unmarshal(rec.Body.Bytes(), &model); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if model.ID != "gpt-4o" || model.Object != "model" || model.Transit.Category != config.CategoryText {
+		t.Fatalf("model = %+v", model)
+	}
+	if model.Transit.Pricing.Per1KInputTokens != 0.005 || model.Transit.Pricing.PerGeneration != 0 {
+		t.Fatalf("pricing = %+v", model.Transit.Pricing)
+	}
+
+	// 未知模型与白名单外的模型都返回 404
+	if rec := serveModels(t, h, "/v1/models/missing", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown model status = %d, want 404", rec.Code)
+	}
+	if rec := serveModels(t, h, "/v1/models/gpt-4o", []string{"dall-e-3"}); rec.Code != http.StatusNotFound {
+		t.Fatalf("disallowed model status = %d, want 404", rec.Code)
+	}
+}
+
+func TestListModelsOnlyServedModels(t *testing.T) {
+	h := newModelsTestHandler(
+		newModelsChannel("images", true, "dall-*"),
+		newModelsChannel("chat", false, "gpt-4o"),
+	)
+	// 停用渠道声明的模型不可用
+	if ids := listModelIDs(t, serveModels(t, h, "/v1/models", nil)); len(ids) != 1 || ids[0] != "dall-e-3" {
+		t.Fatalf("models = %v, want [dall-e-3]", ids)
+	}
+}
+
+func TestListModelsOnlyRoutableModels(t *testing.T) {
+	zeroWeight := newModelsChannel("chat", true, "gpt-4o")
+	zeroWeight.Weight = 0
+	noKey := newModelsChannel("embeddings", true, "text-embedding-*")
+	noKey.Keys[0].IsActive = false
+	h := newModelsTestHandler(newModelsChannel("images", true, "dall-*"), zeroWeight, noKey)
+
+	// 权重为 0 或密钥全部停用的渠道无法路由,其声明的模型不可用
+	if ids := listModelIDs(t, serveModels(t, h, "/v1/models", nil)); len(ids) != 1 || ids[0] != "dall-e-3" {
+		t.Fatalf("models = %v, want [dall-e-3]", ids)
+	}
+	if rec := serveModels(t, h, "/v1/models/gpt-4o", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("unroutable model status = %d, want 404", rec.Code)
+	}
+}
@@ -1,10 +1,13 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/869413421/transit/internal/config"
+	"github.com/869413421/transit/internal/models"
 	"github.com/869413421/transit/internal/services"
 	"github.com/869413421/transit/pkg/billing"
 	"github.com/869413421/transit/pkg/loadbalancer"
@@ -20,6 +23,7 @@ type ProxyHandler struct {
 	selector    *loadbalancer.Selector
 	taskService services.TaskService
 	billing     *billing.Service
+	retry       *loadbalancer.RetryPolicy
 }
 
 // NewProxyHandler 创建代理转发处理器
@@ -34,12 +38,20 @@ func NewProxyHandler(
 		selector:    selector,
 		taskService: taskService,
 		billing:     billing,
+		retry: &loadbalancer.RetryPolicy{
+			MaxAttempts:          cfg.Retry.MaxAttempts,
+			RetryStatusCodes:     cfg.Retry.RetryStatusCodes,
+			RetryOnTimeout:       cfg.Retry.RetryOnTimeout,
+			RetryOnConnectionErr: cfg.Retry.RetryOnConnectionError,
+			InitialBackoff:       cfg.Retry.InitialBackoff,
+			MaxBackoff:           cfg.Retry.MaxBackoff,
+		},
 	}
 }
 
-// ChatCompletions 文本对话(同步)
+// ChatCompletions 文本对话(同步/流式)
 // @Summary 文本对话
-// @Description 同步文本对话API,兼容OpenAI格式
+// @Description 文本对话API,兼容OpenAI格式,stream=true 时以 SSE 流式返回
 // @Tags Proxy
 // @Accept json
 // @Produce json
@@ -51,9 +63,6 @@ func NewProxyHandler(
 // @Failure 500 {object} object{error=string}
 // @Router /api/v1/chat/completions [post]
 func (h *ProxyHandler) ChatCompletions(c *gin.Context) {
-	// 获取用户ID
-	userID, _ := c.Get("user_id")
-
 	// 解析请求
 	var req upstream.ChatCompletionRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -61,57 +70,41 @@ func (h *ProxyHandler) ChatCompletions(c *gin.Context) {
 		return
 	}
 
-	// 获取模型配置
-	modelCfg := h.cfg.Models.GetModelByName(req.Model)
-	if modelCfg == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported model: " + req.Model})
-		return
-	}
-
-	// 检查余额(预估费用,假设1000 tokens)
-	estimatedCost := 1000 * (modelCfg.PricePer1KInputTokens + modelCfg.PricePer1KOutputTokens) / 1000
-	balance, err := h.billing.GetBalance(c.Request.Context(), userID.(string))
-	if err != nil || balance < estimatedCost {
-		c.JSON(http.StatusPaymentRequired, gin.H{"error": "Insufficient balance"})
+	// 校验模型与余额并选择渠道
+	route, routeErr := h.routeChat(c, &req)
+	if routeErr != nil {
+		c.JSON(routeErr.status, gin.H{"error": routeErr.message})
 		return
 	}
+	defer h.releaseChat(c, route)
 
-	// 选择渠道
-	channel, err := h.selector.SelectChannel(c.Request.Context())
-	if err != nil {
-		logger.Error("Failed to select channel", zap.Error(err))
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "No available channels"})
+	// 流式请求单独处理
+	if req.Stream {
+		h.streamChatCompletion(c, route, &req)
 		return
 	}
-	defer h.selector.ReleaseChannel(c.Request.Context(), channel.ID)
-
-	// 创建APIMart适配器
-	adapter := upstream.NewAPIMartAdapter(channel.BaseURL, channel.SecretKey)
 
 	// 转发请求
 	startTime := time.Now()
-	resp, err := adapter.ChatCompletion(c.Request.Context(), &req)
+	var resp *upstream.ChatCompletionResponse
+	err := h.withFailover(c, route, func(ctx context.Context) (err error) {
+		resp, err = route.adapter.ChatCompletion(ctx, &req)
+		return err
+	})
 	if err != nil {
 		logger.Error("Upstream request failed",
-			zap.String("channel_id", channel.ID),
+			zap.String("channel_id", route.channel.ID),
 			zap.Error(err),
 		)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Upstream request failed"})
 		return
 	}
 
-	// 计算实际费用
-	inputCost := float64(resp.Usage.PromptTokens) * modelCfg.PricePer1KInputTokens / 1000
-	outputCost := float64(resp.Usage.CompletionTokens) * modelCfg.PricePer1KOutputTokens / 1000
-	actualCost := inputCost + outputCost
-
-	// 扣费
-	if err := h.billing.PostDeduct(c.Request.Context(), userID.(string), resp.Usage.TotalTokens, actualCost/float64(resp.Usage.TotalTokens)*1000); err != nil {
-		logger.Error("Failed to deduct balance", zap.Error(err))
-	}
+	// 按实际用量扣费
+	actualCost := h.chargeUsage(c.Request.Context(), route.userID, route.modelCfg, resp.Usage, upstream.CountInputImages(req.Messages))
 
 	logger.Info("Chat completion success",
-		zap.String("user_id", userID.(string)),
+		zap.String("user_id", route.userID),
 		zap.String("model", req.Model),
 		zap.Int("total_tokens", resp.Usage.TotalTokens),
 		zap.Float64("cost", actualCost),
@@ -121,15 +114,166 @@ func (h *ProxyHandler) ChatCompletions(c *gin.Context) {
 	c.JSON(http.StatusOK, resp)
 }
 
-// ImageGeneration 图片生成(异步)
+// chatRoute 文本类请求(对话、向量化)的路由结果
+type chatRoute struct {
+	userID   string
+	modelCfg *config.ModelConfig
+	channel  *models.Channel
+	leaseID  string // 渠道并发位租约
+	keyID    string // 本次调用使用的渠道密钥
+	adapter  upstream.Provider
+}
+
+// routeError 路由失败时返回给客户端的状态码与错误信息
+type routeError struct {
+	status  int
+	message string
+}
+
+// routeChat 校验模型与余额,选择渠道并创建适配器
+// 成功后调用方必须通过 releaseChat 释放渠道并发位
+func (h *ProxyHandler) routeChat(c *gin.Context, req *upstream.ChatCompletionRequest) (*chatRoute, *routeError) {
+	// 获取模型配置
+	modelCfg := h.cfg.Models.GetModelByName(req.Model)
+	if modelCfg == nil {
+		return nil, &routeError{http.StatusBadRequest, "Unsupported model: " + req.Model}
+	}
+	if !modelAllowed(c, req.Model) {
+		return nil, &routeError{http.StatusForbidden, "Model not allowed for this API key: " + req.Model}
+	}
+
+	// 预估费用(假设1000 tokens,另加图片输入费用)
+	estimatedCost := 1000 * (modelCfg.PricePer1KInputTokens + modelCfg.PricePer1KOutputTokens) / 1000
+	estimatedCost += float64(upstream.CountInputImages(req.Messages)) * modelCfg.PricePerInputImage
+
+	return h.routeModel(c, modelCfg, estimatedCost)
+}
+
+// routeModel 按预估费用检查余额,选择渠道并创建适配器
+// 成功后调用方必须通过 releaseChat 释放渠道并发位
+func (h *ProxyHandler) routeModel(c *gin.Context, modelCfg *config.ModelConfig, estimatedCost float64) (*chatRoute, *routeError) {
+	// 获取用户ID
+	userID := c.GetString("user_id")
+
+	// 检查余额
+	balance, err := h.billing.GetBalance(c.Request.Context(), userID)
+	if err != nil || balance < estimatedCost {
+		return nil, &routeError{http.StatusPaymentRequired, "Insufficient balance"}
+	}
+
+	return h.selectRoute(c, userID, modelCfg)
+}
+
+// selectRoute 为模型选择渠道并创建适配器,所有渠道满载且启用了等待队列时排队等待
+// 成功后调用方必须通过 releaseChat 释放渠道并发位
+func (h *ProxyHandler) selectRoute(c *gin.Context, userID string, modelCfg *config.ModelConfig) (*chatRoute, *routeError) {
+	// 选择渠道
+	channel, leaseID, err := h.selector.WaitForChannel(c.Request.Context(), modelCfg.Name, userID)
+	if err != nil {
+		logger.Error("Failed to select channel", zap.String("model", modelCfg.Name), zap.Error(err))
+		return nil, selectChannelError(err, modelCfg.Name)
+	}
+
+	// 选择渠道密钥并根据渠道供应商创建适配器
+	adapter, keyID, err := h.channelAdapter(c.Request.Context(), channel, modelCfg)
+	if err != nil {
+		h.selector.ReleaseChannel(c.Request.Context(), channel.ID, leaseID)
+		logger.Error("Failed to create provider", zap.String("channel_id", channel.ID), zap.Error(err))
+		return nil, &routeError{http.StatusInternalServerError, "Channel misconfigured"}
+	}
+
+	return &chatRoute{
+		userID:   userID,
+		modelCfg: modelCfg,
+		channel:  channel,
+		leaseID:  leaseID,
+		keyID:    keyID,
+		adapter:  adapter,
+	}, nil
+}
+
+// selectChannelError 将渠道选择失败转换为返回给客户端的错误
+// 没有渠道声明可服务该模型、渠道密钥均已停用、渠道满载或排队已满、超时时单独提示,便于与其他原因区分
+func selectChannelError(err error, model string) *routeError {
+	if errors.Is(err, loadbalancer.ErrNoChannelForModel) {
+		return &routeError{http.StatusServiceUnavailable, "No channel serves model: " + model}
+	}
+	if errors.Is(err, loadbalancer.ErrNoActiveKey) {
+		return &routeError{http.StatusServiceUnavailable, "No active upstream key for model: " + model}
+	}
+	if errors.Is(err, loadbalancer.ErrChannelsBusy) || errors.Is(err, loadbalancer.ErrQueueFull) || errors.Is(err, loadbalancer.ErrQueueTimeout) {
+		return &routeError{http.StatusServiceUnavailable, "All channels are busy, please retry later"}
+	}
+	return &routeError{http.StatusServiceUnavailable, "No available channels"}
+}
+
+// channelAdapter 选择渠道密钥并创建适配器,返回适配器及所用密钥的 ID
+func (h *ProxyHandler) channelAdapter(ctx context.Context, channel *models.Channel, modelCfg *config.ModelConfig) (upstream.Provider, string, error) {
+	key, err := h.selector.PickKey(ctx, channel)
+	if err != nil {
+		return nil, "", err
+	}
+	adapter, err := newAdapter(channel, key.SecretKey, modelCfg)
+	if err != nil {
+		return nil, "", err
+	}
+	return adapter, key.ID, nil
+}
+
+// newAdapter 根据渠道供应商创建适配器,并按渠道映射或模型配置的 upstream_name 改写上游模型名
+// 渠道映射优先于模型配置
+func newAdapter(channel *models.Channel, secretKey string, modelCfg *config.ModelConfig) (upstream.Provider, error) {
+	adapter, err := upstream.NewProvider(channel.Provider, channel.BaseURL, secretKey)
+	if err != nil {
+		return nil, err
+	}
+
+	upstreamModel := channel.UpstreamModel(modelCfg.Name)
+	if upstreamModel == "" {
+		upstreamModel = modelCfg.UpstreamName
+	}
+	if upstreamModel == modelCfg.Name {
+		return adapter, nil
+	}
+	return upstream.WithUpstreamModel(adapter, upstreamModel), nil
+}
+
+// modelAllowed 判断当前 API Key 是否可以使用指定模型
+func modelAllowed(c *gin.Context, model string) bool {
+	allowedModels, _ := c.Get("allowed_models")
+	names, _ := allowedModels.([]string)
+	return models.ModelAllowed(names, model)
+}
+
+// releaseChat 释放文本对话占用的渠道并发位
+// 流式请求中客户端可能提前断开,释放并发位不能随请求上下文取消
+func (h *ProxyHandler) releaseChat(c *gin.Context, route *chatRoute) {
+	h.selector.ReleaseChannel(context.WithoutCancel(c.Request.Context()), route.channel.ID, route.leaseID)
+}
+
+// chargeUsage 按 Token 用量及图片输入数量计算费用并扣费,返回实际费用
+func (h *ProxyHandler) chargeUsage(ctx context.Context, userID string, modelCfg *config.ModelConfig, usage upstream.Usage, inputImages int) float64 {
+	inputCost := float64(usage.PromptTokens) * modelCfg.PricePer1KInputTokens / 1000
+	outputCost := float64(usage.CompletionTokens) * modelCfg.PricePer1KOutputTokens / 1000
+	imageCost := float64(inputImages) * modelCfg.PricePerInputImage
+	actualCost := inputCost + outputCost + imageCost
+
+	if err := h.billing.Deduct(ctx, userID, actualCost); err != nil {
+		logger.Error("Failed to deduct balance", zap.String("user_id", userID), zap.Error(err))
+	}
+
+	return actualCost
+}
+
+// ImageGeneration 图片生成
 // @Summary 图片生成
-// @Description 异步图片生成API,返回任务ID
+// @Description 图片生成API,返回任务ID;同步上游的结果直接以已完成任务返回
 // @Tags Proxy
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param request body upstream.ImageGenerationRequest true "图片生成请求"
-// @Success 200 {object} object{task_id=string,status=string}
+// @Success 200 {object} object{task_id=string,status=string,result_url=string,images=[]upstream.ImageData}
 // @Failure 400 {object} object{error=string}
 // @Failure 401 {object} object{error=string}
 // @Failure 500 {object} object{error=string}
@@ -151,6 +295,10 @@ func (h *ProxyHandler) ImageGeneration(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported model: " + req.Model})
 		return
 	}
+	if !modelAllowed(c, req.Model) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Model not allowed for this API key: " + req.Model})
+		return
+	}
 
 	// 预扣费
 	cost := modelCfg.PricePerGeneration
@@ -160,41 +308,57 @@ func (h *ProxyHandler) ImageGeneration(c *gin.Context) {
 	}
 
 	// 选择渠道
-	channel, err := h.selector.SelectChannel(c.Request.Context())
-	if err != nil {
+	route, routeErr := h.selectRoute(c, userID.(string), modelCfg)
+	if routeErr != nil {
 		// 退费
 		h.billing.Refund(c.Request.Context(), userID.(string), cost)
-		logger.Error("Failed to select channel", zap.Error(err))
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "No available channels"})
+		c.JSON(routeErr.status, gin.H{"error": routeErr.message})
 		return
 	}
 
-	// 创建APIMart适配器
-	adapter := upstream.NewAPIMartAdapter(channel.BaseURL, channel.SecretKey)
-
-	// 转发请求
-	resp, err := adapter.ImageGeneration(c.Request.Context(), &req)
+	// 转发请求,失败时按重试策略切换渠道
+	var resp *upstream.ImageGenerationResponse
+	err := h.withFailover(c, route, func(ctx context.Context) (err error) {
+		resp, err = route.adapter.ImageGeneration(ctx, &req)
+		return err
+	})
 	if err != nil {
 		// 退费并释放并发位
 		h.billing.Refund(c.Request.Context(), userID.(string), cost)
-		h.selector.ReleaseChannel(c.Request.Context(), channel.ID)
-		logger.Error("Upstream request failed", zap.Error(err))
+		h.releaseChat(c, route)
+		logger.Error("Upstream request failed", zap.String("channel_id", route.channel.ID), zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Upstream request failed"})
 		return
 	}
 
+	// 同步上游直接返回结果: 记录为已完成任务并立即释放并发位
+	if resp.Status == "completed" {
+		h.completeSyncImage(c, userID.(string), route, req.Model, cost, resp)
+		return
+	}
+
 	// 创建任务记录
 	task, err := h.taskService.CreateTask(
 		c.Request.Context(),
 		userID.(string),
-		channel.ID,
+		route.channel.ID,
+		route.leaseID,
 		"async",
 		req.Model,
 		resp.TaskID,
 		cost,
 	)
 	if err != nil {
-		logger.Error("Failed to create task", zap.Error(err))
+		// 任务无法入库时不会被轮询,退费并释放并发位
+		h.billing.Refund(c.Request.Context(), userID.(string), cost)
+		h.releaseChat(c, route)
+		logger.Error("Failed to create task",
+			zap.String("channel_id", route.channel.ID),
+			zap.String("upstream_task_id", resp.TaskID),
+			zap.Error(err),
+		)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record image generation task"})
+		return
 	}
 
 	logger.Info("Image generation submitted",
@@ -209,6 +373,42 @@ func (h *ProxyHandler) ImageGeneration(c *gin.Context) {
 	})
 }
 
+// completeSyncImage 处理同步返回的图片结果
+// 结果以已完成任务的形式入库,调用方仍可通过任务接口查询;任务入库失败时退费并返回 500
+func (h *ProxyHandler) completeSyncImage(c *gin.Context, userID string, route *chatRoute, modelName string, cost float64, resp *upstream.ImageGenerationResponse) {
+	h.releaseChat(c, route)
+
+	// 任务记录仅保存第一张图片的地址,仅返回 base64 数据的图片不入库,完整结果在本次响应中返回
+	resultURL := ""
+	if len(resp.Images) > 0 {
+		resultURL = resp.Images[0].URL
+	}
+
+	task, err := h.taskService.CreateCompletedTask(c.Request.Context(), userID, route.channel.ID, modelName, resultURL, cost)
+	if err != nil {
+		h.billing.Refund(c.Request.Context(), userID, cost)
+		logger.Error("Failed to create task", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record image generation task"})
+		return
+	}
+
+	logger.Info("Image generation completed",
+		zap.String("user_id", userID),
+		zap.String("task_id", task.ID),
+		zap.Int("images", len(resp.Images)),
+	)
+
+	response := gin.H{
+		"task_id": task.ID,
+		"status":  resp.Status,
+		"images":  resp.Images,
+	}
+	if resultURL != "" {
+		response["result_url"] = resultURL
+	}
+	c.JSON(http.StatusOK, response)
+}
+
 // VideoGeneration 视频生成(异步)
 // @Summary 视频生成
 // @Description 异步视频生成API,返回任务ID
@@ -239,6 +439,10 @@ func (h *ProxyHandler) VideoGeneration(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported model: " + req.Model})
 		return
 	}
+	if !modelAllowed(c, req.Model) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Model not allowed for this API key: " + req.Model})
+		return
+	}
 
 	// 预扣费
 	cost := modelCfg.PricePerGeneration
@@ -248,25 +452,25 @@ func (h *ProxyHandler) VideoGeneration(c *gin.Context) {
 	}
 
 	// 选择渠道
-	channel, err := h.selector.SelectChannel(c.Request.Context())
-	if err != nil {
+	route, routeErr := h.selectRoute(c, userID.(string), modelCfg)
+	if routeErr != nil {
 		// 退费
 		h.billing.Refund(c.Request.Context(), userID.(string), cost)
-		logger.Error("Failed to select channel", zap.Error(err))
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "No available channels"})
+		c.JSON(routeErr.status, gin.H{"error": routeErr.message})
 		return
 	}
 
-	// 创建APIMart适配器
-	adapter := upstream.NewAPIMartAdapter(channel.BaseURL, channel.SecretKey)
-
-	// 转发请求
-	resp, err := adapter.VideoGeneration(c.Request.Context(), &req)
+	// 转发请求,失败时按重试策略切换渠道
+	var resp *upstream.VideoGenerationResponse
+	err := h.withFailover(c, route, func(ctx context.Context) (err error) {
+		resp, err = route.adapter.VideoGeneration(ctx, &req)
+		return err
+	})
 	if err != nil {
 		// 退费并释放并发位
 		h.billing.Refund(c.Request.Context(), userID.(string), cost)
-		h.selector.ReleaseChannel(c.Request.Context(), channel.ID)
-		logger.Error("Upstream request failed", zap.Error(err))
+		h.releaseChat(c, route)
+		logger.Error("Upstream request failed", zap.String("channel_id", route.channel.ID), zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Upstream request failed"})
 		return
 	}
@@ -275,14 +479,24 @@ func (h *ProxyHandler) VideoGeneration(c *gin.Context) {
 	task, err := h.taskService.CreateTask(
 		c.Request.Context(),
 		userID.(string),
-		channel.ID,
+		route.channel.ID,
+		route.leaseID,
 		"async",
 		req.Model,
 		resp.TaskID,
 		cost,
 	)
 	if err != nil {
-		logger.Error("Failed to create task", zap.Error(err))
+		// 任务无法入库时不会被轮询,退费并释放并发位
+		h.billing.Refund(c.Request.Context(), userID.(string), cost)
+		h.releaseChat(c, route)
+		logger.Error("Failed to create task",
+			zap.String("channel_id", route.channel.ID),
+			zap.String("upstream_task_id", resp.TaskID),
+			zap.Error(err),
+		)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record video generation task"})
+		return
 	}
 
 	logger.Info("Video generation submitted",
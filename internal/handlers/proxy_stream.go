@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/869413421/transit/pkg/logger"
+	"github.com/869413421/transit/pkg/upstream"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// chatStreamResult 流式对话结束后的汇总结果
+type chatStreamResult struct {
+	usage        upstream.Usage
+	estimated    bool   // usage 是否为估算值
+	finishReason string // 最后一个 finish_reason
+	err          error  // 流中断原因,正常结束时为 nil
+}
+
+// pumpChatStream 逐块读取上游流式响应并交由 onChunk 写出给客户端
+// 从最后一个数据块中收集 usage;上游未返回 usage 时按输入消息和已输出内容(含工具调用参数)估算 Token 数
+func pumpChatStream(
+	stream *upstream.ChatCompletionStream,
+	req *upstream.ChatCompletionRequest,
+	onChunk func(chunk *upstream.ChatCompletionChunk, raw []byte) error,
+) *chatStreamResult {
+	result := &chatStreamResult{}
+
+	var (
+		usage      *upstream.Usage
+		completion strings.Builder
+	)
+	for {
+		chunk, raw, err := stream.Recv()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				result.err = err
+			}
+			break
+		}
+
+		for _, choice := range chunk.Choices {
+			completion.WriteString(choice.Delta.Content.Text())
+			for _, call := range choice.Delta.ToolCalls {
+				completion.WriteString(call.Function.Name)
+				completion.WriteString(call.Function.Arguments)
+			}
+			if choice.FinishReason != "" {
+				result.finishReason = choice.FinishReason
+			}
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+
+		if err := onChunk(chunk, raw); err != nil {
+			result.err = err
+			break
+		}
+	}
+
+	if usage != nil {
+		result.usage = *usage
+		return result
+	}
+
+	// 上游未返回 usage 时按内容估算
+	promptTokens := upstream.EstimatePromptTokens(req.Messages)
+	completionTokens := upstream.EstimateTokens(completion.String())
+	result.usage = upstream.Usage{
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		TotalTokens:      promptTokens + completionTokens,
+	}
+	result.estimated = true
+	return result
+}
+
+// finishChatStream 流式对话结束后扣费并记录日志
+func (h *ProxyHandler) finishChatStream(c *gin.Context, route *chatRoute, req *upstream.ChatCompletionRequest, result *chatStreamResult, startTime time.Time) {
+	if result.err != nil {
+		logger.Warn("Chat completion stream interrupted",
+			zap.String("channel_id", route.channel.ID),
+			zap.Error(result.err),
+		)
+	}
+
+	// 客户端断开连接后仍需完成扣费
+	actualCost := h.chargeUsage(context.WithoutCancel(c.Request.Context()), route.userID, route.modelCfg, result.usage, upstream.CountInputImages(req.Messages))
+
+	logger.Info("Chat completion stream finished",
+		zap.String("user_id", route.userID),
+		zap.String("model", req.Model),
+		zap.Int("total_tokens", result.usage.TotalTokens),
+		zap.Bool("usage_estimated", result.estimated),
+		zap.Float64("cost", actualCost),
+		zap.Duration("latency", time.Since(startTime)),
+	)
+}
+
+// startSSE 写出 SSE 响应头
+func startSSE(c *gin.Context) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+}
+
+// writeSSEData 写出一个仅包含 data 字段的 SSE 事件
+func writeSSEData(c *gin.Context, data []byte) error {
+	if _, err := fmt.Fprintf(c.Writer, "data: %s\n\n", data); err != nil {
+		return err
+	}
+	c.Writer.Flush()
+	return nil
+}
+
+// writeSSEEvent 写出带事件类型的 SSE 事件,payload 序列化为 JSON
+func writeSSEEvent(c *gin.Context, event string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	c.Writer.Flush()
+	return nil
+}
+
+// streamChatCompletion 以 OpenAI SSE 格式转发流式文本对话
+// 上游数据块原样透传给客户端,保持 data: ... [DONE] 的帧格式
+func (h *ProxyHandler) streamChatCompletion(c *gin.Context, route *chatRoute, req *upstream.ChatCompletionRequest) {
+	startTime := time.Now()
+	var stream *upstream.ChatCompletionStream
+	err := h.withFailover(c, route, func(ctx context.Context) (err error) {
+		stream, err = route.adapter.ChatCompletionStream(ctx, req)
+		return err
+	})
+	if err != nil {
+		logger.Error("Upstream stream request failed",
+			zap.String("channel_id", route.channel.ID),
+			zap.Error(err),
+		)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Upstream request failed"})
+		return
+	}
+	defer stream.Close()
+
+	// 客户端未要求返回 usage 时,不透传仅包含 usage 的数据块
+	includeUsage := req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+
+	startSSE(c)
+	result := pumpChatStream(stream, req, func(chunk *upstream.ChatCompletionChunk, raw []byte) error {
+		if len(chunk.Choices) == 0 && chunk.Usage != nil && !includeUsage {
+			return nil
+		}
+		return writeSSEData(c, raw)
+	})
+
+	if result.err == nil {
+		writeSSEData(c, []byte("[DONE]"))
+	} else if c.Request.Context().Err() == nil {
+		// 客户端仍在连接时,以 OpenAI 错误格式通知流中断
+		errBody, _ := json.Marshal(upstream.ErrorResponse{Error: upstream.ErrorDetail{
+			Message: "Upstream stream interrupted",
+			Type:    "upstream_error",
+		}})
+		writeSSEData(c, errBody)
+	}
+
+	h.finishChatStream(c, route, req, result, startTime)
+}
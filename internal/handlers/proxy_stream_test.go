@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/869413421/transit/pkg/upstream"
+)
+
+// newTestStream 基于 SSE 文本创建 OpenAI 格式的流式读取器
+func newTestStream(body string) *upstream.ChatCompletionStream {
+	return upstream.NewChatCompletionStream(io.NopCloser(strings.NewReader(body)))
+}
+
+func TestPumpChatStreamUsesUpstreamUsage(t *testing.T) {
+	stream := newTestStream(
+		"data: {\"id\":\"1\",\"model\":\"m\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"hello\"}}]}\n\n" +
+			"data: {\"id\":\"1\",\"model\":\"m\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n" +
+			"data: {\"id\":\"1\",\"model\":\"m\",\"choices\":[],\"usage\":{\"prompt_tokens\":3,\"completion_tokens\":5,\"total_tokens\":8}}\n\n" +
+			"data: [DONE]\n\n",
+	)
+	req := &upstream.ChatCompletionRequest{Messages: []upstream.Message{{Role: "user", Content: upstream.NewTextContent("hi")}}}
+
+	var forwarded int
+	result := pumpChatStream(stream, req, func(*upstream.ChatCompletionChunk, []byte) error {
+		forwarded++
+		return nil
+	})
+
+	if result.err != nil {
+		t.Fatalf("err = %v", result.err)
+	}
+	if forwarded != 3 {
+		t.Fatalf("forwarded %d chunks, want 3", forwarded)
+	}
+	if result.estimated {
+		t.Fatal("usage estimated although upstream returned usage")
+	}
+	if result.usage.TotalTokens != 8 || result.finishReason != "stop" {
+		t.Fatalf("result = %+v, want total_tokens 8 and finish_reason stop", result)
+	}
+}
+
+func TestPumpChatStreamEstimatesMissingUsage(t *testing.T) {
+	stream := newTestStream(
+		"data: {\"id\":\"1\",\"model\":\"m\",\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":0,\"id\":\"call_1\",\"function\":{\"name\":\"get_weather\",\"arguments\":\"{\\\"city\\\":\"}}]}}]}\n\n" +
+			"data: {\"id\":\"1\",\"model\":\"m\",\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"\\\"Paris\\\"}\"}}]},\"finish_reason\":\"tool_calls\"}]}\n\n" +
+			"data: [DONE]\n\n",
+	)
+	req := &upstream.ChatCompletionRequest{Messages: []upstream.Message{{Role: "user", Content: upstream.NewTextContent("weather in Paris?")}}}
+
+	result := pumpChatStream(stream, req, func(*upstream.ChatCompletionChunk, []byte) error { return nil })
+
+	if !result.estimated {
+		t.Fatal("usage not marked as estimated")
+	}
+	if result.usage.PromptTokens == 0 || result.usage.CompletionTokens == 0 {
+		t.Fatalf("usage = %+v, want non-zero estimate including tool call arguments", result.usage)
+	}
+	if result.usage.TotalTokens != result.usage.PromptTokens+result.usage.CompletionTokens {
+		t.Fatalf("usage = %+v, total does not add up", result.usage)
+	}
+	if result.finishReason != "tool_calls" {
+		t.Fatalf("finishReason = %q, want tool_calls", result.finishReason)
+	}
+}
+
+func TestPumpChatStreamStopsOnWriteError(t *testing.T) {
+	stream := newTestStream(
+		"data: {\"id\":\"1\",\"model\":\"m\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"a\"}}]}\n\n" +
+			"data: {\"id\":\"1\",\"model\":\"m\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"b\"}}]}\n\n" +
+			"data: [DONE]\n\n",
+	)
+	writeErr := errors.New("client gone")
+
+	var forwarded int
+	result := pumpChatStream(stream, &upstream.ChatCompletionRequest{}, func(*upstream.ChatCompletionChunk, []byte) error {
+		forwarded++
+		return writeErr
+	})
+
+	if !errors.Is(result.err, writeErr) || forwarded != 1 {
+		t.Fatalf("err = %v after %d chunks, want write error after the first chunk", result.err, forwarded)
+	}
+}
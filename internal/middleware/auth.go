@@ -14,19 +14,9 @@ import (
 func UserAuth(userAPIKeyRepo repository.UserAPIKeyRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 从请求头获取API Key
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing Authorization header"})
-			c.Abort()
-			return
-		}
-
-		// 支持 "Bearer <api_key>" 格式
-		apiKey := strings.TrimPrefix(authHeader, "Bearer ")
-		apiKey = strings.TrimSpace(apiKey)
-
+		apiKey := extractAPIKey(c)
 		if apiKey == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key format"})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing API key"})
 			c.Abort()
 			return
 		}
@@ -34,7 +24,7 @@ func UserAuth(userAPIKeyRepo repository.UserAPIKeyRepository) gin.HandlerFunc {
 		// 验证API Key
 		userAPIKey, err := userAPIKeyRepo.FindByAPIKey(c.Request.Context(), apiKey)
 		if err != nil {
-			logger.Warn("Invalid API key", zap.String("api_key", apiKey[:8]+"..."), zap.Error(err))
+			logger.Warn("Invalid API key", zap.String("api_key", apiKey[:min(8, len(apiKey))]+"..."), zap.Error(err))
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
 			c.Abort()
 			return
@@ -51,8 +41,24 @@ func UserAuth(userAPIKeyRepo repository.UserAPIKeyRepository) gin.HandlerFunc {
 		// 将用户ID存入上下文
 		c.Set("user_id", userAPIKey.UserID)
 		c.Set("api_key_id", userAPIKey.ID)
+		c.Set("allowed_models", userAPIKey.AllowedModels)
 
 		logger.Debug("User authenticated", zap.String("user_id", userAPIKey.UserID))
 		c.Next()
 	}
 }
+
+// extractAPIKey 从请求中提取API Key
+// 支持 OpenAI 风格的 "Authorization: Bearer <api_key>"、Anthropic 风格的 "x-api-key"
+// 以及 Gemini 风格的 "x-goog-api-key" 请求头和 "key" 查询参数
+func extractAPIKey(c *gin.Context) string {
+	if authHeader := c.GetHeader("Authorization"); authHeader != "" {
+		return strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
+	}
+	for _, header := range []string{"x-api-key", "x-goog-api-key"} {
+		if apiKey := c.GetHeader(header); apiKey != "" {
+			return strings.TrimSpace(apiKey)
+		}
+	}
+	return strings.TrimSpace(c.Query("key"))
+}
@@ -1,6 +1,11 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+)
 
 // User 用户模型
 type User struct {
@@ -14,25 +19,148 @@ type User struct {
 
 // UserAPIKey 用户API密钥
 type UserAPIKey struct {
-	ID        string    `json:"id" gorm:"primaryKey"`
-	UserID    string    `json:"user_id" gorm:"not null;index"`
-	APIKey    string    `json:"api_key" gorm:"unique;not null;index"`
-	IsActive  bool      `json:"is_active" gorm:"default:true"`
-	CreatedAt time.Time `json:"created_at"`
+	ID            string    `json:"id" gorm:"primaryKey"`
+	UserID        string    `json:"user_id" gorm:"not null;index"`
+	APIKey        string    `json:"api_key" gorm:"unique;not null;index"`
+	IsActive      bool      `json:"is_active" gorm:"default:true"`
+	AllowedModels []string  `json:"allowed_models" gorm:"type:text[]"` // 可用模型白名单,为空时可使用全部模型
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ModelAllowed 判断模型是否在白名单内,白名单为空时允许全部模型
+func ModelAllowed(allowedModels []string, model string) bool {
+	if len(allowedModels) == 0 {
+		return true
+	}
+	for _, allowed := range allowedModels {
+		if allowed == model {
+			return true
+		}
+	}
+	return false
 }
 
 // Channel 上游渠道
 type Channel struct {
-	ID                 string    `json:"id" gorm:"primaryKey"`
-	Name               string    `json:"name"`
-	SecretKey          string    `json:"secret_key" gorm:"not null"`
-	BaseURL            string    `json:"base_url"`
-	MaxConcurrency     int       `json:"max_concurrency" gorm:"default:200"`
-	CurrentConcurrency int       `json:"current_concurrency" gorm:"default:0"`
-	Weight             int       `json:"weight" gorm:"default:10"`
-	IsActive           bool      `json:"is_active" gorm:"default:true;index"`
-	CreatedAt          time.Time `json:"created_at"`
-	UpdatedAt          time.Time `json:"updated_at"`
+	ID                 string            `json:"id" gorm:"primaryKey"`
+	Name               string            `json:"name"`
+	BaseURL            string            `json:"base_url"`
+	Provider           string            `json:"provider" gorm:"default:'apimart'"`    // 上游供应商类型,决定使用的适配器
+	Models             []string          `json:"models" gorm:"type:text[]"`            // 可服务的对外模型名,支持 path.Match 通配符,为空时可服务全部模型
+	ModelMapping       map[string]string `json:"model_mapping" gorm:"serializer:json"` // 对外模型名 -> 该渠道的上游模型名,优先于模型配置的 upstream_name
+	MaxConcurrency     int               `json:"max_concurrency" gorm:"default:200"`
+	CurrentConcurrency int               `json:"current_concurrency" gorm:"default:0"`
+	ConcurrencyLimit   int               `json:"concurrency_limit" gorm:"-"` // 实时有效并发上限,未启用自适应并发时等于 MaxConcurrency
+	Weight             int               `json:"weight" gorm:"default:10"`
+	Priority           int               `json:"priority" gorm:"default:0"`                 // 优先级,数值越大越优先,同级内按权重选择
+	KeyStrategy        string            `json:"key_strategy" gorm:"default:'round_robin'"` // 多个密钥之间的选择方式: round_robin, least_used
+	Keys               []ChannelKey      `json:"keys" gorm:"-"`                             // 上游密钥,按添加时间排序
+	IsActive           bool              `json:"is_active" gorm:"default:true;index"`
+	CreatedAt          time.Time         `json:"created_at"`
+	UpdatedAt          time.Time         `json:"updated_at"`
+}
+
+// ServesModel 判断该渠道是否可以服务指定模型
+func (c *Channel) ServesModel(model string) bool {
+	if len(c.Models) == 0 {
+		return true
+	}
+	for _, pattern := range c.Models {
+		if matched, _ := path.Match(pattern, model); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateModelPatterns 校验模型通配符是否合法
+func ValidateModelPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if pattern == "" {
+			return fmt.Errorf("empty model pattern")
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid model pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// ActiveKeys 返回渠道未停用的密钥
+func (c *Channel) ActiveKeys() []ChannelKey {
+	var keys []ChannelKey
+	for _, key := range c.Keys {
+		if key.IsActive {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// HasActiveKey 判断渠道是否还有可用密钥
+func (c *Channel) HasActiveKey() bool {
+	for _, key := range c.Keys {
+		if key.IsActive {
+			return true
+		}
+	}
+	return false
+}
+
+// HasOtherActiveKey 判断渠道除指定密钥外是否还有可用密钥
+func (c *Channel) HasOtherActiveKey(keyID string) bool {
+	for _, key := range c.Keys {
+		if key.IsActive && key.ID != keyID {
+			return true
+		}
+	}
+	return false
+}
+
+// FindKey 按 ID 查找渠道密钥,不存在时返回 nil
+func (c *Channel) FindKey(id string) *ChannelKey {
+	for i := range c.Keys {
+		if c.Keys[i].ID == id {
+			return &c.Keys[i]
+		}
+	}
+	return nil
+}
+
+// ChannelKey 渠道的上游密钥,同一上游账号的多个密钥共享渠道的并发位与统计
+type ChannelKey struct {
+	ID             string    `json:"id" gorm:"primaryKey"`
+	ChannelID      string    `json:"channel_id" gorm:"not null;index"`
+	SecretKey      string    `json:"secret_key" gorm:"not null"`
+	IsActive       bool      `json:"is_active" gorm:"default:true"`
+	DisabledReason string    `json:"disabled_reason,omitempty"` // 自动停用的原因,如上游返回 401/403
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// MarshalJSON 序列化时遮盖密钥,只保留首尾少量字符用于辨认,避免管理接口响应泄露完整密钥
+func (k ChannelKey) MarshalJSON() ([]byte, error) {
+	type channelKey ChannelKey
+	masked := channelKey(k)
+	masked.SecretKey = MaskSecret(k.SecretKey)
+	return json.Marshal(masked)
+}
+
+// MaskSecret 遮盖密钥,如 sk-abcdef123456wxyz 显示为 sk-ab…wxyz,过短的密钥只显示末尾字符
+func MaskSecret(secret string) string {
+	switch {
+	case len(secret) >= 16:
+		return secret[:5] + "…" + secret[len(secret)-4:]
+	case len(secret) >= 8:
+		return "…" + secret[len(secret)-2:]
+	default:
+		return "…"
+	}
+}
+
+// UpstreamModel 返回该渠道为指定模型配置的上游模型名,未配置时返回空字符串
+func (c *Channel) UpstreamModel(model string) string {
+	return c.ModelMapping[model]
 }
 
 // Task 任务记录
@@ -40,6 +168,7 @@ type Task struct {
 	ID             string    `json:"id" gorm:"primaryKey"`
 	UserID         string    `json:"user_id" gorm:"not null;index"`
 	ChannelID      string    `json:"channel_id" gorm:"not null"`
+	LeaseID        string    `json:"-"`                                              // 占用的渠道并发位租约,任务结束时释放
 	Type           string    `json:"type" gorm:"type:enum('sync','async');not null"` // sync/async
 	ModelName      string    `json:"model_name"`
 	UpstreamTaskID string    `json:"upstream_task_id"`
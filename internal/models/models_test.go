@@ -0,0 +1,82 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestChannelServesModel(t *testing.T) {
+	tests := []struct {
+		name   string
+		models []string
+		model  string
+		want   bool
+	}{
+		{"empty list serves all", nil, "gpt-4o", true},
+		{"exact match", []string{"gpt-4o", "dall-e-3"}, "dall-e-3", true},
+		{"wildcard match", []string{"gemini-*"}, "gemini-2.0-flash", true},
+		{"wildcard mismatch", []string{"gemini-*"}, "gpt-4o", false},
+		{"no match", []string{"gpt-4o"}, "gpt-4o-mini", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channel := &Channel{Models: tt.models}
+			if got := channel.ServesModel(tt.model); got != tt.want {
+				t.Fatalf("ServesModel(%q) = %v, want %v", tt.model, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateModelPatterns(t *testing.T) {
+	if err := ValidateModelPatterns([]string{"gpt-4o", "gemini-*", "claude-3-?"}); err != nil {
+		t.Fatalf("ValidateModelPatterns() = %v, want nil", err)
+	}
+	for _, invalid := range [][]string{{""}, {"gpt-[4"}} {
+		if err := ValidateModelPatterns(invalid); err == nil {
+			t.Errorf("ValidateModelPatterns(%q) returned no error", invalid)
+		}
+	}
+}
+
+func TestModelAllowed(t *testing.T) {
+	if !ModelAllowed(nil, "gpt-4o") {
+		t.Fatal("empty allowlist rejected a model")
+	}
+	if !ModelAllowed([]string{"gpt-4o"}, "gpt-4o") || ModelAllowed([]string{"gpt-4o"}, "dall-e-3") {
+		t.Fatal("ModelAllowed() does not match the allowlist")
+	}
+}
+
+func TestMaskSecret(t *testing.T) {
+	tests := []struct {
+		secret string
+		want   string
+	}{
+		{"sk-abcdef123456wxyz", "sk-ab…wxyz"},
+		{"sk-12345", "…45"},
+		{"short", "…"},
+		{"", "…"},
+	}
+	for _, tt := range tests {
+		if got := MaskSecret(tt.secret); got != tt.want {
+			t.Errorf("MaskSecret(%q) = %q, want %q", tt.secret, got, tt.want)
+		}
+	}
+}
+
+func TestChannelKeyMarshalJSONMasksSecret(t *testing.T) {
+	key := ChannelKey{ID: "k0", SecretKey: "sk-abcdef123456wxyz", IsActive: true}
+	data, err := json.Marshal(&Channel{ID: "ch0", Keys: []ChannelKey{key}})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if strings.Contains(string(data), key.SecretKey) || !strings.Contains(string(data), "sk-ab…wxyz") {
+		t.Fatalf("Marshal() = %s, want the secret masked", data)
+	}
+	// 序列化不修改原密钥
+	if key.SecretKey != "sk-abcdef123456wxyz" {
+		t.Fatal("MarshalJSON modified the key")
+	}
+}
@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/869413421/transit/internal/models"
+	"github.com/869413421/transit/pkg/logger"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// channelInvalidateChannel 渠道变更通知的 Redis pub/sub 频道
+const channelInvalidateChannel = "transit:channels:invalidate"
+
+// ChannelCache 带进程内缓存的渠道仓储
+// 读操作直接读取内存中的全部渠道,避免每个请求都查询数据库;
+// 写操作成功后立即刷新本地缓存并通过 Redis pub/sub 通知其他实例刷新,另有定期全量刷新兜底
+type ChannelCache struct {
+	ChannelRepository
+
+	client          *redis.Client
+	refreshInterval time.Duration
+
+	refreshMu sync.Mutex // 串行化刷新,避免较早开始的查询晚于较新的查询写入缓存
+
+	mu       sync.RWMutex
+	channels []*models.Channel
+	loaded   bool
+}
+
+// NewChannelCache 创建带缓存的渠道仓储
+func NewChannelCache(repo ChannelRepository, client *redis.Client, refreshInterval time.Duration) *ChannelCache {
+	return &ChannelCache{
+		ChannelRepository: repo,
+		client:            client,
+		refreshInterval:   refreshInterval,
+	}
+}
+
+// Start 订阅渠道变更通知并定期全量刷新,直到 ctx 取消
+func (c *ChannelCache) Start(ctx context.Context) {
+	pubsub := c.client.Subscribe(ctx, channelInvalidateChannel)
+	defer pubsub.Close()
+
+	ticker := time.NewTicker(c.refreshInterval)
+	defer ticker.Stop()
+
+	logger.Info("Channel cache started", zap.Duration("refresh_interval", c.refreshInterval))
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Channel cache stopped")
+			return
+		case <-messages:
+			c.reload(ctx, "invalidated")
+		case <-ticker.C:
+			c.reload(ctx, "periodic")
+		}
+	}
+}
+
+// Refresh 从数据库重新加载全部渠道
+// 并发的刷新依次执行,后开始的刷新总在先开始的刷新之后写入,缓存不会被旧的查询结果覆盖
+func (c *ChannelCache) Refresh(ctx context.Context) error {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	channels, err := c.ChannelRepository.FindAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.channels = channels
+	c.loaded = true
+	c.mu.Unlock()
+	return nil
+}
+
+// reload 刷新缓存,失败时保留旧数据
+func (c *ChannelCache) reload(ctx context.Context, reason string) {
+	if err := c.Refresh(ctx); err != nil {
+		logger.Error("Failed to refresh channel cache", zap.String("reason", reason), zap.Error(err))
+		return
+	}
+	logger.Debug("Channel cache refreshed", zap.String("reason", reason))
+}
+
+// invalidate 刷新本地缓存并通知其他实例
+func (c *ChannelCache) invalidate(ctx context.Context) {
+	c.reload(ctx, "mutation")
+	if err := c.client.Publish(ctx, channelInvalidateChannel, time.Now().UnixMilli()).Err(); err != nil {
+		logger.Error("Failed to publish channel invalidation", zap.Error(err))
+	}
+}
+
+// snapshot 返回缓存渠道的副本,调用方可以修改返回的渠道而不影响缓存
+// 缓存尚未加载成功时返回 false
+func (c *ChannelCache) snapshot(filter func(*models.Channel) bool) ([]*models.Channel, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if !c.loaded {
+		return nil, false
+	}
+
+	var channels []*models.Channel
+	for _, ch := range c.channels {
+		if filter == nil || filter(ch) {
+			channel := *ch
+			channel.Keys = slices.Clone(ch.Keys)
+			channels = append(channels, &channel)
+		}
+	}
+	return channels, true
+}
+
+func (c *ChannelCache) FindByID(ctx context.Context, id string) (*models.Channel, error) {
+	channels, ok := c.snapshot(func(ch *models.Channel) bool { return ch.ID == id })
+	if ok && len(channels) == 1 {
+		return channels[0], nil
+	}
+	// 缓存未命中时查询数据库,兼容刚创建尚未同步的渠道
+	return c.ChannelRepository.FindByID(ctx, id)
+}
+
+func (c *ChannelCache) FindAll(ctx context.Context) ([]*models.Channel, error) {
+	if channels, ok := c.snapshot(nil); ok {
+		return channels, nil
+	}
+	return c.ChannelRepository.FindAll(ctx)
+}
+
+func (c *ChannelCache) FindActive(ctx context.Context) ([]*models.Channel, error) {
+	if channels, ok := c.snapshot(func(ch *models.Channel) bool { return ch.IsActive }); ok {
+		return channels, nil
+	}
+	return c.ChannelRepository.FindActive(ctx)
+}
+
+func (c *ChannelCache) Create(ctx context.Context, channel *models.Channel) error {
+	if err := c.ChannelRepository.Create(ctx, channel); err != nil {
+		return err
+	}
+	c.invalidate(ctx)
+	return nil
+}
+
+func (c *ChannelCache) Update(ctx context.Context, channel *models.Channel) error {
+	if err := c.ChannelRepository.Update(ctx, channel); err != nil {
+		return err
+	}
+	c.invalidate(ctx)
+	return nil
+}
+
+func (c *ChannelCache) Delete(ctx context.Context, id string) error {
+	if err := c.ChannelRepository.Delete(ctx, id); err != nil {
+		return err
+	}
+	c.invalidate(ctx)
+	return nil
+}
+
+func (c *ChannelCache) AddKey(ctx context.Context, key *models.ChannelKey) error {
+	if err := c.ChannelRepository.AddKey(ctx, key); err != nil {
+		return err
+	}
+	c.invalidate(ctx)
+	return nil
+}
+
+func (c *ChannelCache) UpdateKey(ctx context.Context, key *models.ChannelKey) error {
+	if err := c.ChannelRepository.UpdateKey(ctx, key); err != nil {
+		return err
+	}
+	c.invalidate(ctx)
+	return nil
+}
+
+func (c *ChannelCache) DeleteKey(ctx context.Context, channelID, keyID string) error {
+	if err := c.ChannelRepository.DeleteKey(ctx, channelID, keyID); err != nil {
+		return err
+	}
+	c.invalidate(ctx)
+	return nil
+}
@@ -0,0 +1,211 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/869413421/transit/internal/models"
+	"github.com/869413421/transit/pkg/logger"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestMain(m *testing.M) {
+	if err := logger.Init("production"); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// memChannelRepo 内存渠道仓储,模拟多个实例共享的数据库
+type memChannelRepo struct {
+	ChannelRepository
+
+	mu        sync.Mutex
+	channels  []models.Channel
+	queries   int
+	onFindAll func() // 读取数据后、返回前调用,用于模拟慢查询
+}
+
+func (r *memChannelRepo) FindAll(ctx context.Context) ([]*models.Channel, error) {
+	r.mu.Lock()
+	r.queries++
+	channels := make([]*models.Channel, 0, len(r.channels))
+	for _, ch := range r.channels {
+		channel := ch
+		channels = append(channels, &channel)
+	}
+	hook := r.onFindAll
+	r.mu.Unlock()
+
+	if hook != nil {
+		hook()
+	}
+	return channels, nil
+}
+
+// setOnFindAll 设置 FindAll 返回前的回调
+func (r *memChannelRepo) setOnFindAll(hook func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onFindAll = hook
+}
+
+func (r *memChannelRepo) Update(ctx context.Context, channel *models.Channel) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.channels {
+		if r.channels[i].ID == channel.ID {
+			r.channels[i] = *channel
+		}
+	}
+	return nil
+}
+
+// queryCount 返回数据库查询次数
+func (r *memChannelRepo) queryCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.queries
+}
+
+// newTestRedis 创建基于 miniredis 的 Redis 客户端,测试结束时自动关闭
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return server, client
+}
+
+func TestChannelCacheSnapshotIsCopy(t *testing.T) {
+	_, client := newTestRedis(t)
+	repo := &memChannelRepo{channels: []models.Channel{
+		{ID: "ch-1", Name: "primary", IsActive: true},
+		{ID: "ch-2", Name: "backup", IsActive: false},
+	}}
+	cache := NewChannelCache(repo, client, time.Hour)
+	ctx := context.Background()
+
+	if err := cache.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	channels, err := cache.FindAll(ctx)
+	if err != nil || len(channels) != 2 {
+		t.Fatalf("FindAll() = %v, %v", channels, err)
+	}
+	// 修改返回的渠道不影响缓存
+	channels[0].Name = "modified"
+	channels[0].Models = []string{"gpt-4o"}
+
+	channel, err := cache.FindByID(ctx, "ch-1")
+	if err != nil || channel.Name != "primary" || len(channel.Models) != 0 {
+		t.Fatalf("FindByID() = %+v, %v; want the cached channel unchanged", channel, err)
+	}
+	if active, _ := cache.FindActive(ctx); len(active) != 1 || active[0].ID != "ch-1" {
+		t.Fatalf("FindActive() = %v, want only ch-1", active)
+	}
+	// 读操作不查询数据库
+	if queries := repo.queryCount(); queries != 1 {
+		t.Fatalf("database queried %d times, want only the initial load", queries)
+	}
+}
+
+func TestChannelCacheNotLoaded(t *testing.T) {
+	_, client := newTestRedis(t)
+	repo := &memChannelRepo{channels: []models.Channel{{ID: "ch-1", IsActive: true}}}
+	cache := NewChannelCache(repo, client, time.Hour)
+
+	// 缓存尚未加载时直接查询数据库
+	if channels, err := cache.FindAll(context.Background()); err != nil || len(channels) != 1 || repo.queryCount() != 1 {
+		t.Fatalf("FindAll() = %v, %v after %d queries", channels, err, repo.queryCount())
+	}
+}
+
+func TestChannelCacheInvalidationPropagates(t *testing.T) {
+	server, client := newTestRedis(t)
+	repo := &memChannelRepo{channels: []models.Channel{{ID: "ch-1", Name: "before", IsActive: true}}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// 两个实例共享同一数据库与 Redis
+	writer := NewChannelCache(repo, client, time.Hour)
+	reader := NewChannelCache(repo, client, time.Hour)
+	for _, cache := range []*ChannelCache{writer, reader} {
+		if err := cache.Refresh(ctx); err != nil {
+			t.Fatalf("Refresh: %v", err)
+		}
+	}
+	go reader.Start(ctx)
+	waitFor(t, func() bool { return server.PubSubNumSub(channelInvalidateChannel)[channelInvalidateChannel] == 1 })
+
+	if err := writer.Update(ctx, &models.Channel{ID: "ch-1", Name: "after", IsActive: true}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	// 写入的实例立即刷新,其他实例收到通知后刷新
+	if channel, _ := writer.FindByID(ctx, "ch-1"); channel.Name != "after" {
+		t.Fatalf("writer FindByID() = %+v, want refreshed immediately", channel)
+	}
+	waitFor(t, func() bool {
+		channel, _ := reader.FindByID(ctx, "ch-1")
+		return channel.Name == "after"
+	})
+}
+
+func TestChannelCacheConcurrentRefreshKeepsLatest(t *testing.T) {
+	_, client := newTestRedis(t)
+	repo := &memChannelRepo{channels: []models.Channel{{ID: "ch-1", Name: "before", IsActive: true}}}
+	cache := NewChannelCache(repo, client, time.Hour)
+	ctx := context.Background()
+
+	// 第一次刷新读到旧数据后暂停
+	entered := make(chan struct{})
+	resume := make(chan struct{})
+	repo.setOnFindAll(func() {
+		close(entered)
+		<-resume
+	})
+	first := make(chan error, 1)
+	go func() { first <- cache.Refresh(ctx) }()
+	<-entered
+
+	// 数据变更后开始第二次刷新
+	repo.setOnFindAll(nil)
+	repo.Update(ctx, &models.Channel{ID: "ch-1", Name: "after", IsActive: true})
+	second := make(chan error, 1)
+	go func() { second <- cache.Refresh(ctx) }()
+	select {
+	case err := <-second:
+		second <- err
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(resume)
+	if err := <-first; err != nil {
+		t.Fatalf("first Refresh: %v", err)
+	}
+	if err := <-second; err != nil {
+		t.Fatalf("second Refresh: %v", err)
+	}
+	// 先开始的刷新不会用旧数据覆盖后开始的刷新
+	if channel, _ := cache.FindByID(ctx, "ch-1"); channel.Name != "after" {
+		t.Fatalf("FindByID() = %+v, want the latest channel", channel)
+	}
+}
+
+// waitFor 等待条件成立,超时则测试失败
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before timeout")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
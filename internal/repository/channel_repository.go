@@ -2,8 +2,12 @@ package repository
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/869413421/transit/internal/models"
+	"github.com/869413421/transit/pkg/secret"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -15,47 +19,43 @@ type ChannelRepository interface {
 	FindActive(ctx context.Context) ([]*models.Channel, error)
 	Update(ctx context.Context, channel *models.Channel) error
 	Delete(ctx context.Context, id string) error
+	AddKey(ctx context.Context, key *models.ChannelKey) error
+	UpdateKey(ctx context.Context, key *models.ChannelKey) error
+	DeleteKey(ctx context.Context, channelID, keyID string) error
+	ReencryptKeys(ctx context.Context) (int, error)
 }
 
 type channelRepository struct {
-	db *pgxpool.Pool
+	db     *pgxpool.Pool
+	cipher *secret.Cipher // 渠道密钥落库前加密,读取后解密
 }
 
 // NewChannelRepository 创建渠道仓储
-func NewChannelRepository(db *pgxpool.Pool) ChannelRepository {
-	return &channelRepository{db: db}
+func NewChannelRepository(db *pgxpool.Pool, cipher *secret.Cipher) ChannelRepository {
+	return &channelRepository{db: db, cipher: cipher}
 }
 
-func (r *channelRepository) Create(ctx context.Context, channel *models.Channel) error {
-	query := `
-		INSERT INTO channels (id, name, secret_key, base_url, max_concurrency, weight, is_active, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-	`
-	_, err := r.db.Exec(ctx, query,
-		channel.ID,
-		channel.Name,
-		channel.SecretKey,
-		channel.BaseURL,
-		channel.MaxConcurrency,
-		channel.Weight,
-		channel.IsActive,
-		channel.CreatedAt,
-		channel.UpdatedAt,
-	)
-	return err
-}
+// channelColumns 渠道查询字段,顺序与 scanChannel 一致
+const channelColumns = `id, name, base_url, provider, models, model_mapping, max_concurrency, current_concurrency, weight, priority, key_strategy, is_active, created_at, updated_at`
 
-func (r *channelRepository) FindByID(ctx context.Context, id string) (*models.Channel, error) {
+// channelKeyColumns 渠道密钥查询字段
+const channelKeyColumns = `id, channel_id, secret_key, is_active, disabled_reason, created_at, updated_at`
+
+// scanChannel 按 channelColumns 的顺序读取一行渠道记录
+func scanChannel(row pgx.Row) (*models.Channel, error) {
 	var channel models.Channel
-	query := `SELECT id, name, secret_key, base_url, max_concurrency, current_concurrency, weight, is_active, created_at, updated_at FROM channels WHERE id = $1`
-	err := r.db.QueryRow(ctx, query, id).Scan(
+	err := row.Scan(
 		&channel.ID,
 		&channel.Name,
-		&channel.SecretKey,
 		&channel.BaseURL,
+		&channel.Provider,
+		&channel.Models,
+		&channel.ModelMapping,
 		&channel.MaxConcurrency,
 		&channel.CurrentConcurrency,
 		&channel.Weight,
+		&channel.Priority,
+		&channel.KeyStrategy,
 		&channel.IsActive,
 		&channel.CreatedAt,
 		&channel.UpdatedAt,
@@ -63,9 +63,9 @@ func (r *channelRepository) FindByID(ctx context.Context, id string) (*models.Ch
 	return &channel, err
 }
 
-func (r *channelRepository) FindAll(ctx context.Context) ([]*models.Channel, error) {
-	query := `SELECT id, name, secret_key, base_url, max_concurrency, current_concurrency, weight, is_active, created_at, updated_at FROM channels`
-	rows, err := r.db.Query(ctx, query)
+// queryChannels 查询多行渠道记录
+func (r *channelRepository) queryChannels(ctx context.Context, query string, args ...interface{}) ([]*models.Channel, error) {
+	rows, err := r.db.Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -73,70 +73,137 @@ func (r *channelRepository) FindAll(ctx context.Context) ([]*models.Channel, err
 
 	var channels []*models.Channel
 	for rows.Next() {
-		var channel models.Channel
-		if err := rows.Scan(
-			&channel.ID,
-			&channel.Name,
-			&channel.SecretKey,
-			&channel.BaseURL,
-			&channel.MaxConcurrency,
-			&channel.CurrentConcurrency,
-			&channel.Weight,
-			&channel.IsActive,
-			&channel.CreatedAt,
-			&channel.UpdatedAt,
-		); err != nil {
+		channel, err := scanChannel(rows)
+		if err != nil {
 			return nil, err
 		}
-		channels = append(channels, &channel)
+		channels = append(channels, channel)
 	}
-	return channels, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return channels, r.attachKeys(ctx, channels...)
 }
 
-func (r *channelRepository) FindActive(ctx context.Context) ([]*models.Channel, error) {
-	query := `SELECT id, name, secret_key, base_url, max_concurrency, current_concurrency, weight, is_active, created_at, updated_at FROM channels WHERE is_active = true`
-	rows, err := r.db.Query(ctx, query)
+// attachKeys 一次查询加载渠道的全部密钥
+func (r *channelRepository) attachKeys(ctx context.Context, channels ...*models.Channel) error {
+	if len(channels) == 0 {
+		return nil
+	}
+
+	byID := make(map[string]*models.Channel, len(channels))
+	ids := make([]string, 0, len(channels))
+	for _, ch := range channels {
+		byID[ch.ID] = ch
+		ids = append(ids, ch.ID)
+	}
+
+	query := `SELECT ` + channelKeyColumns + ` FROM channel_keys WHERE channel_id = ANY($1) ORDER BY created_at, id`
+	rows, err := r.db.Query(ctx, query, ids)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
 
-	var channels []*models.Channel
 	for rows.Next() {
-		var channel models.Channel
+		var key models.ChannelKey
 		if err := rows.Scan(
-			&channel.ID,
-			&channel.Name,
-			&channel.SecretKey,
-			&channel.BaseURL,
-			&channel.MaxConcurrency,
-			&channel.CurrentConcurrency,
-			&channel.Weight,
-			&channel.IsActive,
-			&channel.CreatedAt,
-			&channel.UpdatedAt,
+			&key.ID,
+			&key.ChannelID,
+			&key.SecretKey,
+			&key.IsActive,
+			&key.DisabledReason,
+			&key.CreatedAt,
+			&key.UpdatedAt,
 		); err != nil {
-			return nil, err
+			return err
+		}
+		plaintext, err := r.cipher.Decrypt(key.SecretKey)
+		if err != nil {
+			return fmt.Errorf("channel key %s: %w", key.ID, err)
+		}
+		key.SecretKey = plaintext
+		if ch, ok := byID[key.ChannelID]; ok {
+			ch.Keys = append(ch.Keys, key)
 		}
-		channels = append(channels, &channel)
 	}
-	return channels, rows.Err()
+	return rows.Err()
+}
+
+func (r *channelRepository) Create(ctx context.Context, channel *models.Channel) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		INSERT INTO channels (id, name, base_url, provider, models, model_mapping, max_concurrency, weight, priority, key_strategy, is_active, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	`
+	if _, err := tx.Exec(ctx, query,
+		channel.ID,
+		channel.Name,
+		channel.BaseURL,
+		channel.Provider,
+		nonNilStrings(channel.Models),
+		modelMapping(channel.ModelMapping),
+		channel.MaxConcurrency,
+		channel.Weight,
+		channel.Priority,
+		channel.KeyStrategy,
+		channel.IsActive,
+		channel.CreatedAt,
+		channel.UpdatedAt,
+	); err != nil {
+		return err
+	}
+
+	for i := range channel.Keys {
+		if err := r.insertKey(ctx, tx, &channel.Keys[i]); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+func (r *channelRepository) FindByID(ctx context.Context, id string) (*models.Channel, error) {
+	query := `SELECT ` + channelColumns + ` FROM channels WHERE id = $1`
+	channel, err := scanChannel(r.db.QueryRow(ctx, query, id))
+	if err != nil {
+		return nil, err
+	}
+	return channel, r.attachKeys(ctx, channel)
+}
+
+func (r *channelRepository) FindAll(ctx context.Context) ([]*models.Channel, error) {
+	query := `SELECT ` + channelColumns + ` FROM channels`
+	return r.queryChannels(ctx, query)
+}
+
+func (r *channelRepository) FindActive(ctx context.Context) ([]*models.Channel, error) {
+	query := `SELECT ` + channelColumns + ` FROM channels WHERE is_active = true`
+	return r.queryChannels(ctx, query)
 }
 
 func (r *channelRepository) Update(ctx context.Context, channel *models.Channel) error {
 	query := `
 		UPDATE channels 
-		SET name = $2, secret_key = $3, base_url = $4, max_concurrency = $5, 
-		    weight = $6, is_active = $7, updated_at = $8
+		SET name = $2, base_url = $3, provider = $4, models = $5, model_mapping = $6,
+		    max_concurrency = $7, weight = $8, priority = $9, key_strategy = $10, is_active = $11, updated_at = $12
 		WHERE id = $1
 	`
 	_, err := r.db.Exec(ctx, query,
 		channel.ID,
 		channel.Name,
-		channel.SecretKey,
 		channel.BaseURL,
+		channel.Provider,
+		nonNilStrings(channel.Models),
+		modelMapping(channel.ModelMapping),
 		channel.MaxConcurrency,
 		channel.Weight,
+		channel.Priority,
+		channel.KeyStrategy,
 		channel.IsActive,
 		channel.UpdatedAt,
 	)
@@ -148,3 +215,114 @@ func (r *channelRepository) Delete(ctx context.Context, id string) error {
 	_, err := r.db.Exec(ctx, query, id)
 	return err
 }
+
+func (r *channelRepository) AddKey(ctx context.Context, key *models.ChannelKey) error {
+	return r.insertKey(ctx, r.db, key)
+}
+
+func (r *channelRepository) UpdateKey(ctx context.Context, key *models.ChannelKey) error {
+	encrypted, err := r.cipher.Encrypt(key.SecretKey)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE channel_keys
+		SET secret_key = $3, is_active = $4, disabled_reason = $5, updated_at = $6
+		WHERE id = $1 AND channel_id = $2
+	`
+	_, err = r.db.Exec(ctx, query,
+		key.ID,
+		key.ChannelID,
+		encrypted,
+		key.IsActive,
+		key.DisabledReason,
+		key.UpdatedAt,
+	)
+	return err
+}
+
+func (r *channelRepository) DeleteKey(ctx context.Context, channelID, keyID string) error {
+	query := `DELETE FROM channel_keys WHERE id = $1 AND channel_id = $2`
+	_, err := r.db.Exec(ctx, query, keyID, channelID)
+	return err
+}
+
+// ReencryptKeys 用当前主密钥重新加密明文或由历史主密钥加密的渠道密钥,返回重新加密的数量
+// 未配置当前主密钥时,把可由历史主密钥解密的密文还原为明文
+func (r *channelRepository) ReencryptKeys(ctx context.Context) (int, error) {
+	rows, err := r.db.Query(ctx, `SELECT id, secret_key FROM channel_keys`)
+	if err != nil {
+		return 0, err
+	}
+	stale := make(map[string]string)
+	for rows.Next() {
+		var id, value string
+		if err := rows.Scan(&id, &value); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if r.cipher.NeedsRotation(value) {
+			stale[id] = value
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for id, value := range stale {
+		plaintext, err := r.cipher.Decrypt(value)
+		if err != nil {
+			return 0, fmt.Errorf("channel key %s: %w", id, err)
+		}
+		encrypted, err := r.cipher.Encrypt(plaintext)
+		if err != nil {
+			return 0, err
+		}
+		// 仅在值未被并发修改时覆盖
+		if _, err := r.db.Exec(ctx,
+			`UPDATE channel_keys SET secret_key = $2 WHERE id = $1 AND secret_key = $3`,
+			id, encrypted, value,
+		); err != nil {
+			return 0, err
+		}
+	}
+	return len(stale), nil
+}
+
+// execer 可执行写入语句的连接池或事务
+type execer interface {
+	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+}
+
+// insertKey 加密并写入一个渠道密钥
+func (r *channelRepository) insertKey(ctx context.Context, db execer, key *models.ChannelKey) error {
+	encrypted, err := r.cipher.Encrypt(key.SecretKey)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO channel_keys (id, channel_id, secret_key, is_active, disabled_reason, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err = db.Exec(ctx, query,
+		key.ID,
+		key.ChannelID,
+		encrypted,
+		key.IsActive,
+		key.DisabledReason,
+		key.CreatedAt,
+		key.UpdatedAt,
+	)
+	return err
+}
+
+// modelMapping 映射为 nil 时写入空对象
+func modelMapping(mapping map[string]string) map[string]string {
+	if mapping == nil {
+		return map[string]string{}
+	}
+	return mapping
+}
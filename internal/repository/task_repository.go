@@ -2,8 +2,10 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/869413421/transit/internal/models"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -12,7 +14,9 @@ type TaskRepository interface {
 	Create(ctx context.Context, task *models.Task) error
 	FindByID(ctx context.Context, id string) (*models.Task, error)
 	Update(ctx context.Context, task *models.Task) error
+	UpdateLeaseID(ctx context.Context, id, leaseID string) error
 	FindPendingTasks(ctx context.Context, limit int) ([]*models.Task, error)
+	FindLeasedTasks(ctx context.Context) ([]*models.Task, error)
 }
 
 type taskRepository struct {
@@ -26,13 +30,14 @@ func NewTaskRepository(db *pgxpool.Pool) TaskRepository {
 
 func (r *taskRepository) Create(ctx context.Context, task *models.Task) error {
 	query := `
-		INSERT INTO tasks (id, user_id, channel_id, type, model_name, upstream_task_id, status, cost, result_url, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		INSERT INTO tasks (id, user_id, channel_id, lease_id, type, model_name, upstream_task_id, status, cost, result_url, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 	`
 	_, err := r.db.Exec(ctx, query,
 		task.ID,
 		task.UserID,
 		task.ChannelID,
+		task.LeaseID,
 		task.Type,
 		task.ModelName,
 		task.UpstreamTaskID,
@@ -48,13 +53,14 @@ func (r *taskRepository) Create(ctx context.Context, task *models.Task) error {
 func (r *taskRepository) FindByID(ctx context.Context, id string) (*models.Task, error) {
 	var task models.Task
 	query := `
-		SELECT id, user_id, channel_id, type, model_name, upstream_task_id, status, cost, result_url, created_at, updated_at
+		SELECT id, user_id, channel_id, lease_id, type, model_name, upstream_task_id, status, cost, result_url, created_at, updated_at
 		FROM tasks WHERE id = $1
 	`
 	err := r.db.QueryRow(ctx, query, id).Scan(
 		&task.ID,
 		&task.UserID,
 		&task.ChannelID,
+		&task.LeaseID,
 		&task.Type,
 		&task.ModelName,
 		&task.UpstreamTaskID,
@@ -83,9 +89,16 @@ func (r *taskRepository) Update(ctx context.Context, task *models.Task) error {
 	return err
 }
 
+// UpdateLeaseID 更新任务占用的并发位租约,leaseID 为空表示不再占用
+func (r *taskRepository) UpdateLeaseID(ctx context.Context, id, leaseID string) error {
+	query := `UPDATE tasks SET lease_id = $2, updated_at = $3 WHERE id = $1`
+	_, err := r.db.Exec(ctx, query, id, leaseID, time.Now())
+	return err
+}
+
 func (r *taskRepository) FindPendingTasks(ctx context.Context, limit int) ([]*models.Task, error) {
 	query := `
-		SELECT id, user_id, channel_id, type, model_name, upstream_task_id, status, cost, result_url, created_at, updated_at
+		SELECT id, user_id, channel_id, lease_id, type, model_name, upstream_task_id, status, cost, result_url, created_at, updated_at
 		FROM tasks
 		WHERE status = 'running'
 		ORDER BY created_at ASC
@@ -95,6 +108,25 @@ func (r *taskRepository) FindPendingTasks(ctx context.Context, limit int) ([]*mo
 	if err != nil {
 		return nil, err
 	}
+	return scanTasks(rows)
+}
+
+// FindLeasedTasks 查询仍占用并发位租约的运行中任务,不限数量,用于逐个续约
+func (r *taskRepository) FindLeasedTasks(ctx context.Context) ([]*models.Task, error) {
+	query := `
+		SELECT id, user_id, channel_id, lease_id, type, model_name, upstream_task_id, status, cost, result_url, created_at, updated_at
+		FROM tasks
+		WHERE status = 'running' AND lease_id <> ''
+	`
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return scanTasks(rows)
+}
+
+// scanTasks 读取任务查询结果并关闭 rows
+func scanTasks(rows pgx.Rows) ([]*models.Task, error) {
 	defer rows.Close()
 
 	var tasks []*models.Task
@@ -104,6 +136,7 @@ func (r *taskRepository) FindPendingTasks(ctx context.Context, limit int) ([]*mo
 			&task.ID,
 			&task.UserID,
 			&task.ChannelID,
+			&task.LeaseID,
 			&task.Type,
 			&task.ModelName,
 			&task.UpstreamTaskID,
@@ -26,14 +26,15 @@ func NewUserAPIKeyRepository(db *pgxpool.Pool) UserAPIKeyRepository {
 
 func (r *userAPIKeyRepository) Create(ctx context.Context, key *models.UserAPIKey) error {
 	query := `
-		INSERT INTO user_api_keys (id, user_id, api_key, is_active, created_at)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO user_api_keys (id, user_id, api_key, is_active, allowed_models, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
 	`
 	_, err := r.db.Exec(ctx, query,
 		key.ID,
 		key.UserID,
 		key.APIKey,
 		key.IsActive,
+		nonNilStrings(key.AllowedModels),
 		key.CreatedAt,
 	)
 	return err
@@ -41,19 +42,20 @@ func (r *userAPIKeyRepository) Create(ctx context.Context, key *models.UserAPIKe
 
 func (r *userAPIKeyRepository) FindByAPIKey(ctx context.Context, apiKey string) (*models.UserAPIKey, error) {
 	var key models.UserAPIKey
-	query := `SELECT id, user_id, api_key, is_active, created_at FROM user_api_keys WHERE api_key = $1`
+	query := `SELECT id, user_id, api_key, is_active, allowed_models, created_at FROM user_api_keys WHERE api_key = $1`
 	err := r.db.QueryRow(ctx, query, apiKey).Scan(
 		&key.ID,
 		&key.UserID,
 		&key.APIKey,
 		&key.IsActive,
+		&key.AllowedModels,
 		&key.CreatedAt,
 	)
 	return &key, err
 }
 
 func (r *userAPIKeyRepository) FindByUserID(ctx context.Context, userID string) ([]*models.UserAPIKey, error) {
-	query := `SELECT id, user_id, api_key, is_active, created_at FROM user_api_keys WHERE user_id = $1 ORDER BY created_at DESC`
+	query := `SELECT id, user_id, api_key, is_active, allowed_models, created_at FROM user_api_keys WHERE user_id = $1 ORDER BY created_at DESC`
 	rows, err := r.db.Query(ctx, query, userID)
 	if err != nil {
 		return nil, err
@@ -63,7 +65,7 @@ func (r *userAPIKeyRepository) FindByUserID(ctx context.Context, userID string)
 	var keys []*models.UserAPIKey
 	for rows.Next() {
 		var key models.UserAPIKey
-		if err := rows.Scan(&key.ID, &key.UserID, &key.APIKey, &key.IsActive, &key.CreatedAt); err != nil {
+		if err := rows.Scan(&key.ID, &key.UserID, &key.APIKey, &key.IsActive, &key.AllowedModels, &key.CreatedAt); err != nil {
 			return nil, err
 		}
 		keys = append(keys, &key)
@@ -76,3 +78,11 @@ func (r *userAPIKeyRepository) Delete(ctx context.Context, id string) error {
 	_, err := r.db.Exec(ctx, query, id)
 	return err
 }
+
+// nonNilStrings 字符串数组为 nil 时写入空数组,避免违反 NOT NULL 约束
+func nonNilStrings(names []string) []string {
+	if names == nil {
+		return []string{}
+	}
+	return names
+}
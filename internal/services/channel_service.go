@@ -11,9 +11,14 @@ import (
 // ChannelService 渠道服务接口
 type ChannelService interface {
 	Create(ctx context.Context, channel *models.Channel) error
+	Get(ctx context.Context, id string) (*models.Channel, error)
+	Update(ctx context.Context, channel *models.Channel) error
 	GetAll(ctx context.Context) ([]*models.Channel, error)
 	GetAllWithConcurrency(ctx context.Context) ([]*models.Channel, error)
 	Delete(ctx context.Context, id string) error
+	AddKey(ctx context.Context, key *models.ChannelKey) error
+	UpdateKey(ctx context.Context, key *models.ChannelKey) error
+	DeleteKey(ctx context.Context, channelID, keyID string) error
 }
 
 type channelService struct {
@@ -33,6 +38,14 @@ func (s *channelService) Create(ctx context.Context, channel *models.Channel) er
 	return s.repo.Create(ctx, channel)
 }
 
+func (s *channelService) Get(ctx context.Context, id string) (*models.Channel, error) {
+	return s.repo.FindByID(ctx, id)
+}
+
+func (s *channelService) Update(ctx context.Context, channel *models.Channel) error {
+	return s.repo.Update(ctx, channel)
+}
+
 func (s *channelService) GetAll(ctx context.Context) ([]*models.Channel, error) {
 	return s.repo.FindAll(ctx)
 }
@@ -43,10 +56,16 @@ func (s *channelService) GetAllWithConcurrency(ctx context.Context) ([]*models.C
 		return nil, err
 	}
 
-	// 获取实时并发数
+	// 获取实时并发数与有效并发上限
 	for i := range channels {
 		concurrency, _ := s.pool.GetConcurrency(ctx, channels[i].ID)
 		channels[i].CurrentConcurrency = concurrency
+
+		limit, err := s.pool.EffectiveLimit(ctx, channels[i].ID, channels[i].MaxConcurrency)
+		if err != nil {
+			limit = channels[i].MaxConcurrency
+		}
+		channels[i].ConcurrencyLimit = limit
 	}
 
 	return channels, nil
@@ -55,3 +74,15 @@ func (s *channelService) GetAllWithConcurrency(ctx context.Context) ([]*models.C
 func (s *channelService) Delete(ctx context.Context, id string) error {
 	return s.repo.Delete(ctx, id)
 }
+
+func (s *channelService) AddKey(ctx context.Context, key *models.ChannelKey) error {
+	return s.repo.AddKey(ctx, key)
+}
+
+func (s *channelService) UpdateKey(ctx context.Context, key *models.ChannelKey) error {
+	return s.repo.UpdateKey(ctx, key)
+}
+
+func (s *channelService) DeleteKey(ctx context.Context, channelID, keyID string) error {
+	return s.repo.DeleteKey(ctx, channelID, keyID)
+}
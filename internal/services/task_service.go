@@ -13,10 +13,13 @@ import (
 
 // TaskService 任务服务接口
 type TaskService interface {
-	CreateTask(ctx context.Context, userID, channelID, taskType, modelName, upstreamTaskID string, cost float64) (*models.Task, error)
+	CreateTask(ctx context.Context, userID, channelID, leaseID, taskType, modelName, upstreamTaskID string, cost float64) (*models.Task, error)
+	CreateCompletedTask(ctx context.Context, userID, channelID, modelName, resultURL string, cost float64) (*models.Task, error)
 	GetTask(ctx context.Context, taskID string) (*models.Task, error)
 	UpdateTaskStatus(ctx context.Context, taskID, status, resultURL string) error
+	UpdateTaskLease(ctx context.Context, taskID, leaseID string) error
 	GetPendingTasks(ctx context.Context, limit int) ([]*models.Task, error)
+	GetLeasedTasks(ctx context.Context) ([]*models.Task, error)
 }
 
 type taskService struct {
@@ -30,12 +33,13 @@ func NewTaskService(taskRepo repository.TaskRepository) TaskService {
 	}
 }
 
-func (s *taskService) CreateTask(ctx context.Context, userID, channelID, taskType, modelName, upstreamTaskID string, cost float64) (*models.Task, error) {
+func (s *taskService) CreateTask(ctx context.Context, userID, channelID, leaseID, taskType, modelName, upstreamTaskID string, cost float64) (*models.Task, error) {
 	now := time.Now()
 	task := &models.Task{
 		ID:             uuid.New().String(),
 		UserID:         userID,
 		ChannelID:      channelID,
+		LeaseID:        leaseID,
 		Type:           taskType,
 		ModelName:      modelName,
 		UpstreamTaskID: upstreamTaskID,
@@ -59,6 +63,35 @@ func (s *taskService) CreateTask(ctx context.Context, userID, channelID, taskTyp
 	return task, nil
 }
 
+// CreateCompletedTask 记录同步返回结果的任务,直接置为已完成,无需轮询
+func (s *taskService) CreateCompletedTask(ctx context.Context, userID, channelID, modelName, resultURL string, cost float64) (*models.Task, error) {
+	now := time.Now()
+	task := &models.Task{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		ChannelID: channelID,
+		Type:      "sync",
+		ModelName: modelName,
+		Status:    "completed",
+		Cost:      cost,
+		ResultURL: resultURL,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := s.taskRepo.Create(ctx, task); err != nil {
+		logger.Error("Failed to create completed task", zap.Error(err))
+		return nil, err
+	}
+
+	logger.Info("Completed task created",
+		zap.String("task_id", task.ID),
+		zap.String("model", modelName),
+	)
+
+	return task, nil
+}
+
 func (s *taskService) GetTask(ctx context.Context, taskID string) (*models.Task, error) {
 	return s.taskRepo.FindByID(ctx, taskID)
 }
@@ -89,6 +122,14 @@ func (s *taskService) UpdateTaskStatus(ctx context.Context, taskID, status, resu
 	return nil
 }
 
+func (s *taskService) UpdateTaskLease(ctx context.Context, taskID, leaseID string) error {
+	return s.taskRepo.UpdateLeaseID(ctx, taskID, leaseID)
+}
+
 func (s *taskService) GetPendingTasks(ctx context.Context, limit int) ([]*models.Task, error) {
 	return s.taskRepo.FindPendingTasks(ctx, limit)
 }
+
+func (s *taskService) GetLeasedTasks(ctx context.Context) ([]*models.Task, error) {
+	return s.taskRepo.FindLeasedTasks(ctx)
+}
@@ -61,6 +61,16 @@ func (s *Service) PostDeduct(ctx context.Context, userID string, tokens int, pri
 	return s.redis.IncrByFloat(ctx, balanceKey, -cost).Err()
 }
 
+// Deduct 按已计算的金额后扣费（同步任务：文本，含多项计费）
+func (s *Service) Deduct(ctx context.Context, userID string, amount float64) error {
+	if amount <= 0 {
+		return nil
+	}
+
+	balanceKey := fmt.Sprintf("transit:user:%s:balance", userID)
+	return s.redis.IncrByFloat(ctx, balanceKey, -amount).Err()
+}
+
 // Refund 退费（任务失败）
 func (s *Service) Refund(ctx context.Context, userID string, amount float64) error {
 	if amount <= 0 {
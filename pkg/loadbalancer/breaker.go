@@ -0,0 +1,185 @@
+package loadbalancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/869413421/transit/pkg/upstream"
+	"github.com/go-redis/redis/v8"
+)
+
+// 熔断器状态
+const (
+	BreakerClosed   = "closed"    // 正常放行
+	BreakerOpen     = "open"      // 熔断中,冷却期内不参与选择
+	BreakerHalfOpen = "half_open" // 冷却结束,仅放行有限的探测请求
+)
+
+// CircuitBreaker 渠道熔断器
+// 状态保存在 Redis 中,所有 Transit 实例共享;连续失败达到阈值后熔断,
+// 冷却期结束进入半开状态放行少量探测请求,探测成功则恢复,失败则重新熔断
+type CircuitBreaker struct {
+	client           *redis.Client
+	failureThreshold int           // 触发熔断的连续失败次数,小于等于 0 时不启用
+	cooldown         time.Duration // 熔断冷却时间
+	halfOpenProbes   int           // 半开状态下允许的探测请求数
+}
+
+// NewCircuitBreaker 创建渠道熔断器
+func NewCircuitBreaker(client *redis.Client, failureThreshold int, cooldown time.Duration, halfOpenProbes int) *CircuitBreaker {
+	if halfOpenProbes <= 0 {
+		halfOpenProbes = 1
+	}
+	return &CircuitBreaker{
+		client:           client,
+		failureThreshold: failureThreshold,
+		cooldown:         cooldown,
+		halfOpenProbes:   halfOpenProbes,
+	}
+}
+
+// BreakerState 渠道熔断状态
+type BreakerState struct {
+	State     string     `json:"state"`
+	Failures  int        `json:"failures"`             // 当前连续失败次数
+	OpenUntil *time.Time `json:"open_until,omitempty"` // 熔断或探测窗口的截止时间
+}
+
+// Lua 脚本：判断是否放行请求
+// 熔断冷却结束后转为半开状态,半开状态下在探测窗口内最多放行 ARGV[3] 个请求;
+// 探测窗口超时未收到结果时重新开始计数,避免探测请求丢失导致渠道永久半开
+const luaBreakerAllow = `
+local state = redis.call('HGET', KEYS[1], 'state')
+if not state or state == 'closed' then
+    return 1
+end
+local now = tonumber(ARGV[1])
+local until_ms = tonumber(redis.call('HGET', KEYS[1], 'until') or "0")
+if state == 'open' then
+    if now < until_ms then
+        return 0
+    end
+    redis.call('HSET', KEYS[1], 'state', 'half_open', 'probes', 0, 'until', now + tonumber(ARGV[2]))
+elseif now >= until_ms then
+    redis.call('HSET', KEYS[1], 'probes', 0, 'until', now + tonumber(ARGV[2]))
+end
+local probes = tonumber(redis.call('HGET', KEYS[1], 'probes') or "0")
+if probes < tonumber(ARGV[3]) then
+    redis.call('HINCRBY', KEYS[1], 'probes', 1)
+    return 1
+end
+return 0
+`
+
+// Lua 脚本：记录一次失败
+// 关闭状态下连续失败达到阈值,或半开状态下探测失败时熔断
+const luaBreakerFailure = `
+local state = redis.call('HGET', KEYS[1], 'state') or 'closed'
+local failures = redis.call('HINCRBY', KEYS[1], 'failures', 1)
+if state == 'half_open' or (state == 'closed' and failures >= tonumber(ARGV[3])) then
+    redis.call('HSET', KEYS[1], 'state', 'open', 'until', tonumber(ARGV[1]) + tonumber(ARGV[2]), 'probes', 0)
+    return 1
+end
+return 0
+`
+
+// Allow 判断渠道当前是否可以接收请求,半开状态下会占用一个探测名额
+func (b *CircuitBreaker) Allow(ctx context.Context, channelID string) (bool, error) {
+	if b.failureThreshold <= 0 {
+		return true, nil
+	}
+
+	res, err := b.client.Eval(ctx, luaBreakerAllow, []string{breakerKey(channelID)},
+		time.Now().UnixMilli(), b.cooldown.Milliseconds(), b.halfOpenProbes,
+	).Result()
+	if err != nil {
+		return false, err
+	}
+	return res.(int64) == 1, nil
+}
+
+// RecordSuccess 记录一次成功,清空连续失败计数并恢复为关闭状态
+func (b *CircuitBreaker) RecordSuccess(ctx context.Context, channelID string) error {
+	if b.failureThreshold <= 0 {
+		return nil
+	}
+	return b.client.Del(ctx, breakerKey(channelID)).Err()
+}
+
+// RecordFailure 记录一次失败,返回本次失败是否触发熔断
+func (b *CircuitBreaker) RecordFailure(ctx context.Context, channelID string) (bool, error) {
+	if b.failureThreshold <= 0 {
+		return false, nil
+	}
+
+	res, err := b.client.Eval(ctx, luaBreakerFailure, []string{breakerKey(channelID)},
+		time.Now().UnixMilli(), b.cooldown.Milliseconds(), b.failureThreshold,
+	).Result()
+	if err != nil {
+		return false, err
+	}
+	return res.(int64) == 1, nil
+}
+
+// IsOpen 判断渠道是否处于熔断冷却期内,不占用半开状态的探测名额
+func (b *CircuitBreaker) IsOpen(ctx context.Context, channelID string) (bool, error) {
+	if b.failureThreshold <= 0 {
+		return false, nil
+	}
+
+	state, err := b.State(ctx, channelID)
+	if err != nil {
+		return false, err
+	}
+	return state.State == BreakerOpen && state.OpenUntil != nil && time.Now().Before(*state.OpenUntil), nil
+}
+
+// State 查询渠道熔断状态
+func (b *CircuitBreaker) State(ctx context.Context, channelID string) (*BreakerState, error) {
+	fields, err := b.client.HGetAll(ctx, breakerKey(channelID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	state := &BreakerState{State: BreakerClosed}
+	if s, ok := fields["state"]; ok {
+		state.State = s
+	}
+	state.Failures, _ = strconv.Atoi(fields["failures"])
+	if ms, _ := strconv.ParseInt(fields["until"], 10, 64); ms > 0 && state.State != BreakerClosed {
+		until := time.UnixMilli(ms)
+		state.OpenUntil = &until
+	}
+	return state, nil
+}
+
+// IsChannelFailure 判断上游错误是否应计入渠道熔断
+// 服务端错误、限流、鉴权失败(Key 被吊销、额度耗尽)以及超时和连接错误归因于渠道,
+// 其余 4xx 通常是请求本身的问题,不计入
+func IsChannelFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var apiErr *upstream.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case 401, 402, 403, 429:
+			return true
+		default:
+			return apiErr.StatusCode >= 500
+		}
+	}
+
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// breakerKey 熔断状态的 Redis 键
+func breakerKey(channelID string) string {
+	return fmt.Sprintf("transit:channel:%s:breaker", channelID)
+}
@@ -0,0 +1,182 @@
+package loadbalancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/869413421/transit/pkg/upstream"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// newTestRedis 创建基于 miniredis 的 Redis 客户端,测试结束时自动关闭
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return server, client
+}
+
+// expireBreakerWindow 将熔断或探测窗口的截止时间改到过去,模拟冷却结束
+func expireBreakerWindow(t *testing.T, server *miniredis.Miniredis, channelID string) {
+	t.Helper()
+	past := strconv.FormatInt(time.Now().Add(-time.Second).UnixMilli(), 10)
+	server.HSet(breakerKey(channelID), "until", past)
+}
+
+func TestCircuitBreakerOpensAfterThreshold(t *testing.T) {
+	_, client := newTestRedis(t)
+	breaker := NewCircuitBreaker(client, 3, time.Minute, 1)
+	ctx := context.Background()
+
+	for i := 1; i <= 3; i++ {
+		opened, err := breaker.RecordFailure(ctx, "ch0")
+		if err != nil {
+			t.Fatalf("RecordFailure: %v", err)
+		}
+		if opened != (i == 3) {
+			t.Fatalf("failure %d opened = %v", i, opened)
+		}
+	}
+
+	if allowed, _ := breaker.Allow(ctx, "ch0"); allowed {
+		t.Fatal("open breaker allowed a request")
+	}
+	state, err := breaker.State(ctx, "ch0")
+	if err != nil {
+		t.Fatalf("State: %v", err)
+	}
+	if state.State != BreakerOpen || state.Failures != 3 || state.OpenUntil == nil || time.Until(*state.OpenUntil) <= 0 {
+		t.Fatalf("State() = %+v", state)
+	}
+
+	// 其他渠道不受影响
+	if allowed, _ := breaker.Allow(ctx, "ch1"); !allowed {
+		t.Fatal("unrelated channel was rejected")
+	}
+}
+
+func TestCircuitBreakerSuccessResetsFailures(t *testing.T) {
+	_, client := newTestRedis(t)
+	breaker := NewCircuitBreaker(client, 2, time.Minute, 1)
+	ctx := context.Background()
+
+	breaker.RecordFailure(ctx, "ch0")
+	if err := breaker.RecordSuccess(ctx, "ch0"); err != nil {
+		t.Fatalf("RecordSuccess: %v", err)
+	}
+	// 失败需要连续发生才会熔断
+	if opened, _ := breaker.RecordFailure(ctx, "ch0"); opened {
+		t.Fatal("breaker opened although failures were not consecutive")
+	}
+	if state, _ := breaker.State(ctx, "ch0"); state.State != BreakerClosed || state.Failures != 1 || state.OpenUntil != nil {
+		t.Fatalf("State() = %+v", state)
+	}
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	server, client := newTestRedis(t)
+	breaker := NewCircuitBreaker(client, 1, time.Minute, 2)
+	ctx := context.Background()
+
+	breaker.RecordFailure(ctx, "ch0")
+	expireBreakerWindow(t, server, "ch0")
+
+	// 冷却结束后进入半开状态,仅放行 halfOpenProbes 个探测请求
+	for i := 0; i < 2; i++ {
+		if allowed, err := breaker.Allow(ctx, "ch0"); err != nil || !allowed {
+			t.Fatalf("probe %d allowed = %v, %v", i, allowed, err)
+		}
+	}
+	if allowed, _ := breaker.Allow(ctx, "ch0"); allowed {
+		t.Fatal("half-open breaker allowed more probes than configured")
+	}
+	if state, _ := breaker.State(ctx, "ch0"); state.State != BreakerHalfOpen {
+		t.Fatalf("State() = %+v, want half_open", state)
+	}
+
+	// 探测失败立即重新熔断
+	if opened, _ := breaker.RecordFailure(ctx, "ch0"); !opened {
+		t.Fatal("failed probe did not reopen the breaker")
+	}
+	if state, _ := breaker.State(ctx, "ch0"); state.State != BreakerOpen {
+		t.Fatalf("State() = %+v, want open", state)
+	}
+
+	// 探测成功恢复为关闭状态
+	expireBreakerWindow(t, server, "ch0")
+	breaker.Allow(ctx, "ch0")
+	breaker.RecordSuccess(ctx, "ch0")
+	if state, _ := breaker.State(ctx, "ch0"); state.State != BreakerClosed || state.Failures != 0 {
+		t.Fatalf("State() = %+v, want closed", state)
+	}
+	if allowed, _ := breaker.Allow(ctx, "ch0"); !allowed {
+		t.Fatal("closed breaker rejected a request")
+	}
+}
+
+func TestCircuitBreakerLostProbesExpire(t *testing.T) {
+	server, client := newTestRedis(t)
+	breaker := NewCircuitBreaker(client, 1, time.Minute, 1)
+	ctx := context.Background()
+
+	breaker.RecordFailure(ctx, "ch0")
+	expireBreakerWindow(t, server, "ch0")
+	breaker.Allow(ctx, "ch0")
+	if allowed, _ := breaker.Allow(ctx, "ch0"); allowed {
+		t.Fatal("second probe allowed within the probe window")
+	}
+
+	// 探测窗口超时仍未收到结果时重新放行探测请求
+	expireBreakerWindow(t, server, "ch0")
+	if allowed, _ := breaker.Allow(ctx, "ch0"); !allowed {
+		t.Fatal("probe not allowed after the probe window expired")
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	server, client := newTestRedis(t)
+	breaker := NewCircuitBreaker(client, 0, time.Minute, 1)
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		if opened, err := breaker.RecordFailure(ctx, "ch0"); err != nil || opened {
+			t.Fatalf("RecordFailure() = %v, %v", opened, err)
+		}
+	}
+	if allowed, _ := breaker.Allow(ctx, "ch0"); !allowed {
+		t.Fatal("disabled breaker rejected a request")
+	}
+	if keys := server.Keys(); len(keys) != 0 {
+		t.Fatalf("disabled breaker wrote keys %v", keys)
+	}
+}
+
+func TestIsChannelFailure(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{&upstream.APIError{StatusCode: 400}, false},
+		{&upstream.APIError{StatusCode: 404}, false},
+		{&upstream.APIError{StatusCode: 401}, true},
+		{&upstream.APIError{StatusCode: 402}, true},
+		{&upstream.APIError{StatusCode: 403}, true},
+		{&upstream.APIError{StatusCode: 429}, true},
+		{&upstream.APIError{StatusCode: 502}, true},
+		{fmt.Errorf("send request: %w", &url.Error{Op: "Post", URL: "http://upstream", Err: errors.New("connection refused")}), true},
+		{context.Canceled, false},
+	}
+	for _, tt := range tests {
+		if got := IsChannelFailure(tt.err); got != tt.want {
+			t.Errorf("IsChannelFailure(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package loadbalancer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 渠道健康状态
+const (
+	HealthUnknown   = "unknown"   // 尚未探测
+	HealthHealthy   = "healthy"   // 最近一次探测成功,或连续失败未达到阈值
+	HealthUnhealthy = "unhealthy" // 连续探测失败达到阈值,不参与选择
+)
+
+// HealthTracker 渠道健康状态记录
+// 探测结果保存在 Redis 中,所有 Transit 实例共享;
+// 状态在若干个探测周期内未更新时自动过期,避免停止探测后渠道一直被判定为不健康
+type HealthTracker struct {
+	client             *redis.Client
+	unhealthyThreshold int           // 判定为不健康的连续失败次数
+	ttl                time.Duration // 探测结果的保留时间
+}
+
+// NewHealthTracker 创建健康状态记录器
+// interval 为探测周期,探测结果保留 unhealthyThreshold+1 个周期
+func NewHealthTracker(client *redis.Client, unhealthyThreshold int, interval time.Duration) *HealthTracker {
+	if unhealthyThreshold <= 0 {
+		unhealthyThreshold = 1
+	}
+	return &HealthTracker{
+		client:             client,
+		unhealthyThreshold: unhealthyThreshold,
+		ttl:                interval * time.Duration(unhealthyThreshold+1),
+	}
+}
+
+// ChannelHealth 渠道最近一次探测结果
+type ChannelHealth struct {
+	Status              string     `json:"status"`
+	Model               string     `json:"model,omitempty"`      // 探测使用的模型
+	LatencyMs           int64      `json:"latency_ms"`           // 探测耗时
+	ConsecutiveFailures int        `json:"consecutive_failures"` // 连续失败次数
+	LastError           string     `json:"last_error,omitempty"` // 最近一次失败原因
+	CheckedAt           *time.Time `json:"checked_at,omitempty"` // 最近一次探测时间
+}
+
+// Lua 脚本：记录一次探测结果
+// ARGV[1] 为空表示探测成功,否则为失败原因;连续失败达到阈值后标记为不健康,成功一次即恢复
+const luaHealthRecord = `
+local failures = 0
+local status = 'healthy'
+if ARGV[1] == '' then
+    redis.call('HDEL', KEYS[1], 'last_error')
+else
+    failures = redis.call('HINCRBY', KEYS[1], 'failures', 1)
+    if failures >= tonumber(ARGV[5]) then
+        status = 'unhealthy'
+    end
+    redis.call('HSET', KEYS[1], 'last_error', ARGV[1])
+end
+redis.call('HSET', KEYS[1], 'status', status, 'failures', failures, 'latency_ms', ARGV[2], 'checked_at', ARGV[3], 'model', ARGV[4])
+redis.call('PEXPIRE', KEYS[1], ARGV[6])
+return status == 'unhealthy' and 1 or 0
+`
+
+// Record 记录一次探测结果,返回渠道当前是否不健康
+func (t *HealthTracker) Record(ctx context.Context, channelID, model string, latency time.Duration, probeErr error) (bool, error) {
+	lastError := ""
+	if probeErr != nil {
+		lastError = probeErr.Error()
+	}
+
+	res, err := t.client.Eval(ctx, luaHealthRecord, []string{healthKey(channelID)},
+		lastError, latency.Milliseconds(), time.Now().UnixMilli(), model, t.unhealthyThreshold, t.ttl.Milliseconds(),
+	).Result()
+	if err != nil {
+		return false, err
+	}
+	return res.(int64) == 1, nil
+}
+
+// IsHealthy 判断渠道是否可以参与选择,未探测过的渠道视为健康
+func (t *HealthTracker) IsHealthy(ctx context.Context, channelID string) (bool, error) {
+	status, err := t.client.HGet(ctx, healthKey(channelID), "status").Result()
+	if err == redis.Nil {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return status != HealthUnhealthy, nil
+}
+
+// Health 查询渠道最近一次探测结果
+func (t *HealthTracker) Health(ctx context.Context, channelID string) (*ChannelHealth, error) {
+	fields, err := t.client.HGetAll(ctx, healthKey(channelID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	health := &ChannelHealth{Status: HealthUnknown}
+	if len(fields) == 0 {
+		return health, nil
+	}
+	health.Status = fields["status"]
+	health.Model = fields["model"]
+	health.LastError = fields["last_error"]
+	health.LatencyMs, _ = strconv.ParseInt(fields["latency_ms"], 10, 64)
+	health.ConsecutiveFailures, _ = strconv.Atoi(fields["failures"])
+	if ms, _ := strconv.ParseInt(fields["checked_at"], 10, 64); ms > 0 {
+		checkedAt := time.UnixMilli(ms)
+		health.CheckedAt = &checkedAt
+	}
+	return health, nil
+}
+
+// healthKey 健康状态的 Redis 键
+func healthKey(channelID string) string {
+	return fmt.Sprintf("transit:channel:%s:health", channelID)
+}
@@ -0,0 +1,78 @@
+package loadbalancer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHealthTrackerUnknownChannel(t *testing.T) {
+	_, client := newTestRedis(t)
+	tracker := NewHealthTracker(client, 2, time.Minute)
+	ctx := context.Background()
+
+	if healthy, err := tracker.IsHealthy(ctx, "ch0"); err != nil || !healthy {
+		t.Fatalf("IsHealthy() = %v, %v; want unprobed channel healthy", healthy, err)
+	}
+	if health, err := tracker.Health(ctx, "ch0"); err != nil || health.Status != HealthUnknown || health.CheckedAt != nil {
+		t.Fatalf("Health() = %+v, %v", health, err)
+	}
+}
+
+func TestHealthTrackerThreshold(t *testing.T) {
+	_, client := newTestRedis(t)
+	tracker := NewHealthTracker(client, 2, time.Minute)
+	ctx := context.Background()
+	probeErr := errors.New("upstream returned 502")
+
+	unhealthy, err := tracker.Record(ctx, "ch0", "gpt-4o-mini", 120*time.Millisecond, probeErr)
+	if err != nil || unhealthy {
+		t.Fatalf("first failure: Record() = %v, %v", unhealthy, err)
+	}
+	if healthy, _ := tracker.IsHealthy(ctx, "ch0"); !healthy {
+		t.Fatal("channel unhealthy before reaching the threshold")
+	}
+
+	if unhealthy, _ := tracker.Record(ctx, "ch0", "gpt-4o-mini", 80*time.Millisecond, probeErr); !unhealthy {
+		t.Fatal("channel still healthy after reaching the threshold")
+	}
+	if healthy, _ := tracker.IsHealthy(ctx, "ch0"); healthy {
+		t.Fatal("IsHealthy() = true for an unhealthy channel")
+	}
+
+	health, err := tracker.Health(ctx, "ch0")
+	if err != nil {
+		t.Fatalf("Health: %v", err)
+	}
+	if health.Status != HealthUnhealthy || health.ConsecutiveFailures != 2 || health.LastError != probeErr.Error() ||
+		health.Model != "gpt-4o-mini" || health.LatencyMs != 80 || health.CheckedAt == nil {
+		t.Fatalf("Health() = %+v", health)
+	}
+
+	// 一次成功即恢复并清空失败原因
+	if unhealthy, _ := tracker.Record(ctx, "ch0", "gpt-4o-mini", 50*time.Millisecond, nil); unhealthy {
+		t.Fatal("channel still unhealthy after a successful probe")
+	}
+	health, _ = tracker.Health(ctx, "ch0")
+	if health.Status != HealthHealthy || health.ConsecutiveFailures != 0 || health.LastError != "" {
+		t.Fatalf("Health() after recovery = %+v", health)
+	}
+}
+
+func TestHealthTrackerExpires(t *testing.T) {
+	server, client := newTestRedis(t)
+	tracker := NewHealthTracker(client, 1, 10*time.Second)
+	ctx := context.Background()
+
+	tracker.Record(ctx, "ch0", "m", time.Millisecond, errors.New("timeout"))
+	if ttl := server.TTL(healthKey("ch0")); ttl != 20*time.Second {
+		t.Fatalf("TTL = %v, want threshold+1 probe intervals", ttl)
+	}
+
+	// 停止探测后状态过期,渠道重新视为健康
+	server.FastForward(21 * time.Second)
+	if healthy, _ := tracker.IsHealthy(ctx, "ch0"); !healthy {
+		t.Fatal("channel still unhealthy after the health state expired")
+	}
+}
@@ -0,0 +1,188 @@
+package loadbalancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/869413421/transit/internal/models"
+	"github.com/869413421/transit/internal/repository"
+	"github.com/869413421/transit/pkg/logger"
+	"github.com/869413421/transit/pkg/upstream"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// 渠道密钥选择方式
+const (
+	KeyStrategyRoundRobin = "round_robin" // 依次轮换
+	KeyStrategyLeastUsed  = "least_used"  // 最近一个统计窗口内使用次数最少优先
+)
+
+// keyUsageWindow least_used 的使用次数统计窗口
+const keyUsageWindow = time.Minute
+
+// keyRejectionWindow 密钥连续被拒绝次数的保留时间,期间没有新的拒绝则重新计数
+const keyRejectionWindow = 10 * time.Minute
+
+// ErrNoActiveKey 渠道的密钥均已停用
+var ErrNoActiveKey = errors.New("channel has no active key")
+
+// IsKeyStrategy 判断是否为支持的密钥选择方式
+func IsKeyStrategy(name string) bool {
+	return name == KeyStrategyRoundRobin || name == KeyStrategyLeastUsed
+}
+
+// KeyRotator 渠道密钥轮换器
+// 在渠道的可用密钥之间按渠道配置的方式选择,选择状态保存在 Redis 中由所有实例共享;
+// 上游连续以 401/403 拒绝达到阈值的密钥被停用,渠道其余密钥继续服务
+type KeyRotator struct {
+	client             *redis.Client
+	channelRepo        repository.ChannelRepository
+	rejectionThreshold int // 停用密钥的连续拒绝次数,0 表示不自动停用
+}
+
+// NewKeyRotator 创建密钥轮换器
+func NewKeyRotator(client *redis.Client, channelRepo repository.ChannelRepository, rejectionThreshold int) *KeyRotator {
+	return &KeyRotator{client: client, channelRepo: channelRepo, rejectionThreshold: rejectionThreshold}
+}
+
+// Lua 脚本：选择统计窗口内使用次数最少的密钥并计数
+// ARGV[1] 为统计窗口毫秒数,其余参数为候选密钥 ID
+const luaKeyLeastUsed = `
+local best, bestScore
+for i = 2, #ARGV do
+    local score = tonumber(redis.call('ZSCORE', KEYS[1], ARGV[i]) or '0')
+    if not best or score < bestScore then
+        best, bestScore = ARGV[i], score
+    end
+end
+redis.call('ZINCRBY', KEYS[1], 1, best)
+if redis.call('PTTL', KEYS[1]) < 0 then
+    redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return best
+`
+
+// Lua 脚本：累加密钥的连续被拒绝次数并返回累加后的值
+// ARGV[1] 为密钥 ID,ARGV[2] 为计数保留毫秒数
+const luaKeyReject = `
+local n = redis.call('HINCRBY', KEYS[1], ARGV[1], 1)
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return n
+`
+
+// Pick 为一次上游调用选择渠道密钥
+// Redis 异常时使用第一个可用密钥,不阻断请求
+func (r *KeyRotator) Pick(ctx context.Context, channel *models.Channel) (*models.ChannelKey, error) {
+	keys := channel.ActiveKeys()
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoActiveKey, channel.ID)
+	}
+	if len(keys) == 1 {
+		return &keys[0], nil
+	}
+
+	index, err := r.pick(ctx, channel, keys)
+	if err != nil {
+		logger.Warn("Failed to rotate channel key", zap.String("channel_id", channel.ID), zap.Error(err))
+		return &keys[0], nil
+	}
+	return &keys[index], nil
+}
+
+// pick 按渠道的密钥选择方式返回选中密钥的下标
+func (r *KeyRotator) pick(ctx context.Context, channel *models.Channel, keys []models.ChannelKey) (int, error) {
+	if channel.KeyStrategy == KeyStrategyLeastUsed {
+		args := []interface{}{keyUsageWindow.Milliseconds()}
+		for _, key := range keys {
+			args = append(args, key.ID)
+		}
+		id, err := r.client.Eval(ctx, luaKeyLeastUsed, []string{keyUsageKey(channel.ID)}, args...).Text()
+		if err != nil {
+			return 0, err
+		}
+		for i, key := range keys {
+			if key.ID == id {
+				return i, nil
+			}
+		}
+		return 0, nil
+	}
+
+	n, err := r.client.Incr(ctx, keyCursorKey(channel.ID)).Result()
+	if err != nil {
+		return 0, err
+	}
+	return int((n - 1) % int64(len(keys))), nil
+}
+
+// RecordRejection 记录一次上游对密钥的拒绝,连续拒绝次数达到阈值时停用密钥,返回密钥是否被停用
+// 单次 401/403 可能来自上游的瞬时故障,不立即停用
+func (r *KeyRotator) RecordRejection(ctx context.Context, channelID, keyID, reason string) (bool, error) {
+	if r.rejectionThreshold <= 0 {
+		return false, nil
+	}
+
+	n, err := r.client.Eval(ctx, luaKeyReject, []string{keyRejectionsKey(channelID)},
+		keyID, keyRejectionWindow.Milliseconds(),
+	).Int()
+	if err != nil {
+		return false, err
+	}
+	if n < r.rejectionThreshold {
+		return false, nil
+	}
+
+	if err := r.Disable(ctx, channelID, keyID, reason); err != nil {
+		return false, err
+	}
+	return true, r.client.HDel(ctx, keyRejectionsKey(channelID), keyID).Err()
+}
+
+// RecordSuccess 记录一次密钥调用成功,清零连续被拒绝次数
+func (r *KeyRotator) RecordSuccess(ctx context.Context, channelID, keyID string) error {
+	return r.client.HDel(ctx, keyRejectionsKey(channelID), keyID).Err()
+}
+
+// Disable 停用渠道密钥并记录原因
+func (r *KeyRotator) Disable(ctx context.Context, channelID, keyID, reason string) error {
+	channel, err := r.channelRepo.FindByID(ctx, channelID)
+	if err != nil {
+		return err
+	}
+	key := channel.FindKey(keyID)
+	if key == nil || !key.IsActive {
+		return nil
+	}
+
+	key.IsActive = false
+	key.DisabledReason = reason
+	key.UpdatedAt = time.Now()
+	return r.channelRepo.UpdateKey(ctx, key)
+}
+
+// IsKeyRejected 判断错误是否表明上游拒绝了密钥(401/403)
+func IsKeyRejected(err error) bool {
+	var apiErr *upstream.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == 401 || apiErr.StatusCode == 403
+	}
+	return false
+}
+
+// keyCursorKey 渠道密钥轮询游标的 Redis 键
+func keyCursorKey(channelID string) string {
+	return fmt.Sprintf("transit:channel:%s:key_cursor", channelID)
+}
+
+// keyRejectionsKey 渠道各密钥连续被拒绝次数的 Redis 键
+func keyRejectionsKey(channelID string) string {
+	return fmt.Sprintf("transit:channel:%s:key_rejections", channelID)
+}
+
+// keyUsageKey 渠道密钥使用次数统计的 Redis 键
+func keyUsageKey(channelID string) string {
+	return fmt.Sprintf("transit:channel:%s:key_usage", channelID)
+}
@@ -0,0 +1,177 @@
+package loadbalancer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/869413421/transit/internal/models"
+	"github.com/869413421/transit/internal/repository"
+	"github.com/869413421/transit/pkg/upstream"
+)
+
+// fakeChannelRepo 内存中的渠道仓储,只实现密钥轮换用到的方法
+type fakeChannelRepo struct {
+	repository.ChannelRepository
+	channel *models.Channel
+	updated []models.ChannelKey
+}
+
+func (r *fakeChannelRepo) FindByID(ctx context.Context, id string) (*models.Channel, error) {
+	if r.channel == nil || r.channel.ID != id {
+		return nil, errors.New("channel not found")
+	}
+	return r.channel, nil
+}
+
+func (r *fakeChannelRepo) UpdateKey(ctx context.Context, key *models.ChannelKey) error {
+	r.updated = append(r.updated, *key)
+	return nil
+}
+
+// newKeyChannel 创建带有指定密钥的测试渠道,密钥 ID 即传入的名称
+func newKeyChannel(strategy string, ids ...string) *models.Channel {
+	channel := &models.Channel{ID: "ch0", KeyStrategy: strategy}
+	for _, id := range ids {
+		channel.Keys = append(channel.Keys, models.ChannelKey{ID: id, ChannelID: "ch0", IsActive: true})
+	}
+	return channel
+}
+
+// pickKeys 连续选择 n 次密钥并返回选中的密钥 ID
+func pickKeys(t *testing.T, rotator *KeyRotator, channel *models.Channel, n int) []string {
+	t.Helper()
+	var ids []string
+	for i := 0; i < n; i++ {
+		key, err := rotator.Pick(context.Background(), channel)
+		if err != nil {
+			t.Fatalf("Pick: %v", err)
+		}
+		ids = append(ids, key.ID)
+	}
+	return ids
+}
+
+func TestKeyRotatorRoundRobin(t *testing.T) {
+	_, client := newTestRedis(t)
+	rotator := NewKeyRotator(client, nil, 3)
+	channel := newKeyChannel(KeyStrategyRoundRobin, "k0", "k1", "k2")
+	channel.Keys[1].IsActive = false
+
+	// 停用的密钥不参与轮换
+	got := pickKeys(t, rotator, channel, 4)
+	want := []string{"k0", "k2", "k0", "k2"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Pick() sequence = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestKeyRotatorLeastUsed(t *testing.T) {
+	server, client := newTestRedis(t)
+	rotator := NewKeyRotator(client, nil, 3)
+	channel := newKeyChannel(KeyStrategyLeastUsed, "k0", "k1", "k2")
+
+	server.ZAdd(keyUsageKey("ch0"), 5, "k0")
+	server.ZAdd(keyUsageKey("ch0"), 1, "k2")
+
+	got := pickKeys(t, rotator, channel, 3)
+	if got[0] != "k1" || got[1] != "k1" || got[2] != "k2" {
+		t.Fatalf("Pick() sequence = %v, want least used keys first", got)
+	}
+	if ttl := server.TTL(keyUsageKey("ch0")); ttl != keyUsageWindow {
+		t.Fatalf("usage TTL = %v, want %v", ttl, keyUsageWindow)
+	}
+}
+
+func TestKeyRotatorNoActiveKey(t *testing.T) {
+	rotator := NewKeyRotator(nil, nil, 3)
+	channel := newKeyChannel(KeyStrategyRoundRobin, "k0")
+	channel.Keys[0].IsActive = false
+
+	if _, err := rotator.Pick(context.Background(), channel); !errors.Is(err, ErrNoActiveKey) {
+		t.Fatalf("Pick() error = %v, want ErrNoActiveKey", err)
+	}
+	// 单个密钥无需访问 Redis
+	channel.Keys[0].IsActive = true
+	if key, err := rotator.Pick(context.Background(), channel); err != nil || key.ID != "k0" {
+		t.Fatalf("Pick() = %+v, %v", key, err)
+	}
+}
+
+func TestKeyRotatorRecordRejection(t *testing.T) {
+	server, client := newTestRedis(t)
+	repo := &fakeChannelRepo{channel: newKeyChannel(KeyStrategyRoundRobin, "k0", "k1")}
+	rotator := NewKeyRotator(client, repo, 3)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if disabled, err := rotator.RecordRejection(ctx, "ch0", "k0", "upstream returned 401"); err != nil || disabled {
+			t.Fatalf("RecordRejection() = %v, %v; want below threshold", disabled, err)
+		}
+	}
+	if ttl := server.TTL(keyRejectionsKey("ch0")); ttl != keyRejectionWindow {
+		t.Fatalf("rejections TTL = %v, want %v", ttl, keyRejectionWindow)
+	}
+
+	// 成功调用清零连续被拒绝次数
+	if err := rotator.RecordSuccess(ctx, "ch0", "k0"); err != nil {
+		t.Fatalf("RecordSuccess: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		rotator.RecordRejection(ctx, "ch0", "k0", "upstream returned 401")
+	}
+	if len(repo.updated) != 0 {
+		t.Fatalf("key disabled after a success reset the count: %+v", repo.updated)
+	}
+
+	disabled, err := rotator.RecordRejection(ctx, "ch0", "k0", "upstream returned 401")
+	if err != nil || !disabled {
+		t.Fatalf("RecordRejection() = %v, %v; want disabled at threshold", disabled, err)
+	}
+	if len(repo.updated) != 1 || repo.updated[0].ID != "k0" || repo.updated[0].IsActive ||
+		repo.updated[0].DisabledReason != "upstream returned 401" {
+		t.Fatalf("UpdateKey() calls = %+v", repo.updated)
+	}
+	if n := server.HGet(keyRejectionsKey("ch0"), "k0"); n != "" {
+		t.Fatalf("rejection count = %s, want cleared after disabling", n)
+	}
+
+	// 已停用的密钥不再重复更新
+	if err := rotator.Disable(ctx, "ch0", "k0", "again"); err != nil || len(repo.updated) != 1 {
+		t.Fatalf("Disable() = %v with %d updates, want no-op", err, len(repo.updated))
+	}
+}
+
+func TestKeyRotatorRejectionThresholdDisabled(t *testing.T) {
+	server, client := newTestRedis(t)
+	repo := &fakeChannelRepo{channel: newKeyChannel(KeyStrategyRoundRobin, "k0")}
+	rotator := NewKeyRotator(client, repo, 0)
+
+	for i := 0; i < 10; i++ {
+		if disabled, err := rotator.RecordRejection(context.Background(), "ch0", "k0", "401"); err != nil || disabled {
+			t.Fatalf("RecordRejection() = %v, %v; want never disabled", disabled, err)
+		}
+	}
+	if len(repo.updated) != 0 || server.Exists(keyRejectionsKey("ch0")) {
+		t.Fatal("rejections recorded with automatic disabling turned off")
+	}
+}
+
+func TestIsKeyRejected(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&upstream.APIError{StatusCode: 401}, true},
+		{&upstream.APIError{StatusCode: 403}, true},
+		{&upstream.APIError{StatusCode: 429}, false},
+		{errors.New("connection reset"), false},
+	}
+	for _, tt := range tests {
+		if got := IsKeyRejected(tt.err); got != tt.want {
+			t.Errorf("IsKeyRejected(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package loadbalancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrQueueFull 等待队列已满
+	ErrQueueFull = errors.New("wait queue is full")
+	// ErrQueueTimeout 排队超时仍未获得并发位
+	ErrQueueTimeout = errors.New("timed out waiting for a channel")
+)
+
+// WaitQueue 渠道并发位等待队列
+// 所有渠道满载时请求按到达顺序在 Redis 有序集合中排队,多个 Transit 实例共享同一队列;
+// 每个模型一个队列,队首的请求优先获取空闲并发位,保证先到先得
+type WaitQueue struct {
+	client       *redis.Client
+	maxSize      int           // 每个模型队列的最大长度
+	timeout      time.Duration // 最长等待时间
+	pollInterval time.Duration // 检查排名与空闲并发位的间隔
+}
+
+// NewWaitQueue 创建等待队列
+func NewWaitQueue(client *redis.Client, maxSize int, timeout, pollInterval time.Duration) *WaitQueue {
+	if pollInterval <= 0 {
+		pollInterval = 100 * time.Millisecond
+	}
+	return &WaitQueue{
+		client:       client,
+		maxSize:      maxSize,
+		timeout:      timeout,
+		pollInterval: pollInterval,
+	}
+}
+
+// QueueStats 模型等待队列的统计
+type QueueStats struct {
+	Depth      int64 `json:"depth"`        // 当前排队数
+	Served     int64 `json:"served"`       // 排队后成功获取并发位的请求数
+	Timeouts   int64 `json:"timeouts"`     // 排队超时的请求数
+	Rejected   int64 `json:"rejected"`     // 队列已满被拒绝的请求数
+	AvgWaitMs  int64 `json:"avg_wait_ms"`  // 成功请求的平均等待时间
+	LastWaitMs int64 `json:"last_wait_ms"` // 最近一次成功请求的等待时间
+}
+
+// Lua 脚本：清理过期排队记录后入队
+// 排队记录以入队时间为分值,实例异常退出遗留的记录在超过 ARGV[2] 毫秒后被清理
+const luaQueueEnter = `
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', tonumber(ARGV[1]) - tonumber(ARGV[2]))
+if redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[3]) then
+    return 0
+end
+redis.call('ZADD', KEYS[1], ARGV[1], ARGV[4])
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return 1
+`
+
+// Lua 脚本：清理过期排队记录后返回排名,记录不存在时返回 -1
+const luaQueueRank = `
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', tonumber(ARGV[1]) - tonumber(ARGV[2]))
+local rank = redis.call('ZRANK', KEYS[1], ARGV[3])
+if not rank then
+    return -1
+end
+return rank
+`
+
+// wait 排队等待,直到 try 获取成功、返回错误或超时
+// free 返回当前可服务该模型的空闲并发位数量,排名小于空闲数量的请求才会尝试获取,避免后到的请求插队;
+// free 返回错误时不再等待,直接返回该错误
+func (q *WaitQueue) wait(
+	ctx context.Context,
+	model string,
+	free func() (int, error),
+	try func() (bool, error),
+) error {
+	ticket := uuid.New().String()
+	key := queueKey(model)
+	startTime := time.Now()
+
+	entered, err := q.client.Eval(ctx, luaQueueEnter, []string{key},
+		startTime.UnixMilli(), q.staleAfter().Milliseconds(), q.maxSize, ticket,
+	).Result()
+	if err != nil {
+		return err
+	}
+	if entered.(int64) == 0 {
+		q.client.HIncrBy(ctx, queueStatsKey(model), "rejected", 1)
+		return ErrQueueFull
+	}
+	defer q.client.ZRem(context.WithoutCancel(ctx), key, ticket)
+
+	timer := time.NewTimer(q.timeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(q.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		rank, err := q.client.Eval(ctx, luaQueueRank, []string{key},
+			time.Now().UnixMilli(), q.staleAfter().Milliseconds(), ticket,
+		).Int64()
+		if err != nil {
+			return err
+		}
+
+		slots, err := free()
+		if err != nil {
+			return err
+		}
+		if rank < int64(slots) {
+			acquired, err := try()
+			if err != nil {
+				return err
+			}
+			if acquired {
+				q.recordWait(context.WithoutCancel(ctx), model, time.Since(startTime))
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			q.client.HIncrBy(context.WithoutCancel(ctx), queueStatsKey(model), "timeouts", 1)
+			return ErrQueueTimeout
+		case <-ticker.C:
+		}
+	}
+}
+
+// recordWait 记录一次排队成功的等待时间
+func (q *WaitQueue) recordWait(ctx context.Context, model string, waited time.Duration) {
+	key := queueStatsKey(model)
+	pipe := q.client.TxPipeline()
+	pipe.HIncrBy(ctx, key, "served", 1)
+	pipe.HIncrBy(ctx, key, "wait_ms_total", waited.Milliseconds())
+	pipe.HSet(ctx, key, "last_wait_ms", waited.Milliseconds())
+	pipe.Exec(ctx)
+}
+
+// Depth 返回模型队列的当前排队数
+func (q *WaitQueue) Depth(ctx context.Context, model string) (int64, error) {
+	return q.client.ZCount(ctx, queueKey(model),
+		strconv.FormatInt(time.Now().Add(-q.staleAfter()).UnixMilli(), 10), "+inf",
+	).Result()
+}
+
+// Stats 返回模型队列的排队数与等待时间统计
+func (q *WaitQueue) Stats(ctx context.Context, model string) (*QueueStats, error) {
+	depth, err := q.Depth(ctx, model)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := q.client.HGetAll(ctx, queueStatsKey(model)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &QueueStats{Depth: depth}
+	stats.Served, _ = strconv.ParseInt(fields["served"], 10, 64)
+	stats.Timeouts, _ = strconv.ParseInt(fields["timeouts"], 10, 64)
+	stats.Rejected, _ = strconv.ParseInt(fields["rejected"], 10, 64)
+	stats.LastWaitMs, _ = strconv.ParseInt(fields["last_wait_ms"], 10, 64)
+	if stats.Served > 0 {
+		total, _ := strconv.ParseInt(fields["wait_ms_total"], 10, 64)
+		stats.AvgWaitMs = total / stats.Served
+	}
+	return stats, nil
+}
+
+// staleAfter 排队记录的最长保留时间,超过后视为实例异常退出遗留的记录
+func (q *WaitQueue) staleAfter() time.Duration {
+	return 2*q.timeout + time.Second
+}
+
+// queueKey 模型等待队列的 Redis 键
+func queueKey(model string) string {
+	return fmt.Sprintf("transit:queue:%s", model)
+}
+
+// queueStatsKey 模型等待队列统计的 Redis 键
+func queueStatsKey(model string) string {
+	return fmt.Sprintf("transit:queue:%s:stats", model)
+}
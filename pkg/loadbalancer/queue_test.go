@@ -0,0 +1,182 @@
+package loadbalancer
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// alwaysFree 模拟始终有一个空闲并发位
+func alwaysFree() (int, error) { return 1, nil }
+
+func TestWaitQueueServesImmediately(t *testing.T) {
+	_, client := newTestRedis(t)
+	queue := NewWaitQueue(client, 10, time.Second, 10*time.Millisecond)
+	ctx := context.Background()
+
+	err := queue.wait(ctx, "gpt-4o", alwaysFree, func() (bool, error) { return true, nil })
+	if err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+
+	stats, err := queue.Stats(ctx, "gpt-4o")
+	if err != nil {
+		t.Fatalf("Stats: %v", err)
+	}
+	if stats.Depth != 0 || stats.Served != 1 {
+		t.Fatalf("Stats() = %+v, want ticket removed and one request served", stats)
+	}
+}
+
+func TestWaitQueueFull(t *testing.T) {
+	server, client := newTestRedis(t)
+	queue := NewWaitQueue(client, 1, time.Second, 10*time.Millisecond)
+	ctx := context.Background()
+
+	server.ZAdd(queueKey("gpt-4o"), float64(time.Now().UnixMilli()), "other-request")
+
+	var tried bool
+	err := queue.wait(ctx, "gpt-4o", alwaysFree, func() (bool, error) { tried = true; return true, nil })
+	if !errors.Is(err, ErrQueueFull) || tried {
+		t.Fatalf("wait() = %v (tried %v), want ErrQueueFull without trying", err, tried)
+	}
+	if stats, _ := queue.Stats(ctx, "gpt-4o"); stats.Rejected != 1 || stats.Depth != 1 {
+		t.Fatalf("Stats() = %+v", stats)
+	}
+}
+
+func TestWaitQueuePurgesStaleTickets(t *testing.T) {
+	server, client := newTestRedis(t)
+	queue := NewWaitQueue(client, 1, time.Second, 10*time.Millisecond)
+	ctx := context.Background()
+
+	// 实例异常退出遗留的排队记录不占用队列长度,也不阻挡后来的请求
+	stale := time.Now().Add(-queue.staleAfter() - time.Second)
+	server.ZAdd(queueKey("gpt-4o"), float64(stale.UnixMilli()), "crashed-request")
+
+	if depth, _ := queue.Depth(ctx, "gpt-4o"); depth != 0 {
+		t.Fatalf("Depth() = %d, want stale ticket ignored", depth)
+	}
+	if err := queue.wait(ctx, "gpt-4o", alwaysFree, func() (bool, error) { return true, nil }); err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+}
+
+func TestWaitQueueFirstComeFirstServed(t *testing.T) {
+	server, client := newTestRedis(t)
+	queue := NewWaitQueue(client, 10, 5*time.Second, 5*time.Millisecond)
+	ctx := context.Background()
+
+	earlier := time.Now().Add(-time.Millisecond)
+	server.ZAdd(queueKey("gpt-4o"), float64(earlier.UnixMilli()), "earlier-request")
+
+	var tries atomic.Int32
+	done := make(chan error, 1)
+	go func() {
+		done <- queue.wait(ctx, "gpt-4o", alwaysFree, func() (bool, error) {
+			tries.Add(1)
+			return true, nil
+		})
+	}()
+
+	// 只有一个空闲并发位时,排在后面的请求不会尝试获取
+	time.Sleep(50 * time.Millisecond)
+	if n := tries.Load(); n != 0 {
+		t.Fatalf("request behind the queue head tried %d times", n)
+	}
+
+	server.ZRem(queueKey("gpt-4o"), "earlier-request")
+	select {
+	case err := <-done:
+		if err != nil || tries.Load() != 1 {
+			t.Fatalf("wait() = %v after %d tries", err, tries.Load())
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("request not served after the queue head left")
+	}
+}
+
+func TestWaitQueueTimeout(t *testing.T) {
+	_, client := newTestRedis(t)
+	queue := NewWaitQueue(client, 10, 50*time.Millisecond, 5*time.Millisecond)
+	ctx := context.Background()
+
+	var tries int
+	err := queue.wait(ctx, "gpt-4o", alwaysFree, func() (bool, error) { tries++; return false, nil })
+	if !errors.Is(err, ErrQueueTimeout) {
+		t.Fatalf("wait() = %v, want ErrQueueTimeout", err)
+	}
+	if tries < 2 {
+		t.Fatalf("tried %d times, want retries until the timeout", tries)
+	}
+
+	stats, _ := queue.Stats(ctx, "gpt-4o")
+	if stats.Timeouts != 1 || stats.Depth != 0 || stats.Served != 0 {
+		t.Fatalf("Stats() = %+v", stats)
+	}
+}
+
+func TestWaitQueueTryError(t *testing.T) {
+	_, client := newTestRedis(t)
+	queue := NewWaitQueue(client, 10, time.Second, 5*time.Millisecond)
+	tryErr := errors.New("redis unavailable")
+
+	err := queue.wait(context.Background(), "gpt-4o", alwaysFree, func() (bool, error) { return false, tryErr })
+	if !errors.Is(err, tryErr) {
+		t.Fatalf("wait() = %v, want try error", err)
+	}
+	if depth, _ := queue.Depth(context.Background(), "gpt-4o"); depth != 0 {
+		t.Fatalf("Depth() = %d, want ticket removed", depth)
+	}
+}
+
+func TestWaitQueueFreeError(t *testing.T) {
+	_, client := newTestRedis(t)
+	queue := NewWaitQueue(client, 10, 5*time.Second, 5*time.Millisecond)
+
+	// 渠道不会再释放并发位时立即结束等待,不等到超时
+	err := queue.wait(context.Background(), "gpt-4o", func() (int, error) { return 0, ErrChannelsUnavailable }, func() (bool, error) {
+		t.Error("tried to acquire without a free slot")
+		return false, nil
+	})
+	if !errors.Is(err, ErrChannelsUnavailable) {
+		t.Fatalf("wait() = %v, want ErrChannelsUnavailable", err)
+	}
+	if depth, _ := queue.Depth(context.Background(), "gpt-4o"); depth != 0 {
+		t.Fatalf("Depth() = %d, want ticket removed", depth)
+	}
+}
+
+func TestWaitQueueContextCanceled(t *testing.T) {
+	_, client := newTestRedis(t)
+	queue := NewWaitQueue(client, 10, 5*time.Second, 5*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	err := queue.wait(ctx, "gpt-4o", func() (int, error) { return 0, nil }, func() (bool, error) {
+		t.Error("tried to acquire without a free slot")
+		return false, nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("wait() = %v, want context.Canceled", err)
+	}
+	if depth, _ := queue.Depth(context.Background(), "gpt-4o"); depth != 0 {
+		t.Fatalf("Depth() = %d, want ticket removed after cancellation", depth)
+	}
+}
+
+func TestWaitQueueAverageWait(t *testing.T) {
+	server, client := newTestRedis(t)
+	queue := NewWaitQueue(client, 10, time.Second, time.Millisecond)
+
+	server.HSet(queueStatsKey("gpt-4o"), "served", "2", "wait_ms_total", "300", "last_wait_ms", "100")
+	stats, err := queue.Stats(context.Background(), "gpt-4o")
+	if err != nil {
+		t.Fatalf("Stats: %v", err)
+	}
+	if stats.AvgWaitMs != 150 || stats.LastWaitMs != 100 {
+		t.Fatalf("Stats() = %+v", stats)
+	}
+}
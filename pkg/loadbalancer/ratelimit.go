@@ -0,0 +1,190 @@
+package loadbalancer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/869413421/transit/pkg/upstream"
+	"github.com/go-redis/redis/v8"
+)
+
+// 渠道上游限流状态
+const (
+	RateLimitNormal  = "normal"  // 剩余配额充足或上游未返回限流信息
+	RateLimitLow     = "low"     // 剩余配额低于阈值,同一优先级内排到最后
+	RateLimitCooling = "cooling" // 配额耗尽或收到 429,冷却结束前不参与选择
+)
+
+// RateLimitTracker 渠道上游限流状态记录
+// 根据上游返回的 x-ratelimit-* 与 Retry-After 响应头,在 Redis 中为渠道写入短期的冷却或低配额标记,
+// 标记随配额重置时间自动过期,所有 Transit 实例共享,用于在触发 429 之前绕开即将限流的渠道
+type RateLimitTracker struct {
+	client          *redis.Client
+	lowRatio        float64       // 剩余配额占总配额的比例低于该值时视为低配额
+	defaultCooldown time.Duration // 上游未给出重置时间时的冷却时间
+	maxCooldown     time.Duration // 冷却时间上限
+}
+
+// NewRateLimitTracker 创建限流状态记录器
+func NewRateLimitTracker(client *redis.Client, lowRatio float64, defaultCooldown, maxCooldown time.Duration) *RateLimitTracker {
+	if defaultCooldown <= 0 {
+		defaultCooldown = 5 * time.Second
+	}
+	if maxCooldown < defaultCooldown {
+		maxCooldown = defaultCooldown
+	}
+	return &RateLimitTracker{
+		client:          client,
+		lowRatio:        lowRatio,
+		defaultCooldown: defaultCooldown,
+		maxCooldown:     maxCooldown,
+	}
+}
+
+// ChannelRateLimit 渠道当前的上游限流状态
+type ChannelRateLimit struct {
+	Status string     `json:"status"`
+	Until  *time.Time `json:"until,omitempty"` // 冷却或低配额标记的过期时间
+}
+
+// Lua 脚本：写入冷却标记,仅在新的冷却结束时间更晚时覆盖
+const luaRateLimitCool = `
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+if tonumber(ARGV[1]) > current then
+    redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+    return 1
+end
+return 0
+`
+
+// Observe 根据一次上游响应的限流信息更新渠道状态,返回渠道是否进入(或延长)冷却
+func (t *RateLimitTracker) Observe(ctx context.Context, channelID string, rl *upstream.RateLimit) (bool, error) {
+	now := time.Now()
+
+	if cooldown := t.cooldown(rl); cooldown > 0 {
+		extended, err := t.client.Eval(ctx, luaRateLimitCool, []string{coolingKey(channelID)},
+			now.Add(cooldown).UnixMilli(), cooldown.Milliseconds(),
+		).Int()
+		return extended == 1, err
+	}
+
+	// 低配额标记以最近一次响应为准,配额恢复后立即清除
+	if lowFor := t.lowFor(rl); lowFor > 0 {
+		return false, t.client.Set(ctx, lowKey(channelID), now.Add(lowFor).UnixMilli(), lowFor).Err()
+	}
+	return false, t.client.Del(ctx, lowKey(channelID)).Err()
+}
+
+// cooldown 计算需要冷却的时间,不需要冷却时返回 0
+func (t *RateLimitTracker) cooldown(rl *upstream.RateLimit) time.Duration {
+	var d time.Duration
+	switch {
+	case rl.RetryAfter > 0:
+		d = rl.RetryAfter
+	case rl.StatusCode == http.StatusTooManyRequests:
+		d = max(rl.ResetRequests, rl.ResetTokens)
+	case rl.RemainingRequests == 0:
+		d = rl.ResetRequests
+	case rl.RemainingTokens == 0:
+		d = rl.ResetTokens
+	default:
+		return 0
+	}
+
+	if d <= 0 {
+		d = t.defaultCooldown
+	}
+	return min(d, t.maxCooldown)
+}
+
+// lowFor 剩余配额低于阈值时返回标记的保留时间(到配额重置为止),否则返回 0
+func (t *RateLimitTracker) lowFor(rl *upstream.RateLimit) time.Duration {
+	lowRequests := isLow(rl.RemainingRequests, rl.LimitRequests, t.lowRatio)
+	lowTokens := isLow(rl.RemainingTokens, rl.LimitTokens, t.lowRatio)
+	if !lowRequests && !lowTokens {
+		return 0
+	}
+
+	var d time.Duration
+	if lowRequests {
+		d = max(d, rl.ResetRequests)
+	}
+	if lowTokens {
+		d = max(d, rl.ResetTokens)
+	}
+	if d <= 0 {
+		d = t.defaultCooldown
+	}
+	return min(d, t.maxCooldown)
+}
+
+// isLow 剩余配额占总配额的比例是否低于阈值,缺少任一响应头时返回 false
+func isLow(remaining, limit int, ratio float64) bool {
+	if remaining < 0 || limit <= 0 {
+		return false
+	}
+	return float64(remaining) < float64(limit)*ratio
+}
+
+// Statuses 批量查询渠道的限流状态,只返回处于冷却或低配额的渠道
+func (t *RateLimitTracker) Statuses(ctx context.Context, channelIDs []string) (map[string]string, error) {
+	if len(channelIDs) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, 0, 2*len(channelIDs))
+	for _, id := range channelIDs {
+		keys = append(keys, coolingKey(id), lowKey(id))
+	}
+	values, err := t.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make(map[string]string)
+	for i, id := range channelIDs {
+		switch {
+		case values[2*i] != nil:
+			statuses[id] = RateLimitCooling
+		case values[2*i+1] != nil:
+			statuses[id] = RateLimitLow
+		}
+	}
+	return statuses, nil
+}
+
+// State 返回渠道当前的限流状态及标记过期时间
+func (t *RateLimitTracker) State(ctx context.Context, channelID string) (*ChannelRateLimit, error) {
+	values, err := t.client.MGet(ctx, coolingKey(channelID), lowKey(channelID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	state := &ChannelRateLimit{Status: RateLimitNormal}
+	for i, status := range []string{RateLimitCooling, RateLimitLow} {
+		value, ok := values[i].(string)
+		if !ok {
+			continue
+		}
+		state.Status = status
+		if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+			until := time.UnixMilli(ms)
+			state.Until = &until
+		}
+		break
+	}
+	return state, nil
+}
+
+// coolingKey 渠道冷却标记的 Redis 键,值为冷却结束时间(毫秒)
+func coolingKey(channelID string) string {
+	return fmt.Sprintf("transit:channel:%s:cooling", channelID)
+}
+
+// lowKey 渠道低配额标记的 Redis 键,值为标记过期时间(毫秒)
+func lowKey(channelID string) string {
+	return fmt.Sprintf("transit:channel:%s:ratelimit_low", channelID)
+}
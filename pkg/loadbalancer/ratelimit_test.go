@@ -0,0 +1,175 @@
+package loadbalancer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/869413421/transit/pkg/upstream"
+)
+
+// newRateLimit 创建未携带任何限流响应头的限流信息
+func newRateLimit(statusCode int) *upstream.RateLimit {
+	return &upstream.RateLimit{
+		StatusCode:        statusCode,
+		LimitRequests:     -1,
+		RemainingRequests: -1,
+		LimitTokens:       -1,
+		RemainingTokens:   -1,
+	}
+}
+
+func TestRateLimitTrackerCooldown(t *testing.T) {
+	tracker := NewRateLimitTracker(nil, 0.1, 5*time.Second, time.Minute)
+
+	tests := []struct {
+		name string
+		rl   func(rl *upstream.RateLimit)
+		want time.Duration
+	}{
+		{"retry-after wins", func(rl *upstream.RateLimit) {
+			rl.RetryAfter = 3 * time.Second
+			rl.ResetRequests = 30 * time.Second
+			rl.RemainingRequests = 0
+		}, 3 * time.Second},
+		{"429 waits for the later reset", func(rl *upstream.RateLimit) {
+			rl.StatusCode = http.StatusTooManyRequests
+			rl.ResetRequests = 2 * time.Second
+			rl.ResetTokens = 8 * time.Second
+		}, 8 * time.Second},
+		{"429 without reset uses default", func(rl *upstream.RateLimit) { rl.StatusCode = http.StatusTooManyRequests }, 5 * time.Second},
+		{"requests exhausted", func(rl *upstream.RateLimit) { rl.RemainingRequests = 0; rl.ResetRequests = 10 * time.Second }, 10 * time.Second},
+		{"tokens exhausted", func(rl *upstream.RateLimit) { rl.RemainingTokens = 0; rl.ResetTokens = 20 * time.Second }, 20 * time.Second},
+		{"capped at max cooldown", func(rl *upstream.RateLimit) { rl.RetryAfter = time.Hour }, time.Minute},
+		{"quota left", func(rl *upstream.RateLimit) { rl.RemainingRequests = 5; rl.LimitRequests = 100 }, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl := newRateLimit(http.StatusOK)
+			tt.rl(rl)
+			if got := tracker.cooldown(rl); got != tt.want {
+				t.Fatalf("cooldown() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimitTrackerObserveCooling(t *testing.T) {
+	server, client := newTestRedis(t)
+	tracker := NewRateLimitTracker(client, 0.1, 5*time.Second, time.Minute)
+	ctx := context.Background()
+
+	rl := newRateLimit(http.StatusTooManyRequests)
+	rl.RetryAfter = 30 * time.Second
+	cooling, err := tracker.Observe(ctx, "ch0", rl)
+	if err != nil || !cooling {
+		t.Fatalf("Observe() = %v, %v; want cooling", cooling, err)
+	}
+	if ttl := server.TTL(coolingKey("ch0")); ttl != 30*time.Second {
+		t.Fatalf("cooling TTL = %v, want 30s", ttl)
+	}
+
+	// 更短的冷却不会缩短已有的冷却
+	rl.RetryAfter = time.Second
+	if cooling, _ := tracker.Observe(ctx, "ch0", rl); cooling {
+		t.Fatal("shorter cooldown replaced a longer one")
+	}
+	if ttl := server.TTL(coolingKey("ch0")); ttl != 30*time.Second {
+		t.Fatalf("cooling TTL = %v, want 30s kept", ttl)
+	}
+
+	state, err := tracker.State(ctx, "ch0")
+	if err != nil || state.Status != RateLimitCooling || state.Until == nil || time.Until(*state.Until) < 25*time.Second {
+		t.Fatalf("State() = %+v, %v", state, err)
+	}
+
+	// 冷却标记随重置时间过期
+	server.FastForward(31 * time.Second)
+	if state, _ := tracker.State(ctx, "ch0"); state.Status != RateLimitNormal || state.Until != nil {
+		t.Fatalf("State() after cooldown = %+v", state)
+	}
+}
+
+func TestRateLimitTrackerObserveLow(t *testing.T) {
+	server, client := newTestRedis(t)
+	tracker := NewRateLimitTracker(client, 0.1, 5*time.Second, time.Minute)
+	ctx := context.Background()
+
+	rl := newRateLimit(http.StatusOK)
+	rl.LimitTokens, rl.RemainingTokens, rl.ResetTokens = 10000, 500, 12*time.Second
+	rl.LimitRequests, rl.RemainingRequests, rl.ResetRequests = 100, 90, time.Second
+
+	if cooling, err := tracker.Observe(ctx, "ch0", rl); err != nil || cooling {
+		t.Fatalf("Observe() = %v, %v; want low quota without cooling", cooling, err)
+	}
+	if ttl := server.TTL(lowKey("ch0")); ttl != 12*time.Second {
+		t.Fatalf("low TTL = %v, want time until the token reset", ttl)
+	}
+	if state, _ := tracker.State(ctx, "ch0"); state.Status != RateLimitLow {
+		t.Fatalf("State() = %+v, want low", state)
+	}
+
+	// 配额恢复后立即清除低配额标记
+	rl.RemainingTokens = 9000
+	tracker.Observe(ctx, "ch0", rl)
+	if server.Exists(lowKey("ch0")) {
+		t.Fatal("low quota mark kept after the quota recovered")
+	}
+}
+
+func TestRateLimitTrackerStatuses(t *testing.T) {
+	server, client := newTestRedis(t)
+	tracker := NewRateLimitTracker(client, 0.1, 5*time.Second, time.Minute)
+	ctx := context.Background()
+
+	until := fmt.Sprint(time.Now().Add(time.Minute).UnixMilli())
+	server.Set(coolingKey("ch0"), until)
+	server.Set(lowKey("ch0"), until)
+	server.Set(lowKey("ch1"), until)
+
+	statuses, err := tracker.Statuses(ctx, []string{"ch0", "ch1", "ch2"})
+	if err != nil {
+		t.Fatalf("Statuses: %v", err)
+	}
+	// 冷却优先于低配额,正常渠道不返回
+	want := map[string]string{"ch0": RateLimitCooling, "ch1": RateLimitLow}
+	if fmt.Sprint(statuses) != fmt.Sprint(want) {
+		t.Fatalf("Statuses() = %v, want %v", statuses, want)
+	}
+	if statuses, err := tracker.Statuses(ctx, nil); err != nil || statuses != nil {
+		t.Fatalf("Statuses(nil) = %v, %v", statuses, err)
+	}
+}
+
+func TestIsLow(t *testing.T) {
+	tests := []struct {
+		remaining, limit int
+		want             bool
+	}{
+		{5, 100, true},
+		{10, 100, false},
+		{0, 100, true},
+		{-1, 100, false},
+		{5, -1, false},
+		{5, 0, false},
+	}
+	for _, tt := range tests {
+		if got := isLow(tt.remaining, tt.limit, 0.1); got != tt.want {
+			t.Errorf("isLow(%d, %d) = %v, want %v", tt.remaining, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestDeprioritizeLimited(t *testing.T) {
+	channels := newChannels(10, 10, 10, 10)
+
+	ordered := deprioritizeLimited(channels, map[string]string{"ch0": RateLimitLow, "ch2": RateLimitLow})
+	if got := fmt.Sprint(channelIDs(ordered)); got != "[ch1 ch3 ch0 ch2]" {
+		t.Fatalf("deprioritizeLimited() = %s, want low quota channels last in original order", got)
+	}
+	if got := fmt.Sprint(channelIDs(deprioritizeLimited(channels, nil))); got != "[ch0 ch1 ch2 ch3]" {
+		t.Fatalf("deprioritizeLimited() without limits = %s", got)
+	}
+}
@@ -0,0 +1,65 @@
+package loadbalancer
+
+import (
+	"errors"
+	"math/rand"
+	"net/url"
+	"time"
+
+	"github.com/869413421/transit/pkg/upstream"
+)
+
+// RetryPolicy 跨渠道重试策略
+// 上游返回可重试的错误时,释放失败渠道并经 Selector 重新选择其他渠道
+type RetryPolicy struct {
+	MaxAttempts          int           // 最大尝试次数(含首次),小于等于 1 时不重试
+	RetryStatusCodes     []int         // 可重试的上游 HTTP 状态码
+	RetryOnTimeout       bool          // 请求超时是否重试
+	RetryOnConnectionErr bool          // 连接失败是否重试
+	InitialBackoff       time.Duration // 首次重试前的等待时间
+	MaxBackoff           time.Duration // 等待时间上限
+}
+
+// ShouldRetry 判断第 attempt 次尝试失败后是否应切换渠道重试
+func (p *RetryPolicy) ShouldRetry(err error, attempt int) bool {
+	if err == nil || attempt >= p.MaxAttempts {
+		return false
+	}
+
+	var apiErr *upstream.APIError
+	if errors.As(err, &apiErr) {
+		for _, code := range p.RetryStatusCodes {
+			if apiErr.StatusCode == code {
+				return true
+			}
+		}
+		return false
+	}
+
+	// HTTP 客户端的传输层错误(超时、连接拒绝、连接重置等)统一包装为 url.Error
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		if urlErr.Timeout() {
+			return p.RetryOnTimeout
+		}
+		return p.RetryOnConnectionErr
+	}
+	return false
+}
+
+// Backoff 第 attempt 次尝试失败后的等待时间
+// 指数退避并加入最多 50% 的随机抖动,避免重试集中打到同一时刻
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	if p.InitialBackoff <= 0 {
+		return 0
+	}
+
+	backoff := p.InitialBackoff
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || backoff < p.MaxBackoff); i++ {
+		backoff *= 2
+	}
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
@@ -0,0 +1,80 @@
+package loadbalancer
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/869413421/transit/pkg/upstream"
+)
+
+// timeoutError 超时的传输层错误
+type timeoutError struct{}
+
+func (timeoutError) Error() string { return "i/o timeout" }
+func (timeoutError) Timeout() bool { return true }
+
+func TestRetryPolicyShouldRetry(t *testing.T) {
+	policy := &RetryPolicy{
+		MaxAttempts:          3,
+		RetryStatusCodes:     []int{429, 503},
+		RetryOnTimeout:       true,
+		RetryOnConnectionErr: false,
+	}
+	connErr := &url.Error{Op: "Post", URL: "https://api.example.com", Err: errors.New("connection refused")}
+	timeoutErr := &url.Error{Op: "Post", URL: "https://api.example.com", Err: timeoutError{}}
+
+	tests := []struct {
+		name    string
+		err     error
+		attempt int
+		want    bool
+	}{
+		{"success", nil, 1, false},
+		{"retriable status", &upstream.APIError{StatusCode: 503}, 1, true},
+		{"wrapped retriable status", errors.Join(errors.New("chat"), &upstream.APIError{StatusCode: 429}), 2, true},
+		{"non-retriable status", &upstream.APIError{StatusCode: 400}, 1, false},
+		{"attempts exhausted", &upstream.APIError{StatusCode: 503}, 3, false},
+		{"timeout", timeoutErr, 1, true},
+		{"connection error disabled", connErr, 1, false},
+		{"other error", errors.New("unmarshal response"), 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.ShouldRetry(tt.err, tt.attempt); got != tt.want {
+				t.Fatalf("ShouldRetry(%v, %d) = %v, want %v", tt.err, tt.attempt, got, tt.want)
+			}
+		})
+	}
+
+	if (&RetryPolicy{MaxAttempts: 1, RetryStatusCodes: []int{503}}).ShouldRetry(&upstream.APIError{StatusCode: 503}, 1) {
+		t.Fatal("ShouldRetry() with MaxAttempts 1 retried")
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := &RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond}
+
+	// 指数增长并加入最多 50% 的抖动,不超过上限
+	tests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{1, 50 * time.Millisecond, 100 * time.Millisecond},
+		{2, 100 * time.Millisecond, 200 * time.Millisecond},
+		{3, 150 * time.Millisecond, 300 * time.Millisecond},
+		{10, 150 * time.Millisecond, 300 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			if got := policy.Backoff(tt.attempt); got < tt.min || got > tt.max {
+				t.Fatalf("Backoff(%d) = %v, want within [%v, %v]", tt.attempt, got, tt.min, tt.max)
+			}
+		}
+	}
+
+	if got := (&RetryPolicy{}).Backoff(2); got != 0 {
+		t.Fatalf("Backoff() without InitialBackoff = %v, want 0", got)
+	}
+}
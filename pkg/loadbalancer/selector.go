@@ -3,33 +3,249 @@ package loadbalancer
 import (
 	"context"
 	"errors"
-	"math/rand"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"time"
 
 	"github.com/869413421/transit/internal/models"
 	"github.com/869413421/transit/internal/repository"
 	"github.com/869413421/transit/pkg/logger"
 	"github.com/869413421/transit/pkg/pool"
+	"github.com/869413421/transit/pkg/upstream"
 	"go.uber.org/zap"
 )
 
+var (
+	// ErrNoChannelForModel 没有任何激活渠道声明可以服务所请求的模型
+	ErrNoChannelForModel = errors.New("no channel serves model")
+	// ErrChannelsBusy 可服务该模型的渠道均不可用,且至少有一个渠道因并发位已满被跳过,释放并发位后可能选中
+	ErrChannelsBusy = errors.New("all channels are at capacity")
+	// ErrChannelsUnavailable 可服务该模型的渠道均处于熔断、不健康或上游限流冷却,不会因并发位释放而变为可用
+	ErrChannelsUnavailable = errors.New("all channels are unhealthy, rate limited or circuit open")
+)
+
 // Selector 渠道选择器
 type Selector struct {
 	channelRepo repository.ChannelRepository
 	pool        *pool.RedisPool
+	breaker     *CircuitBreaker
+	health      *HealthTracker
+	strategies  *Strategies
+	queue       *WaitQueue        // 为 nil 时不排队
+	rateLimits  *RateLimitTracker // 为 nil 时不感知上游限流
+	keys        *KeyRotator
 }
 
 // NewSelector 创建渠道选择器
-func NewSelector(channelRepo repository.ChannelRepository, pool *pool.RedisPool) *Selector {
+func NewSelector(
+	channelRepo repository.ChannelRepository,
+	pool *pool.RedisPool,
+	breaker *CircuitBreaker,
+	health *HealthTracker,
+	strategies *Strategies,
+	queue *WaitQueue,
+	rateLimits *RateLimitTracker,
+	keys *KeyRotator,
+) *Selector {
 	return &Selector{
 		channelRepo: channelRepo,
 		pool:        pool,
+		breaker:     breaker,
+		health:      health,
+		strategies:  strategies,
+		queue:       queue,
+		rateLimits:  rateLimits,
+		keys:        keys,
 	}
 }
 
-// SelectChannel 选择可用渠道并获取并发位
-// 使用加权轮询算法,优先选择权重高且并发未满的渠道
-func (s *Selector) SelectChannel(ctx context.Context) (*models.Channel, error) {
-	// 获取所有激活的渠道
+// SelectChannel 为指定模型选择可用渠道并获取并发位
+// 仅考虑声明可服务该模型、权重大于 0 且有可用密钥的激活渠道;高优先级的渠道全部不可用时才降级到下一优先级,
+// 同一优先级内按模型配置的负载均衡策略排序后依次尝试获取并发位,上游配额偏低的渠道排在组内最后,冷却中的渠道跳过;
+// userID 供一致性哈希策略使用,exclude 为本次请求中已失败的渠道,重试时不再选择;
+// 返回选中的渠道及并发位租约 ID,调用方需通过 ReleaseChannel 释放;没有渠道可选时,有渠道满载返回 ErrChannelsBusy,否则返回 ErrChannelsUnavailable
+func (s *Selector) SelectChannel(ctx context.Context, model, userID string, exclude ...string) (*models.Channel, string, error) {
+	activeChannels, err := s.eligibleChannels(ctx, model)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// 排除已失败的渠道
+	if len(exclude) > 0 {
+		remaining := activeChannels[:0]
+		for _, ch := range activeChannels {
+			if !slices.Contains(exclude, ch.ID) {
+				remaining = append(remaining, ch)
+			}
+		}
+		if len(remaining) == 0 {
+			return nil, "", errors.New("no untried channels")
+		}
+		activeChannels = remaining
+	}
+
+	// 按优先级从高到低分组,组内按策略排序后依次尝试获取并发位
+	strategy := s.strategies.For(model)
+	limits := s.rateLimitStatuses(ctx, activeChannels)
+	var ordered []*models.Channel
+	for _, tier := range priorityTiers(activeChannels) {
+		ordered = append(ordered, deprioritizeLimited(strategy.Order(ctx, tier, userID), limits)...)
+	}
+	atCapacity := false
+	for _, channel := range ordered {
+		// 上游限流冷却中的渠道不参与选择
+		if limits[channel.ID] == RateLimitCooling {
+			logger.Debug("Channel rate limit cooling", zap.String("channel_id", channel.ID))
+			continue
+		}
+
+		// 健康探测连续失败的渠道不参与选择,Redis 异常时不阻断请求
+		healthy, err := s.health.IsHealthy(ctx, channel.ID)
+		if err != nil {
+			logger.Warn("Failed to check channel health",
+				zap.String("channel_id", channel.ID),
+				zap.Error(err),
+			)
+		} else if !healthy {
+			logger.Debug("Channel unhealthy", zap.String("channel_id", channel.ID))
+			continue
+		}
+
+		// 先获取并发位,满载的渠道不消耗半开状态的探测名额
+		leaseID, err := s.pool.Acquire(ctx, channel.ID, channel.MaxConcurrency)
+		if errors.Is(err, pool.ErrConcurrencyLimit) {
+			logger.Debug("Channel concurrency limit reached",
+				zap.String("channel_id", channel.ID),
+				zap.Int("max_concurrency", channel.MaxConcurrency),
+			)
+			atCapacity = true
+			continue
+		}
+		if err != nil {
+			logger.Warn("Failed to acquire concurrency slot",
+				zap.String("channel_id", channel.ID),
+				zap.Error(err),
+			)
+			continue
+		}
+
+		// 熔断中的渠道不参与选择,释放刚获取的并发位;Redis 异常时不阻断请求
+		allowed, err := s.breaker.Allow(ctx, channel.ID)
+		if err != nil {
+			logger.Warn("Failed to check circuit breaker",
+				zap.String("channel_id", channel.ID),
+				zap.Error(err),
+			)
+		} else if !allowed {
+			logger.Debug("Channel circuit open", zap.String("channel_id", channel.ID))
+			s.ReleaseChannel(context.WithoutCancel(ctx), channel.ID, leaseID)
+			continue
+		}
+
+		logger.Info("Channel selected",
+			zap.String("channel_id", channel.ID),
+			zap.String("channel_name", channel.Name),
+			zap.String("strategy", strategy.Name()),
+		)
+		return channel, leaseID, nil
+	}
+
+	if atCapacity {
+		return nil, "", ErrChannelsBusy
+	}
+	return nil, "", ErrChannelsUnavailable
+}
+
+// WaitForChannel 为指定模型选择渠道,所有渠道满载时进入等待队列
+// 未启用等待队列时等同于 SelectChannel;已有请求排队时新请求直接排到队尾,不与排队中的请求争抢并发位;
+// 渠道均因熔断、不健康或限流冷却不可用时不会有并发位释放,直接返回 ErrChannelsUnavailable 而不排队或继续等待
+func (s *Selector) WaitForChannel(ctx context.Context, model, userID string) (*models.Channel, string, error) {
+	if s.queue == nil {
+		return s.SelectChannel(ctx, model, userID)
+	}
+
+	depth, err := s.queue.Depth(ctx, model)
+	if err != nil {
+		logger.Warn("Failed to get wait queue depth", zap.String("model", model), zap.Error(err))
+	}
+	if err != nil || depth == 0 {
+		channel, leaseID, err := s.SelectChannel(ctx, model, userID)
+		if !errors.Is(err, ErrChannelsBusy) {
+			return channel, leaseID, err
+		}
+	}
+
+	var (
+		channel *models.Channel
+		leaseID string
+	)
+	err = s.queue.wait(ctx, model,
+		func() (int, error) { return s.freeSlots(ctx, model) },
+		func() (bool, error) {
+			var selectErr error
+			channel, leaseID, selectErr = s.SelectChannel(ctx, model, userID)
+			if errors.Is(selectErr, ErrChannelsBusy) {
+				return false, nil
+			}
+			return selectErr == nil, selectErr
+		},
+	)
+	if err != nil {
+		return nil, "", err
+	}
+	return channel, leaseID, nil
+}
+
+// freeSlots 估算可服务该模型的渠道当前空闲并发位总数,熔断、不健康或上游限流冷却中的渠道不计入
+// 可服务该模型的渠道均处于这些状态时返回 ErrChannelsUnavailable,排队中的请求无需继续等待
+func (s *Selector) freeSlots(ctx context.Context, model string) (int, error) {
+	channels, err := s.eligibleChannels(ctx, model)
+	if err != nil {
+		return 0, err
+	}
+
+	limits := s.rateLimitStatuses(ctx, channels)
+	var free int
+	selectable := false
+	for _, ch := range channels {
+		if !s.selectable(ctx, ch, limits) {
+			continue
+		}
+		selectable = true
+		current, err := s.pool.GetConcurrency(ctx, ch.ID)
+		if err != nil {
+			continue
+		}
+		limit, err := s.pool.EffectiveLimit(ctx, ch.ID, ch.MaxConcurrency)
+		if err != nil {
+			continue
+		}
+		free += max(limit-current, 0)
+	}
+	if !selectable {
+		return 0, ErrChannelsUnavailable
+	}
+	return free, nil
+}
+
+// selectable 判断渠道是否可能被选中:未处于上游限流冷却、健康且未熔断,不占用半开状态的探测名额;Redis 异常时视为可选
+func (s *Selector) selectable(ctx context.Context, ch *models.Channel, limits map[string]string) bool {
+	if limits[ch.ID] == RateLimitCooling {
+		return false
+	}
+	if healthy, err := s.health.IsHealthy(ctx, ch.ID); err == nil && !healthy {
+		return false
+	}
+	open, err := s.breaker.IsOpen(ctx, ch.ID)
+	return err != nil || !open
+}
+
+// eligibleChannels 返回可服务该模型、权重大于 0 且有可用密钥的激活渠道
+func (s *Selector) eligibleChannels(ctx context.Context, model string) ([]*models.Channel, error) {
+	// 获取所有渠道(由进程内缓存提供,不查询数据库)
 	channels, err := s.channelRepo.FindAll(ctx)
 	if err != nil {
 		return nil, err
@@ -51,49 +267,191 @@ func (s *Selector) SelectChannel(ctx context.Context) (*models.Channel, error) {
 		return nil, errors.New("no active channels")
 	}
 
-	// 尝试获取并发位(最多尝试所有渠道)
-	tried := make(map[string]bool)
-	for len(tried) < len(activeChannels) {
-		// 加权随机选择
-		channel := s.weightedRandomSelect(activeChannels, tried)
-		if channel == nil {
-			break
+	// 过滤出可服务该模型且仍有可用密钥的渠道
+	eligible := activeChannels[:0]
+	var noKey []string
+	for _, ch := range activeChannels {
+		if !routesModel(ch, model) {
+			continue
 		}
+		if !ch.HasActiveKey() {
+			noKey = append(noKey, ch.ID)
+			continue
+		}
+		eligible = append(eligible, ch)
+	}
 
-		tried[channel.ID] = true
+	// 密钥全部停用的渠道需要管理员处理,单独记录;仍有其他渠道可用时每次选择都会经过这里,只记调试日志
+	if len(eligible) == 0 && len(noKey) > 0 {
+		logger.Warn("Channels skipped: no active key",
+			zap.String("model", model),
+			zap.Strings("channel_ids", noKey),
+		)
+		return nil, fmt.Errorf("%w: all channels serving %s", ErrNoActiveKey, model)
+	}
+	if len(noKey) > 0 {
+		logger.Debug("Channels skipped: no active key",
+			zap.String("model", model),
+			zap.Strings("channel_ids", noKey),
+		)
+	}
+	if len(eligible) == 0 {
+		return nil, fmt.Errorf("%w %s", ErrNoChannelForModel, model)
+	}
+	return eligible, nil
+}
 
-		// 尝试获取并发位
-		acquired, err := s.pool.Acquire(ctx, channel.ID, channel.MaxConcurrency)
-		if err != nil {
-			logger.Warn("Failed to acquire concurrency slot",
+// routesModel 判断渠道是否为激活状态、声明可服务该模型且权重大于 0
+func routesModel(ch *models.Channel, model string) bool {
+	return ch.IsActive && ch.ServesModel(model) && ch.Weight > 0
+}
+
+// CanRoute 判断是否有渠道可以路由指定模型,筛选条件与 SelectChannel 相同,不考虑渠道当前的负载与熔断状态
+func (s *Selector) CanRoute(ctx context.Context, model string) (bool, error) {
+	channels, err := s.channelRepo.FindAll(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, ch := range channels {
+		if routesModel(ch, model) && ch.HasActiveKey() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ReportResult 上报渠道使用 keyID 密钥的一次上游调用的结果与耗时,用于熔断判断、延迟感知策略和自适应并发上限
+// 仅 IsChannelFailure 认定的错误计入失败,并以惩罚延迟计入延迟感知策略,其余错误不影响熔断状态;上游限流或超时会减小渠道的有效并发上限;
+// 密钥被上游拒绝(401/403)而渠道仍有其他可用密钥时,只由 ReportKeyResult 处理该密钥,不计入渠道失败
+func (s *Selector) ReportResult(ctx context.Context, channel *models.Channel, keyID string, latency time.Duration, err error) {
+	if err == nil {
+		s.strategies.ObserveLatency(channel.ID, latency)
+		if err := s.breaker.RecordSuccess(ctx, channel.ID); err != nil {
+			logger.Warn("Failed to record channel success", zap.String("channel_id", channel.ID), zap.Error(err))
+		}
+		if err := s.pool.RecordSuccess(ctx, channel.ID, channel.MaxConcurrency, latency); err != nil {
+			logger.Warn("Failed to grow channel concurrency limit", zap.String("channel_id", channel.ID), zap.Error(err))
+		}
+		return
+	}
+
+	if s.pool.Adaptive() && isOverload(err) {
+		limit, limitErr := s.pool.RecordOverload(ctx, channel.ID, channel.MaxConcurrency)
+		if limitErr != nil {
+			logger.Warn("Failed to shrink channel concurrency limit", zap.String("channel_id", channel.ID), zap.Error(limitErr))
+		} else {
+			logger.Info("Channel concurrency limit decreased",
 				zap.String("channel_id", channel.ID),
+				zap.Int("limit", limit),
 				zap.Error(err),
 			)
-			continue
 		}
+	}
 
-		if acquired {
-			logger.Info("Channel selected",
-				zap.String("channel_id", channel.ID),
-				zap.String("channel_name", channel.Name),
+	if !IsChannelFailure(err) {
+		return
+	}
+	if IsKeyRejected(err) && channel.HasOtherActiveKey(keyID) {
+		return
+	}
+	s.strategies.ObserveFailure(channel.ID)
+
+	tripped, recordErr := s.breaker.RecordFailure(ctx, channel.ID)
+	if recordErr != nil {
+		logger.Warn("Failed to record channel failure", zap.String("channel_id", channel.ID), zap.Error(recordErr))
+		return
+	}
+	if tripped {
+		logger.Warn("Channel circuit opened", zap.String("channel_id", channel.ID), zap.Error(err))
+	}
+}
+
+// ReportRateLimit 上报渠道一次上游响应中的限流信息,rl 为 nil 或未启用限流感知时忽略
+func (s *Selector) ReportRateLimit(ctx context.Context, channelID string, rl *upstream.RateLimit) {
+	if s.rateLimits == nil || rl == nil {
+		return
+	}
+
+	cooling, err := s.rateLimits.Observe(ctx, channelID, rl)
+	if err != nil {
+		logger.Warn("Failed to record channel rate limit", zap.String("channel_id", channelID), zap.Error(err))
+		return
+	}
+	if cooling {
+		logger.Warn("Channel rate limit cooling",
+			zap.String("channel_id", channelID),
+			zap.Int("status_code", rl.StatusCode),
+			zap.Int("remaining_requests", rl.RemainingRequests),
+			zap.Int("remaining_tokens", rl.RemainingTokens),
+			zap.Duration("retry_after", rl.RetryAfter),
+		)
+	}
+}
+
+// rateLimitStatuses 批量查询渠道的上游限流状态,未启用或 Redis 异常时返回空,不阻断请求
+func (s *Selector) rateLimitStatuses(ctx context.Context, channels []*models.Channel) map[string]string {
+	if s.rateLimits == nil {
+		return nil
+	}
+
+	ids := make([]string, 0, len(channels))
+	for _, ch := range channels {
+		ids = append(ids, ch.ID)
+	}
+	statuses, err := s.rateLimits.Statuses(ctx, ids)
+	if err != nil {
+		logger.Warn("Failed to check channel rate limits", zap.Error(err))
+		return nil
+	}
+	return statuses
+}
+
+// PickKey 为一次上游调用选择渠道密钥
+func (s *Selector) PickKey(ctx context.Context, channel *models.Channel) (*models.ChannelKey, error) {
+	return s.keys.Pick(ctx, channel)
+}
+
+// ReportKeyResult 记录一次上游调用中渠道密钥的结果
+// 成功时清零连续被拒绝次数;被上游以 401/403 拒绝时计数,连续拒绝达到阈值后停用该密钥,渠道其余密钥继续服务
+func (s *Selector) ReportKeyResult(ctx context.Context, channelID, keyID string, err error) {
+	if err == nil {
+		if resetErr := s.keys.RecordSuccess(ctx, channelID, keyID); resetErr != nil {
+			logger.Warn("Failed to reset channel key rejections",
+				zap.String("channel_id", channelID),
+				zap.String("key_id", keyID),
+				zap.Error(resetErr),
 			)
-			return channel, nil
 		}
+		return
+	}
+	if !IsKeyRejected(err) {
+		return
+	}
 
-		logger.Debug("Channel concurrency limit reached",
-			zap.String("channel_id", channel.ID),
-			zap.Int("max_concurrency", channel.MaxConcurrency),
+	disabled, disableErr := s.keys.RecordRejection(ctx, channelID, keyID, err.Error())
+	if disableErr != nil {
+		logger.Error("Failed to record channel key rejection",
+			zap.String("channel_id", channelID),
+			zap.String("key_id", keyID),
+			zap.Error(disableErr),
+		)
+		return
+	}
+	if disabled {
+		logger.Warn("Channel key disabled",
+			zap.String("channel_id", channelID),
+			zap.String("key_id", keyID),
+			zap.Error(err),
 		)
 	}
-
-	return nil, errors.New("all channels are at capacity")
 }
 
-// ReleaseChannel 释放渠道并发位
-func (s *Selector) ReleaseChannel(ctx context.Context, channelID string) error {
-	if err := s.pool.Release(ctx, channelID); err != nil {
+// ReleaseChannel 释放渠道并发位租约
+func (s *Selector) ReleaseChannel(ctx context.Context, channelID, leaseID string) error {
+	if err := s.pool.Release(ctx, channelID, leaseID); err != nil {
 		logger.Error("Failed to release concurrency slot",
 			zap.String("channel_id", channelID),
+			zap.String("lease_id", leaseID),
 			zap.Error(err),
 		)
 		return err
@@ -103,32 +461,61 @@ func (s *Selector) ReleaseChannel(ctx context.Context, channelID string) error {
 	return nil
 }
 
-// weightedRandomSelect 加权随机选择渠道
-func (s *Selector) weightedRandomSelect(channels []*models.Channel, tried map[string]bool) *models.Channel {
-	// 计算未尝试渠道的总权重
-	var totalWeight int
-	for _, ch := range channels {
-		if !tried[ch.ID] {
-			totalWeight += ch.Weight
+// RenewLease 为长耗时的异步任务续约并发位租约,租约已丢失时返回 pool.ErrLeaseLost
+func (s *Selector) RenewLease(ctx context.Context, channelID, leaseID string) error {
+	return s.pool.Renew(ctx, channelID, leaseID)
+}
+
+// ReacquireLease 为租约已丢失的异步任务在原渠道重新获取并发位,渠道已满时返回 pool.ErrConcurrencyLimit
+func (s *Selector) ReacquireLease(ctx context.Context, channel *models.Channel) (string, error) {
+	return s.pool.Acquire(ctx, channel.ID, channel.MaxConcurrency)
+}
+
+// priorityTiers 将渠道按优先级从高到低分组
+func priorityTiers(channels []*models.Channel) [][]*models.Channel {
+	sorted := append([]*models.Channel(nil), channels...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority > sorted[j].Priority
+	})
+
+	var tiers [][]*models.Channel
+	for i, ch := range sorted {
+		if i == 0 || ch.Priority != sorted[i-1].Priority {
+			tiers = append(tiers, nil)
 		}
+		tiers[len(tiers)-1] = append(tiers[len(tiers)-1], ch)
 	}
+	return tiers
+}
 
-	if totalWeight == 0 {
-		return nil
+// deprioritizeLimited 将上游配额偏低的渠道移到末尾,其余渠道保持策略给出的顺序
+func deprioritizeLimited(channels []*models.Channel, limits map[string]string) []*models.Channel {
+	if len(limits) == 0 {
+		return channels
 	}
 
-	// 随机选择
-	r := rand.Intn(totalWeight)
-	var cumulative int
+	ordered := make([]*models.Channel, 0, len(channels))
+	var low []*models.Channel
 	for _, ch := range channels {
-		if tried[ch.ID] {
+		if limits[ch.ID] == RateLimitLow {
+			low = append(low, ch)
 			continue
 		}
-		cumulative += ch.Weight
-		if r < cumulative {
-			return ch
-		}
+		ordered = append(ordered, ch)
 	}
+	return append(ordered, low...)
+}
 
-	return nil
+// isOverload 判断错误是否表明上游过载(429 或请求超时),用于减小自适应并发上限
+func isOverload(err error) bool {
+	var apiErr *upstream.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests
+	}
+
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Timeout()
+	}
+	return errors.Is(err, context.DeadlineExceeded)
 }
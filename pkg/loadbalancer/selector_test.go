@@ -0,0 +1,211 @@
+package loadbalancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/869413421/transit/internal/models"
+	"github.com/869413421/transit/internal/repository"
+	"github.com/869413421/transit/pkg/logger"
+	"github.com/869413421/transit/pkg/pool"
+	"github.com/869413421/transit/pkg/upstream"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestMain(m *testing.M) {
+	if err := logger.Init("production"); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// staticChannelRepo 返回固定渠道列表的渠道仓储
+type staticChannelRepo struct {
+	repository.ChannelRepository
+	channels []*models.Channel
+}
+
+func (r *staticChannelRepo) FindAll(ctx context.Context) ([]*models.Channel, error) {
+	return r.channels, nil
+}
+
+func TestSelectChannelNoChannelForModel(t *testing.T) {
+	activeKeys := []models.ChannelKey{{ID: "k0", IsActive: true}}
+	selector := NewSelector(&staticChannelRepo{channels: []*models.Channel{
+		{ID: "gemini", IsActive: true, Weight: 1, Models: []string{"gemini-*"}, Keys: activeKeys},
+		{ID: "inactive", IsActive: false, Weight: 1, Keys: activeKeys},
+		{ID: "drained", IsActive: true, Weight: 0, Keys: activeKeys},
+	}}, nil, nil, nil, nil, nil, nil, nil)
+
+	_, _, err := selector.SelectChannel(context.Background(), "gpt-4o", "")
+	if !errors.Is(err, ErrNoChannelForModel) {
+		t.Fatalf("SelectChannel() error = %v, want ErrNoChannelForModel", err)
+	}
+}
+
+func TestSelectChannelNoActiveKey(t *testing.T) {
+	selector := NewSelector(&staticChannelRepo{channels: []*models.Channel{
+		{ID: "keyless", IsActive: true, Weight: 1, Keys: []models.ChannelKey{{ID: "k0", IsActive: false}}},
+		{ID: "gemini", IsActive: true, Weight: 1, Models: []string{"gemini-*"}, Keys: []models.ChannelKey{{ID: "k1", IsActive: true}}},
+	}}, nil, nil, nil, nil, nil, nil, nil)
+
+	// 可服务该模型的渠道密钥均已停用时与没有渠道声明该模型区分
+	_, _, err := selector.SelectChannel(context.Background(), "gpt-4o", "")
+	if !errors.Is(err, ErrNoActiveKey) || errors.Is(err, ErrNoChannelForModel) {
+		t.Fatalf("SelectChannel() error = %v, want ErrNoActiveKey", err)
+	}
+}
+
+// redisSelector 使用 miniredis 并发池与熔断器的选择器测试环境
+type redisSelector struct {
+	*Selector
+	server  *miniredis.Miniredis
+	client  *redis.Client
+	pool    *pool.RedisPool
+	breaker *CircuitBreaker
+}
+
+// newRedisSelector 创建选择器,熔断器连续失败一次即熔断,半开状态只放行一个探测请求
+func newRedisSelector(t *testing.T, channels ...*models.Channel) *redisSelector {
+	t.Helper()
+	server, client := newTestRedis(t)
+	redisPool := pool.NewRedisPool(client, time.Minute, nil)
+	breaker := NewCircuitBreaker(client, 1, time.Minute, 1)
+	strategies, err := NewStrategies(StrategyWeightedRandom, nil, redisPool)
+	if err != nil {
+		t.Fatalf("NewStrategies: %v", err)
+	}
+	for _, ch := range channels {
+		ch.Keys = []models.ChannelKey{{ID: ch.ID + "-key", IsActive: true}}
+	}
+	selector := NewSelector(&staticChannelRepo{channels: channels}, redisPool, breaker,
+		NewHealthTracker(client, 3, time.Minute), strategies, nil, nil, NewKeyRotator(client, nil, 0))
+	return &redisSelector{Selector: selector, server: server, client: client, pool: redisPool, breaker: breaker}
+}
+
+func TestSelectChannelBusyKeepsHalfOpenProbe(t *testing.T) {
+	s := newRedisSelector(t, &models.Channel{ID: "ch0", IsActive: true, Weight: 1, MaxConcurrency: 1})
+	ctx := context.Background()
+
+	s.breaker.RecordFailure(ctx, "ch0")
+	expireBreakerWindow(t, s.server, "ch0")
+	if _, err := s.pool.Acquire(ctx, "ch0", 1); err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+
+	// 满载的渠道不消耗半开状态的探测名额
+	if _, _, err := s.SelectChannel(ctx, "gpt-4o", ""); !errors.Is(err, ErrChannelsBusy) {
+		t.Fatalf("SelectChannel() error = %v, want ErrChannelsBusy", err)
+	}
+	if allowed, err := s.breaker.Allow(ctx, "ch0"); err != nil || !allowed {
+		t.Fatalf("Allow() = %v, %v; want the probe still available", allowed, err)
+	}
+}
+
+func TestSelectChannelOpenBreakerReleasesLease(t *testing.T) {
+	s := newRedisSelector(t, &models.Channel{ID: "ch0", IsActive: true, Weight: 1, MaxConcurrency: 1})
+	ctx := context.Background()
+
+	s.breaker.RecordFailure(ctx, "ch0")
+	if _, _, err := s.SelectChannel(ctx, "gpt-4o", ""); !errors.Is(err, ErrChannelsUnavailable) {
+		t.Fatalf("SelectChannel() error = %v, want ErrChannelsUnavailable", err)
+	}
+	// 熔断拒绝后释放获取的并发位
+	if n, err := s.pool.GetConcurrency(ctx, "ch0"); err != nil || n != 0 {
+		t.Fatalf("GetConcurrency() = %d, %v; want the lease released", n, err)
+	}
+}
+
+func TestWaitForChannelUnavailableFailsFast(t *testing.T) {
+	s := newRedisSelector(t, &models.Channel{ID: "ch0", IsActive: true, Weight: 1, MaxConcurrency: 1})
+	s.queue = NewWaitQueue(s.client, 10, 5*time.Second, 5*time.Millisecond)
+	ctx := context.Background()
+	s.breaker.RecordFailure(ctx, "ch0")
+
+	// 渠道熔断时不会有并发位释放,不进入等待队列
+	start := time.Now()
+	if _, _, err := s.WaitForChannel(ctx, "gpt-4o", ""); !errors.Is(err, ErrChannelsUnavailable) {
+		t.Fatalf("WaitForChannel() error = %v, want ErrChannelsUnavailable", err)
+	}
+	// 已有请求排队时同样直接返回,不等到排队超时
+	s.server.ZAdd(queueKey("gpt-4o"), float64(time.Now().UnixMilli()), "other-request")
+	if _, _, err := s.WaitForChannel(ctx, "gpt-4o", ""); !errors.Is(err, ErrChannelsUnavailable) {
+		t.Fatalf("WaitForChannel() with queued requests error = %v, want ErrChannelsUnavailable", err)
+	}
+	if waited := time.Since(start); waited > time.Second {
+		t.Fatalf("WaitForChannel() waited %v, want it to fail fast", waited)
+	}
+}
+
+func TestWaitForChannelQueuesWhenAtCapacity(t *testing.T) {
+	s := newRedisSelector(t, &models.Channel{ID: "ch0", IsActive: true, Weight: 1, MaxConcurrency: 1})
+	s.queue = NewWaitQueue(s.client, 10, 5*time.Second, 5*time.Millisecond)
+	ctx := context.Background()
+	leaseID, err := s.pool.Acquire(ctx, "ch0", 1)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	time.AfterFunc(50*time.Millisecond, func() { s.pool.Release(context.Background(), "ch0", leaseID) })
+
+	// 渠道满载时排队,并发位释放后获得渠道
+	channel, _, err := s.WaitForChannel(ctx, "gpt-4o", "")
+	if err != nil || channel.ID != "ch0" {
+		t.Fatalf("WaitForChannel() = %v, %v; want ch0 after the slot is released", channel, err)
+	}
+}
+
+func TestPriorityTiers(t *testing.T) {
+	channels := newChannels(10, 10, 10, 10, 10)
+	for i, priority := range []int{0, 5, 0, -1, 5} {
+		channels[i].Priority = priority
+	}
+
+	tiers := priorityTiers(channels)
+	got := make([]string, len(tiers))
+	for i, tier := range tiers {
+		got[i] = fmt.Sprint(channelIDs(tier))
+	}
+
+	// 优先级从高到低分组,同级内保持原有顺序
+	want := []string{"[ch1 ch4]", "[ch0 ch2]", "[ch3]"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("priorityTiers() = %v, want %v", got, want)
+	}
+	if fmt.Sprint(channelIDs(channels)) != "[ch0 ch1 ch2 ch3 ch4]" {
+		t.Fatal("priorityTiers() reordered its input")
+	}
+}
+
+func TestPriorityTiersSingleTier(t *testing.T) {
+	if tiers := priorityTiers(newChannels(1, 2)); len(tiers) != 1 || len(tiers[0]) != 2 {
+		t.Fatalf("priorityTiers() = %v, want one tier", tiers)
+	}
+	if tiers := priorityTiers([]*models.Channel{}); len(tiers) != 0 {
+		t.Fatalf("priorityTiers() = %v, want no tiers", tiers)
+	}
+}
+
+func TestReportResultKeyRejection(t *testing.T) {
+	multiKey := &models.Channel{ID: "multi", IsActive: true, Weight: 1, MaxConcurrency: 1}
+	singleKey := &models.Channel{ID: "single", IsActive: true, Weight: 1, MaxConcurrency: 1}
+	s := newRedisSelector(t, multiKey, singleKey)
+	multiKey.Keys = append(multiKey.Keys, models.ChannelKey{ID: "multi-key-2", IsActive: true})
+	ctx := context.Background()
+	unauthorized := &upstream.APIError{StatusCode: 401}
+
+	// 渠道还有其他可用密钥时,密钥被拒绝不触发渠道熔断
+	s.ReportResult(ctx, multiKey, "multi-key", time.Second, unauthorized)
+	if allowed, err := s.breaker.Allow(ctx, "multi"); err != nil || !allowed {
+		t.Fatalf("Allow(multi) = %v, %v; want the circuit closed", allowed, err)
+	}
+	// 唯一的密钥被拒绝时渠道无法服务,计入渠道失败
+	s.ReportResult(ctx, singleKey, "single-key", time.Second, unauthorized)
+	if allowed, err := s.breaker.Allow(ctx, "single"); err != nil || allowed {
+		t.Fatalf("Allow(single) = %v, %v; want the circuit open", allowed, err)
+	}
+}
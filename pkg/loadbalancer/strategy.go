@@ -0,0 +1,342 @@
+package loadbalancer
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/869413421/transit/internal/models"
+	"github.com/869413421/transit/pkg/logger"
+	"github.com/869413421/transit/pkg/pool"
+	"github.com/869413421/transit/pkg/upstream"
+	"go.uber.org/zap"
+)
+
+// 内置负载均衡策略名称
+const (
+	StrategyWeightedRandom = "weighted_random" // 按权重随机
+	StrategyLeastInFlight  = "least_inflight"  // 并发占用率最低优先
+	StrategyEWMALatency    = "ewma_latency"    // 延迟滑动平均最低优先
+	StrategyConsistentHash = "consistent_hash" // 按用户 ID 一致性哈希
+)
+
+// Strategy 负载均衡策略
+// Order 返回候选渠道的尝试顺序,Selector 按顺序尝试获取并发位,首个获取成功的渠道被选中;
+// 传入的渠道均为激活、可服务请求模型且权重大于 0 的渠道
+type Strategy interface {
+	Name() string
+	Order(ctx context.Context, channels []*models.Channel, userID string) []*models.Channel
+}
+
+// LatencyObserver 需要感知上游调用延迟的策略
+// ObserveFailure 在渠道调用失败时通知,失败没有可用的延迟样本
+type LatencyObserver interface {
+	ObserveLatency(channelID string, latency time.Duration)
+	ObserveFailure(channelID string)
+}
+
+// Strategies 全局默认策略与按模型覆盖的策略
+type Strategies struct {
+	defaultStrategy Strategy
+	byModel         map[string]Strategy
+	observers       []LatencyObserver
+}
+
+// NewStrategies 按名称创建负载均衡策略,同名策略共享同一实例
+// byModel 为模型名到策略名的映射,未配置的模型使用 defaultName
+func NewStrategies(defaultName string, byModel map[string]string, pool *pool.RedisPool) (*Strategies, error) {
+	instances := make(map[string]Strategy)
+	s := &Strategies{byModel: make(map[string]Strategy)}
+
+	get := func(name string) (Strategy, error) {
+		if name == "" {
+			name = StrategyWeightedRandom
+		}
+		if strategy, ok := instances[name]; ok {
+			return strategy, nil
+		}
+
+		var strategy Strategy
+		switch name {
+		case StrategyWeightedRandom:
+			strategy = &weightedRandom{}
+		case StrategyLeastInFlight:
+			strategy = &leastInFlight{pool: pool}
+		case StrategyEWMALatency:
+			strategy = newEWMALatency()
+		case StrategyConsistentHash:
+			strategy = &consistentHash{}
+		default:
+			return nil, fmt.Errorf("unknown load balancing strategy: %s", name)
+		}
+
+		instances[name] = strategy
+		if observer, ok := strategy.(LatencyObserver); ok {
+			s.observers = append(s.observers, observer)
+		}
+		return strategy, nil
+	}
+
+	var err error
+	if s.defaultStrategy, err = get(defaultName); err != nil {
+		return nil, err
+	}
+	for model, name := range byModel {
+		if s.byModel[model], err = get(name); err != nil {
+			return nil, fmt.Errorf("model %s: %w", model, err)
+		}
+	}
+	return s, nil
+}
+
+// For 返回模型使用的策略
+func (s *Strategies) For(model string) Strategy {
+	if strategy, ok := s.byModel[model]; ok {
+		return strategy
+	}
+	return s.defaultStrategy
+}
+
+// ObserveLatency 将一次成功调用的延迟通知给需要感知延迟的策略
+func (s *Strategies) ObserveLatency(channelID string, latency time.Duration) {
+	for _, observer := range s.observers {
+		observer.ObserveLatency(channelID, latency)
+	}
+}
+
+// ObserveFailure 将一次渠道失败通知给需要感知延迟的策略
+func (s *Strategies) ObserveFailure(channelID string) {
+	for _, observer := range s.observers {
+		observer.ObserveFailure(channelID)
+	}
+}
+
+// weightedRandom 加权随机策略
+// 每次按权重随机抽取一个尚未排序的渠道,权重越高越靠前的概率越大
+type weightedRandom struct{}
+
+func (w *weightedRandom) Name() string { return StrategyWeightedRandom }
+
+func (w *weightedRandom) Order(_ context.Context, channels []*models.Channel, _ string) []*models.Channel {
+	return weightedShuffle(channels)
+}
+
+// weightedShuffle 按权重随机排列渠道
+func weightedShuffle(channels []*models.Channel) []*models.Channel {
+	ordered := make([]*models.Channel, 0, len(channels))
+	picked := make(map[string]bool, len(channels))
+	for len(ordered) < len(channels) {
+		channel := weightedRandomSelect(channels, picked)
+		if channel == nil {
+			break
+		}
+		picked[channel.ID] = true
+		ordered = append(ordered, channel)
+	}
+	return ordered
+}
+
+// weightedRandomSelect 加权随机选择渠道
+func weightedRandomSelect(channels []*models.Channel, tried map[string]bool) *models.Channel {
+	// 计算未尝试渠道的总权重
+	var totalWeight int
+	for _, ch := range channels {
+		if !tried[ch.ID] {
+			totalWeight += ch.Weight
+		}
+	}
+
+	if totalWeight == 0 {
+		return nil
+	}
+
+	// 随机选择
+	r := rand.Intn(totalWeight)
+	var cumulative int
+	for _, ch := range channels {
+		if tried[ch.ID] {
+			continue
+		}
+		cumulative += ch.Weight
+		if r < cumulative {
+			return ch
+		}
+	}
+
+	return nil
+}
+
+// leastInFlight 最少并发策略
+// 按当前并发数占有效并发上限的比例升序排列,比例相同时权重高者优先,适合视频等长耗时任务
+type leastInFlight struct {
+	pool *pool.RedisPool
+}
+
+func (l *leastInFlight) Name() string { return StrategyLeastInFlight }
+
+func (l *leastInFlight) Order(ctx context.Context, channels []*models.Channel, _ string) []*models.Channel {
+	load := make(map[string]float64, len(channels))
+	for _, ch := range channels {
+		current, err := l.pool.GetConcurrency(ctx, ch.ID)
+		if err != nil {
+			// 无法获取并发数时排在最后
+			logger.Warn("Failed to get channel concurrency", zap.String("channel_id", ch.ID), zap.Error(err))
+			load[ch.ID] = math.Inf(1)
+			continue
+		}
+		limit, err := l.pool.EffectiveLimit(ctx, ch.ID, ch.MaxConcurrency)
+		if err != nil || limit <= 0 {
+			load[ch.ID] = math.Inf(1)
+			continue
+		}
+		load[ch.ID] = float64(current) / float64(limit)
+	}
+
+	// 先随机打乱,使负载与权重都相同的渠道均匀分担流量
+	ordered := shuffled(channels)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, b := ordered[i], ordered[j]
+		if load[a.ID] != load[b.ID] {
+			return load[a.ID] < load[b.ID]
+		}
+		return a.Weight > b.Weight
+	})
+	return ordered
+}
+
+// ewmaAlpha 延迟滑动平均的平滑系数,越大越偏向最近的样本
+const ewmaAlpha = 0.3
+
+// ewmaStaleAfter 延迟样本的有效期,过期后视为未知,使慢渠道恢复后能重新获得流量
+const ewmaStaleAfter = time.Minute
+
+// ewmaFailurePenalty 渠道失败计入滑动平均的惩罚延迟,取上游请求超时时间
+const ewmaFailurePenalty = upstream.RequestTimeout
+
+// ewmaLatency 延迟感知策略
+// 记录每个渠道调用延迟的指数加权移动平均(EWMA),按平均延迟升序排列;失败按惩罚延迟计入,
+// 快速失败的渠道不会因此排在前面。没有有效样本的渠道按已采样渠道的平均值排序,
+// 既能分到流量完成采样,又不会压过已知较快的渠道。延迟保存在本实例内存中
+type ewmaLatency struct {
+	mu      sync.Mutex
+	samples map[string]*latencySample
+}
+
+// latencySample 渠道延迟滑动平均
+type latencySample struct {
+	ewma    float64 // 毫秒
+	updated time.Time
+}
+
+func newEWMALatency() *ewmaLatency {
+	return &ewmaLatency{samples: make(map[string]*latencySample)}
+}
+
+func (e *ewmaLatency) Name() string { return StrategyEWMALatency }
+
+func (e *ewmaLatency) ObserveLatency(channelID string, latency time.Duration) {
+	ms := float64(latency) / float64(time.Millisecond)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	sample, ok := e.samples[channelID]
+	if !ok || time.Since(sample.updated) > ewmaStaleAfter {
+		e.samples[channelID] = &latencySample{ewma: ms, updated: time.Now()}
+		return
+	}
+	sample.ewma = ewmaAlpha*ms + (1-ewmaAlpha)*sample.ewma
+	sample.updated = time.Now()
+}
+
+func (e *ewmaLatency) ObserveFailure(channelID string) {
+	e.ObserveLatency(channelID, ewmaFailurePenalty)
+}
+
+func (e *ewmaLatency) Order(_ context.Context, channels []*models.Channel, _ string) []*models.Channel {
+	latency := make(map[string]float64, len(channels))
+	var total float64
+	e.mu.Lock()
+	for _, ch := range channels {
+		if sample, ok := e.samples[ch.ID]; ok && time.Since(sample.updated) <= ewmaStaleAfter {
+			latency[ch.ID] = sample.ewma
+			total += sample.ewma
+		}
+	}
+	e.mu.Unlock()
+
+	// 未采样或样本已过期的渠道取已采样渠道的平均延迟
+	if len(latency) > 0 {
+		mean := total / float64(len(latency))
+		for _, ch := range channels {
+			if _, ok := latency[ch.ID]; !ok {
+				latency[ch.ID] = mean
+			}
+		}
+	}
+
+	// 先按权重随机排列,未采样或延迟相同的渠道仍按权重分担流量
+	ordered := weightedShuffle(channels)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return latency[ordered[i].ID] < latency[ordered[j].ID]
+	})
+	return ordered
+}
+
+// consistentHash 一致性哈希策略
+// 使用带权重的最高随机权重哈希(rendezvous hashing),同一用户稳定地落到同一渠道以提高上游缓存命中率,
+// 渠道增减时只影响原本落在该渠道上的用户;未提供用户 ID 时退化为加权随机
+type consistentHash struct{}
+
+func (h *consistentHash) Name() string { return StrategyConsistentHash }
+
+func (h *consistentHash) Order(_ context.Context, channels []*models.Channel, userID string) []*models.Channel {
+	if userID == "" {
+		return weightedShuffle(channels)
+	}
+
+	score := make(map[string]float64, len(channels))
+	for _, ch := range channels {
+		score[ch.ID] = rendezvousScore(userID, ch)
+	}
+
+	ordered := append([]*models.Channel(nil), channels...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return score[ordered[i].ID] > score[ordered[j].ID]
+	})
+	return ordered
+}
+
+// rendezvousScore 计算用户与渠道的加权哈希得分,得分越高越优先
+// 得分为 -weight/ln(u),u 为 (0,1) 区间内的均匀哈希值,各渠道被选为首选的概率与权重成正比
+func rendezvousScore(key string, channel *models.Channel) float64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h.Write([]byte{0})
+	h.Write([]byte(channel.ID))
+
+	// FNV 对短字符串高位扩散不足,先做一次 splitmix64 混合
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+
+	u := (float64(x>>11) + 0.5) / (1 << 53)
+	return -float64(channel.Weight) / math.Log(u)
+}
+
+// shuffled 返回随机打乱后的渠道副本
+func shuffled(channels []*models.Channel) []*models.Channel {
+	ordered := append([]*models.Channel(nil), channels...)
+	rand.Shuffle(len(ordered), func(i, j int) {
+		ordered[i], ordered[j] = ordered[j], ordered[i]
+	})
+	return ordered
+}
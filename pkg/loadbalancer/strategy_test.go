@@ -0,0 +1,257 @@
+package loadbalancer
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/869413421/transit/internal/models"
+)
+
+// newChannels 按权重创建测试渠道,ID 依次为 ch0、ch1...
+func newChannels(weights ...int) []*models.Channel {
+	channels := make([]*models.Channel, len(weights))
+	for i, weight := range weights {
+		channels[i] = &models.Channel{ID: fmt.Sprintf("ch%d", i), Weight: weight, MaxConcurrency: 10, IsActive: true}
+	}
+	return channels
+}
+
+// channelIDs 返回渠道 ID 序列
+func channelIDs(channels []*models.Channel) []string {
+	ids := make([]string, len(channels))
+	for i, ch := range channels {
+		ids[i] = ch.ID
+	}
+	return ids
+}
+
+// assertShare 断言观测比例与期望比例的偏差在容差内
+func assertShare(t *testing.T, name string, got, total int, want float64) {
+	t.Helper()
+	share := float64(got) / float64(total)
+	if math.Abs(share-want) > 0.03 {
+		t.Errorf("%s share = %.3f, want %.3f", name, share, want)
+	}
+}
+
+func TestWeightedShuffleIsPermutation(t *testing.T) {
+	channels := newChannels(1, 5, 10, 3)
+	for i := 0; i < 100; i++ {
+		ordered := weightedShuffle(channels)
+		if len(ordered) != len(channels) {
+			t.Fatalf("weightedShuffle() returned %d channels, want %d", len(ordered), len(channels))
+		}
+		seen := make(map[string]bool)
+		for _, ch := range ordered {
+			if seen[ch.ID] {
+				t.Fatalf("channel %s returned twice: %v", ch.ID, channelIDs(ordered))
+			}
+			seen[ch.ID] = true
+		}
+	}
+}
+
+func TestWeightedShuffleFirstPickFollowsWeight(t *testing.T) {
+	channels := newChannels(1, 3, 6)
+	const rounds = 20000
+	first := make(map[string]int)
+	for i := 0; i < rounds; i++ {
+		first[weightedShuffle(channels)[0].ID]++
+	}
+	assertShare(t, "ch0", first["ch0"], rounds, 0.1)
+	assertShare(t, "ch1", first["ch1"], rounds, 0.3)
+	assertShare(t, "ch2", first["ch2"], rounds, 0.6)
+}
+
+func TestWeightedShuffleSkipsZeroWeight(t *testing.T) {
+	ordered := weightedShuffle(newChannels(0, 2))
+	if len(ordered) != 1 || ordered[0].ID != "ch1" {
+		t.Fatalf("weightedShuffle() = %v, want only the weighted channel", channelIDs(ordered))
+	}
+	if got := weightedRandomSelect(newChannels(0, 0), nil); got != nil {
+		t.Fatalf("weightedRandomSelect() = %s, want nil when all weights are zero", got.ID)
+	}
+}
+
+func TestConsistentHashIsStable(t *testing.T) {
+	strategy := &consistentHash{}
+	channels := newChannels(10, 10, 10, 10)
+
+	for i := 0; i < 50; i++ {
+		userID := fmt.Sprintf("user-%d", i)
+		want := channelIDs(strategy.Order(context.Background(), channels, userID))
+
+		// 输入顺序不影响结果
+		reversed := []*models.Channel{channels[3], channels[2], channels[1], channels[0]}
+		if got := channelIDs(strategy.Order(context.Background(), reversed, userID)); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("%s: order %v depends on input order, want %v", userID, got, want)
+		}
+	}
+}
+
+func TestConsistentHashFirstPickFollowsWeight(t *testing.T) {
+	strategy := &consistentHash{}
+	channels := newChannels(1, 3, 6)
+	const users = 20000
+	first := make(map[string]int)
+	for i := 0; i < users; i++ {
+		first[strategy.Order(context.Background(), channels, fmt.Sprintf("user-%d", i))[0].ID]++
+	}
+	assertShare(t, "ch0", first["ch0"], users, 0.1)
+	assertShare(t, "ch1", first["ch1"], users, 0.3)
+	assertShare(t, "ch2", first["ch2"], users, 0.6)
+}
+
+func TestConsistentHashMinimalDisruption(t *testing.T) {
+	strategy := &consistentHash{}
+	channels := newChannels(10, 10, 10, 10)
+	removed := channels[:3] // 移除 ch3
+
+	for i := 0; i < 1000; i++ {
+		userID := fmt.Sprintf("user-%d", i)
+		before := strategy.Order(context.Background(), channels, userID)[0].ID
+		after := strategy.Order(context.Background(), removed, userID)[0].ID
+		// 只有原本落在被移除渠道上的用户会迁移
+		if before != "ch3" && before != after {
+			t.Fatalf("%s moved from %s to %s after removing ch3", userID, before, after)
+		}
+	}
+}
+
+func TestRendezvousScore(t *testing.T) {
+	ch := &models.Channel{ID: "ch0", Weight: 10}
+	score := rendezvousScore("user-1", ch)
+	if score <= 0 || math.IsInf(score, 0) || math.IsNaN(score) {
+		t.Fatalf("rendezvousScore() = %v, want finite positive score", score)
+	}
+	if again := rendezvousScore("user-1", ch); again != score {
+		t.Fatalf("rendezvousScore() not deterministic: %v != %v", again, score)
+	}
+
+	// 得分与权重成正比
+	doubled := rendezvousScore("user-1", &models.Channel{ID: "ch0", Weight: 20})
+	if math.Abs(doubled-2*score) > 1e-9*score {
+		t.Fatalf("rendezvousScore() with double weight = %v, want %v", doubled, 2*score)
+	}
+}
+
+func TestConsistentHashWithoutUserFallsBackToWeightedRandom(t *testing.T) {
+	ordered := (&consistentHash{}).Order(context.Background(), newChannels(0, 5), "")
+	if len(ordered) != 1 || ordered[0].ID != "ch1" {
+		t.Fatalf("Order() = %v, want weighted random order", channelIDs(ordered))
+	}
+}
+
+func TestEWMALatencyOrder(t *testing.T) {
+	strategy := newEWMALatency()
+	channels := newChannels(10, 10, 10)
+
+	strategy.ObserveLatency("ch0", 300*time.Millisecond)
+	strategy.ObserveLatency("ch1", 100*time.Millisecond)
+
+	// 按平均延迟升序,未采样的渠道取已采样渠道的平均值(200ms)
+	ordered := channelIDs(strategy.Order(context.Background(), channels, ""))
+	if fmt.Sprint(ordered) != "[ch1 ch2 ch0]" {
+		t.Fatalf("Order() = %v, want [ch1 ch2 ch0]", ordered)
+	}
+
+	// 新样本按平滑系数计入平均值
+	strategy.ObserveLatency("ch1", 1100*time.Millisecond)
+	if got, want := strategy.samples["ch1"].ewma, ewmaAlpha*1100+(1-ewmaAlpha)*100; math.Abs(got-want) > 1e-9 {
+		t.Fatalf("ewma = %v, want %v", got, want)
+	}
+	ordered = channelIDs(strategy.Order(context.Background(), channels, ""))
+	if fmt.Sprint(ordered) != "[ch0 ch2 ch1]" {
+		t.Fatalf("Order() = %v, want [ch0 ch2 ch1]", ordered)
+	}
+}
+
+func TestEWMALatencyFailurePenalty(t *testing.T) {
+	strategy := newEWMALatency()
+	channels := newChannels(10, 10)
+
+	strategy.ObserveLatency("ch0", 50*time.Millisecond)
+	strategy.ObserveLatency("ch1", 200*time.Millisecond)
+	if ordered := channelIDs(strategy.Order(context.Background(), channels, "")); ordered[0] != "ch0" {
+		t.Fatalf("Order() = %v, want the fastest channel first", ordered)
+	}
+
+	// 快速失败的渠道按惩罚延迟计入,不再排在前面
+	strategy.ObserveFailure("ch0")
+	if ordered := channelIDs(strategy.Order(context.Background(), channels, "")); fmt.Sprint(ordered) != "[ch1 ch0]" {
+		t.Fatalf("Order() = %v, want the failing channel last", ordered)
+	}
+	if got, want := strategy.samples["ch0"].ewma, ewmaAlpha*float64(ewmaFailurePenalty/time.Millisecond)+(1-ewmaAlpha)*50; math.Abs(got-want) > 1e-9 {
+		t.Fatalf("ewma = %v, want %v", got, want)
+	}
+}
+
+func TestEWMALatencyStaleSamples(t *testing.T) {
+	strategy := newEWMALatency()
+	strategy.ObserveLatency("ch0", 100*time.Millisecond)
+	strategy.ObserveLatency("ch1", 50*time.Millisecond)
+	strategy.ObserveLatency("ch2", 300*time.Millisecond)
+	strategy.samples["ch1"].updated = time.Now().Add(-2 * ewmaStaleAfter)
+
+	// 过期样本视为未知,取其余渠道的平均值(200ms),慢渠道恢复后重新获得流量
+	ordered := channelIDs(strategy.Order(context.Background(), newChannels(10, 10, 10), ""))
+	if fmt.Sprint(ordered) != "[ch0 ch1 ch2]" {
+		t.Fatalf("Order() = %v, want [ch0 ch1 ch2]", ordered)
+	}
+
+	// 过期后的新样本重新开始计算平均值
+	strategy.ObserveLatency("ch1", 400*time.Millisecond)
+	if got := strategy.samples["ch1"].ewma; got != 400 {
+		t.Fatalf("ewma = %v, want 400 after a stale sample", got)
+	}
+}
+
+func TestEWMALatencyWithoutSamples(t *testing.T) {
+	// 没有任何样本时按权重随机排列
+	ordered := newEWMALatency().Order(context.Background(), newChannels(0, 5), "")
+	if len(ordered) != 1 || ordered[0].ID != "ch1" {
+		t.Fatalf("Order() = %v, want weighted random order", channelIDs(ordered))
+	}
+}
+
+func TestNewStrategies(t *testing.T) {
+	strategies, err := NewStrategies("", map[string]string{
+		"gpt-4o":     StrategyEWMALatency,
+		"gpt-4o-pro": StrategyEWMALatency,
+		"claude-3":   StrategyConsistentHash,
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewStrategies: %v", err)
+	}
+
+	if name := strategies.For("unknown-model").Name(); name != StrategyWeightedRandom {
+		t.Fatalf("default strategy = %s, want %s", name, StrategyWeightedRandom)
+	}
+	if name := strategies.For("claude-3").Name(); name != StrategyConsistentHash {
+		t.Fatalf("claude-3 strategy = %s", name)
+	}
+
+	// 同名策略共享实例,延迟样本对所有使用该策略的模型可见
+	if strategies.For("gpt-4o") != strategies.For("gpt-4o-pro") {
+		t.Fatal("models configured with the same strategy got different instances")
+	}
+	if len(strategies.observers) != 1 {
+		t.Fatalf("got %d latency observers, want 1", len(strategies.observers))
+	}
+	strategies.ObserveLatency("ch0", time.Second)
+	if _, ok := strategies.For("gpt-4o").(*ewmaLatency).samples["ch0"]; !ok {
+		t.Fatal("ObserveLatency() did not reach the latency strategy")
+	}
+}
+
+func TestNewStrategiesUnknownName(t *testing.T) {
+	if _, err := NewStrategies("fastest", nil, nil); err == nil {
+		t.Fatal("NewStrategies() accepted an unknown default strategy")
+	}
+	if _, err := NewStrategies("", map[string]string{"gpt-4o": "fastest"}, nil); err == nil {
+		t.Fatal("NewStrategies() accepted an unknown model strategy")
+	}
+}
@@ -2,6 +2,7 @@ package poller
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/869413421/transit/internal/models"
@@ -10,6 +11,7 @@ import (
 	"github.com/869413421/transit/pkg/billing"
 	"github.com/869413421/transit/pkg/loadbalancer"
 	"github.com/869413421/transit/pkg/logger"
+	"github.com/869413421/transit/pkg/pool"
 	"github.com/869413421/transit/pkg/upstream"
 	"go.uber.org/zap"
 )
@@ -74,6 +76,9 @@ func (p *Poller) Stop() {
 
 // pollTasks 轮询任务
 func (p *Poller) pollTasks(ctx context.Context) {
+	// 先为所有运行中的任务续约,不受单批处理数量限制,也不依赖查询上游状态的后续步骤
+	p.renewLeases(ctx)
+
 	// 获取待处理任务
 	tasks, err := p.taskService.GetPendingTasks(ctx, p.batchSize)
 	if err != nil {
@@ -98,6 +103,73 @@ func (p *Poller) pollTasks(ctx context.Context) {
 	}
 }
 
+// renewLeases 续约所有仍占用并发位的运行中任务的租约,避免长耗时任务运行期间租约到期被回收
+func (p *Poller) renewLeases(ctx context.Context) {
+	tasks, err := p.taskService.GetLeasedTasks(ctx)
+	if err != nil {
+		logger.Error("Failed to get leased tasks", zap.Error(err))
+		return
+	}
+	for _, task := range tasks {
+		p.renewLease(ctx, task)
+	}
+}
+
+// renewLease 续约任务的并发位租约
+// 租约已到期或被管理员重置时,任务仍在上游运行:尝试在原渠道重新获取并发位,渠道已满则任务不再占用并发位
+func (p *Poller) renewLease(ctx context.Context, task *models.Task) {
+	err := p.selector.RenewLease(ctx, task.ChannelID, task.LeaseID)
+	if err == nil {
+		return
+	}
+	if !errors.Is(err, pool.ErrLeaseLost) {
+		logger.Warn("Failed to renew lease",
+			zap.String("task_id", task.ID),
+			zap.Error(err),
+		)
+		return
+	}
+
+	// 渠道查询失败时保留原租约记录,下一轮再处理
+	channel, err := p.channelRepo.FindByID(ctx, task.ChannelID)
+	if err != nil {
+		logger.Warn("Lease lost, failed to find channel",
+			zap.String("task_id", task.ID),
+			zap.String("channel_id", task.ChannelID),
+			zap.Error(err),
+		)
+		return
+	}
+
+	leaseID, err := p.selector.ReacquireLease(ctx, channel)
+	if err != nil {
+		logger.Warn("Lease lost, task continues without a concurrency slot",
+			zap.String("task_id", task.ID),
+			zap.String("channel_id", task.ChannelID),
+			zap.String("lease_id", task.LeaseID),
+			zap.Error(err),
+		)
+		leaseID = ""
+	} else {
+		logger.Warn("Lease lost, reacquired a concurrency slot",
+			zap.String("task_id", task.ID),
+			zap.String("channel_id", task.ChannelID),
+			zap.String("lease_id", leaseID),
+		)
+	}
+
+	if err := p.taskService.UpdateTaskLease(ctx, task.ID, leaseID); err != nil {
+		logger.Error("Failed to update task lease",
+			zap.String("task_id", task.ID),
+			zap.Error(err),
+		)
+		// 新租约未能记录到任务上,释放以免泄漏到到期
+		if leaseID != "" {
+			p.selector.ReleaseChannel(ctx, task.ChannelID, leaseID)
+		}
+	}
+}
+
 // processTask 处理单个任务
 func (p *Poller) processTask(ctx context.Context, task *models.Task) error {
 	// 获取渠道信息
@@ -106,8 +178,15 @@ func (p *Poller) processTask(ctx context.Context, task *models.Task) error {
 		return err
 	}
 
-	// 创建APIMart适配器
-	adapter := upstream.NewAPIMartAdapter(channel.BaseURL, channel.SecretKey)
+	// 根据渠道供应商创建适配器,同一渠道的密钥属于同一上游账号,任一可用密钥均可查询任务
+	key, err := p.selector.PickKey(ctx, channel)
+	if err != nil {
+		return err
+	}
+	adapter, err := upstream.NewProvider(channel.Provider, channel.BaseURL, key.SecretKey)
+	if err != nil {
+		return err
+	}
 
 	// 查询上游任务状态
 	status, err := adapter.GetTaskStatus(ctx, task.UpstreamTaskID)
@@ -136,7 +215,7 @@ func (p *Poller) processTask(ctx context.Context, task *models.Task) error {
 		}
 
 		// 释放并发位
-		p.selector.ReleaseChannel(ctx, task.ChannelID)
+		p.selector.ReleaseChannel(ctx, task.ChannelID, task.LeaseID)
 
 		logger.Info("Task completed",
 			zap.String("task_id", task.ID),
@@ -158,7 +237,7 @@ func (p *Poller) processTask(ctx context.Context, task *models.Task) error {
 		}
 
 		// 释放并发位
-		p.selector.ReleaseChannel(ctx, task.ChannelID)
+		p.selector.ReleaseChannel(ctx, task.ChannelID, task.LeaseID)
 
 		logger.Warn("Task failed",
 			zap.String("task_id", task.ID),
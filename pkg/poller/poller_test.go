@@ -0,0 +1,182 @@
+package poller
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/869413421/transit/internal/models"
+	"github.com/869413421/transit/internal/repository"
+	"github.com/869413421/transit/internal/services"
+	"github.com/869413421/transit/pkg/loadbalancer"
+	"github.com/869413421/transit/pkg/logger"
+	"github.com/869413421/transit/pkg/pool"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestMain(m *testing.M) {
+	if err := logger.Init("production"); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// stubTaskService 返回固定运行中任务的任务服务
+type stubTaskService struct {
+	services.TaskService
+	tasks  []*models.Task
+	leases map[string]string // 任务 ID -> 更新后的租约
+}
+
+func (s *stubTaskService) GetPendingTasks(ctx context.Context, limit int) ([]*models.Task, error) {
+	if len(s.tasks) > limit {
+		return s.tasks[:limit], nil
+	}
+	return s.tasks, nil
+}
+
+func (s *stubTaskService) GetLeasedTasks(ctx context.Context) ([]*models.Task, error) {
+	var leased []*models.Task
+	for _, task := range s.tasks {
+		if task.LeaseID != "" {
+			leased = append(leased, task)
+		}
+	}
+	return leased, nil
+}
+
+func (s *stubTaskService) UpdateTaskLease(ctx context.Context, taskID, leaseID string) error {
+	s.leases[taskID] = leaseID
+	return nil
+}
+
+// stubChannelRepo 按 ID 返回渠道的仓储,未登记的渠道查询失败
+type stubChannelRepo struct {
+	repository.ChannelRepository
+	channels map[string]*models.Channel
+}
+
+func (r *stubChannelRepo) FindByID(ctx context.Context, id string) (*models.Channel, error) {
+	channel, ok := r.channels[id]
+	if !ok {
+		return nil, errors.New("channel not found")
+	}
+	return channel, nil
+}
+
+// pollerFixture 轮询器测试环境
+// shortPool 以很短的有效期发放租约,轮询器续约时使用一分钟的有效期
+type pollerFixture struct {
+	poller    *Poller
+	tasks     *stubTaskService
+	shortPool *pool.RedisPool
+	pool      *pool.RedisPool
+}
+
+func newPollerFixture(t *testing.T, channels ...*models.Channel) *pollerFixture {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	repo := &stubChannelRepo{channels: make(map[string]*models.Channel)}
+	for _, ch := range channels {
+		repo.channels[ch.ID] = ch
+	}
+	redisPool := pool.NewRedisPool(client, time.Minute, nil)
+	selector := loadbalancer.NewSelector(repo, redisPool, nil, nil, nil, nil, nil, nil)
+	tasks := &stubTaskService{leases: make(map[string]string)}
+	return &pollerFixture{
+		poller:    NewPoller(tasks, repo, selector, nil),
+		tasks:     tasks,
+		shortPool: pool.NewRedisPool(client, time.Second, nil),
+		pool:      redisPool,
+	}
+}
+
+// addTask 添加一个占用渠道短期租约的运行中任务
+func (f *pollerFixture) addTask(t *testing.T, id, channelID string) *models.Task {
+	t.Helper()
+	leaseID, err := f.shortPool.Acquire(context.Background(), channelID, 100)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	task := &models.Task{ID: id, ChannelID: channelID, LeaseID: leaseID, Status: "running"}
+	f.tasks.tasks = append(f.tasks.tasks, task)
+	return task
+}
+
+// leaseExpiries 返回渠道各租约的到期时间
+func (f *pollerFixture) leaseExpiries(t *testing.T, channelID string) map[string]time.Time {
+	t.Helper()
+	leases, err := f.pool.Leases(context.Background(), channelID)
+	if err != nil {
+		t.Fatalf("Leases: %v", err)
+	}
+	expiries := make(map[string]time.Time, len(leases))
+	for _, lease := range leases {
+		expiries[lease.ID] = lease.ExpiresAt
+	}
+	return expiries
+}
+
+func TestPollTasksRenewsLeasesBeyondBatch(t *testing.T) {
+	// 渠道查询失败,任务处理在续约之前的步骤就会出错
+	f := newPollerFixture(t)
+	f.poller.batchSize = 1
+	var tasks []*models.Task
+	for _, id := range []string{"task-1", "task-2", "task-3"} {
+		tasks = append(tasks, f.addTask(t, id, "ch-missing"))
+	}
+
+	f.poller.pollTasks(context.Background())
+
+	// 超出单批数量的任务同样续约,且续约不受任务处理失败影响
+	expiries := f.leaseExpiries(t, "ch-missing")
+	for _, task := range tasks {
+		if until := time.Until(expiries[task.LeaseID]); until < 30*time.Second {
+			t.Fatalf("lease of %s expires in %v, want renewed for a minute", task.ID, until)
+		}
+	}
+	if len(f.tasks.leases) != 0 {
+		t.Fatalf("task leases updated: %v, want live leases renewed in place", f.tasks.leases)
+	}
+}
+
+func TestPollTasksReacquiresLostLease(t *testing.T) {
+	f := newPollerFixture(t, &models.Channel{ID: "ch-1", MaxConcurrency: 10})
+	f.poller.batchSize = 0
+	task := f.addTask(t, "task-1", "ch-1")
+	f.shortPool.Release(context.Background(), "ch-1", task.LeaseID)
+
+	f.poller.pollTasks(context.Background())
+
+	// 丢失的租约在原渠道重新获取,并记录到任务上
+	leaseID := f.tasks.leases["task-1"]
+	if leaseID == "" || leaseID == task.LeaseID {
+		t.Fatalf("task lease = %q, want a new lease", leaseID)
+	}
+	if _, ok := f.leaseExpiries(t, "ch-1")[leaseID]; !ok {
+		t.Fatalf("new lease %s not held on ch-1", leaseID)
+	}
+}
+
+func TestPollTasksDropsLeaseWhenChannelFull(t *testing.T) {
+	f := newPollerFixture(t, &models.Channel{ID: "ch-1", MaxConcurrency: 1})
+	f.poller.batchSize = 0
+	task := f.addTask(t, "task-1", "ch-1")
+	f.shortPool.Release(context.Background(), "ch-1", task.LeaseID)
+	if _, err := f.pool.Acquire(context.Background(), "ch-1", 1); err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+
+	f.poller.pollTasks(context.Background())
+
+	// 渠道已满时任务继续运行,但不再占用并发位
+	if leaseID, ok := f.tasks.leases["task-1"]; !ok || leaseID != "" {
+		t.Fatalf("task lease = %q (updated %v), want cleared", leaseID, ok)
+	}
+}
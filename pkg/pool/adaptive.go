@@ -0,0 +1,107 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// AdaptiveLimit 自适应并发上限(AIMD)配置
+// 渠道的有效并发上限从 Floor 开始,请求成功且耗时正常时加性增长,上游限流或超时时乘性减小,
+// 始终介于 Floor 与渠道的 MaxConcurrency 之间
+type AdaptiveLimit struct {
+	Floor            int           // 初始及最低有效上限
+	Increase         float64       // 每轮(有效上限个成功请求)增加的并发数
+	DecreaseFactor   float64       // 限流或超时后有效上限乘以该系数
+	LatencyThreshold time.Duration // 成功请求耗时超过该值时不增长,0 表示不考虑耗时
+}
+
+// Lua 脚本：成功请求后加性增长有效上限
+// 每个成功请求增加 Increase/当前上限,相当于每轮增加 Increase
+const luaAdaptiveIncrease = `
+local floor = math.min(tonumber(ARGV[1]), tonumber(ARGV[2]))
+local limit = tonumber(redis.call('GET', KEYS[1]) or ARGV[1])
+limit = limit + tonumber(ARGV[3]) / math.max(math.floor(limit), 1)
+limit = math.max(math.min(limit, tonumber(ARGV[2])), floor)
+redis.call('SET', KEYS[1], tostring(limit))
+return tostring(limit)
+`
+
+// Lua 脚本：限流或超时后乘性减小有效上限
+const luaAdaptiveDecrease = `
+local floor = math.min(tonumber(ARGV[1]), tonumber(ARGV[2]))
+local limit = tonumber(redis.call('GET', KEYS[1]) or ARGV[1])
+limit = math.max(math.min(limit, tonumber(ARGV[2])) * tonumber(ARGV[3]), floor)
+redis.call('SET', KEYS[1], tostring(limit))
+return tostring(limit)
+`
+
+// Adaptive 是否启用自适应并发上限
+func (p *RedisPool) Adaptive() bool {
+	return p.adaptive != nil
+}
+
+// EffectiveLimit 返回渠道当前的有效并发上限,未启用自适应时即为 maxConcurrency
+func (p *RedisPool) EffectiveLimit(ctx context.Context, channelID string, maxConcurrency int) (int, error) {
+	if p.adaptive == nil {
+		return maxConcurrency, nil
+	}
+
+	value, err := p.client.Get(ctx, limitKey(channelID)).Result()
+	if err == redis.Nil {
+		return min(p.adaptive.Floor, maxConcurrency), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	limit, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	return p.clampLimit(limit, maxConcurrency), nil
+}
+
+// RecordSuccess 记录一次成功请求,耗时正常时增长有效上限
+func (p *RedisPool) RecordSuccess(ctx context.Context, channelID string, maxConcurrency int, latency time.Duration) error {
+	if p.adaptive == nil {
+		return nil
+	}
+	if p.adaptive.LatencyThreshold > 0 && latency > p.adaptive.LatencyThreshold {
+		return nil
+	}
+	return p.client.Eval(ctx, luaAdaptiveIncrease, []string{limitKey(channelID)},
+		p.adaptive.Floor, maxConcurrency, p.adaptive.Increase,
+	).Err()
+}
+
+// RecordOverload 记录一次上游限流或超时,减小有效上限并返回减小后的值
+func (p *RedisPool) RecordOverload(ctx context.Context, channelID string, maxConcurrency int) (int, error) {
+	if p.adaptive == nil {
+		return maxConcurrency, nil
+	}
+	value, err := p.client.Eval(ctx, luaAdaptiveDecrease, []string{limitKey(channelID)},
+		p.adaptive.Floor, maxConcurrency, p.adaptive.DecreaseFactor,
+	).Text()
+	if err != nil {
+		return 0, err
+	}
+	limit, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	return p.clampLimit(limit, maxConcurrency), nil
+}
+
+// clampLimit 将记录的有效上限取整并限制在 [Floor, maxConcurrency] 范围内
+func (p *RedisPool) clampLimit(limit float64, maxConcurrency int) int {
+	return min(max(int(math.Floor(limit)), p.adaptive.Floor), maxConcurrency)
+}
+
+// limitKey 渠道自适应并发上限的 Redis 键
+func limitKey(channelID string) string {
+	return fmt.Sprintf("transit:channel:%s:limit", channelID)
+}
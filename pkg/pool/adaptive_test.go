@@ -0,0 +1,147 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// newAdaptivePool 创建启用自适应并发上限的测试池
+func newAdaptivePool(t *testing.T, adaptive *AdaptiveLimit) *RedisPool {
+	t.Helper()
+	_, client := newTestRedis(t)
+	return NewRedisPool(client, time.Minute, adaptive)
+}
+
+// effectiveLimit 查询有效并发上限,出错时终止测试
+func effectiveLimit(t *testing.T, p *RedisPool, channelID string, maxConcurrency int) int {
+	t.Helper()
+	limit, err := p.EffectiveLimit(context.Background(), channelID, maxConcurrency)
+	if err != nil {
+		t.Fatalf("EffectiveLimit: %v", err)
+	}
+	return limit
+}
+
+func TestAdaptiveLimitDefaults(t *testing.T) {
+	p := newAdaptivePool(t, &AdaptiveLimit{Floor: 0, Increase: -1, DecreaseFactor: 1.5})
+	if p.adaptive.Floor != 1 || p.adaptive.Increase != 1 || p.adaptive.DecreaseFactor != 0.5 {
+		t.Fatalf("adaptive = %+v, want invalid values replaced by defaults", p.adaptive)
+	}
+
+	// 未记录过的渠道从 Floor 开始,且不超过渠道上限
+	p = newAdaptivePool(t, &AdaptiveLimit{Floor: 4})
+	if got := effectiveLimit(t, p, "ch0", 10); got != 4 {
+		t.Fatalf("EffectiveLimit() = %d, want floor 4", got)
+	}
+	if got := effectiveLimit(t, p, "ch0", 2); got != 2 {
+		t.Fatalf("EffectiveLimit() = %d, want capped at max concurrency 2", got)
+	}
+}
+
+func TestAdaptiveLimitAdditiveIncrease(t *testing.T) {
+	p := newAdaptivePool(t, &AdaptiveLimit{Floor: 2, Increase: 1})
+	ctx := context.Background()
+
+	// 每轮(有效上限个成功请求)增加 Increase
+	for i := 0; i < 2; i++ {
+		if err := p.RecordSuccess(ctx, "ch0", 10, time.Millisecond); err != nil {
+			t.Fatalf("RecordSuccess: %v", err)
+		}
+	}
+	if got := effectiveLimit(t, p, "ch0", 10); got != 3 {
+		t.Fatalf("EffectiveLimit() = %d after one round, want 3", got)
+	}
+	for i := 0; i < 3; i++ {
+		p.RecordSuccess(ctx, "ch0", 10, time.Millisecond)
+	}
+	if got := effectiveLimit(t, p, "ch0", 10); got != 4 {
+		t.Fatalf("EffectiveLimit() = %d after two rounds, want 4", got)
+	}
+
+	// 不超过渠道的 MaxConcurrency
+	for i := 0; i < 100; i++ {
+		p.RecordSuccess(ctx, "ch0", 5, time.Millisecond)
+	}
+	if got := effectiveLimit(t, p, "ch0", 5); got != 5 {
+		t.Fatalf("EffectiveLimit() = %d, want capped at 5", got)
+	}
+}
+
+func TestAdaptiveLimitIgnoresSlowSuccess(t *testing.T) {
+	p := newAdaptivePool(t, &AdaptiveLimit{Floor: 1, Increase: 1, LatencyThreshold: time.Second})
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		p.RecordSuccess(ctx, "ch0", 10, 2*time.Second)
+	}
+	if got := effectiveLimit(t, p, "ch0", 10); got != 1 {
+		t.Fatalf("EffectiveLimit() = %d, want slow successes ignored", got)
+	}
+}
+
+func TestAdaptiveLimitMultiplicativeDecrease(t *testing.T) {
+	server, client := newTestRedis(t)
+	p := NewRedisPool(client, time.Minute, &AdaptiveLimit{Floor: 2, Increase: 1, DecreaseFactor: 0.5})
+	ctx := context.Background()
+
+	server.Set(limitKey("ch0"), "9")
+	limit, err := p.RecordOverload(ctx, "ch0", 10)
+	if err != nil || limit != 4 {
+		t.Fatalf("RecordOverload() = %d, %v; want 4", limit, err)
+	}
+	limit, _ = p.RecordOverload(ctx, "ch0", 10)
+	if limit != 2 {
+		t.Fatalf("RecordOverload() = %d, want 2", limit)
+	}
+	// 不低于 Floor
+	limit, _ = p.RecordOverload(ctx, "ch0", 10)
+	if limit != 2 {
+		t.Fatalf("RecordOverload() = %d, want floor 2", limit)
+	}
+
+	// 渠道上限调低后,减小从新的上限开始计算
+	server.Set(limitKey("ch1"), "40")
+	if limit, _ := p.RecordOverload(ctx, "ch1", 10); limit != 5 {
+		t.Fatalf("RecordOverload() = %d, want 5", limit)
+	}
+}
+
+func TestAdaptiveLimitGatesAcquire(t *testing.T) {
+	p := newAdaptivePool(t, &AdaptiveLimit{Floor: 1, Increase: 1})
+	ctx := context.Background()
+
+	if _, err := p.Acquire(ctx, "ch0", 10); err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	if _, err := p.Acquire(ctx, "ch0", 10); !errors.Is(err, ErrConcurrencyLimit) {
+		t.Fatalf("Acquire() error = %v, want ErrConcurrencyLimit at the adaptive limit", err)
+	}
+
+	// 有效上限增长后可以获取更多并发位
+	p.RecordSuccess(ctx, "ch0", 10, time.Millisecond)
+	if _, err := p.Acquire(ctx, "ch0", 10); err != nil {
+		t.Fatalf("Acquire after increase: %v", err)
+	}
+}
+
+func TestAdaptiveLimitDisabled(t *testing.T) {
+	server, client := newTestRedis(t)
+	p := NewRedisPool(client, time.Minute, nil)
+	ctx := context.Background()
+
+	if p.Adaptive() {
+		t.Fatal("Adaptive() = true without configuration")
+	}
+	if got := effectiveLimit(t, p, "ch0", 7); got != 7 {
+		t.Fatalf("EffectiveLimit() = %d, want max concurrency", got)
+	}
+	if limit, err := p.RecordOverload(ctx, "ch0", 7); err != nil || limit != 7 {
+		t.Fatalf("RecordOverload() = %d, %v", limit, err)
+	}
+	p.RecordSuccess(ctx, "ch0", 7, time.Millisecond)
+	if server.Exists(limitKey("ch0")) {
+		t.Fatal("disabled adaptive limit wrote a limit key")
+	}
+}
@@ -0,0 +1,81 @@
+package pool
+
+import (
+	"context"
+	"time"
+
+	"github.com/869413421/transit/internal/repository"
+	"github.com/869413421/transit/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// Reaper 过期租约回收器
+// 获取并发位时会顺带回收该渠道的过期租约,回收器定期清理所有渠道,使监控数据及时反映真实占用
+type Reaper struct {
+	pool        *RedisPool
+	channelRepo repository.ChannelRepository
+	interval    time.Duration
+	stopChan    chan struct{}
+}
+
+// NewReaper 创建回收器
+func NewReaper(pool *RedisPool, channelRepo repository.ChannelRepository, interval time.Duration) *Reaper {
+	return &Reaper{
+		pool:        pool,
+		channelRepo: channelRepo,
+		interval:    interval,
+		stopChan:    make(chan struct{}),
+	}
+}
+
+// Start 启动回收器
+func (r *Reaper) Start(ctx context.Context) {
+	logger.Info("Lease reaper started", zap.Duration("interval", r.interval))
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Lease reaper stopped")
+			return
+		case <-r.stopChan:
+			logger.Info("Lease reaper stopped")
+			return
+		case <-ticker.C:
+			r.reap(ctx)
+		}
+	}
+}
+
+// Stop 停止回收器
+func (r *Reaper) Stop() {
+	close(r.stopChan)
+}
+
+// reap 回收所有渠道的过期租约
+func (r *Reaper) reap(ctx context.Context) {
+	channels, err := r.channelRepo.FindAll(ctx)
+	if err != nil {
+		logger.Error("Failed to get channels", zap.Error(err))
+		return
+	}
+
+	for _, channel := range channels {
+		reaped, err := r.pool.ReapExpired(ctx, channel.ID)
+		if err != nil {
+			logger.Error("Failed to reap expired leases",
+				zap.String("channel_id", channel.ID),
+				zap.Error(err),
+			)
+			continue
+		}
+		if reaped > 0 {
+			logger.Warn("Reaped expired leases",
+				zap.String("channel_id", channel.ID),
+				zap.Int64("count", reaped),
+			)
+		}
+	}
+}
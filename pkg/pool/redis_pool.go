@@ -4,61 +4,171 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrConcurrencyLimit 渠道并发位已满
+	ErrConcurrencyLimit = errors.New("channel concurrency limit reached")
+	// ErrLeaseLost 租约已到期或已被释放、重置,无法续约
+	ErrLeaseLost = errors.New("lease expired or released")
 )
 
 // RedisPool Redis 并发控制池
+// 每个渠道的并发位是一个有序集合信号量: 成员为租约 ID,分值为租约到期时间;
+// 进程崩溃或异步任务未被轮询到时,租约到期后自动失效,并发位不会永久泄漏
 type RedisPool struct {
-	client *redis.Client
+	client   *redis.Client
+	leaseTTL time.Duration  // 租约有效期,长耗时任务需在到期前续约
+	adaptive *AdaptiveLimit // 为 nil 时并发上限固定为渠道的 MaxConcurrency
+}
+
+// NewRedisPool 创建 Redis 池,adaptive 为 nil 时不启用自适应并发上限
+func NewRedisPool(client *redis.Client, leaseTTL time.Duration, adaptive *AdaptiveLimit) *RedisPool {
+	if adaptive != nil {
+		if adaptive.Floor < 1 {
+			adaptive.Floor = 1
+		}
+		if adaptive.Increase <= 0 {
+			adaptive.Increase = 1
+		}
+		if adaptive.DecreaseFactor <= 0 || adaptive.DecreaseFactor >= 1 {
+			adaptive.DecreaseFactor = 0.5
+		}
+	}
+	return &RedisPool{client: client, leaseTTL: leaseTTL, adaptive: adaptive}
 }
 
-// NewRedisPool 创建 Redis 池
-func NewRedisPool(client *redis.Client) *RedisPool {
-	return &RedisPool{client: client}
+// Lease 并发位租约
+type Lease struct {
+	ID        string    `json:"id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Expired   bool      `json:"expired"` // 已到期但尚未被回收
 }
 
-// Lua 脚本：原子性检查并增加并发位
+// Lua 脚本：回收过期租约后原子性检查并获取并发位
+// ARGV[5] 大于 0 时启用自适应并发上限,实际上限取 KEYS[2] 中记录的有效上限(不低于 ARGV[5])与 ARGV[2] 的较小值
 const luaAcquirePermit = `
-local current = tonumber(redis.call('GET', KEYS[1]) or "0")
-local max = tonumber(ARGV[1])
-if current < max then
-    redis.call('INCR', KEYS[1])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+local limit = tonumber(ARGV[2])
+local floor = tonumber(ARGV[5])
+if floor > 0 then
+    local adaptive = tonumber(redis.call('GET', KEYS[2]) or ARGV[5])
+    limit = math.min(limit, math.max(math.floor(adaptive), floor))
+end
+if redis.call('ZCARD', KEYS[1]) < limit then
+    redis.call('ZADD', KEYS[1], ARGV[3], ARGV[4])
     return 1
-else
-    return 0
 end
+return 0
 `
 
-// Acquire 获取并发位
-func (p *RedisPool) Acquire(ctx context.Context, channelID string, maxConcurrency int) (bool, error) {
-	key := fmt.Sprintf("transit:channel:%s:concurrency", channelID)
+// Acquire 获取并发位,返回租约 ID;并发位已满(达到有效并发上限)时返回 ErrConcurrencyLimit
+func (p *RedisPool) Acquire(ctx context.Context, channelID string, maxConcurrency int) (string, error) {
+	leaseID := uuid.New().String()
+	now := time.Now()
 
-	res, err := p.client.Eval(ctx, luaAcquirePermit, []string{key}, maxConcurrency).Result()
+	floor := 0
+	if p.adaptive != nil {
+		floor = p.adaptive.Floor
+	}
+	res, err := p.client.Eval(ctx, luaAcquirePermit, []string{leasesKey(channelID), limitKey(channelID)},
+		now.UnixMilli(), maxConcurrency, now.Add(p.leaseTTL).UnixMilli(), leaseID, floor,
+	).Result()
 	if err != nil {
-		return false, err
+		return "", err
 	}
 
-	acquired := res.(int64) == 1
-	if !acquired {
-		return false, errors.New("channel concurrency limit reached")
+	if res.(int64) != 1 {
+		return "", ErrConcurrencyLimit
 	}
-
-	return true, nil
+	return leaseID, nil
 }
 
 // Release 释放并发位
-func (p *RedisPool) Release(ctx context.Context, channelID string) error {
-	key := fmt.Sprintf("transit:channel:%s:concurrency", channelID)
-	return p.client.Decr(ctx, key).Err()
+func (p *RedisPool) Release(ctx context.Context, channelID, leaseID string) error {
+	return p.client.ZRem(ctx, leasesKey(channelID), leaseID).Err()
+}
+
+// Lua 脚本：仅在租约存在且未到期时延后到期时间
+// 已到期的租约不再计入并发数,其并发位可能已被其他请求占用,不能直接恢复
+const luaRenewLease = `
+local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not score or tonumber(score) < tonumber(ARGV[2]) then
+    return 0
+end
+redis.call('ZADD', KEYS[1], 'XX', ARGV[3], ARGV[1])
+return 1
+`
+
+// Renew 续约,将租约到期时间延后一个有效期
+// 租约已到期、被释放或被重置时返回 ErrLeaseLost,由调用方决定是否重新获取并发位
+func (p *RedisPool) Renew(ctx context.Context, channelID, leaseID string) error {
+	now := time.Now()
+	renewed, err := p.client.Eval(ctx, luaRenewLease, []string{leasesKey(channelID)},
+		leaseID, now.UnixMilli(), now.Add(p.leaseTTL).UnixMilli(),
+	).Int()
+	if err != nil {
+		return err
+	}
+	if renewed != 1 {
+		return ErrLeaseLost
+	}
+	return nil
 }
 
-// GetConcurrency 获取当前并发数
+// GetConcurrency 获取当前并发数(未到期的租约数)
 func (p *RedisPool) GetConcurrency(ctx context.Context, channelID string) (int, error) {
-	key := fmt.Sprintf("transit:channel:%s:concurrency", channelID)
-	val, err := p.client.Get(ctx, key).Int()
-	if err == redis.Nil {
-		return 0, nil
+	count, err := p.client.ZCount(ctx, leasesKey(channelID),
+		strconv.FormatInt(time.Now().UnixMilli(), 10), "+inf",
+	).Result()
+	return int(count), err
+}
+
+// Leases 列出渠道的全部租约,按到期时间升序
+func (p *RedisPool) Leases(ctx context.Context, channelID string) ([]Lease, error) {
+	members, err := p.client.ZRangeWithScores(ctx, leasesKey(channelID), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	leases := make([]Lease, 0, len(members))
+	for _, m := range members {
+		expiresAt := time.UnixMilli(int64(m.Score))
+		leases = append(leases, Lease{
+			ID:        m.Member.(string),
+			ExpiresAt: expiresAt,
+			Expired:   !expiresAt.After(now),
+		})
 	}
-	return val, err
+	return leases, nil
+}
+
+// Reset 清空渠道的全部租约,返回清除的数量
+func (p *RedisPool) Reset(ctx context.Context, channelID string) (int64, error) {
+	key := leasesKey(channelID)
+	pipe := p.client.TxPipeline()
+	count := pipe.ZCard(ctx, key)
+	pipe.Del(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return count.Val(), nil
+}
+
+// ReapExpired 回收渠道已到期的租约,返回回收的数量
+func (p *RedisPool) ReapExpired(ctx context.Context, channelID string) (int64, error) {
+	return p.client.ZRemRangeByScore(ctx, leasesKey(channelID),
+		"-inf", strconv.FormatInt(time.Now().UnixMilli(), 10),
+	).Result()
+}
+
+// leasesKey 渠道并发位租约的 Redis 键
+func leasesKey(channelID string) string {
+	return fmt.Sprintf("transit:channel:%s:leases", channelID)
 }
@@ -0,0 +1,155 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// newTestRedis 创建基于 miniredis 的 Redis 客户端,测试结束时自动关闭
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return server, client
+}
+
+// expireLease 将租约到期时间改到过去,模拟进程崩溃后租约到期
+func expireLease(server *miniredis.Miniredis, channelID, leaseID string) {
+	server.ZAdd(leasesKey(channelID), float64(time.Now().Add(-time.Second).UnixMilli()), leaseID)
+}
+
+func TestRedisPoolAcquireLimit(t *testing.T) {
+	_, client := newTestRedis(t)
+	p := NewRedisPool(client, time.Minute, nil)
+	ctx := context.Background()
+
+	first, err := p.Acquire(ctx, "ch0", 2)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	second, err := p.Acquire(ctx, "ch0", 2)
+	if err != nil || second == first {
+		t.Fatalf("Acquire() = %q, %v; want a distinct lease", second, err)
+	}
+	if _, err := p.Acquire(ctx, "ch0", 2); !errors.Is(err, ErrConcurrencyLimit) {
+		t.Fatalf("Acquire() error = %v, want ErrConcurrencyLimit", err)
+	}
+	if current, _ := p.GetConcurrency(ctx, "ch0"); current != 2 {
+		t.Fatalf("GetConcurrency() = %d, want 2", current)
+	}
+
+	// 释放后并发位可再次获取
+	if err := p.Release(ctx, "ch0", first); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if _, err := p.Acquire(ctx, "ch0", 2); err != nil {
+		t.Fatalf("Acquire after release: %v", err)
+	}
+}
+
+func TestRedisPoolExpiredLeasesFreeSlots(t *testing.T) {
+	server, client := newTestRedis(t)
+	p := NewRedisPool(client, time.Minute, nil)
+	ctx := context.Background()
+
+	leaseID, _ := p.Acquire(ctx, "ch0", 1)
+	expireLease(server, "ch0", leaseID)
+
+	if current, _ := p.GetConcurrency(ctx, "ch0"); current != 0 {
+		t.Fatalf("GetConcurrency() = %d, want expired lease not counted", current)
+	}
+	leases, err := p.Leases(ctx, "ch0")
+	if err != nil || len(leases) != 1 || !leases[0].Expired || leases[0].ID != leaseID {
+		t.Fatalf("Leases() = %+v, %v", leases, err)
+	}
+
+	// 获取并发位时回收到期的租约
+	if _, err := p.Acquire(ctx, "ch0", 1); err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	if leases, _ := p.Leases(ctx, "ch0"); len(leases) != 1 || leases[0].ID == leaseID || leases[0].Expired {
+		t.Fatalf("Leases() = %+v, want only the new lease", leases)
+	}
+}
+
+func TestRedisPoolRenew(t *testing.T) {
+	server, client := newTestRedis(t)
+	p := NewRedisPool(client, time.Minute, nil)
+	ctx := context.Background()
+
+	leaseID, _ := p.Acquire(ctx, "ch0", 1)
+	server.ZAdd(leasesKey("ch0"), float64(time.Now().Add(time.Second).UnixMilli()), leaseID)
+
+	if err := p.Renew(ctx, "ch0", leaseID); err != nil {
+		t.Fatalf("Renew: %v", err)
+	}
+	leases, _ := p.Leases(ctx, "ch0")
+	if remaining := time.Until(leases[0].ExpiresAt); remaining < 50*time.Second {
+		t.Fatalf("lease expires in %v after renewal, want about one TTL", remaining)
+	}
+}
+
+func TestRedisPoolRenewLostLease(t *testing.T) {
+	server, client := newTestRedis(t)
+	p := NewRedisPool(client, time.Minute, nil)
+	ctx := context.Background()
+
+	t.Run("expired", func(t *testing.T) {
+		leaseID, _ := p.Acquire(ctx, "ch0", 10)
+		expireLease(server, "ch0", leaseID)
+		if err := p.Renew(ctx, "ch0", leaseID); !errors.Is(err, ErrLeaseLost) {
+			t.Fatalf("Renew() error = %v, want ErrLeaseLost", err)
+		}
+		// 到期的租约不会被续约复活
+		if leases, _ := p.Leases(ctx, "ch0"); !leases[0].Expired {
+			t.Fatalf("Leases() = %+v, want lease still expired", leases)
+		}
+	})
+
+	t.Run("released", func(t *testing.T) {
+		leaseID, _ := p.Acquire(ctx, "ch1", 10)
+		p.Release(ctx, "ch1", leaseID)
+		if err := p.Renew(ctx, "ch1", leaseID); !errors.Is(err, ErrLeaseLost) {
+			t.Fatalf("Renew() error = %v, want ErrLeaseLost", err)
+		}
+		// ZADD XX 不会重新插入已释放的租约
+		if leases, _ := p.Leases(ctx, "ch1"); len(leases) != 0 {
+			t.Fatalf("Leases() = %+v, want released lease not recreated", leases)
+		}
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		leaseID, _ := p.Acquire(ctx, "ch2", 10)
+		p.Acquire(ctx, "ch2", 10)
+		if cleared, err := p.Reset(ctx, "ch2"); err != nil || cleared != 2 {
+			t.Fatalf("Reset() = %d, %v; want 2", cleared, err)
+		}
+		if err := p.Renew(ctx, "ch2", leaseID); !errors.Is(err, ErrLeaseLost) {
+			t.Fatalf("Renew() error = %v, want ErrLeaseLost", err)
+		}
+	})
+}
+
+func TestRedisPoolReapExpired(t *testing.T) {
+	server, client := newTestRedis(t)
+	p := NewRedisPool(client, time.Minute, nil)
+	ctx := context.Background()
+
+	expired, _ := p.Acquire(ctx, "ch0", 10)
+	live, _ := p.Acquire(ctx, "ch0", 10)
+	expireLease(server, "ch0", expired)
+
+	reaped, err := p.ReapExpired(ctx, "ch0")
+	if err != nil || reaped != 1 {
+		t.Fatalf("ReapExpired() = %d, %v; want 1", reaped, err)
+	}
+	if leases, _ := p.Leases(ctx, "ch0"); len(leases) != 1 || leases[0].ID != live {
+		t.Fatalf("Leases() = %+v, want only the live lease", leases)
+	}
+}
@@ -0,0 +1,243 @@
+package prober
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/869413421/transit/internal/config"
+	"github.com/869413421/transit/internal/models"
+	"github.com/869413421/transit/internal/repository"
+	"github.com/869413421/transit/pkg/loadbalancer"
+	"github.com/869413421/transit/pkg/logger"
+	"github.com/869413421/transit/pkg/upstream"
+	"go.uber.org/zap"
+)
+
+// probeMaxTokens 探测请求的最大输出 Token 数,只需确认渠道可用
+const probeMaxTokens = 1
+
+// Prober 渠道健康探测器
+// 定期通过每个激活渠道的适配器发送一次低成本的文本对话请求,记录耗时、状态与失败原因;
+// 探测请求不占用渠道并发位,也不计费。管理接口的渠道测试同样经由探测器发送请求
+type Prober struct {
+	channelRepo repository.ChannelRepository
+	health      *loadbalancer.HealthTracker
+	keys        *loadbalancer.KeyRotator
+	models      *config.ModelsConfig
+	cfg         config.HealthConfig
+	stopChan    chan struct{}
+}
+
+// NewProber 创建健康探测器
+func NewProber(
+	channelRepo repository.ChannelRepository,
+	health *loadbalancer.HealthTracker,
+	keys *loadbalancer.KeyRotator,
+	models *config.ModelsConfig,
+	cfg config.HealthConfig,
+) *Prober {
+	return &Prober{
+		channelRepo: channelRepo,
+		health:      health,
+		keys:        keys,
+		models:      models,
+		cfg:         cfg,
+		stopChan:    make(chan struct{}),
+	}
+}
+
+// Start 启动探测器,启动后立即执行一轮探测
+func (p *Prober) Start(ctx context.Context) {
+	logger.Info("Channel health prober started",
+		zap.Duration("interval", p.cfg.Interval),
+		zap.String("model", p.cfg.Model),
+		zap.Int("unhealthy_threshold", p.cfg.UnhealthyThreshold),
+	)
+
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+
+	p.probeChannels(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Channel health prober stopped")
+			return
+		case <-p.stopChan:
+			logger.Info("Channel health prober stopped")
+			return
+		case <-ticker.C:
+			p.probeChannels(ctx)
+		}
+	}
+}
+
+// Stop 停止探测器
+func (p *Prober) Stop() {
+	close(p.stopChan)
+}
+
+// probeChannels 并发探测所有激活的渠道
+func (p *Prober) probeChannels(ctx context.Context) {
+	channels, err := p.channelRepo.FindActive(ctx)
+	if err != nil {
+		logger.Error("Failed to get active channels", zap.Error(err))
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, channel := range channels {
+		wg.Add(1)
+		go func(channel *models.Channel) {
+			defer wg.Done()
+			p.probeChannel(ctx, channel)
+		}(channel)
+	}
+	wg.Wait()
+}
+
+// probeChannel 探测单个渠道并记录结果
+func (p *Prober) probeChannel(ctx context.Context, channel *models.Channel) {
+	model := p.probeModel(channel)
+	if model == "" {
+		logger.Debug("No probe model for channel", zap.String("channel_id", channel.ID))
+		return
+	}
+
+	startTime := time.Now()
+	_, probeErr := p.probe(ctx, channel, model)
+	latency := time.Since(startTime)
+	if ctx.Err() != nil {
+		return
+	}
+
+	unhealthy, err := p.health.Record(ctx, channel.ID, model, latency, probeErr)
+	if err != nil {
+		logger.Error("Failed to record channel health",
+			zap.String("channel_id", channel.ID),
+			zap.Error(err),
+		)
+		return
+	}
+
+	if probeErr != nil {
+		logger.Warn("Channel health probe failed",
+			zap.String("channel_id", channel.ID),
+			zap.String("channel_name", channel.Name),
+			zap.String("model", model),
+			zap.Bool("unhealthy", unhealthy),
+			zap.Error(probeErr),
+		)
+		return
+	}
+	logger.Debug("Channel health probe succeeded",
+		zap.String("channel_id", channel.ID),
+		zap.Duration("latency", latency),
+	)
+}
+
+// probe 通过渠道适配器发送一次探测请求,按渠道的密钥选择方式轮换使用密钥,返回本次使用的密钥 ID
+// 探测只反映渠道健康状态,被上游拒绝的密钥由请求路径按连续拒绝次数停用
+func (p *Prober) probe(ctx context.Context, channel *models.Channel, model string) (string, error) {
+	key, err := p.keys.Pick(ctx, channel)
+	if err != nil {
+		return "", err
+	}
+	adapter, err := upstream.NewProvider(channel.Provider, channel.BaseURL, key.SecretKey)
+	if err != nil {
+		return key.ID, err
+	}
+	if upstreamModel := p.upstreamModel(channel, model); upstreamModel != model {
+		adapter = upstream.WithUpstreamModel(adapter, upstreamModel)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.Timeout)
+	defer cancel()
+
+	maxTokens := probeMaxTokens
+	resp, err := adapter.ChatCompletion(ctx, &upstream.ChatCompletionRequest{
+		Model: model,
+		Messages: []upstream.Message{
+			{Role: "user", Content: upstream.NewTextContent(p.cfg.Prompt)},
+		},
+		MaxTokens: &maxTokens,
+	})
+	if err != nil {
+		return key.ID, err
+	}
+	if len(resp.Choices) == 0 {
+		return key.ID, errors.New("empty choices in probe response")
+	}
+	return key.ID, nil
+}
+
+// TestResult 手动测试渠道的结果
+type TestResult struct {
+	Model      string `json:"model"`
+	KeyID      string `json:"key_id,omitempty"` // 本次使用的密钥
+	Success    bool   `json:"success"`
+	LatencyMs  int64  `json:"latency_ms"`
+	StatusCode int    `json:"status_code,omitempty"` // 上游返回的错误状态码
+	Error      string `json:"error,omitempty"`
+}
+
+// Test 通过渠道发送一次与健康探测相同的实时请求并返回耗时与错误,不记录健康状态
+// model 为空时按探测模型的规则选择
+func (p *Prober) Test(ctx context.Context, channel *models.Channel, model string) *TestResult {
+	if model == "" {
+		model = p.probeModel(channel)
+	}
+	result := &TestResult{Model: model}
+	if model == "" {
+		result.Error = "no text model to test with, please specify one"
+		return result
+	}
+
+	startTime := time.Now()
+	keyID, err := p.probe(ctx, channel, model)
+	result.LatencyMs = time.Since(startTime).Milliseconds()
+	result.KeyID = keyID
+	if err != nil {
+		result.Error = err.Error()
+		var apiErr *upstream.APIError
+		if errors.As(err, &apiErr) {
+			result.StatusCode = apiErr.StatusCode
+		}
+		return result
+	}
+	result.Success = true
+	return result
+}
+
+// probeModel 选择渠道的探测模型
+// 优先使用配置的探测模型;渠道不服务该模型时,使用渠道声明的第一个已配置的文本模型
+func (p *Prober) probeModel(channel *models.Channel) string {
+	if p.cfg.Model != "" && channel.ServesModel(p.cfg.Model) {
+		return p.cfg.Model
+	}
+	for _, pattern := range channel.Models {
+		if strings.ContainsAny(pattern, "*?[") {
+			continue
+		}
+		for _, m := range p.models.Text {
+			if m.Name == pattern {
+				return m.Name
+			}
+		}
+	}
+	return ""
+}
+
+// upstreamModel 解析探测模型在渠道上游的名称,渠道映射优先于模型配置中的 upstream_name
+func (p *Prober) upstreamModel(channel *models.Channel, model string) string {
+	if name := channel.UpstreamModel(model); name != "" {
+		return name
+	}
+	if modelCfg := p.models.GetModelByName(model); modelCfg != nil && modelCfg.UpstreamName != "" {
+		return modelCfg.UpstreamName
+	}
+	return model
+}
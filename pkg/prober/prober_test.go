@@ -0,0 +1,80 @@
+package prober
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/869413421/transit/internal/config"
+	"github.com/869413421/transit/internal/models"
+	"github.com/869413421/transit/internal/repository"
+	"github.com/869413421/transit/pkg/loadbalancer"
+	"github.com/869413421/transit/pkg/logger"
+	"github.com/869413421/transit/pkg/upstream"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestMain(m *testing.M) {
+	if err := logger.Init("production"); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// keyRecordingRepo 记录密钥更新的渠道仓储
+type keyRecordingRepo struct {
+	repository.ChannelRepository
+	channel *models.Channel
+	updated []models.ChannelKey
+}
+
+func (r *keyRecordingRepo) FindByID(ctx context.Context, id string) (*models.Channel, error) {
+	return r.channel, nil
+}
+
+func (r *keyRecordingRepo) UpdateKey(ctx context.Context, key *models.ChannelKey) error {
+	r.updated = append(r.updated, *key)
+	return nil
+}
+
+func TestProbeChannelKeepsRejectedKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"error":{"message":"invalid api key"}}`)
+	}))
+	defer server.Close()
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	channel := &models.Channel{
+		ID:       "ch-1",
+		BaseURL:  server.URL,
+		Provider: upstream.ProviderOpenAI,
+		Models:   []string{"gpt-4o"},
+		Keys:     []models.ChannelKey{{ID: "k0", ChannelID: "ch-1", SecretKey: "sk-test", IsActive: true}},
+	}
+	repo := &keyRecordingRepo{channel: channel}
+	health := loadbalancer.NewHealthTracker(client, 1, time.Minute)
+	p := NewProber(repo, health, loadbalancer.NewKeyRotator(client, repo, 1), &config.ModelsConfig{
+		Text: []config.ModelConfig{{Name: "gpt-4o"}},
+	}, config.HealthConfig{Timeout: 5 * time.Second, Prompt: "ping", UnhealthyThreshold: 1})
+
+	ctx := context.Background()
+	p.probeChannel(ctx, channel)
+
+	// 探测失败只记录健康状态,不停用密钥
+	state, err := health.Health(ctx, "ch-1")
+	if err != nil || state == nil || state.ConsecutiveFailures != 1 || state.LastError == "" {
+		t.Fatalf("Health() = %+v, %v; want the failed probe recorded", state, err)
+	}
+	if len(repo.updated) != 0 {
+		t.Fatalf("UpdateKey() calls = %+v, want the key left active", repo.updated)
+	}
+}
@@ -0,0 +1,156 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// encryptedPrefix 密文前缀,格式为 enc:v1:<主密钥 ID>:<base64(nonce+密文)>
+const encryptedPrefix = "enc:v1:"
+
+var (
+	// ErrNoMasterKey 未配置主密钥却读取到密文
+	ErrNoMasterKey = errors.New("secret is encrypted but no master key is configured")
+	// ErrUnknownMasterKey 密文使用的主密钥不在当前及历史主密钥中
+	ErrUnknownMasterKey = errors.New("secret is encrypted with an unknown master key")
+)
+
+// Cipher 使用 AES-256-GCM 加解密渠道密钥
+// 主密钥经 SHA-256 派生为 AES 密钥,密文中记录主密钥 ID;
+// 轮换主密钥时把旧主密钥放入历史主密钥,旧密文仍可解密,并可通过 NeedsRotation 找出需要重新加密的值
+type Cipher struct {
+	current  *masterKey // 为 nil 时不加密
+	previous map[string]*masterKey
+}
+
+type masterKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// NewCipher 创建加解密器,currentKey 为空时不加密,仅能读取明文
+// 主密钥首尾的空白被忽略,previousKeys 可能来自以逗号分隔的环境变量
+func NewCipher(currentKey string, previousKeys []string) (*Cipher, error) {
+	c := &Cipher{previous: make(map[string]*masterKey)}
+
+	currentKey = strings.TrimSpace(currentKey)
+	if currentKey != "" {
+		key, err := newMasterKey(currentKey)
+		if err != nil {
+			return nil, err
+		}
+		c.current = key
+	}
+
+	for _, previous := range previousKeys {
+		previous = strings.TrimSpace(previous)
+		if previous == "" {
+			continue
+		}
+		key, err := newMasterKey(previous)
+		if err != nil {
+			return nil, err
+		}
+		c.previous[key.id] = key
+	}
+	return c, nil
+}
+
+// newMasterKey 由主密钥派生 AES-256-GCM 密钥及其 ID
+func newMasterKey(secret string) (*masterKey, error) {
+	derived := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(derived[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprint := sha256.Sum256(derived[:])
+	return &masterKey{id: hex.EncodeToString(fingerprint[:4]), aead: aead}, nil
+}
+
+// Enabled 是否配置了主密钥
+func (c *Cipher) Enabled() bool {
+	return c.current != nil
+}
+
+// Encrypt 使用当前主密钥加密,未配置主密钥时原样返回
+func (c *Cipher) Encrypt(plaintext string) (string, error) {
+	if c.current == nil {
+		return plaintext, nil
+	}
+
+	nonce := make([]byte, c.current.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := c.current.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encryptedPrefix + c.current.id + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt 解密密文,非密文(加密前写入的明文)原样返回
+func (c *Cipher) Decrypt(value string) (string, error) {
+	id, payload, ok := parse(value)
+	if !ok {
+		return value, nil
+	}
+
+	key := c.key(id)
+	if key == nil {
+		if c.current == nil {
+			return "", ErrNoMasterKey
+		}
+		return "", fmt.Errorf("%w: %s", ErrUnknownMasterKey, id)
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", fmt.Errorf("decode secret: %w", err)
+	}
+	nonceSize := key.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return "", errors.New("secret ciphertext too short")
+	}
+	plaintext, err := key.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return "", fmt.Errorf("decrypt secret: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// NeedsRotation 判断存储的值是否需要用当前主密钥重新加密(明文或由历史主密钥加密)
+// 未配置当前主密钥时,可由历史主密钥解密的密文需要还原为明文,用于停用加密
+func (c *Cipher) NeedsRotation(value string) bool {
+	id, _, ok := parse(value)
+	if c.current == nil {
+		return ok && c.previous[id] != nil
+	}
+	return !ok || id != c.current.id
+}
+
+// key 按 ID 查找主密钥
+func (c *Cipher) key(id string) *masterKey {
+	if c.current != nil && c.current.id == id {
+		return c.current
+	}
+	return c.previous[id]
+}
+
+// parse 拆分密文中的主密钥 ID 与载荷,非密文返回 false
+func parse(value string) (id, payload string, ok bool) {
+	rest, found := strings.CutPrefix(value, encryptedPrefix)
+	if !found {
+		return "", "", false
+	}
+	return strings.Cut(rest, ":")
+}
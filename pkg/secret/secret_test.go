@@ -0,0 +1,199 @@
+package secret
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCipherRoundTrip(t *testing.T) {
+	c, err := NewCipher("current-master-key", nil)
+	if err != nil {
+		t.Fatalf("NewCipher: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		plaintext string
+	}{
+		{"api key", "sk-abcdefghijklmnopqrstuvwxyz"},
+		{"empty", ""},
+		{"unicode", "密钥-🔑"},
+		{"contains separator", "a:b:enc:v1:c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encrypted, err := c.Encrypt(tt.plaintext)
+			if err != nil {
+				t.Fatalf("Encrypt: %v", err)
+			}
+			if !strings.HasPrefix(encrypted, encryptedPrefix) {
+				t.Fatalf("Encrypt() = %q, want %q prefix", encrypted, encryptedPrefix)
+			}
+			if tt.plaintext != "" && strings.Contains(encrypted, tt.plaintext) {
+				t.Fatalf("ciphertext %q contains plaintext", encrypted)
+			}
+
+			decrypted, err := c.Decrypt(encrypted)
+			if err != nil {
+				t.Fatalf("Decrypt: %v", err)
+			}
+			if decrypted != tt.plaintext {
+				t.Fatalf("Decrypt() = %q, want %q", decrypted, tt.plaintext)
+			}
+		})
+	}
+}
+
+func TestCipherEncryptUsesFreshNonce(t *testing.T) {
+	c, err := NewCipher("current-master-key", nil)
+	if err != nil {
+		t.Fatalf("NewCipher: %v", err)
+	}
+
+	first, _ := c.Encrypt("sk-same")
+	second, _ := c.Encrypt("sk-same")
+	if first == second {
+		t.Fatalf("two encryptions of the same plaintext are identical: %q", first)
+	}
+}
+
+func TestCipherDisabled(t *testing.T) {
+	c, err := NewCipher("", nil)
+	if err != nil {
+		t.Fatalf("NewCipher: %v", err)
+	}
+	if c.Enabled() {
+		t.Fatal("Enabled() = true without a master key")
+	}
+
+	encrypted, err := c.Encrypt("sk-plain")
+	if err != nil || encrypted != "sk-plain" {
+		t.Fatalf("Encrypt() = %q, %v; want plaintext unchanged", encrypted, err)
+	}
+
+	sealed, _ := mustCipher(t, "some-key").Encrypt("sk-plain")
+	if _, err := c.Decrypt(sealed); !errors.Is(err, ErrNoMasterKey) {
+		t.Fatalf("Decrypt() error = %v, want ErrNoMasterKey", err)
+	}
+}
+
+func TestCipherRotation(t *testing.T) {
+	old := mustCipher(t, "old-master-key")
+	sealedByOld, err := old.Encrypt("sk-rotate-me")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	rotated, err := NewCipher("new-master-key", []string{"old-master-key"})
+	if err != nil {
+		t.Fatalf("NewCipher: %v", err)
+	}
+	sealedByNew, _ := rotated.Encrypt("sk-rotate-me")
+
+	decrypted, err := rotated.Decrypt(sealedByOld)
+	if err != nil || decrypted != "sk-rotate-me" {
+		t.Fatalf("Decrypt(old ciphertext) = %q, %v", decrypted, err)
+	}
+
+	// 旧主密钥被移除后,旧密文无法再解密
+	withoutOld := mustCipher(t, "new-master-key")
+	if _, err := withoutOld.Decrypt(sealedByOld); !errors.Is(err, ErrUnknownMasterKey) {
+		t.Fatalf("Decrypt() error = %v, want ErrUnknownMasterKey", err)
+	}
+
+	tests := []struct {
+		name   string
+		cipher *Cipher
+		value  string
+		want   bool
+	}{
+		{"plaintext with master key", rotated, "sk-plain", true},
+		{"sealed by previous key", rotated, sealedByOld, true},
+		{"sealed by current key", rotated, sealedByNew, false},
+		{"plaintext without master key", mustCipher(t, ""), "sk-plain", false},
+		{"decrypting with previous key only", mustCipherWith(t, "", "old-master-key"), sealedByOld, true},
+		{"unknown key without master key", mustCipher(t, ""), sealedByOld, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cipher.NeedsRotation(tt.value); got != tt.want {
+				t.Fatalf("NeedsRotation() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCipherDecryptPlaintextPassthrough(t *testing.T) {
+	c := mustCipher(t, "current-master-key")
+	for _, value := range []string{"sk-legacy", "", "enc:v0:not-ours"} {
+		got, err := c.Decrypt(value)
+		if err != nil || got != value {
+			t.Fatalf("Decrypt(%q) = %q, %v; want value unchanged", value, got, err)
+		}
+	}
+}
+
+func TestCipherDecryptCorrupted(t *testing.T) {
+	c := mustCipher(t, "current-master-key")
+	sealed, _ := c.Encrypt("sk-original")
+	id, payload, _ := parse(sealed)
+
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"bad base64", encryptedPrefix + id + ":!!!"},
+		{"too short", encryptedPrefix + id + ":AAAA"},
+		{"tampered", encryptedPrefix + id + ":" + flipFirst(payload)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := c.Decrypt(tt.value); err == nil {
+				t.Fatal("Decrypt() succeeded on corrupted ciphertext")
+			}
+		})
+	}
+}
+
+func TestNewCipherTrimsKeys(t *testing.T) {
+	sealed, _ := mustCipher(t, "old-master-key").Encrypt("sk-trim")
+
+	// 环境变量以逗号分隔时,旧主密钥可能带有空格
+	c, err := NewCipher(" new-master-key ", []string{" old-master-key", " "})
+	if err != nil {
+		t.Fatalf("NewCipher: %v", err)
+	}
+	got, err := c.Decrypt(sealed)
+	if err != nil || got != "sk-trim" {
+		t.Fatalf("Decrypt() = %q, %v", got, err)
+	}
+
+	resealed, _ := c.Encrypt("sk-trim")
+	if got, err := mustCipher(t, "new-master-key").Decrypt(resealed); err != nil || got != "sk-trim" {
+		t.Fatalf("Decrypt() with untrimmed key = %q, %v", got, err)
+	}
+}
+
+func mustCipher(t *testing.T, currentKey string) *Cipher {
+	t.Helper()
+	return mustCipherWith(t, currentKey)
+}
+
+func mustCipherWith(t *testing.T, currentKey string, previousKeys ...string) *Cipher {
+	t.Helper()
+	c, err := NewCipher(currentKey, previousKeys)
+	if err != nil {
+		t.Fatalf("NewCipher: %v", err)
+	}
+	return c
+}
+
+// flipFirst 修改 base64 载荷的第一个字符(nonce),使认证失败
+func flipFirst(payload string) string {
+	replacement := "A"
+	if payload[0] == 'A' {
+		replacement = "B"
+	}
+	return replacement + payload[1:]
+}
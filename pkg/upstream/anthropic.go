@@ -0,0 +1,312 @@
+package upstream
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// AnthropicMessagesRequest Anthropic Messages API 请求
+type AnthropicMessagesRequest struct {
+	Model         string               `json:"model" binding:"required"`
+	MaxTokens     int                  `json:"max_tokens" binding:"required,gt=0"`
+	System        AnthropicContent     `json:"system,omitempty"`
+	Messages      []AnthropicMessage   `json:"messages" binding:"required"`
+	Temperature   *float64             `json:"temperature,omitempty"`
+	TopP          *float64             `json:"top_p,omitempty"`
+	StopSequences []string             `json:"stop_sequences,omitempty"`
+	Tools         []AnthropicTool      `json:"tools,omitempty"`
+	ToolChoice    *AnthropicToolChoice `json:"tool_choice,omitempty"`
+	Stream        bool                 `json:"stream,omitempty"`
+}
+
+// AnthropicTool Anthropic 工具定义
+type AnthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+// AnthropicToolChoice Anthropic 工具选择策略
+type AnthropicToolChoice struct {
+	Type string `json:"type"` // auto, any, tool, none
+	Name string `json:"name,omitempty"`
+}
+
+// AnthropicMessage Anthropic 消息
+type AnthropicMessage struct {
+	Role    string           `json:"role"` // user, assistant
+	Content AnthropicContent `json:"content"`
+}
+
+// AnthropicContent 消息内容,兼容字符串和内容块数组两种写法
+type AnthropicContent []AnthropicContentBlock
+
+// UnmarshalJSON 解析字符串或内容块数组,字符串按单个文本块处理
+func (c *AnthropicContent) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*c = AnthropicContent{{Type: "text", Text: text}}
+		return nil
+	}
+
+	var blocks []AnthropicContentBlock
+	if err := json.Unmarshal(data, &blocks); err != nil {
+		return err
+	}
+	*c = blocks
+	return nil
+}
+
+// Text 拼接所有文本块
+func (c AnthropicContent) Text() string {
+	var parts []string
+	for _, block := range c {
+		if block.Type == "text" {
+			parts = append(parts, block.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// ToMessages 转换为内部消息
+// assistant 消息中的 tool_use 块转换为 tool_calls;
+// user 消息中的 tool_result 块转换为独立的 tool 消息,并排在其余内容之前
+func (m AnthropicMessage) ToMessages() []Message {
+	var (
+		messages  []Message
+		toolCalls []ToolCall
+		rest      AnthropicContent
+	)
+	for _, block := range m.Content {
+		switch block.Type {
+		case "tool_use":
+			toolCalls = append(toolCalls, ToolCall{
+				ID:   block.ID,
+				Type: "function",
+				Function: FunctionCall{
+					Name:      block.Name,
+					Arguments: string(argumentsJSON(string(block.Input))),
+				},
+			})
+		case "tool_result":
+			messages = append(messages, Message{
+				Role:       "tool",
+				ToolCallID: block.ToolUseID,
+				Content:    block.Content.ToMessageContent(),
+			})
+		default:
+			rest = append(rest, block)
+		}
+	}
+
+	if len(toolCalls) > 0 {
+		content := NullContent()
+		if len(rest) > 0 {
+			content = rest.ToMessageContent()
+		}
+		return append(messages, Message{Role: m.Role, Content: content, ToolCalls: toolCalls})
+	}
+	if len(rest) > 0 || len(messages) == 0 {
+		messages = append(messages, Message{Role: m.Role, Content: rest.ToMessageContent()})
+	}
+	return messages
+}
+
+// ToMessageContent 转换为内部消息内容
+// 仅含文本块时转换为纯文本,否则转换为内容片段数组:
+// image 转换为 image_url,base64 编码的 document 转换为 file
+func (c AnthropicContent) ToMessageContent() MessageContent {
+	multimodal := false
+	for _, block := range c {
+		if block.Type != "text" {
+			multimodal = true
+			break
+		}
+	}
+	if !multimodal {
+		return NewTextContent(c.Text())
+	}
+
+	parts := make([]ContentPart, 0, len(c))
+	for _, block := range c {
+		switch block.Type {
+		case "text":
+			parts = append(parts, ContentPart{Type: ContentPartText, Text: block.Text})
+		case "image":
+			if block.Source == nil {
+				continue
+			}
+			url := block.Source.URL
+			if block.Source.Type == "base64" {
+				url = DataURI(block.Source.MediaType, block.Source.Data)
+			}
+			parts = append(parts, ContentPart{Type: ContentPartImageURL, ImageURL: &ImageURL{URL: url}})
+		case "document":
+			if block.Source == nil || block.Source.Type != "base64" {
+				continue
+			}
+			parts = append(parts, ContentPart{Type: ContentPartFile, File: &FilePart{
+				FileData: DataURI(block.Source.MediaType, block.Source.Data),
+			}})
+		}
+	}
+	return NewPartsContent(parts)
+}
+
+// AnthropicContentBlock 内容块
+type AnthropicContentBlock struct {
+	Type   string           `json:"type"` // text, image, document, tool_use, tool_result
+	Text   string           `json:"text,omitempty"`
+	Source *AnthropicSource `json:"source,omitempty"`
+
+	// tool_use 块
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// tool_result 块
+	ToolUseID string           `json:"tool_use_id,omitempty"`
+	Content   AnthropicContent `json:"content,omitempty"`
+	IsError   bool             `json:"is_error,omitempty"`
+}
+
+// AnthropicSource 图片或文档来源
+type AnthropicSource struct {
+	Type      string `json:"type"` // base64, url
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+// AnthropicMessagesResponse Anthropic Messages API 响应
+type AnthropicMessagesResponse struct {
+	ID           string                  `json:"id"`
+	Type         string                  `json:"type"` // message
+	Role         string                  `json:"role"` // assistant
+	Model        string                  `json:"model"`
+	Content      []AnthropicContentBlock `json:"content"`
+	StopReason   string                  `json:"stop_reason"`
+	StopSequence *string                 `json:"stop_sequence"`
+	Usage        AnthropicUsage          `json:"usage"`
+}
+
+// AnthropicUsage Anthropic Token 使用量
+type AnthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// AnthropicErrorResponse Anthropic 错误响应
+type AnthropicErrorResponse struct {
+	Type  string               `json:"type"` // error
+	Error AnthropicErrorDetail `json:"error"`
+}
+
+// AnthropicErrorDetail Anthropic 错误详情
+type AnthropicErrorDetail struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// ToChatCompletionRequest 转换为内部文本对话请求
+// system 转换为首条 system 消息,工具定义与工具选择策略转换为 OpenAI 格式
+func (r *AnthropicMessagesRequest) ToChatCompletionRequest() *ChatCompletionRequest {
+	messages := make([]Message, 0, len(r.Messages)+1)
+	if len(r.System) > 0 {
+		messages = append(messages, Message{Role: "system", Content: NewTextContent(r.System.Text())})
+	}
+	for _, msg := range r.Messages {
+		messages = append(messages, msg.ToMessages()...)
+	}
+
+	maxTokens := r.MaxTokens
+	req := &ChatCompletionRequest{
+		Model:       r.Model,
+		Messages:    messages,
+		MaxTokens:   &maxTokens,
+		Temperature: r.Temperature,
+		TopP:        r.TopP,
+		Stop:        r.StopSequences,
+		Stream:      r.Stream,
+	}
+
+	for _, tool := range r.Tools {
+		req.Tools = append(req.Tools, Tool{
+			Type: "function",
+			Function: FunctionDefinition{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.InputSchema,
+			},
+		})
+	}
+
+	if r.ToolChoice != nil {
+		switch r.ToolChoice.Type {
+		case "any":
+			req.ToolChoice = &ToolChoice{Mode: "required"}
+		case "tool":
+			req.ToolChoice = &ToolChoice{Function: r.ToolChoice.Name}
+		default:
+			req.ToolChoice = &ToolChoice{Mode: r.ToolChoice.Type}
+		}
+	}
+	return req
+}
+
+// NewAnthropicMessagesResponse 将内部文本对话响应转换为 Anthropic 格式
+func NewAnthropicMessagesResponse(resp *ChatCompletionResponse, model string) *AnthropicMessagesResponse {
+	out := &AnthropicMessagesResponse{
+		ID:         AnthropicMessageID(resp.ID),
+		Type:       "message",
+		Role:       "assistant",
+		Model:      model,
+		Content:    []AnthropicContentBlock{},
+		StopReason: "end_turn",
+		Usage: AnthropicUsage{
+			InputTokens:  resp.Usage.PromptTokens,
+			OutputTokens: resp.Usage.CompletionTokens,
+		},
+	}
+
+	if len(resp.Choices) > 0 {
+		choice := resp.Choices[0]
+		if text := choice.Message.Content.Text(); text != "" {
+			out.Content = append(out.Content, AnthropicContentBlock{Type: "text", Text: text})
+		}
+		for _, call := range choice.Message.ToolCalls {
+			out.Content = append(out.Content, AnthropicContentBlock{
+				Type:  "tool_use",
+				ID:    call.ID,
+				Name:  call.Function.Name,
+				Input: argumentsJSON(call.Function.Arguments),
+			})
+		}
+		out.StopReason = AnthropicStopReason(choice.FinishReason)
+	}
+
+	return out
+}
+
+// AnthropicMessageID 基于上游响应 ID 生成 Anthropic 风格的消息 ID
+func AnthropicMessageID(id string) string {
+	id = strings.TrimPrefix(id, "chatcmpl-")
+	if id == "" {
+		id = strings.ReplaceAll(uuid.New().String(), "-", "")
+	}
+	return "msg_" + id
+}
+
+// AnthropicStopReason 将 OpenAI finish_reason 映射为 Anthropic stop_reason
+func AnthropicStopReason(finishReason string) string {
+	switch finishReason {
+	case "length":
+		return "max_tokens"
+	case "tool_calls", "function_call":
+		return "tool_use"
+	default:
+		return "end_turn"
+	}
+}
@@ -0,0 +1,247 @@
+package upstream
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// decodeAnthropicRequest 解析 Anthropic 请求 JSON 并转换为内部请求
+func decodeAnthropicRequest(t *testing.T, body string) *ChatCompletionRequest {
+	t.Helper()
+	var req AnthropicMessagesRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	return req.ToChatCompletionRequest()
+}
+
+func TestAnthropicToChatCompletionRequest(t *testing.T) {
+	req := decodeAnthropicRequest(t, `{
+		"model": "claude-3",
+		"max_tokens": 256,
+		"system": [{"type":"text","text":"be brief"},{"type":"text","text":"be kind"}],
+		"stop_sequences": ["END"],
+		"stream": true,
+		"messages": [{"role":"user","content":"hello"}]
+	}`)
+
+	if req.Model != "claude-3" || req.MaxTokens == nil || *req.MaxTokens != 256 || !req.Stream {
+		t.Fatalf("request = %+v", req)
+	}
+	if len(req.Stop) != 1 || req.Stop[0] != "END" {
+		t.Fatalf("Stop = %v", req.Stop)
+	}
+	if len(req.Messages) != 2 {
+		t.Fatalf("got %d messages, want system and user", len(req.Messages))
+	}
+	if m := req.Messages[0]; m.Role != "system" || m.Content.Text() != "be brief\nbe kind" {
+		t.Fatalf("system message = %+v", m)
+	}
+	if m := req.Messages[1]; m.Role != "user" || m.Content.IsMultipart() || m.Content.Text() != "hello" {
+		t.Fatalf("user message = %+v", m)
+	}
+}
+
+func TestAnthropicToolChoice(t *testing.T) {
+	tests := []struct {
+		name     string
+		choice   string
+		mode     string
+		function string
+	}{
+		{"auto", `{"type":"auto"}`, "auto", ""},
+		{"any", `{"type":"any"}`, "required", ""},
+		{"none", `{"type":"none"}`, "none", ""},
+		{"named tool", `{"type":"tool","name":"get_weather"}`, "", "get_weather"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := decodeAnthropicRequest(t, `{
+				"model": "claude-3",
+				"max_tokens": 16,
+				"messages": [{"role":"user","content":"hi"}],
+				"tools": [{"name":"get_weather","description":"weather","input_schema":{"type":"object"}}],
+				"tool_choice": `+tt.choice+`
+			}`)
+
+			if len(req.Tools) != 1 || req.Tools[0].Type != "function" || req.Tools[0].Function.Name != "get_weather" {
+				t.Fatalf("Tools = %+v", req.Tools)
+			}
+			if string(req.Tools[0].Function.Parameters) != `{"type":"object"}` {
+				t.Fatalf("Parameters = %s", req.Tools[0].Function.Parameters)
+			}
+			if req.ToolChoice == nil || req.ToolChoice.Mode != tt.mode || req.ToolChoice.Function != tt.function {
+				t.Fatalf("ToolChoice = %+v, want mode %q function %q", req.ToolChoice, tt.mode, tt.function)
+			}
+		})
+	}
+}
+
+func TestAnthropicToolUseAndResultMessages(t *testing.T) {
+	req := decodeAnthropicRequest(t, `{
+		"model": "claude-3",
+		"max_tokens": 16,
+		"messages": [
+			{"role":"user","content":"weather in Paris?"},
+			{"role":"assistant","content":[
+				{"type":"text","text":"Let me check."},
+				{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{"city":"Paris"}}
+			]},
+			{"role":"user","content":[
+				{"type":"text","text":"and be quick"},
+				{"type":"tool_result","tool_use_id":"toolu_1","content":"sunny"}
+			]}
+		]
+	}`)
+
+	if len(req.Messages) != 4 {
+		t.Fatalf("got %d messages, want 4: %+v", len(req.Messages), req.Messages)
+	}
+
+	assistant := req.Messages[1]
+	if assistant.Role != "assistant" || assistant.Content.Text() != "Let me check." {
+		t.Fatalf("assistant message = %+v", assistant)
+	}
+	if len(assistant.ToolCalls) != 1 {
+		t.Fatalf("ToolCalls = %+v", assistant.ToolCalls)
+	}
+	call := assistant.ToolCalls[0]
+	if call.ID != "toolu_1" || call.Type != "function" || call.Function.Name != "get_weather" || call.Function.Arguments != `{"city":"Paris"}` {
+		t.Fatalf("tool call = %+v", call)
+	}
+
+	// tool_result 转换为 tool 消息,排在同一轮的其余内容之前
+	if m := req.Messages[2]; m.Role != "tool" || m.ToolCallID != "toolu_1" || m.Content.Text() != "sunny" {
+		t.Fatalf("tool message = %+v", m)
+	}
+	if m := req.Messages[3]; m.Role != "user" || m.Content.Text() != "and be quick" {
+		t.Fatalf("trailing user message = %+v", m)
+	}
+}
+
+func TestAnthropicToolUseWithoutText(t *testing.T) {
+	msgs := AnthropicMessage{
+		Role:    "assistant",
+		Content: AnthropicContent{{Type: "tool_use", ID: "toolu_1", Name: "noop"}},
+	}.ToMessages()
+
+	if len(msgs) != 1 {
+		t.Fatalf("got %d messages, want 1", len(msgs))
+	}
+	content, _ := json.Marshal(msgs[0].Content)
+	if string(content) != "null" {
+		t.Fatalf("content = %s, want null", content)
+	}
+	if args := msgs[0].ToolCalls[0].Function.Arguments; args != "{}" {
+		t.Fatalf("Arguments = %q, want {}", args)
+	}
+}
+
+func TestAnthropicContentToMessageContent(t *testing.T) {
+	var content AnthropicContent
+	err := json.Unmarshal([]byte(`[
+		{"type":"text","text":"describe"},
+		{"type":"image","source":{"type":"base64","media_type":"image/png","data":"iVBORw0KGgo="}},
+		{"type":"image","source":{"type":"url","url":"https://example.com/cat.png"}},
+		{"type":"document","source":{"type":"base64","media_type":"application/pdf","data":"JVBERi0="}},
+		{"type":"document","source":{"type":"url","url":"https://example.com/doc.pdf"}}
+	]`), &content)
+	if err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	parts := content.ToMessageContent().Parts()
+	if len(parts) != 4 {
+		t.Fatalf("got %d parts, want 4 (url documents are dropped): %+v", len(parts), parts)
+	}
+	if parts[0].Type != ContentPartText || parts[0].Text != "describe" {
+		t.Fatalf("part 0 = %+v", parts[0])
+	}
+	if parts[1].ImageURL == nil || parts[1].ImageURL.URL != "data:image/png;base64,iVBORw0KGgo=" {
+		t.Fatalf("part 1 = %+v", parts[1])
+	}
+	if parts[2].ImageURL == nil || parts[2].ImageURL.URL != "https://example.com/cat.png" {
+		t.Fatalf("part 2 = %+v", parts[2])
+	}
+	if parts[3].Type != ContentPartFile || parts[3].File == nil || parts[3].File.FileData != "data:application/pdf;base64,JVBERi0=" {
+		t.Fatalf("part 3 = %+v", parts[3])
+	}
+}
+
+func TestNewAnthropicMessagesResponse(t *testing.T) {
+	var resp ChatCompletionResponse
+	err := json.Unmarshal([]byte(`{
+		"id": "chatcmpl-abc",
+		"model": "gpt-4o",
+		"choices": [{
+			"index": 0,
+			"message": {
+				"role": "assistant",
+				"content": "Checking.",
+				"tool_calls": [{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]
+			},
+			"finish_reason": "tool_calls"
+		}],
+		"usage": {"prompt_tokens": 10, "completion_tokens": 4, "total_tokens": 14}
+	}`), &resp)
+	if err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	out := NewAnthropicMessagesResponse(&resp, "claude-3")
+	if out.ID != "msg_abc" || out.Model != "claude-3" || out.StopReason != "tool_use" {
+		t.Fatalf("response = %+v", out)
+	}
+	if out.Usage.InputTokens != 10 || out.Usage.OutputTokens != 4 {
+		t.Fatalf("Usage = %+v", out.Usage)
+	}
+	if len(out.Content) != 2 || out.Content[0].Type != "text" || out.Content[0].Text != "Checking." {
+		t.Fatalf("Content = %+v", out.Content)
+	}
+	if block := out.Content[1]; block.Type != "tool_use" || block.ID != "call_1" || string(block.Input) != `{"city":"Paris"}` {
+		t.Fatalf("tool_use block = %+v", block)
+	}
+}
+
+func TestNewAnthropicMessagesResponseEmpty(t *testing.T) {
+	out := NewAnthropicMessagesResponse(&ChatCompletionResponse{ID: "chatcmpl-x"}, "claude-3")
+
+	data, err := json.Marshal(out)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	// content 即使为空也必须是数组
+	if !strings.Contains(string(data), `"content":[]`) || out.StopReason != "end_turn" {
+		t.Fatalf("response = %s", data)
+	}
+}
+
+func TestAnthropicStopReason(t *testing.T) {
+	tests := map[string]string{
+		"stop":           "end_turn",
+		"":               "end_turn",
+		"length":         "max_tokens",
+		"tool_calls":     "tool_use",
+		"function_call":  "tool_use",
+		"content_filter": "end_turn",
+	}
+	for finishReason, want := range tests {
+		if got := AnthropicStopReason(finishReason); got != want {
+			t.Errorf("AnthropicStopReason(%q) = %q, want %q", finishReason, got, want)
+		}
+	}
+}
+
+func TestAnthropicMessageID(t *testing.T) {
+	if got := AnthropicMessageID("chatcmpl-123"); got != "msg_123" {
+		t.Fatalf("AnthropicMessageID() = %q, want msg_123", got)
+	}
+	if got := AnthropicMessageID("resp-9"); got != "msg_resp-9" {
+		t.Fatalf("AnthropicMessageID() = %q, want msg_resp-9", got)
+	}
+	generated := AnthropicMessageID("")
+	if !strings.HasPrefix(generated, "msg_") || len(generated) != len("msg_")+32 {
+		t.Fatalf("AnthropicMessageID(\"\") = %q, want generated msg_ ID", generated)
+	}
+}
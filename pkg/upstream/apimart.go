@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 
 	"github.com/869413421/transit/pkg/logger"
@@ -15,6 +16,14 @@ type APIMartAdapter struct {
 	client *Client
 }
 
+var _ Provider = (*APIMartAdapter)(nil)
+
+func init() {
+	RegisterProvider(ProviderAPIMart, func(baseURL, apiKey string) Provider {
+		return NewAPIMartAdapter(baseURL, apiKey)
+	})
+}
+
 // NewAPIMartAdapter 创建APIMart适配器
 func NewAPIMartAdapter(baseURL, apiKey string) *APIMartAdapter {
 	return &APIMartAdapter{
@@ -41,11 +50,7 @@ func (a *APIMartAdapter) ChatCompletion(ctx context.Context, req *ChatCompletion
 
 	// 检查HTTP状态码
 	if resp.StatusCode != http.StatusOK {
-		var errResp ErrorResponse
-		if err := json.Unmarshal(resp.Body, &errResp); err != nil {
-			return nil, fmt.Errorf("http %d: %s", resp.StatusCode, string(resp.Body))
-		}
-		return nil, fmt.Errorf("api error: %s", errResp.Error.Message)
+		return nil, newAPIError(resp.StatusCode, resp.Body)
 	}
 
 	// 解析响应
@@ -62,6 +67,72 @@ func (a *APIMartAdapter) ChatCompletion(ctx context.Context, req *ChatCompletion
 	return &chatResp, nil
 }
 
+// ChatCompletionStream 文本对话(流式)
+// 始终要求上游在最后一个数据块中返回 usage,以便准确计费
+func (a *APIMartAdapter) ChatCompletionStream(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionStream, error) {
+	logger.Info("APIMart chat completion stream request",
+		zap.String("model", req.Model),
+		zap.Int("messages", len(req.Messages)),
+	)
+
+	streamReq := *req
+	streamReq.Stream = true
+	streamReq.StreamOptions = &StreamOptions{IncludeUsage: true}
+
+	// 发送请求到APIMart
+	resp, err := a.client.DoStream(ctx, &Request{
+		Method:  http.MethodPost,
+		Path:    "/v1/chat/completions",
+		Headers: map[string]string{"Accept": "text/event-stream"},
+		Body:    &streamReq,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+
+	// 检查HTTP状态码
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, newAPIError(resp.StatusCode, body)
+	}
+
+	return NewChatCompletionStream(resp.Body), nil
+}
+
+// Embeddings 文本向量化
+func (a *APIMartAdapter) Embeddings(ctx context.Context, req *EmbeddingRequest) (*EmbeddingResponse, error) {
+	logger.Info("APIMart embeddings request",
+		zap.String("model", req.Model),
+		zap.Int("inputs", req.Input.Len()),
+	)
+
+	resp, err := a.client.Do(ctx, &Request{
+		Method: http.MethodPost,
+		Path:   "/v1/embeddings",
+		Body:   req,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp.StatusCode, resp.Body)
+	}
+
+	var embeddingResp EmbeddingResponse
+	if err := json.Unmarshal(resp.Body, &embeddingResp); err != nil {
+		return nil, fmt.Errorf("unmarshal response: %w", err)
+	}
+
+	logger.Info("APIMart embeddings success",
+		zap.String("model", embeddingResp.Model),
+		zap.Int("prompt_tokens", embeddingResp.Usage.PromptTokens),
+	)
+
+	return &embeddingResp, nil
+}
+
 // ImageGeneration 图片生成(异步)
 func (a *APIMartAdapter) ImageGeneration(ctx context.Context, req *ImageGenerationRequest) (*ImageGenerationResponse, error) {
 	logger.Info("APIMart image generation request",
@@ -81,11 +152,7 @@ func (a *APIMartAdapter) ImageGeneration(ctx context.Context, req *ImageGenerati
 
 	// 检查HTTP状态码
 	if resp.StatusCode != http.StatusOK {
-		var errResp ErrorResponse
-		if err := json.Unmarshal(resp.Body, &errResp); err != nil {
-			return nil, fmt.Errorf("http %d: %s", resp.StatusCode, string(resp.Body))
-		}
-		return nil, fmt.Errorf("api error: %s", errResp.Error.Message)
+		return nil, newAPIError(resp.StatusCode, resp.Body)
 	}
 
 	// 解析响应(APIMart返回格式: {code: 0, data: {status: "submitted", task_id: "xxx"}})
@@ -130,11 +197,7 @@ func (a *APIMartAdapter) VideoGeneration(ctx context.Context, req *VideoGenerati
 
 	// 检查HTTP状态码
 	if resp.StatusCode != http.StatusOK {
-		var errResp ErrorResponse
-		if err := json.Unmarshal(resp.Body, &errResp); err != nil {
-			return nil, fmt.Errorf("http %d: %s", resp.StatusCode, string(resp.Body))
-		}
-		return nil, fmt.Errorf("api error: %s", errResp.Error.Message)
+		return nil, newAPIError(resp.StatusCode, resp.Body)
 	}
 
 	// 解析响应
@@ -175,7 +238,7 @@ func (a *APIMartAdapter) GetTaskStatus(ctx context.Context, taskID string) (*Tas
 
 	// 检查HTTP状态码
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("http %d: %s", resp.StatusCode, string(resp.Body))
+		return nil, newAPIError(resp.StatusCode, resp.Body)
 	}
 
 	// 解析响应
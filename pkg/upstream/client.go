@@ -13,21 +13,44 @@ import (
 	"go.uber.org/zap"
 )
 
+// RequestTimeout 非流式上游请求的超时时间,同时是流式请求等待响应头的最长时间
+const RequestTimeout = 60 * time.Second
+
+// streamTransport 流式请求共享的传输层
+// 流式响应体持续时间不可预知,不设置整体超时,仅限制等待响应头的时间,
+// 连接生命周期由请求上下文控制
+var streamTransport = func() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.ResponseHeaderTimeout = RequestTimeout
+	return t
+}()
+
 // Client 上游API客户端
 type Client struct {
-	httpClient *http.Client
-	baseURL    string
-	apiKey     string
+	httpClient   *http.Client
+	streamClient *http.Client
+	baseURL      string
+	authHeader   string
+	authValue    string
 }
 
-// NewClient 创建上游API客户端
+// NewClient 创建上游API客户端,使用 "Authorization: Bearer <apiKey>" 鉴权
 func NewClient(baseURL, apiKey string) *Client {
+	return NewClientWithAuthHeader(baseURL, "Authorization", "Bearer "+apiKey)
+}
+
+// NewClientWithAuthHeader 创建使用自定义鉴权头的上游API客户端(如 x-goog-api-key)
+func NewClientWithAuthHeader(baseURL, header, value string) *Client {
 	return &Client{
 		httpClient: &http.Client{
-			Timeout: 60 * time.Second,
+			Timeout: RequestTimeout,
 		},
-		baseURL: baseURL,
-		apiKey:  apiKey,
+		streamClient: &http.Client{
+			Transport: streamTransport,
+		},
+		baseURL:    baseURL,
+		authHeader: header,
+		authValue:  value,
 	}
 }
 
@@ -46,8 +69,72 @@ type Response struct {
 	Headers    http.Header
 }
 
+// StreamResponse 流式响应结构,调用方负责关闭 Body
+type StreamResponse struct {
+	StatusCode int
+	Body       io.ReadCloser
+	Headers    http.Header
+}
+
 // Do 执行HTTP请求
 func (c *Client) Do(ctx context.Context, req *Request) (*Response, error) {
+	httpReq, err := c.newHTTPRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	httpResp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("send http request: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	// 读取响应体
+	respBody, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response body: %w", err)
+	}
+
+	logger.Debug("Received upstream response",
+		zap.Int("status_code", httpResp.StatusCode),
+		zap.Int("body_size", len(respBody)),
+	)
+	captureRateLimit(ctx, httpResp.StatusCode, httpResp.Header)
+
+	return &Response{
+		StatusCode: httpResp.StatusCode,
+		Body:       respBody,
+		Headers:    httpResp.Header,
+	}, nil
+}
+
+// DoStream 执行HTTP请求并返回未读取的响应体,用于SSE等流式响应
+func (c *Client) DoStream(ctx context.Context, req *Request) (*StreamResponse, error) {
+	httpReq, err := c.newHTTPRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	httpResp, err := c.streamClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("send http request: %w", err)
+	}
+
+	logger.Debug("Received upstream stream response",
+		zap.Int("status_code", httpResp.StatusCode),
+		zap.String("content_type", httpResp.Header.Get("Content-Type")),
+	)
+	captureRateLimit(ctx, httpResp.StatusCode, httpResp.Header)
+
+	return &StreamResponse{
+		StatusCode: httpResp.StatusCode,
+		Body:       httpResp.Body,
+		Headers:    httpResp.Header,
+	}, nil
+}
+
+// newHTTPRequest 构建带鉴权头的HTTP请求
+func (c *Client) newHTTPRequest(ctx context.Context, req *Request) (*http.Request, error) {
 	// 构建请求URL
 	url := c.baseURL + req.Path
 
@@ -69,39 +156,17 @@ func (c *Client) Do(ctx context.Context, req *Request) (*Response, error) {
 
 	// 设置默认请求头
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
+	httpReq.Header.Set(c.authHeader, c.authValue)
 
 	// 设置自定义请求头
 	for key, value := range req.Headers {
 		httpReq.Header.Set(key, value)
 	}
 
-	// 发送请求
 	logger.Debug("Sending upstream request",
 		zap.String("method", req.Method),
 		zap.String("url", url),
 	)
 
-	httpResp, err := c.httpClient.Do(httpReq)
-	if err != nil {
-		return nil, fmt.Errorf("send http request: %w", err)
-	}
-	defer httpResp.Body.Close()
-
-	// 读取响应体
-	respBody, err := io.ReadAll(httpResp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("read response body: %w", err)
-	}
-
-	logger.Debug("Received upstream response",
-		zap.Int("status_code", httpResp.StatusCode),
-		zap.Int("body_size", len(respBody)),
-	)
-
-	return &Response{
-		StatusCode: httpResp.StatusCode,
-		Body:       respBody,
-		Headers:    httpResp.Header,
-	}, nil
+	return httpReq, nil
 }
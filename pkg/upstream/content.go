@@ -0,0 +1,198 @@
+package upstream
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// MessageContent 消息内容,兼容 OpenAI 的字符串和内容片段数组两种写法
+// 序列化时保持原始写法: 字符串仍为字符串,数组仍为数组,null 仍为 null
+type MessageContent struct {
+	text  string
+	parts []ContentPart
+	null  bool
+}
+
+// NewTextContent 创建纯文本内容
+func NewTextContent(text string) MessageContent {
+	return MessageContent{text: text}
+}
+
+// NewPartsContent 创建内容片段数组
+func NewPartsContent(parts []ContentPart) MessageContent {
+	if parts == nil {
+		parts = []ContentPart{}
+	}
+	return MessageContent{parts: parts}
+}
+
+// NullContent 创建 null 内容(如仅包含工具调用的 assistant 消息)
+func NullContent() MessageContent {
+	return MessageContent{null: true}
+}
+
+// IsMultipart 是否为内容片段数组
+func (c MessageContent) IsMultipart() bool {
+	return c.parts != nil
+}
+
+// Parts 返回内容片段,纯文本内容转换为单个 text 片段
+func (c MessageContent) Parts() []ContentPart {
+	if c.parts != nil {
+		return c.parts
+	}
+	if c.text == "" {
+		return nil
+	}
+	return []ContentPart{{Type: ContentPartText, Text: c.text}}
+}
+
+// Text 返回文本内容,内容片段数组时拼接所有 text 片段
+func (c MessageContent) Text() string {
+	if c.parts == nil {
+		return c.text
+	}
+	var texts []string
+	for _, part := range c.parts {
+		if part.Type == ContentPartText {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// UnmarshalJSON 解析字符串、内容片段数组或 null
+func (c *MessageContent) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.Equal(data, []byte("null")):
+		*c = NullContent()
+		return nil
+	case bytes.HasPrefix(data, []byte("[")):
+		var parts []ContentPart
+		if err := json.Unmarshal(data, &parts); err != nil {
+			return err
+		}
+		*c = NewPartsContent(parts)
+		return nil
+	default:
+		var text string
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+		*c = NewTextContent(text)
+		return nil
+	}
+}
+
+// MarshalJSON 按原始写法序列化
+func (c MessageContent) MarshalJSON() ([]byte, error) {
+	switch {
+	case c.parts != nil:
+		return json.Marshal(c.parts)
+	case c.null:
+		return []byte("null"), nil
+	default:
+		return json.Marshal(c.text)
+	}
+}
+
+// 内容片段类型
+const (
+	ContentPartText       = "text"
+	ContentPartImageURL   = "image_url"
+	ContentPartInputAudio = "input_audio"
+	ContentPartFile       = "file"
+)
+
+// ContentPart 内容片段
+type ContentPart struct {
+	Type       string      `json:"type"` // text, image_url, input_audio, file
+	Text       string      `json:"text,omitempty"`
+	ImageURL   *ImageURL   `json:"image_url,omitempty"`
+	InputAudio *InputAudio `json:"input_audio,omitempty"`
+	File       *FilePart   `json:"file,omitempty"`
+
+	// Extra 未声明的字段,原样透传
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON 解析已声明字段,其余字段保留到 Extra
+func (p *ContentPart) UnmarshalJSON(data []byte) error {
+	type alias ContentPart
+	if err := json.Unmarshal(data, (*alias)(p)); err != nil {
+		return err
+	}
+	extra, err := extractExtra(data, p)
+	p.Extra = extra
+	return err
+}
+
+// MarshalJSON 序列化时合并 Extra 字段,text 片段即使为空也保留 text 字段
+func (p ContentPart) MarshalJSON() ([]byte, error) {
+	type alias ContentPart
+	extra := p.Extra
+	if p.Type == ContentPartText && p.Text == "" {
+		extra = make(map[string]json.RawMessage, len(p.Extra)+1)
+		for k, v := range p.Extra {
+			extra[k] = v
+		}
+		extra["text"] = json.RawMessage(`""`)
+	}
+	return marshalWithExtra(alias(p), extra)
+}
+
+// ImageURL 图片输入,URL 可以是 http(s) 地址或 data URI
+type ImageURL struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"` // auto, low, high
+}
+
+// InputAudio 音频输入(base64)
+type InputAudio struct {
+	Data   string `json:"data"`
+	Format string `json:"format"` // wav, mp3
+}
+
+// FilePart 文件输入
+type FilePart struct {
+	FileID   string `json:"file_id,omitempty"`
+	FileData string `json:"file_data,omitempty"` // data URI
+	Filename string `json:"filename,omitempty"`
+}
+
+// DataURI 构建 base64 data URI
+func DataURI(mimeType, data string) string {
+	return "data:" + mimeType + ";base64," + data
+}
+
+// ParseDataURI 解析 base64 data URI,返回 MIME 类型与数据
+func ParseDataURI(uri string) (mimeType, data string, ok bool) {
+	rest, found := strings.CutPrefix(uri, "data:")
+	if !found {
+		return "", "", false
+	}
+	meta, data, found := strings.Cut(rest, ",")
+	if !found {
+		return "", "", false
+	}
+	mimeType, found = strings.CutSuffix(meta, ";base64")
+	if !found {
+		return "", "", false
+	}
+	return mimeType, data, true
+}
+
+// CountInputImages 统计请求消息中的图片输入数量
+func CountInputImages(messages []Message) int {
+	count := 0
+	for _, msg := range messages {
+		for _, part := range msg.Content.parts {
+			if part.Type == ContentPartImageURL {
+				count++
+			}
+		}
+	}
+	return count
+}
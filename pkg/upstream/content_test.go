@@ -0,0 +1,86 @@
+package upstream
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMessageContentRoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		raw       string
+		multipart bool
+		text      string
+	}{
+		{"string", `"hello"`, false, "hello"},
+		{"null", `null`, false, ""},
+		{"empty parts", `[]`, true, ""},
+		{"parts", `[{"type":"text","text":"describe"},{"type":"image_url","image_url":{"url":"https://example.com/cat.png","detail":"low"}},{"type":"text","text":"this"}]`, true, "describe\nthis"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var content MessageContent
+			if err := json.Unmarshal([]byte(tt.raw), &content); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if content.IsMultipart() != tt.multipart || content.Text() != tt.text {
+				t.Fatalf("content = %+v, want multipart %v text %q", content, tt.multipart, tt.text)
+			}
+
+			// 序列化保持原始写法
+			out, err := json.Marshal(content)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			if string(out) != tt.raw {
+				t.Fatalf("marshal = %s, want %s", out, tt.raw)
+			}
+		})
+	}
+}
+
+func TestMessageContentParts(t *testing.T) {
+	if parts := NewTextContent("hi").Parts(); len(parts) != 1 || parts[0].Type != ContentPartText || parts[0].Text != "hi" {
+		t.Fatalf("Parts() = %+v, want a single text part", parts)
+	}
+	if parts := NewTextContent("").Parts(); parts != nil {
+		t.Fatalf("Parts() of empty text = %+v, want nil", parts)
+	}
+}
+
+func TestContentPartKeepsEmptyText(t *testing.T) {
+	out, err := json.Marshal(ContentPart{Type: ContentPartText})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if string(out) != `{"text":"","type":"text"}` {
+		t.Fatalf("marshal = %s", out)
+	}
+}
+
+func TestParseDataURI(t *testing.T) {
+	uri := DataURI("image/png", "iVBORw0KGgo=")
+	mimeType, data, ok := ParseDataURI(uri)
+	if !ok || mimeType != "image/png" || data != "iVBORw0KGgo=" {
+		t.Fatalf("ParseDataURI(%q) = %q, %q, %v", uri, mimeType, data, ok)
+	}
+
+	for _, invalid := range []string{"https://example.com/cat.png", "data:image/png,plain", "data:image/png;base64"} {
+		if _, _, ok := ParseDataURI(invalid); ok {
+			t.Errorf("ParseDataURI(%q) ok, want false", invalid)
+		}
+	}
+}
+
+func TestCountInputImages(t *testing.T) {
+	image := ContentPart{Type: ContentPartImageURL, ImageURL: &ImageURL{URL: "https://example.com/cat.png"}}
+	messages := []Message{
+		{Role: "system", Content: NewTextContent("be brief")},
+		{Role: "user", Content: NewPartsContent([]ContentPart{{Type: ContentPartText, Text: "compare"}, image, image})},
+		{Role: "assistant", Content: NewTextContent("they match")},
+		{Role: "user", Content: NewPartsContent([]ContentPart{image})},
+	}
+	if got := CountInputImages(messages); got != 3 {
+		t.Fatalf("CountInputImages() = %d, want 3", got)
+	}
+}
@@ -0,0 +1,164 @@
+package upstream
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// EmbeddingRequest 向量化请求(OpenAI 格式)
+type EmbeddingRequest struct {
+	Model          string         `json:"model" binding:"required"`
+	Input          EmbeddingInput `json:"input"`
+	EncodingFormat string         `json:"encoding_format,omitempty"` // float, base64
+	Dimensions     *int           `json:"dimensions,omitempty"`
+	User           string         `json:"user,omitempty"`
+
+	// Extra 中转站不解析的字段,原样转发给上游
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON 解析已声明字段,其余字段保留到 Extra
+func (r *EmbeddingRequest) UnmarshalJSON(data []byte) error {
+	type alias EmbeddingRequest
+	if err := json.Unmarshal(data, (*alias)(r)); err != nil {
+		return err
+	}
+	extra, err := extractExtra(data, r)
+	r.Extra = extra
+	return err
+}
+
+// MarshalJSON 序列化时合并 Extra 字段
+func (r EmbeddingRequest) MarshalJSON() ([]byte, error) {
+	type alias EmbeddingRequest
+	return marshalWithExtra(alias(r), r.Extra)
+}
+
+// EmbeddingInput 向量化输入,兼容字符串、字符串数组、Token 数组及 Token 数组的数组
+// 序列化时保持原始写法
+type EmbeddingInput struct {
+	texts  []string
+	tokens [][]int
+	raw    json.RawMessage
+}
+
+// NewEmbeddingInput 由文本创建向量化输入
+func NewEmbeddingInput(texts ...string) EmbeddingInput {
+	return EmbeddingInput{texts: texts}
+}
+
+// Texts 文本输入,输入为 Token 数组时为空
+func (in EmbeddingInput) Texts() []string {
+	return in.texts
+}
+
+// IsTokens 输入是否为 Token 数组
+func (in EmbeddingInput) IsTokens() bool {
+	return len(in.tokens) > 0
+}
+
+// Len 输入条数
+func (in EmbeddingInput) Len() int {
+	if in.IsTokens() {
+		return len(in.tokens)
+	}
+	return len(in.texts)
+}
+
+// EstimateTokens 估算输入 Token 数,Token 数组输入直接按长度计数
+func (in EmbeddingInput) EstimateTokens() int {
+	total := 0
+	for _, tokens := range in.tokens {
+		total += len(tokens)
+	}
+	for _, text := range in.texts {
+		total += EstimateTokens(text)
+	}
+	return total
+}
+
+// UnmarshalJSON 解析字符串、字符串数组、Token 数组或 Token 数组的数组
+func (in *EmbeddingInput) UnmarshalJSON(data []byte) error {
+	*in = EmbeddingInput{raw: append(json.RawMessage(nil), data...)}
+
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte(`"`)) {
+		var text string
+		if err := json.Unmarshal(trimmed, &text); err != nil {
+			return err
+		}
+		in.texts = []string{text}
+		return nil
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(trimmed, &items); err != nil {
+		return fmt.Errorf("input must be a string or an array: %w", err)
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	switch first := bytes.TrimSpace(items[0]); {
+	case bytes.HasPrefix(first, []byte(`"`)):
+		return json.Unmarshal(trimmed, &in.texts)
+	case bytes.HasPrefix(first, []byte(`[`)):
+		return json.Unmarshal(trimmed, &in.tokens)
+	default:
+		var tokens []int
+		if err := json.Unmarshal(trimmed, &tokens); err != nil {
+			return err
+		}
+		in.tokens = [][]int{tokens}
+		return nil
+	}
+}
+
+// MarshalJSON 保持原始写法序列化
+func (in EmbeddingInput) MarshalJSON() ([]byte, error) {
+	if len(in.raw) > 0 {
+		return in.raw, nil
+	}
+	if in.IsTokens() {
+		return json.Marshal(in.tokens)
+	}
+	return json.Marshal(in.texts)
+}
+
+// EmbeddingResponse 向量化响应(OpenAI 格式)
+type EmbeddingResponse struct {
+	Object string          `json:"object"`
+	Data   []EmbeddingData `json:"data"`
+	Model  string          `json:"model"`
+	Usage  EmbeddingUsage  `json:"usage"`
+}
+
+// EmbeddingData 单条向量
+type EmbeddingData struct {
+	Object    string          `json:"object"`
+	Index     int             `json:"index"`
+	Embedding json.RawMessage `json:"embedding"` // float 数组,或 encoding_format=base64 时的字符串
+}
+
+// EmbeddingUsage 向量化 Token 使用量
+type EmbeddingUsage struct {
+	PromptTokens int `json:"prompt_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+// encodeEmbedding 按 encoding_format 编码向量,base64 为小端 float32 序列
+func encodeEmbedding(values []float64, encodingFormat string) (json.RawMessage, error) {
+	if encodingFormat != "base64" {
+		return json.Marshal(values)
+	}
+
+	buf := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(float32(v)))
+	}
+	return json.Marshal(base64.StdEncoding.EncodeToString(buf))
+}
@@ -0,0 +1,149 @@
+package upstream
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"testing"
+)
+
+func TestEmbeddingInputForms(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		tokens bool
+		len    int
+	}{
+		{"string", `"hello world"`, false, 1},
+		{"strings", `["a","b","c"]`, false, 3},
+		{"tokens", `[1,2,3]`, true, 1},
+		{"token arrays", `[[1,2],[3]]`, true, 2},
+		{"empty", `[]`, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req EmbeddingRequest
+			body := `{"model":"text-embedding-3-small","input":` + tt.input + `,"user":"u1"}`
+			out := roundTrip(t, body, &req)
+			if req.Input.IsTokens() != tt.tokens || req.Input.Len() != tt.len {
+				t.Fatalf("input = %+v, want tokens %v len %d", req.Input, tt.tokens, tt.len)
+			}
+			// 转发给上游时保持原始写法
+			assertJSONEqual(t, out, body)
+		})
+	}
+
+	var req EmbeddingRequest
+	if err := json.Unmarshal([]byte(`{"model":"m","input":{"text":"x"}}`), &req); err == nil {
+		t.Fatal("unmarshal object input returned no error")
+	}
+}
+
+func TestEmbeddingInputEstimateTokens(t *testing.T) {
+	var in EmbeddingInput
+	if err := json.Unmarshal([]byte(`[[1,2,3],[4,5]]`), &in); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	// Token 数组输入直接按长度计数
+	if got := in.EstimateTokens(); got != 5 {
+		t.Fatalf("EstimateTokens() = %d, want 5", got)
+	}
+	if got := NewEmbeddingInput("hello", "world").EstimateTokens(); got != EstimateTokens("hello")+EstimateTokens("world") {
+		t.Fatalf("EstimateTokens() = %d", got)
+	}
+}
+
+func TestEncodeEmbedding(t *testing.T) {
+	values := []float64{0.5, -1.25}
+
+	floats, err := encodeEmbedding(values, "")
+	if err != nil || string(floats) != `[0.5,-1.25]` {
+		t.Fatalf("encodeEmbedding(float) = %s, %v", floats, err)
+	}
+
+	encoded, err := encodeEmbedding(values, "base64")
+	if err != nil {
+		t.Fatalf("encodeEmbedding(base64): %v", err)
+	}
+	var text string
+	if err := json.Unmarshal(encoded, &text); err != nil {
+		t.Fatalf("base64 embedding is not a JSON string: %s", encoded)
+	}
+	raw, err := base64.StdEncoding.DecodeString(text)
+	if err != nil || len(raw) != 8 {
+		t.Fatalf("decoded %d bytes, err %v", len(raw), err)
+	}
+	for i, want := range values {
+		if got := math.Float32frombits(binary.LittleEndian.Uint32(raw[4*i:])); float64(got) != want {
+			t.Fatalf("value %d = %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestGeminiBatchEmbedContents(t *testing.T) {
+	dims := 2
+	req := &EmbeddingRequest{Model: "text-embedding-004", Input: NewEmbeddingInput("a", "b"), Dimensions: &dims}
+
+	out, err := NewGeminiBatchEmbedContentsRequest(req)
+	if err != nil {
+		t.Fatalf("NewGeminiBatchEmbedContentsRequest: %v", err)
+	}
+	if len(out.Requests) != 2 || out.Requests[1].Model != "models/text-embedding-004" || out.Requests[1].Content.Text() != "b" {
+		t.Fatalf("requests = %+v", out.Requests)
+	}
+	if out.Requests[0].OutputDimensionality == nil || *out.Requests[0].OutputDimensionality != 2 {
+		t.Fatalf("OutputDimensionality = %v", out.Requests[0].OutputDimensionality)
+	}
+
+	resp, err := (&GeminiBatchEmbedContentsResponse{Embeddings: []GeminiContentEmbedding{
+		{Values: []float64{0.1, 0.2}},
+		{Values: []float64{0.3, 0.4}},
+	}}).ToEmbeddingResponse(req)
+	if err != nil {
+		t.Fatalf("ToEmbeddingResponse: %v", err)
+	}
+	if resp.Object != "list" || resp.Model != "text-embedding-004" || len(resp.Data) != 2 || resp.Data[1].Index != 1 {
+		t.Fatalf("response = %+v", resp)
+	}
+	// Gemini 不返回用量,按输入估算
+	if resp.Usage.PromptTokens != req.Input.EstimateTokens() || resp.Usage.TotalTokens != resp.Usage.PromptTokens {
+		t.Fatalf("Usage = %+v", resp.Usage)
+	}
+}
+
+func TestGeminiBatchEmbedContentsRejectsTokens(t *testing.T) {
+	var req EmbeddingRequest
+	if err := json.Unmarshal([]byte(`{"model":"m","input":[1,2,3]}`), &req); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if _, err := NewGeminiBatchEmbedContentsRequest(&req); !errors.Is(err, ErrUnsupportedOperation) {
+		t.Fatalf("NewGeminiBatchEmbedContentsRequest() error = %v, want ErrUnsupportedOperation", err)
+	}
+}
+
+func TestOpenAIAdapterEmbeddings(t *testing.T) {
+	server := newOpenAIServer(t, "/v1/embeddings", func(w http.ResponseWriter, body map[string]interface{}) {
+		if body["model"] != "text-embedding-3-small" || body["dimensions"] != float64(2) {
+			t.Errorf("body = %v", body)
+		}
+		io.WriteString(w, `{"object":"list","data":[{"object":"embedding","index":0,"embedding":[0.1,0.2]}],"model":"text-embedding-3-small","usage":{"prompt_tokens":3,"total_tokens":3}}`)
+	})
+
+	dims := 2
+	resp, err := NewOpenAIAdapter(server.URL, "test-key").Embeddings(context.Background(), &EmbeddingRequest{
+		Model:      "text-embedding-3-small",
+		Input:      NewEmbeddingInput("hello"),
+		Dimensions: &dims,
+	})
+	if err != nil {
+		t.Fatalf("Embeddings: %v", err)
+	}
+	if len(resp.Data) != 1 || string(resp.Data[0].Embedding) != `[0.1,0.2]` || resp.Usage.TotalTokens != 3 {
+		t.Fatalf("Embeddings() = %+v", resp)
+	}
+}
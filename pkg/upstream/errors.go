@@ -0,0 +1,54 @@
+package upstream
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnsupportedOperation 供应商不支持该操作
+var ErrUnsupportedOperation = errors.New("operation not supported by provider")
+
+// APIError 上游返回的非成功响应
+type APIError struct {
+	StatusCode int
+	Message    string
+	Type       string
+	Code       string
+}
+
+// Error 实现 error 接口
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("http %d", e.StatusCode)
+	}
+	return fmt.Sprintf("api error (http %d): %s", e.StatusCode, e.Message)
+}
+
+// newAPIError 根据上游响应构建错误,兼容 OpenAI 与 Gemini 错误格式,无法解析时保留原始响应体
+func newAPIError(statusCode int, body []byte) *APIError {
+	apiErr := &APIError{StatusCode: statusCode}
+
+	// OpenAI 的 code 为字符串,Gemini 的 code 为数字并以 status 表示错误类型
+	var errResp struct {
+		Error struct {
+			Message string          `json:"message"`
+			Type    string          `json:"type"`
+			Status  string          `json:"status"`
+			Code    json.RawMessage `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error.Message != "" {
+		apiErr.Message = errResp.Error.Message
+		apiErr.Type = errResp.Error.Type
+		if apiErr.Type == "" {
+			apiErr.Type = errResp.Error.Status
+		}
+		apiErr.Code = strings.Trim(string(errResp.Error.Code), `"`)
+		return apiErr
+	}
+
+	apiErr.Message = string(body)
+	return apiErr
+}
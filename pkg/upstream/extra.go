@@ -0,0 +1,86 @@
+package upstream
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// knownFieldsCache 各结构体已声明的 JSON 字段名缓存
+var knownFieldsCache sync.Map // map[reflect.Type]map[string]struct{}
+
+// knownFields 返回结构体声明的 JSON 字段名集合
+func knownFields(t reflect.Type) map[string]struct{} {
+	if cached, ok := knownFieldsCache.Load(t); ok {
+		return cached.(map[string]struct{})
+	}
+
+	fields := make(map[string]struct{}, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = struct{}{}
+	}
+
+	knownFieldsCache.Store(t, fields)
+	return fields
+}
+
+// extractExtra 提取 JSON 对象中结构体未声明的字段,原样保留其原始 JSON
+// v 为目标结构体(或其指针),data 不是 JSON 对象时返回 nil
+func extractExtra(data []byte, v interface{}) (map[string]json.RawMessage, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return nil, nil
+	}
+
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+
+	t := reflect.TypeOf(v)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	known := knownFields(t)
+
+	var extra map[string]json.RawMessage
+	for key, value := range all {
+		if _, ok := known[key]; ok {
+			continue
+		}
+		if extra == nil {
+			extra = make(map[string]json.RawMessage)
+		}
+		extra[key] = value
+	}
+	return extra, nil
+}
+
+// marshalWithExtra 序列化结构体并合并未声明字段,已声明字段优先
+func marshalWithExtra(v interface{}, extra map[string]json.RawMessage) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || len(extra) == 0 {
+		return data, err
+	}
+
+	var merged map[string]json.RawMessage
+	if err := json.Unmarshal(data, &merged); err != nil {
+		return nil, err
+	}
+	for key, value := range extra {
+		if _, ok := merged[key]; !ok {
+			merged[key] = value
+		}
+	}
+	return json.Marshal(merged)
+}
@@ -0,0 +1,505 @@
+package upstream
+
+import (
+	"fmt"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// GeminiGenerateContentRequest Gemini generateContent 请求
+type GeminiGenerateContentRequest struct {
+	Contents          []GeminiContent         `json:"contents"`
+	SystemInstruction *GeminiContent          `json:"systemInstruction,omitempty"`
+	GenerationConfig  *GeminiGenerationConfig `json:"generationConfig,omitempty"`
+	Tools             []GeminiTool            `json:"tools,omitempty"`
+	ToolConfig        *GeminiToolConfig       `json:"toolConfig,omitempty"`
+}
+
+// GeminiContent Gemini 消息内容
+type GeminiContent struct {
+	Role  string       `json:"role,omitempty"` // user, model
+	Parts []GeminiPart `json:"parts"`
+}
+
+// GeminiPart Gemini 内容片段
+type GeminiPart struct {
+	Text       string          `json:"text,omitempty"`
+	InlineData *GeminiBlob     `json:"inlineData,omitempty"`
+	FileData   *GeminiFileData `json:"fileData,omitempty"`
+
+	FunctionCall     *GeminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *GeminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+// GeminiFileData Gemini 文件引用
+type GeminiFileData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileURI  string `json:"fileUri"`
+}
+
+// GeminiBlob Gemini 内联二进制数据(base64)
+type GeminiBlob struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+// GeminiGenerationConfig Gemini 生成参数
+type GeminiGenerationConfig struct {
+	Temperature        *float64 `json:"temperature,omitempty"`
+	TopP               *float64 `json:"topP,omitempty"`
+	MaxOutputTokens    *int     `json:"maxOutputTokens,omitempty"`
+	StopSequences      []string `json:"stopSequences,omitempty"`
+	ResponseModalities []string `json:"responseModalities,omitempty"`
+}
+
+// GeminiGenerateContentResponse Gemini generateContent 响应,流式响应的每个数据块也使用该结构
+type GeminiGenerateContentResponse struct {
+	Candidates    []GeminiCandidate    `json:"candidates"`
+	UsageMetadata *GeminiUsageMetadata `json:"usageMetadata,omitempty"`
+	ModelVersion  string               `json:"modelVersion,omitempty"`
+	ResponseID    string               `json:"responseId,omitempty"`
+}
+
+// GeminiCandidate Gemini 候选结果
+type GeminiCandidate struct {
+	Content      GeminiContent `json:"content"`
+	FinishReason string        `json:"finishReason,omitempty"`
+	Index        int           `json:"index"`
+}
+
+// GeminiUsageMetadata Gemini Token 使用量
+type GeminiUsageMetadata struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+	TotalTokenCount      int `json:"totalTokenCount"`
+}
+
+// GeminiErrorResponse Gemini 错误响应
+type GeminiErrorResponse struct {
+	Error GeminiErrorDetail `json:"error"`
+}
+
+// GeminiErrorDetail Gemini 错误详情
+type GeminiErrorDetail struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Status  string `json:"status"`
+}
+
+// Text 拼接所有文本片段
+func (c GeminiContent) Text() string {
+	var sb strings.Builder
+	for _, part := range c.Parts {
+		sb.WriteString(part.Text)
+	}
+	return sb.String()
+}
+
+// ToMessageContent 转换为内部消息内容
+// 仅含文本时转换为纯文本,否则转换为内容片段数组:
+// 图片转换为 image_url,音频转换为 input_audio,其他内联文件转换为 file
+func (c GeminiContent) ToMessageContent() MessageContent {
+	multimodal := false
+	for _, part := range c.Parts {
+		if part.InlineData != nil || part.FileData != nil {
+			multimodal = true
+			break
+		}
+	}
+	if !multimodal {
+		return NewTextContent(c.Text())
+	}
+
+	parts := make([]ContentPart, 0, len(c.Parts))
+	for _, part := range c.Parts {
+		switch {
+		case part.InlineData != nil:
+			blob := part.InlineData
+			switch {
+			case strings.HasPrefix(blob.MimeType, "image/"):
+				parts = append(parts, ContentPart{Type: ContentPartImageURL, ImageURL: &ImageURL{
+					URL: DataURI(blob.MimeType, blob.Data),
+				}})
+			case strings.HasPrefix(blob.MimeType, "audio/"):
+				parts = append(parts, ContentPart{Type: ContentPartInputAudio, InputAudio: &InputAudio{
+					Data:   blob.Data,
+					Format: strings.TrimPrefix(blob.MimeType, "audio/"),
+				}})
+			default:
+				parts = append(parts, ContentPart{Type: ContentPartFile, File: &FilePart{
+					FileData: DataURI(blob.MimeType, blob.Data),
+				}})
+			}
+		case part.FileData != nil:
+			// 仅图片文件引用可以用 URL 表达
+			if strings.HasPrefix(part.FileData.MimeType, "image/") {
+				parts = append(parts, ContentPart{Type: ContentPartImageURL, ImageURL: &ImageURL{URL: part.FileData.FileURI}})
+			}
+		case part.FunctionCall != nil, part.FunctionResponse != nil:
+			// 函数调用与结果由 toMessages 单独转换
+		default:
+			parts = append(parts, ContentPart{Type: ContentPartText, Text: part.Text})
+		}
+	}
+	return NewPartsContent(parts)
+}
+
+// newGeminiParts 将内部消息内容转换为 Gemini 内容片段
+// data URI 转换为 inlineData,http(s) 图片地址转换为 fileData
+func newGeminiParts(content MessageContent) []GeminiPart {
+	if !content.IsMultipart() {
+		return []GeminiPart{{Text: content.Text()}}
+	}
+
+	parts := make([]GeminiPart, 0, len(content.Parts()))
+	for _, part := range content.Parts() {
+		switch part.Type {
+		case ContentPartText:
+			if part.Text != "" {
+				parts = append(parts, GeminiPart{Text: part.Text})
+			}
+		case ContentPartImageURL:
+			if part.ImageURL == nil {
+				continue
+			}
+			if mimeType, data, ok := ParseDataURI(part.ImageURL.URL); ok {
+				parts = append(parts, GeminiPart{InlineData: &GeminiBlob{MimeType: mimeType, Data: data}})
+				continue
+			}
+			parts = append(parts, GeminiPart{FileData: &GeminiFileData{
+				MimeType: guessImageMimeType(part.ImageURL.URL),
+				FileURI:  part.ImageURL.URL,
+			}})
+		case ContentPartInputAudio:
+			if part.InputAudio == nil {
+				continue
+			}
+			parts = append(parts, GeminiPart{InlineData: &GeminiBlob{
+				MimeType: "audio/" + part.InputAudio.Format,
+				Data:     part.InputAudio.Data,
+			}})
+		case ContentPartFile:
+			if part.File == nil {
+				continue
+			}
+			if mimeType, data, ok := ParseDataURI(part.File.FileData); ok {
+				parts = append(parts, GeminiPart{InlineData: &GeminiBlob{MimeType: mimeType, Data: data}})
+			}
+		}
+	}
+	return parts
+}
+
+// guessImageMimeType 根据图片地址的扩展名推断 MIME 类型,无法推断时按 JPEG 处理
+func guessImageMimeType(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		if mimeType := mime.TypeByExtension(path.Ext(u.Path)); strings.HasPrefix(mimeType, "image/") {
+			return mimeType
+		}
+	}
+	return "image/jpeg"
+}
+
+// ToChatCompletionRequest 转换为内部文本对话请求
+// systemInstruction 转换为首条 system 消息,model 角色转换为 assistant,
+// functionDeclarations 与 toolConfig 转换为 OpenAI 工具定义与工具选择策略
+func (r *GeminiGenerateContentRequest) ToChatCompletionRequest(model string) *ChatCompletionRequest {
+	messages := make([]Message, 0, len(r.Contents)+1)
+	if r.SystemInstruction != nil {
+		messages = append(messages, Message{Role: "system", Content: NewTextContent(r.SystemInstruction.Text())})
+	}
+	pending := make(map[string][]string) // 函数名 -> 尚未返回结果的调用 ID
+	for _, content := range r.Contents {
+		role := "user"
+		if content.Role == "model" {
+			role = "assistant"
+		}
+		messages = append(messages, content.toMessages(role, pending)...)
+	}
+
+	req := &ChatCompletionRequest{
+		Model:      model,
+		Messages:   messages,
+		Tools:      geminiToolsToTools(r.Tools),
+		ToolChoice: r.ToolConfig.toToolChoice(),
+	}
+	if cfg := r.GenerationConfig; cfg != nil {
+		req.MaxTokens = cfg.MaxOutputTokens
+		req.Temperature = cfg.Temperature
+		req.TopP = cfg.TopP
+		req.Stop = cfg.StopSequences
+	}
+	return req
+}
+
+// NewGeminiGenerateContentRequest 将内部文本对话请求转换为 Gemini 格式
+// system 消息合并为 systemInstruction,assistant 角色转换为 model,
+// tool_calls 转换为 functionCall,连续的 tool 消息合并为一轮 functionResponse
+func NewGeminiGenerateContentRequest(req *ChatCompletionRequest) *GeminiGenerateContentRequest {
+	out := &GeminiGenerateContentRequest{
+		Contents:   make([]GeminiContent, 0, len(req.Messages)),
+		Tools:      newGeminiTools(req.Tools),
+		ToolConfig: newGeminiToolConfig(req.ToolChoice),
+	}
+
+	var system []GeminiPart
+	names := make(map[string]string) // tool_call_id -> 函数名
+	for _, msg := range req.Messages {
+		switch msg.Role {
+		case "system":
+			system = append(system, GeminiPart{Text: msg.Content.Text()})
+		case "assistant":
+			for _, call := range msg.ToolCalls {
+				names[call.ID] = call.Function.Name
+			}
+			out.Contents = append(out.Contents, GeminiContent{Role: "model", Parts: newGeminiModelParts(msg)})
+		case "tool":
+			part := GeminiPart{FunctionResponse: &GeminiFunctionResponse{
+				Name:     names[msg.ToolCallID],
+				Response: geminiFunctionResult(msg.Content.Text()),
+			}}
+			if n := len(out.Contents); n > 0 && isFunctionResponseTurn(out.Contents[n-1]) {
+				out.Contents[n-1].Parts = append(out.Contents[n-1].Parts, part)
+				continue
+			}
+			out.Contents = append(out.Contents, GeminiContent{Role: "user", Parts: []GeminiPart{part}})
+		default:
+			out.Contents = append(out.Contents, GeminiContent{Role: "user", Parts: newGeminiParts(msg.Content)})
+		}
+	}
+	if len(system) > 0 {
+		out.SystemInstruction = &GeminiContent{Parts: system}
+	}
+
+	if req.MaxTokens != nil || req.Temperature != nil || req.TopP != nil || len(req.Stop) > 0 {
+		out.GenerationConfig = &GeminiGenerationConfig{
+			Temperature:     req.Temperature,
+			TopP:            req.TopP,
+			MaxOutputTokens: req.MaxTokens,
+			StopSequences:   req.Stop,
+		}
+	}
+	return out
+}
+
+// ToChatCompletionResponse 将 Gemini 响应转换为内部文本对话响应
+func (r *GeminiGenerateContentResponse) ToChatCompletionResponse(id, model string) *ChatCompletionResponse {
+	resp := &ChatCompletionResponse{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   model,
+		Choices: make([]Choice, 0, len(r.Candidates)),
+	}
+	for _, candidate := range r.Candidates {
+		choice := Choice{
+			Index:        candidate.Index,
+			Message:      Message{Role: "assistant", Content: NewTextContent(candidate.Content.Text())},
+			FinishReason: OpenAIFinishReason(candidate.FinishReason),
+		}
+		if calls := candidate.Content.geminiToolCalls(); len(calls) > 0 {
+			choice.Message.ToolCalls = calls
+			if candidate.Content.Text() == "" {
+				choice.Message.Content = NullContent()
+			}
+			if choice.FinishReason == "stop" {
+				choice.FinishReason = "tool_calls"
+			}
+		}
+		resp.Choices = append(resp.Choices, choice)
+	}
+	if r.UsageMetadata != nil {
+		resp.Usage = r.UsageMetadata.ToUsage()
+	}
+	return resp
+}
+
+// ToChatCompletionChunk 将 Gemini 流式数据块转换为内部数据块
+// Gemini 每个数据块的 usageMetadata 均为累计值,仅在结束块中携带;
+// 函数调用整体出现在单个数据块中,其 Index 为块内序号,由调用方按整个流重新编号
+func (r *GeminiGenerateContentResponse) ToChatCompletionChunk(id, model string) *ChatCompletionChunk {
+	chunk := &ChatCompletionChunk{
+		ID:      id,
+		Object:  "chat.completion.chunk",
+		Created: time.Now().Unix(),
+		Model:   model,
+		Choices: make([]ChunkChoice, 0, len(r.Candidates)),
+	}
+	finished := false
+	for _, candidate := range r.Candidates {
+		choice := ChunkChoice{
+			Index: candidate.Index,
+			Delta: Message{Role: "assistant", Content: NewTextContent(candidate.Content.Text())},
+		}
+		for i, call := range candidate.Content.geminiToolCalls() {
+			index := i
+			call.Index = &index
+			choice.Delta.ToolCalls = append(choice.Delta.ToolCalls, call)
+		}
+		if candidate.FinishReason != "" {
+			choice.FinishReason = OpenAIFinishReason(candidate.FinishReason)
+			finished = true
+		}
+		chunk.Choices = append(chunk.Choices, choice)
+	}
+	if finished && r.UsageMetadata != nil {
+		usage := r.UsageMetadata.ToUsage()
+		chunk.Usage = &usage
+	}
+	return chunk
+}
+
+// ToUsage 转换为内部 Token 使用量
+func (u *GeminiUsageMetadata) ToUsage() Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokenCount,
+		CompletionTokens: u.CandidatesTokenCount,
+		TotalTokens:      u.TotalTokenCount,
+	}
+}
+
+// NewGeminiGenerateContentResponse 将内部文本对话响应转换为 Gemini 格式
+func NewGeminiGenerateContentResponse(resp *ChatCompletionResponse, model string) *GeminiGenerateContentResponse {
+	out := &GeminiGenerateContentResponse{
+		Candidates:   make([]GeminiCandidate, 0, len(resp.Choices)),
+		ModelVersion: model,
+		ResponseID:   resp.ID,
+		UsageMetadata: &GeminiUsageMetadata{
+			PromptTokenCount:     resp.Usage.PromptTokens,
+			CandidatesTokenCount: resp.Usage.CompletionTokens,
+			TotalTokenCount:      resp.Usage.TotalTokens,
+		},
+	}
+	for _, choice := range resp.Choices {
+		var parts []GeminiPart
+		if text := choice.Message.Content.Text(); text != "" || len(choice.Message.ToolCalls) == 0 {
+			parts = append(parts, GeminiPart{Text: text})
+		}
+		parts = append(parts, NewGeminiFunctionCallParts(choice.Message.ToolCalls)...)
+		out.Candidates = append(out.Candidates, GeminiCandidate{
+			Index:        choice.Index,
+			Content:      GeminiContent{Role: "model", Parts: parts},
+			FinishReason: GeminiFinishReason(choice.FinishReason),
+		})
+	}
+	return out
+}
+
+// OpenAIFinishReason 将 Gemini finishReason 映射为 OpenAI finish_reason
+func OpenAIFinishReason(finishReason string) string {
+	switch finishReason {
+	case "":
+		return ""
+	case "STOP":
+		return "stop"
+	case "MAX_TOKENS":
+		return "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII", "IMAGE_SAFETY":
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
+
+// GeminiFinishReason 将 OpenAI finish_reason 映射为 Gemini finishReason
+func GeminiFinishReason(finishReason string) string {
+	switch finishReason {
+	case "":
+		return ""
+	case "length":
+		return "MAX_TOKENS"
+	case "content_filter":
+		return "SAFETY"
+	default:
+		return "STOP"
+	}
+}
+
+// NewGeminiStreamChunk 将内部流式数据块转换为 Gemini 格式,不含文本和结束标记的数据块返回 nil
+func NewGeminiStreamChunk(chunk *ChatCompletionChunk, model string) *GeminiGenerateContentResponse {
+	out := &GeminiGenerateContentResponse{
+		ModelVersion: model,
+		ResponseID:   chunk.ID,
+	}
+	for _, choice := range chunk.Choices {
+		text := choice.Delta.Content.Text()
+		if text == "" && choice.FinishReason == "" {
+			continue
+		}
+		out.Candidates = append(out.Candidates, GeminiCandidate{
+			Index:        choice.Index,
+			Content:      GeminiContent{Role: "model", Parts: []GeminiPart{{Text: text}}},
+			FinishReason: GeminiFinishReason(choice.FinishReason),
+		})
+	}
+	if len(out.Candidates) == 0 {
+		return nil
+	}
+	return out
+}
+
+// GeminiBatchEmbedContentsRequest Gemini batchEmbedContents 请求
+type GeminiBatchEmbedContentsRequest struct {
+	Requests []GeminiEmbedContentRequest `json:"requests"`
+}
+
+// GeminiEmbedContentRequest Gemini 单条向量化请求
+type GeminiEmbedContentRequest struct {
+	Model                string        `json:"model"` // models/{model}
+	Content              GeminiContent `json:"content"`
+	OutputDimensionality *int          `json:"outputDimensionality,omitempty"`
+}
+
+// GeminiBatchEmbedContentsResponse Gemini batchEmbedContents 响应
+type GeminiBatchEmbedContentsResponse struct {
+	Embeddings []GeminiContentEmbedding `json:"embeddings"`
+}
+
+// GeminiContentEmbedding Gemini 向量
+type GeminiContentEmbedding struct {
+	Values []float64 `json:"values"`
+}
+
+// NewGeminiBatchEmbedContentsRequest 将向量化请求转换为 Gemini 格式,每条文本输入对应一个子请求
+// Gemini 不支持 Token 数组输入
+func NewGeminiBatchEmbedContentsRequest(req *EmbeddingRequest) (*GeminiBatchEmbedContentsRequest, error) {
+	if req.Input.IsTokens() {
+		return nil, fmt.Errorf("%w: token array input", ErrUnsupportedOperation)
+	}
+
+	out := &GeminiBatchEmbedContentsRequest{
+		Requests: make([]GeminiEmbedContentRequest, 0, len(req.Input.Texts())),
+	}
+	for _, text := range req.Input.Texts() {
+		out.Requests = append(out.Requests, GeminiEmbedContentRequest{
+			Model:                "models/" + req.Model,
+			Content:              GeminiContent{Parts: []GeminiPart{{Text: text}}},
+			OutputDimensionality: req.Dimensions,
+		})
+	}
+	return out, nil
+}
+
+// ToEmbeddingResponse 转换为 OpenAI 格式的向量化响应
+// Gemini 不返回 Token 用量,按输入估算
+func (r *GeminiBatchEmbedContentsResponse) ToEmbeddingResponse(req *EmbeddingRequest) (*EmbeddingResponse, error) {
+	resp := &EmbeddingResponse{
+		Object: "list",
+		Data:   make([]EmbeddingData, 0, len(r.Embeddings)),
+		Model:  req.Model,
+	}
+	for i, embedding := range r.Embeddings {
+		encoded, err := encodeEmbedding(embedding.Values, req.EncodingFormat)
+		if err != nil {
+			return nil, err
+		}
+		resp.Data = append(resp.Data, EmbeddingData{Object: "embedding", Index: i, Embedding: encoded})
+	}
+
+	tokens := req.Input.EstimateTokens()
+	resp.Usage = EmbeddingUsage{PromptTokens: tokens, TotalTokens: tokens}
+	return resp, nil
+}
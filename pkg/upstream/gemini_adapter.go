@@ -0,0 +1,349 @@
+package upstream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/869413421/transit/pkg/logger"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// ProviderGemini Google Gemini 原生接口(generativelanguage.googleapis.com)
+const ProviderGemini = "gemini"
+
+var _ Provider = (*GeminiAdapter)(nil)
+
+func init() {
+	RegisterProvider(ProviderGemini, func(baseURL, apiKey string) Provider {
+		return NewGeminiAdapter(baseURL, apiKey)
+	})
+}
+
+// GeminiAdapter Gemini 原生接口适配器
+// 文本与图片走 generateContent,视频(Veo)走 predictLongRunning 长任务
+type GeminiAdapter struct {
+	client *Client
+}
+
+// NewGeminiAdapter 创建 Gemini 适配器
+func NewGeminiAdapter(baseURL, apiKey string) *GeminiAdapter {
+	return &GeminiAdapter{
+		client: NewClientWithAuthHeader(baseURL, "x-goog-api-key", apiKey),
+	}
+}
+
+// ChatCompletion 文本对话(同步)
+func (a *GeminiAdapter) ChatCompletion(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	logger.Info("Gemini generate content request",
+		zap.String("model", req.Model),
+		zap.Int("messages", len(req.Messages)),
+	)
+
+	resp, err := a.client.Do(ctx, &Request{
+		Method: http.MethodPost,
+		Path:   fmt.Sprintf("/v1beta/models/%s:generateContent", req.Model),
+		Body:   NewGeminiGenerateContentRequest(req),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp.StatusCode, resp.Body)
+	}
+
+	var geminiResp GeminiGenerateContentResponse
+	if err := json.Unmarshal(resp.Body, &geminiResp); err != nil {
+		return nil, fmt.Errorf("unmarshal response: %w", err)
+	}
+
+	chatResp := geminiResp.ToChatCompletionResponse(geminiChatID(geminiResp.ResponseID), req.Model)
+
+	logger.Info("Gemini generate content success",
+		zap.String("model", req.Model),
+		zap.Int("total_tokens", chatResp.Usage.TotalTokens),
+	)
+
+	return chatResp, nil
+}
+
+// ChatCompletionStream 文本对话(流式)
+// 使用 alt=sse 获取 SSE 格式的流式响应,并将每个数据块转换为 OpenAI 格式
+func (a *GeminiAdapter) ChatCompletionStream(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionStream, error) {
+	logger.Info("Gemini stream generate content request",
+		zap.String("model", req.Model),
+		zap.Int("messages", len(req.Messages)),
+	)
+
+	resp, err := a.client.DoStream(ctx, &Request{
+		Method:  http.MethodPost,
+		Path:    fmt.Sprintf("/v1beta/models/%s:streamGenerateContent?alt=sse", req.Model),
+		Headers: map[string]string{"Accept": "text/event-stream"},
+		Body:    NewGeminiGenerateContentRequest(req),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, newAPIError(resp.StatusCode, body)
+	}
+
+	// 同一个流的所有数据块使用相同的 ID,工具调用在整个流内连续编号
+	id := geminiChatID("")
+	toolCalls := 0
+	return NewChatCompletionStreamWithDecoder(resp.Body, func(data []byte) (*ChatCompletionChunk, []byte, error) {
+		var geminiChunk GeminiGenerateContentResponse
+		if err := json.Unmarshal(data, &geminiChunk); err != nil {
+			return nil, nil, fmt.Errorf("unmarshal chunk: %w", err)
+		}
+
+		chunk := geminiChunk.ToChatCompletionChunk(id, req.Model)
+		for i := range chunk.Choices {
+			choice := &chunk.Choices[i]
+			for j := range choice.Delta.ToolCalls {
+				index := toolCalls
+				choice.Delta.ToolCalls[j].Index = &index
+				toolCalls++
+			}
+			if choice.FinishReason == "stop" && toolCalls > 0 {
+				choice.FinishReason = "tool_calls"
+			}
+		}
+		raw, err := json.Marshal(chunk)
+		if err != nil {
+			return nil, nil, fmt.Errorf("marshal chunk: %w", err)
+		}
+		return chunk, raw, nil
+	}), nil
+}
+
+// Embeddings 文本向量化
+// 通过 batchEmbedContents 一次提交全部输入
+func (a *GeminiAdapter) Embeddings(ctx context.Context, req *EmbeddingRequest) (*EmbeddingResponse, error) {
+	logger.Info("Gemini embeddings request",
+		zap.String("model", req.Model),
+		zap.Int("inputs", req.Input.Len()),
+	)
+
+	body, err := NewGeminiBatchEmbedContentsRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := a.client.Do(ctx, &Request{
+		Method: http.MethodPost,
+		Path:   fmt.Sprintf("/v1beta/models/%s:batchEmbedContents", req.Model),
+		Body:   body,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp.StatusCode, resp.Body)
+	}
+
+	var geminiResp GeminiBatchEmbedContentsResponse
+	if err := json.Unmarshal(resp.Body, &geminiResp); err != nil {
+		return nil, fmt.Errorf("unmarshal response: %w", err)
+	}
+
+	embeddingResp, err := geminiResp.ToEmbeddingResponse(req)
+	if err != nil {
+		return nil, fmt.Errorf("encode embeddings: %w", err)
+	}
+
+	logger.Info("Gemini embeddings success",
+		zap.String("model", req.Model),
+		zap.Int("embeddings", len(embeddingResp.Data)),
+	)
+
+	return embeddingResp, nil
+}
+
+// ImageGeneration 图片生成(同步)
+// 通过 generateContent 指定 IMAGE 输出模态,图片以 inlineData 返回
+func (a *GeminiAdapter) ImageGeneration(ctx context.Context, req *ImageGenerationRequest) (*ImageGenerationResponse, error) {
+	logger.Info("Gemini image generation request",
+		zap.String("model", req.Model),
+		zap.String("prompt", req.Prompt[:min(50, len(req.Prompt))]),
+	)
+
+	resp, err := a.client.Do(ctx, &Request{
+		Method: http.MethodPost,
+		Path:   fmt.Sprintf("/v1beta/models/%s:generateContent", req.Model),
+		Body: &GeminiGenerateContentRequest{
+			Contents: []GeminiContent{{Role: "user", Parts: []GeminiPart{{Text: req.Prompt}}}},
+			GenerationConfig: &GeminiGenerationConfig{
+				ResponseModalities: []string{"IMAGE"},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp.StatusCode, resp.Body)
+	}
+
+	var geminiResp GeminiGenerateContentResponse
+	if err := json.Unmarshal(resp.Body, &geminiResp); err != nil {
+		return nil, fmt.Errorf("unmarshal response: %w", err)
+	}
+
+	var images []ImageData
+	for _, candidate := range geminiResp.Candidates {
+		for _, part := range candidate.Content.Parts {
+			if part.InlineData != nil {
+				images = append(images, ImageData{
+					B64JSON:  part.InlineData.Data,
+					MimeType: part.InlineData.MimeType,
+				})
+			}
+		}
+	}
+	if len(images) == 0 {
+		return nil, fmt.Errorf("empty image response")
+	}
+
+	logger.Info("Gemini image generation completed",
+		zap.String("model", req.Model),
+		zap.Int("images", len(images)),
+	)
+
+	return &ImageGenerationResponse{
+		Status: "completed",
+		Images: images,
+	}, nil
+}
+
+// VideoGeneration 视频生成(异步)
+// Veo 通过 predictLongRunning 提交,返回的 operation 名称作为上游任务 ID
+func (a *GeminiAdapter) VideoGeneration(ctx context.Context, req *VideoGenerationRequest) (*VideoGenerationResponse, error) {
+	logger.Info("Gemini video generation request",
+		zap.String("model", req.Model),
+		zap.String("prompt", req.Prompt[:min(50, len(req.Prompt))]),
+	)
+
+	body := map[string]interface{}{
+		"instances": []map[string]interface{}{{"prompt": req.Prompt}},
+	}
+	if req.Duration > 0 {
+		body["parameters"] = map[string]interface{}{"durationSeconds": req.Duration}
+	}
+
+	resp, err := a.client.Do(ctx, &Request{
+		Method: http.MethodPost,
+		Path:   fmt.Sprintf("/v1beta/models/%s:predictLongRunning", req.Model),
+		Body:   body,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp.StatusCode, resp.Body)
+	}
+
+	var operation struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(resp.Body, &operation); err != nil {
+		return nil, fmt.Errorf("unmarshal response: %w", err)
+	}
+
+	logger.Info("Gemini video generation submitted",
+		zap.String("operation", operation.Name),
+	)
+
+	return &VideoGenerationResponse{
+		TaskID: operation.Name,
+		Status: "submitted",
+	}, nil
+}
+
+// GetTaskStatus 查询长任务状态
+// 返回格式: {name, done, response: {generateVideoResponse: {generatedSamples: [{video: {uri}}]}}, error: {code, message}}
+func (a *GeminiAdapter) GetTaskStatus(ctx context.Context, taskID string) (*TaskStatusResponse, error) {
+	logger.Debug("Gemini get operation", zap.String("operation", taskID))
+
+	resp, err := a.client.Do(ctx, &Request{
+		Method: http.MethodGet,
+		Path:   "/v1beta/" + strings.TrimPrefix(taskID, "/"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp.StatusCode, resp.Body)
+	}
+
+	var operation struct {
+		Name     string `json:"name"`
+		Done     bool   `json:"done"`
+		Response struct {
+			GenerateVideoResponse struct {
+				GeneratedSamples []struct {
+					Video struct {
+						URI string `json:"uri"`
+					} `json:"video"`
+				} `json:"generatedSamples"`
+			} `json:"generateVideoResponse"`
+		} `json:"response"`
+		Error *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(resp.Body, &operation); err != nil {
+		return nil, fmt.Errorf("unmarshal response: %w", err)
+	}
+
+	status := &TaskStatusResponse{TaskID: taskID, Status: "processing"}
+	switch {
+	case !operation.Done:
+	case operation.Error != nil:
+		status.Status = "failed"
+		status.Error = TaskError{
+			Code:    fmt.Sprintf("%d", operation.Error.Code),
+			Message: operation.Error.Message,
+		}
+	default:
+		for _, sample := range operation.Response.GenerateVideoResponse.GeneratedSamples {
+			status.Result.Videos = append(status.Result.Videos, sample.Video.URI)
+		}
+		// 内容被安全策略过滤时任务完成但没有结果
+		if len(status.Result.Videos) == 0 {
+			status.Status = "failed"
+			status.Error = TaskError{Message: "no video generated"}
+			break
+		}
+		status.Status = "completed"
+		status.Progress = 100
+	}
+
+	logger.Debug("Gemini operation status",
+		zap.String("operation", taskID),
+		zap.String("status", status.Status),
+	)
+
+	return status, nil
+}
+
+// geminiChatID 生成 OpenAI 风格的对话 ID
+func geminiChatID(responseID string) string {
+	if responseID == "" {
+		responseID = strings.ReplaceAll(uuid.New().String(), "-", "")
+	}
+	return "chatcmpl-" + responseID
+}
@@ -0,0 +1,144 @@
+package upstream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newGeminiStreamServer 创建以 SSE 返回固定内容的 Gemini 测试服务,并记录收到的请求
+func newGeminiStreamServer(t *testing.T, body string, got *GeminiGenerateContentRequest) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1beta/models/gemini-2.0-flash:streamGenerateContent" || r.URL.Query().Get("alt") != "sse" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		if r.Header.Get("x-goog-api-key") != "test-key" {
+			t.Errorf("x-goog-api-key = %q", r.Header.Get("x-goog-api-key"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(got); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGeminiAdapterChatCompletionStream(t *testing.T) {
+	var got GeminiGenerateContentRequest
+	server := newGeminiStreamServer(t,
+		"data: {\"candidates\":[{\"content\":{\"role\":\"model\",\"parts\":[{\"text\":\"Hel\"}]}}],\"usageMetadata\":{\"promptTokenCount\":3,\"candidatesTokenCount\":1,\"totalTokenCount\":4}}\r\n\r\n"+
+			"data: {\"candidates\":[{\"content\":{\"role\":\"model\",\"parts\":[{\"text\":\"lo\"}]},\"finishReason\":\"STOP\"}],\"usageMetadata\":{\"promptTokenCount\":3,\"candidatesTokenCount\":2,\"totalTokenCount\":5}}\r\n\r\n",
+		&got,
+	)
+
+	stream, err := NewGeminiAdapter(server.URL, "test-key").ChatCompletionStream(context.Background(), &ChatCompletionRequest{
+		Model:    "gemini-2.0-flash",
+		Messages: []Message{{Role: "user", Content: NewTextContent("hi")}},
+		Stream:   true,
+	})
+	if err != nil {
+		t.Fatalf("ChatCompletionStream: %v", err)
+	}
+	defer stream.Close()
+
+	chunks, raws, err := recvAll(t, stream)
+	if !errors.Is(err, io.EOF) {
+		t.Fatalf("Recv() error = %v, want io.EOF", err)
+	}
+	if len(got.Contents) != 1 || got.Contents[0].Text() != "hi" {
+		t.Fatalf("upstream request = %+v", got)
+	}
+	if len(chunks) != 2 {
+		t.Fatalf("got %d chunks, want 2", len(chunks))
+	}
+	if chunks[0].ID == "" || chunks[0].ID != chunks[1].ID {
+		t.Fatalf("chunk IDs = %q, %q; want one shared ID", chunks[0].ID, chunks[1].ID)
+	}
+	if chunks[0].Usage != nil || chunks[1].Usage == nil || chunks[1].Usage.TotalTokens != 5 {
+		t.Fatalf("usage = %+v, %+v; want usage only on the final chunk", chunks[0].Usage, chunks[1].Usage)
+	}
+	if chunks[1].Choices[0].FinishReason != "stop" {
+		t.Fatalf("finish_reason = %q, want stop", chunks[1].Choices[0].FinishReason)
+	}
+
+	// 原始数据块已转换为 OpenAI 格式,可直接透传给客户端
+	var openAI ChatCompletionChunk
+	if err := json.Unmarshal(raws[0], &openAI); err != nil || openAI.Object != "chat.completion.chunk" {
+		t.Fatalf("raw chunk = %s, err = %v", raws[0], err)
+	}
+}
+
+func TestGeminiAdapterChatCompletionStreamToolCalls(t *testing.T) {
+	var got GeminiGenerateContentRequest
+	server := newGeminiStreamServer(t,
+		"data: {\"candidates\":[{\"content\":{\"role\":\"model\",\"parts\":[{\"functionCall\":{\"name\":\"get_weather\",\"args\":{\"city\":\"Paris\"}}}]}}]}\n\n"+
+			"data: {\"candidates\":[{\"content\":{\"role\":\"model\",\"parts\":[{\"functionCall\":{\"name\":\"get_time\",\"args\":{}}}]},\"finishReason\":\"STOP\"}]}\n\n",
+		&got,
+	)
+
+	stream, err := NewGeminiAdapter(server.URL, "test-key").ChatCompletionStream(context.Background(), &ChatCompletionRequest{
+		Model:    "gemini-2.0-flash",
+		Messages: []Message{{Role: "user", Content: NewTextContent("weather and time?")}},
+		Tools: []Tool{
+			{Type: "function", Function: FunctionDefinition{Name: "get_weather", Parameters: json.RawMessage(`{"type":"object"}`)}},
+			{Type: "function", Function: FunctionDefinition{Name: "get_time"}},
+		},
+		ToolChoice: &ToolChoice{Mode: "required"},
+	})
+	if err != nil {
+		t.Fatalf("ChatCompletionStream: %v", err)
+	}
+	defer stream.Close()
+
+	chunks, _, err := recvAll(t, stream)
+	if !errors.Is(err, io.EOF) {
+		t.Fatalf("Recv() error = %v, want io.EOF", err)
+	}
+	if len(got.Tools) != 1 || len(got.Tools[0].FunctionDeclarations) != 2 {
+		t.Fatalf("upstream tools = %+v", got.Tools)
+	}
+	if got.ToolConfig == nil || got.ToolConfig.FunctionCallingConfig.Mode != "ANY" {
+		t.Fatalf("upstream tool config = %+v", got.ToolConfig)
+	}
+
+	// 工具调用在整个流内连续编号,以工具调用结束时 finish_reason 为 tool_calls
+	var acc ToolCallAccumulator
+	for i, chunk := range chunks {
+		calls := chunk.Choices[0].Delta.ToolCalls
+		if len(calls) != 1 || calls[0].Index == nil || *calls[0].Index != i {
+			t.Fatalf("chunk %d tool calls = %+v, want index %d", i, calls, i)
+		}
+		acc.Add(calls)
+	}
+	if reason := chunks[1].Choices[0].FinishReason; reason != "tool_calls" {
+		t.Fatalf("finish_reason = %q, want tool_calls", reason)
+	}
+	calls := acc.Calls()
+	if len(calls) != 2 || calls[0].Function.Name != "get_weather" || calls[0].Function.Arguments != `{"city":"Paris"}` || calls[0].ID == "" {
+		t.Fatalf("accumulated calls = %+v", calls)
+	}
+}
+
+func TestGeminiAdapterChatCompletionStreamError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		io.WriteString(w, `{"error":{"code":429,"message":"quota exceeded","status":"RESOURCE_EXHAUSTED"}}`)
+	}))
+	defer server.Close()
+
+	_, err := NewGeminiAdapter(server.URL, "test-key").ChatCompletionStream(context.Background(), &ChatCompletionRequest{
+		Model:    "gemini-2.0-flash",
+		Messages: []Message{{Role: "user", Content: NewTextContent("hi")}},
+	})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("err = %v, want APIError with status 429", err)
+	}
+}
@@ -0,0 +1,260 @@
+package upstream
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestGeminiToChatCompletionRequest(t *testing.T) {
+	var req GeminiGenerateContentRequest
+	err := json.Unmarshal([]byte(`{
+		"systemInstruction": {"parts": [{"text": "be brief"}]},
+		"contents": [
+			{"role": "user", "parts": [{"text": "describe"}, {"inlineData": {"mimeType": "image/png", "data": "iVBORw0KGgo="}}]},
+			{"role": "model", "parts": [{"text": "a cat"}]},
+			{"parts": [{"text": "thanks"}]}
+		],
+		"generationConfig": {"temperature": 0.2, "maxOutputTokens": 64, "stopSequences": ["END"]}
+	}`), &req)
+	if err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	out := req.ToChatCompletionRequest("gemini-2.0-flash")
+	if out.Model != "gemini-2.0-flash" || out.MaxTokens == nil || *out.MaxTokens != 64 || out.Temperature == nil || *out.Temperature != 0.2 {
+		t.Fatalf("request = %+v", out)
+	}
+	if len(out.Stop) != 1 || out.Stop[0] != "END" {
+		t.Fatalf("Stop = %v", out.Stop)
+	}
+
+	wantRoles := []string{"system", "user", "assistant", "user"}
+	if len(out.Messages) != len(wantRoles) {
+		t.Fatalf("got %d messages, want %d", len(out.Messages), len(wantRoles))
+	}
+	for i, role := range wantRoles {
+		if out.Messages[i].Role != role {
+			t.Fatalf("message %d role = %q, want %q", i, out.Messages[i].Role, role)
+		}
+	}
+
+	parts := out.Messages[1].Content.Parts()
+	if len(parts) != 2 || parts[1].ImageURL == nil || parts[1].ImageURL.URL != "data:image/png;base64,iVBORw0KGgo=" {
+		t.Fatalf("multimodal parts = %+v", parts)
+	}
+	if out.Messages[2].Content.IsMultipart() || out.Messages[2].Content.Text() != "a cat" {
+		t.Fatalf("model message = %+v", out.Messages[2])
+	}
+}
+
+func TestGeminiContentToMessageContent(t *testing.T) {
+	content := GeminiContent{Parts: []GeminiPart{
+		{Text: "listen"},
+		{InlineData: &GeminiBlob{MimeType: "audio/wav", Data: "UklGRg=="}},
+		{InlineData: &GeminiBlob{MimeType: "application/pdf", Data: "JVBERi0="}},
+		{FileData: &GeminiFileData{MimeType: "image/jpeg", FileURI: "https://example.com/a.jpg"}},
+		{FileData: &GeminiFileData{MimeType: "video/mp4", FileURI: "gs://bucket/v.mp4"}},
+	}}
+
+	parts := content.ToMessageContent().Parts()
+	if len(parts) != 4 {
+		t.Fatalf("got %d parts, want 4 (non-image file references are dropped): %+v", len(parts), parts)
+	}
+	if parts[1].InputAudio == nil || parts[1].InputAudio.Format != "wav" || parts[1].InputAudio.Data != "UklGRg==" {
+		t.Fatalf("audio part = %+v", parts[1])
+	}
+	if parts[2].File == nil || parts[2].File.FileData != "data:application/pdf;base64,JVBERi0=" {
+		t.Fatalf("file part = %+v", parts[2])
+	}
+	if parts[3].ImageURL == nil || parts[3].ImageURL.URL != "https://example.com/a.jpg" {
+		t.Fatalf("image reference part = %+v", parts[3])
+	}
+}
+
+func TestNewGeminiGenerateContentRequest(t *testing.T) {
+	maxTokens := 32
+	req := &ChatCompletionRequest{
+		Model:     "gemini-2.0-flash",
+		MaxTokens: &maxTokens,
+		Messages: []Message{
+			{Role: "system", Content: NewTextContent("be brief")},
+			{Role: "system", Content: NewTextContent("be kind")},
+			{Role: "user", Content: NewPartsContent([]ContentPart{
+				{Type: ContentPartText, Text: "what is this?"},
+				{Type: ContentPartImageURL, ImageURL: &ImageURL{URL: "data:image/png;base64,iVBORw0KGgo="}},
+				{Type: ContentPartImageURL, ImageURL: &ImageURL{URL: "https://example.com/cat.png?size=large"}},
+			})},
+			{Role: "assistant", Content: NewTextContent("a cat")},
+		},
+	}
+
+	out := NewGeminiGenerateContentRequest(req)
+	if out.SystemInstruction == nil || len(out.SystemInstruction.Parts) != 2 || out.SystemInstruction.Text() != "be briefbe kind" {
+		t.Fatalf("SystemInstruction = %+v", out.SystemInstruction)
+	}
+	if len(out.Contents) != 2 || out.Contents[0].Role != "user" || out.Contents[1].Role != "model" {
+		t.Fatalf("Contents = %+v", out.Contents)
+	}
+
+	parts := out.Contents[0].Parts
+	if len(parts) != 3 {
+		t.Fatalf("user parts = %+v", parts)
+	}
+	if blob := parts[1].InlineData; blob == nil || blob.MimeType != "image/png" || blob.Data != "iVBORw0KGgo=" {
+		t.Fatalf("inline image = %+v", parts[1])
+	}
+	if file := parts[2].FileData; file == nil || file.MimeType != "image/png" || file.FileURI != "https://example.com/cat.png?size=large" {
+		t.Fatalf("image reference = %+v", parts[2])
+	}
+
+	if out.GenerationConfig == nil || out.GenerationConfig.MaxOutputTokens == nil || *out.GenerationConfig.MaxOutputTokens != 32 {
+		t.Fatalf("GenerationConfig = %+v", out.GenerationConfig)
+	}
+	if out.Tools != nil || out.ToolConfig != nil {
+		t.Fatalf("tools = %+v, tool config = %+v; want none", out.Tools, out.ToolConfig)
+	}
+}
+
+func TestNewGeminiGenerateContentRequestWithoutParameters(t *testing.T) {
+	out := NewGeminiGenerateContentRequest(&ChatCompletionRequest{
+		Messages: []Message{{Role: "user", Content: NewTextContent("hi")}},
+	})
+	if out.GenerationConfig != nil || out.SystemInstruction != nil {
+		t.Fatalf("request = %+v, want no generationConfig or systemInstruction", out)
+	}
+}
+
+func TestGeminiToChatCompletionResponse(t *testing.T) {
+	var resp GeminiGenerateContentResponse
+	err := json.Unmarshal([]byte(`{
+		"candidates": [
+			{"index": 0, "content": {"role": "model", "parts": [{"text": "Hello"}, {"text": " world"}]}, "finishReason": "MAX_TOKENS"}
+		],
+		"usageMetadata": {"promptTokenCount": 4, "candidatesTokenCount": 2, "totalTokenCount": 6},
+		"responseId": "r1"
+	}`), &resp)
+	if err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	out := resp.ToChatCompletionResponse("chatcmpl-r1", "gemini-2.0-flash")
+	if out.ID != "chatcmpl-r1" || out.Object != "chat.completion" || out.Model != "gemini-2.0-flash" {
+		t.Fatalf("response = %+v", out)
+	}
+	if len(out.Choices) != 1 || out.Choices[0].Message.Content.Text() != "Hello world" || out.Choices[0].FinishReason != "length" {
+		t.Fatalf("Choices = %+v", out.Choices)
+	}
+	if out.Usage.PromptTokens != 4 || out.Usage.CompletionTokens != 2 || out.Usage.TotalTokens != 6 {
+		t.Fatalf("Usage = %+v", out.Usage)
+	}
+}
+
+func TestGeminiToChatCompletionChunk(t *testing.T) {
+	usage := &GeminiUsageMetadata{PromptTokenCount: 4, CandidatesTokenCount: 1, TotalTokenCount: 5}
+
+	partial := (&GeminiGenerateContentResponse{
+		Candidates:    []GeminiCandidate{{Content: GeminiContent{Parts: []GeminiPart{{Text: "Hel"}}}}},
+		UsageMetadata: usage,
+	}).ToChatCompletionChunk("chatcmpl-1", "m")
+	if partial.Object != "chat.completion.chunk" || partial.Choices[0].Delta.Content.Text() != "Hel" {
+		t.Fatalf("chunk = %+v", partial)
+	}
+	// 累计 usage 仅在结束块中返回,避免中间块被当作最终用量
+	if partial.Usage != nil || partial.Choices[0].FinishReason != "" {
+		t.Fatalf("partial chunk carries usage %+v or finish reason %q", partial.Usage, partial.Choices[0].FinishReason)
+	}
+
+	final := (&GeminiGenerateContentResponse{
+		Candidates:    []GeminiCandidate{{Content: GeminiContent{Parts: []GeminiPart{{Text: "lo"}}}, FinishReason: "STOP"}},
+		UsageMetadata: usage,
+	}).ToChatCompletionChunk("chatcmpl-1", "m")
+	if final.Choices[0].FinishReason != "stop" || final.Usage == nil || final.Usage.TotalTokens != 5 {
+		t.Fatalf("final chunk = %+v", final)
+	}
+}
+
+func TestNewGeminiGenerateContentResponse(t *testing.T) {
+	resp := &ChatCompletionResponse{
+		ID: "chatcmpl-1",
+		Choices: []Choice{
+			{Index: 0, Message: Message{Role: "assistant", Content: NewTextContent("hi")}, FinishReason: "stop"},
+			{Index: 1, Message: Message{Role: "assistant", Content: NewTextContent("")}, FinishReason: "content_filter"},
+		},
+		Usage: Usage{PromptTokens: 3, CompletionTokens: 1, TotalTokens: 4},
+	}
+
+	out := NewGeminiGenerateContentResponse(resp, "gemini-2.0-flash")
+	if out.ResponseID != "chatcmpl-1" || out.ModelVersion != "gemini-2.0-flash" || out.UsageMetadata.TotalTokenCount != 4 {
+		t.Fatalf("response = %+v", out)
+	}
+	if len(out.Candidates) != 2 {
+		t.Fatalf("Candidates = %+v", out.Candidates)
+	}
+	if c := out.Candidates[0]; c.Content.Role != "model" || c.Content.Text() != "hi" || c.FinishReason != "STOP" {
+		t.Fatalf("candidate 0 = %+v", c)
+	}
+	// 没有文本时仍输出一个空文本片段,保证 parts 非空
+	if c := out.Candidates[1]; len(c.Content.Parts) != 1 || c.FinishReason != "SAFETY" {
+		t.Fatalf("candidate 1 = %+v", c)
+	}
+}
+
+func TestNewGeminiStreamChunk(t *testing.T) {
+	tests := []struct {
+		name       string
+		choice     ChunkChoice
+		wantNil    bool
+		wantText   string
+		wantFinish string
+	}{
+		{"text", ChunkChoice{Delta: Message{Content: NewTextContent("hi")}}, false, "hi", ""},
+		{"finish only", ChunkChoice{Delta: Message{}, FinishReason: "length"}, false, "", "MAX_TOKENS"},
+		{"role only", ChunkChoice{Delta: Message{Role: "assistant"}}, true, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := NewGeminiStreamChunk(&ChatCompletionChunk{ID: "chatcmpl-1", Choices: []ChunkChoice{tt.choice}}, "m")
+			if tt.wantNil {
+				if out != nil {
+					t.Fatalf("NewGeminiStreamChunk() = %+v, want nil", out)
+				}
+				return
+			}
+			if out == nil || len(out.Candidates) != 1 {
+				t.Fatalf("NewGeminiStreamChunk() = %+v", out)
+			}
+			if c := out.Candidates[0]; c.Content.Text() != tt.wantText || c.FinishReason != tt.wantFinish {
+				t.Fatalf("candidate = %+v, want text %q finish %q", c, tt.wantText, tt.wantFinish)
+			}
+		})
+	}
+}
+
+func TestGeminiFinishReasonMapping(t *testing.T) {
+	toOpenAI := map[string]string{
+		"":                   "",
+		"STOP":               "stop",
+		"MAX_TOKENS":         "length",
+		"SAFETY":             "content_filter",
+		"PROHIBITED_CONTENT": "content_filter",
+		"OTHER":              "stop",
+	}
+	for in, want := range toOpenAI {
+		if got := OpenAIFinishReason(in); got != want {
+			t.Errorf("OpenAIFinishReason(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	toGemini := map[string]string{
+		"":               "",
+		"stop":           "STOP",
+		"length":         "MAX_TOKENS",
+		"content_filter": "SAFETY",
+		"tool_calls":     "STOP",
+	}
+	for in, want := range toGemini {
+		if got := GeminiFinishReason(in); got != want {
+			t.Errorf("GeminiFinishReason(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
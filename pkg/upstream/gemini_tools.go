@@ -0,0 +1,302 @@
+package upstream
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// GeminiTool Gemini 工具定义
+type GeminiTool struct {
+	FunctionDeclarations []GeminiFunctionDeclaration `json:"functionDeclarations,omitempty"`
+}
+
+// GeminiFunctionDeclaration Gemini 函数声明
+// parameters 为 OpenAPI 子集 Schema,parametersJsonSchema 为标准 JSON Schema,二者择一
+type GeminiFunctionDeclaration struct {
+	Name                 string          `json:"name"`
+	Description          string          `json:"description,omitempty"`
+	Parameters           json.RawMessage `json:"parameters,omitempty"`
+	ParametersJSONSchema json.RawMessage `json:"parametersJsonSchema,omitempty"`
+}
+
+// GeminiToolConfig Gemini 工具配置
+type GeminiToolConfig struct {
+	FunctionCallingConfig *GeminiFunctionCallingConfig `json:"functionCallingConfig,omitempty"`
+}
+
+// GeminiFunctionCallingConfig Gemini 函数调用配置
+type GeminiFunctionCallingConfig struct {
+	Mode                 string   `json:"mode,omitempty"` // AUTO, ANY, NONE
+	AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+}
+
+// GeminiFunctionCall Gemini 函数调用
+type GeminiFunctionCall struct {
+	ID   string          `json:"id,omitempty"`
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+// GeminiFunctionResponse Gemini 函数调用结果
+type GeminiFunctionResponse struct {
+	ID       string          `json:"id,omitempty"`
+	Name     string          `json:"name"`
+	Response json.RawMessage `json:"response"`
+}
+
+// geminiToolsToTools 将 Gemini 函数声明转换为 OpenAI 工具定义
+// OpenAPI Schema 中的大写类型名(OBJECT、STRING 等)转换为 JSON Schema 的小写形式
+func geminiToolsToTools(tools []GeminiTool) []Tool {
+	var out []Tool
+	for _, tool := range tools {
+		for _, decl := range tool.FunctionDeclarations {
+			params := decl.ParametersJSONSchema
+			if len(params) == 0 && len(decl.Parameters) > 0 {
+				params = lowerSchemaTypes(decl.Parameters)
+			}
+			out = append(out, Tool{
+				Type: "function",
+				Function: FunctionDefinition{
+					Name:        decl.Name,
+					Description: decl.Description,
+					Parameters:  params,
+				},
+			})
+		}
+	}
+	return out
+}
+
+// lowerSchemaTypes 将 Schema 中所有 type 字段的取值转换为小写,解析失败时原样返回
+func lowerSchemaTypes(schema json.RawMessage) json.RawMessage {
+	var v interface{}
+	if err := json.Unmarshal(schema, &v); err != nil {
+		return schema
+	}
+
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			for key, child := range node {
+				if s, ok := child.(string); ok && key == "type" {
+					node[key] = strings.ToLower(s)
+					continue
+				}
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range node {
+				walk(child)
+			}
+		}
+	}
+	walk(v)
+
+	out, err := json.Marshal(v)
+	if err != nil {
+		return schema
+	}
+	return out
+}
+
+// toToolChoice 将 Gemini 函数调用配置转换为 OpenAI 工具选择策略
+func (c *GeminiToolConfig) toToolChoice() *ToolChoice {
+	if c == nil || c.FunctionCallingConfig == nil {
+		return nil
+	}
+	cfg := c.FunctionCallingConfig
+	switch cfg.Mode {
+	case "ANY":
+		if len(cfg.AllowedFunctionNames) == 1 {
+			return &ToolChoice{Function: cfg.AllowedFunctionNames[0]}
+		}
+		return &ToolChoice{Mode: "required"}
+	case "NONE":
+		return &ToolChoice{Mode: "none"}
+	case "AUTO":
+		return &ToolChoice{Mode: "auto"}
+	default:
+		return nil
+	}
+}
+
+// newGeminiTools 将 OpenAI 工具定义转换为 Gemini 函数声明,非函数工具无法表达,忽略
+func newGeminiTools(tools []Tool) []GeminiTool {
+	decls := make([]GeminiFunctionDeclaration, 0, len(tools))
+	for _, tool := range tools {
+		if !tool.IsFunction() {
+			continue
+		}
+		decls = append(decls, GeminiFunctionDeclaration{
+			Name:                 tool.Function.Name,
+			Description:          tool.Function.Description,
+			ParametersJSONSchema: tool.Function.Parameters,
+		})
+	}
+	if len(decls) == 0 {
+		return nil
+	}
+	return []GeminiTool{{FunctionDeclarations: decls}}
+}
+
+// newGeminiToolConfig 将 OpenAI 工具选择策略转换为 Gemini 函数调用配置
+func newGeminiToolConfig(choice *ToolChoice) *GeminiToolConfig {
+	if choice == nil {
+		return nil
+	}
+	cfg := &GeminiFunctionCallingConfig{}
+	switch {
+	case choice.Function != "":
+		cfg.Mode = "ANY"
+		cfg.AllowedFunctionNames = []string{choice.Function}
+	case choice.Mode == "required":
+		cfg.Mode = "ANY"
+	case choice.Mode == "none":
+		cfg.Mode = "NONE"
+	default:
+		cfg.Mode = "AUTO"
+	}
+	return &GeminiToolConfig{FunctionCallingConfig: cfg}
+}
+
+// toToolCall 将 Gemini 函数调用转换为 OpenAI 工具调用,上游未返回 ID 时生成一个
+func (f *GeminiFunctionCall) toToolCall() ToolCall {
+	id := f.ID
+	if id == "" {
+		id = newToolCallID()
+	}
+	return ToolCall{
+		ID:   id,
+		Type: "function",
+		Function: FunctionCall{
+			Name:      f.Name,
+			Arguments: string(argumentsJSON(string(f.Args))),
+		},
+	}
+}
+
+// newGeminiFunctionCall 将 OpenAI 工具调用转换为 Gemini 函数调用
+func newGeminiFunctionCall(call ToolCall) *GeminiFunctionCall {
+	return &GeminiFunctionCall{
+		Name: call.Function.Name,
+		Args: argumentsJSON(call.Function.Arguments),
+	}
+}
+
+// geminiFunctionResult 将工具消息内容转换为 Gemini 函数结果
+// 内容为 JSON 对象时直接使用,否则包装为 {"output": ...}
+func geminiFunctionResult(content string) json.RawMessage {
+	trimmed := strings.TrimSpace(content)
+	if strings.HasPrefix(trimmed, "{") && json.Valid([]byte(trimmed)) {
+		return json.RawMessage(trimmed)
+	}
+	out, _ := json.Marshal(map[string]string{"output": content})
+	return out
+}
+
+// geminiToolCalls 提取内容中的函数调用并转换为 OpenAI 工具调用
+func (c GeminiContent) geminiToolCalls() []ToolCall {
+	var calls []ToolCall
+	for _, part := range c.Parts {
+		if part.FunctionCall != nil {
+			calls = append(calls, part.FunctionCall.toToolCall())
+		}
+	}
+	return calls
+}
+
+// toMessages 将一轮 Gemini 内容转换为内部消息
+// functionCall 转换为 tool_calls;functionResponse 转换为独立的 tool 消息,
+// 未携带 ID 时按函数名关联到此前尚未返回结果的调用
+func (c GeminiContent) toMessages(role string, pending map[string][]string) []Message {
+	var (
+		messages []Message
+		calls    []ToolCall
+		rest     = GeminiContent{Role: c.Role}
+	)
+	for _, part := range c.Parts {
+		switch {
+		case part.FunctionCall != nil:
+			call := part.FunctionCall.toToolCall()
+			pending[call.Function.Name] = append(pending[call.Function.Name], call.ID)
+			calls = append(calls, call)
+		case part.FunctionResponse != nil:
+			resp := part.FunctionResponse
+			messages = append(messages, Message{
+				Role:       "tool",
+				ToolCallID: takePendingCall(pending, resp.Name, resp.ID),
+				Content:    NewTextContent(string(resp.Response)),
+			})
+		default:
+			rest.Parts = append(rest.Parts, part)
+		}
+	}
+
+	if len(calls) > 0 {
+		content := NullContent()
+		if len(rest.Parts) > 0 {
+			content = rest.ToMessageContent()
+		}
+		return append(messages, Message{Role: role, Content: content, ToolCalls: calls})
+	}
+	if len(rest.Parts) > 0 || len(messages) == 0 {
+		messages = append(messages, Message{Role: role, Content: rest.ToMessageContent()})
+	}
+	return messages
+}
+
+// takePendingCall 取出函数结果对应的调用 ID
+func takePendingCall(pending map[string][]string, name, id string) string {
+	ids := pending[name]
+	for i, pendingID := range ids {
+		if id == "" || pendingID == id {
+			pending[name] = append(ids[:i:i], ids[i+1:]...)
+			return pendingID
+		}
+	}
+	if id == "" {
+		id = newToolCallID()
+	}
+	return id
+}
+
+// newGeminiModelParts 将 assistant 消息转换为 Gemini 内容片段,tool_calls 转换为 functionCall
+func newGeminiModelParts(msg Message) []GeminiPart {
+	if len(msg.ToolCalls) == 0 {
+		return newGeminiParts(msg.Content)
+	}
+
+	var parts []GeminiPart
+	if msg.Content.IsMultipart() || msg.Content.Text() != "" {
+		parts = newGeminiParts(msg.Content)
+	}
+	for _, call := range msg.ToolCalls {
+		parts = append(parts, GeminiPart{FunctionCall: newGeminiFunctionCall(call)})
+	}
+	return parts
+}
+
+// isFunctionResponseTurn 判断一轮内容是否仅包含函数结果
+func isFunctionResponseTurn(c GeminiContent) bool {
+	if len(c.Parts) == 0 {
+		return false
+	}
+	for _, part := range c.Parts {
+		if part.FunctionResponse == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// NewGeminiFunctionCallParts 将完整的工具调用转换为 functionCall 片段,保留调用 ID
+func NewGeminiFunctionCallParts(calls []ToolCall) []GeminiPart {
+	parts := make([]GeminiPart, 0, len(calls))
+	for _, call := range calls {
+		fc := newGeminiFunctionCall(call)
+		fc.ID = call.ID
+		parts = append(parts, GeminiPart{FunctionCall: fc})
+	}
+	return parts
+}
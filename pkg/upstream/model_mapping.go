@@ -0,0 +1,71 @@
+package upstream
+
+import "context"
+
+// modelMappedProvider 模型名映射适配器
+// 请求发往上游前将 model 改写为上游模型名,响应中恢复为对外模型名,
+// 保证映射不会泄露给客户端,也不会影响计费与任务记录
+type modelMappedProvider struct {
+	Provider
+	upstreamModel string
+}
+
+// WithUpstreamModel 包装适配器,将请求中的模型名改写为 upstreamModel
+// upstreamModel 为空时返回原适配器
+func WithUpstreamModel(provider Provider, upstreamModel string) Provider {
+	if upstreamModel == "" {
+		return provider
+	}
+	return &modelMappedProvider{Provider: provider, upstreamModel: upstreamModel}
+}
+
+// ChatCompletion 文本对话(同步)
+func (p *modelMappedProvider) ChatCompletion(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	mapped := *req
+	mapped.Model = p.upstreamModel
+
+	resp, err := p.Provider.ChatCompletion(ctx, &mapped)
+	if resp != nil {
+		resp.Model = req.Model
+	}
+	return resp, err
+}
+
+// ChatCompletionStream 文本对话(流式)
+func (p *modelMappedProvider) ChatCompletionStream(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionStream, error) {
+	mapped := *req
+	mapped.Model = p.upstreamModel
+
+	stream, err := p.Provider.ChatCompletionStream(ctx, &mapped)
+	if err != nil {
+		return nil, err
+	}
+	stream.RewriteModel(req.Model)
+	return stream, nil
+}
+
+// Embeddings 文本向量化
+func (p *modelMappedProvider) Embeddings(ctx context.Context, req *EmbeddingRequest) (*EmbeddingResponse, error) {
+	mapped := *req
+	mapped.Model = p.upstreamModel
+
+	resp, err := p.Provider.Embeddings(ctx, &mapped)
+	if resp != nil {
+		resp.Model = req.Model
+	}
+	return resp, err
+}
+
+// ImageGeneration 图片生成
+func (p *modelMappedProvider) ImageGeneration(ctx context.Context, req *ImageGenerationRequest) (*ImageGenerationResponse, error) {
+	mapped := *req
+	mapped.Model = p.upstreamModel
+	return p.Provider.ImageGeneration(ctx, &mapped)
+}
+
+// VideoGeneration 视频生成
+func (p *modelMappedProvider) VideoGeneration(ctx context.Context, req *VideoGenerationRequest) (*VideoGenerationResponse, error) {
+	mapped := *req
+	mapped.Model = p.upstreamModel
+	return p.Provider.VideoGeneration(ctx, &mapped)
+}
@@ -0,0 +1,103 @@
+package upstream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// recordingProvider 记录收到的模型名,并以上游模型名响应的测试适配器
+type recordingProvider struct {
+	Provider
+	models []string
+	stream string
+}
+
+func (p *recordingProvider) ChatCompletion(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	p.models = append(p.models, req.Model)
+	return &ChatCompletionResponse{ID: "chatcmpl-1", Model: req.Model}, nil
+}
+
+func (p *recordingProvider) ChatCompletionStream(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionStream, error) {
+	p.models = append(p.models, req.Model)
+	return NewChatCompletionStream(io.NopCloser(strings.NewReader(p.stream))), nil
+}
+
+func (p *recordingProvider) Embeddings(ctx context.Context, req *EmbeddingRequest) (*EmbeddingResponse, error) {
+	p.models = append(p.models, req.Model)
+	return &EmbeddingResponse{Object: "list", Model: req.Model}, nil
+}
+
+func (p *recordingProvider) ImageGeneration(ctx context.Context, req *ImageGenerationRequest) (*ImageGenerationResponse, error) {
+	p.models = append(p.models, req.Model)
+	return &ImageGenerationResponse{Status: "completed"}, nil
+}
+
+func TestWithUpstreamModelEmpty(t *testing.T) {
+	inner := &recordingProvider{}
+	if WithUpstreamModel(inner, "") != Provider(inner) {
+		t.Fatal("WithUpstreamModel() with an empty name wrapped the provider")
+	}
+}
+
+func TestModelMappedProviderRewritesRequests(t *testing.T) {
+	inner := &recordingProvider{}
+	provider := WithUpstreamModel(inner, "gpt-4o-2024-08-06")
+	ctx := context.Background()
+
+	req := &ChatCompletionRequest{Model: "gpt-4o"}
+	resp, err := provider.ChatCompletion(ctx, req)
+	if err != nil {
+		t.Fatalf("ChatCompletion: %v", err)
+	}
+	// 响应中恢复对外模型名,调用方的请求不被修改
+	if resp.Model != "gpt-4o" || req.Model != "gpt-4o" {
+		t.Fatalf("response model = %q, request model = %q", resp.Model, req.Model)
+	}
+
+	embedding, err := provider.Embeddings(ctx, &EmbeddingRequest{Model: "gpt-4o"})
+	if err != nil || embedding.Model != "gpt-4o" {
+		t.Fatalf("Embeddings() = %+v, %v", embedding, err)
+	}
+	if _, err := provider.ImageGeneration(ctx, &ImageGenerationRequest{Model: "gpt-4o"}); err != nil {
+		t.Fatalf("ImageGeneration: %v", err)
+	}
+
+	for i, model := range inner.models {
+		if model != "gpt-4o-2024-08-06" {
+			t.Fatalf("upstream call %d used model %q", i, model)
+		}
+	}
+	if len(inner.models) != 3 {
+		t.Fatalf("upstream received %d calls, want 3", len(inner.models))
+	}
+}
+
+func TestModelMappedProviderRewritesStream(t *testing.T) {
+	inner := &recordingProvider{stream: "data: {\"id\":\"1\",\"model\":\"gpt-4o-2024-08-06\",\"choices\":[],\"system_fingerprint\":\"fp\"}\n\ndata: [DONE]\n\n"}
+	stream, err := WithUpstreamModel(inner, "gpt-4o-2024-08-06").ChatCompletionStream(context.Background(), &ChatCompletionRequest{Model: "gpt-4o"})
+	if err != nil {
+		t.Fatalf("ChatCompletionStream: %v", err)
+	}
+	defer stream.Close()
+
+	chunks, raws, err := recvAll(t, stream)
+	if !errors.Is(err, io.EOF) || len(chunks) != 1 {
+		t.Fatalf("got %d chunks, err %v", len(chunks), err)
+	}
+	if chunks[0].Model != "gpt-4o" {
+		t.Fatalf("chunk model = %q, want gpt-4o", chunks[0].Model)
+	}
+
+	// 原始 JSON 同样改写,其余字段保持不变
+	var fields map[string]interface{}
+	if err := json.Unmarshal(raws[0], &fields); err != nil {
+		t.Fatalf("unmarshal raw chunk: %v", err)
+	}
+	if fields["model"] != "gpt-4o" || fields["system_fingerprint"] != "fp" {
+		t.Fatalf("raw chunk = %s", raws[0])
+	}
+}
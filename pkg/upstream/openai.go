@@ -0,0 +1,185 @@
+package upstream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/869413421/transit/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// ProviderOpenAI OpenAI 兼容上游(OpenAI 官方、vLLM、one-api 类中转等)
+const ProviderOpenAI = "openai"
+
+var _ Provider = (*OpenAIAdapter)(nil)
+
+func init() {
+	RegisterProvider(ProviderOpenAI, func(baseURL, apiKey string) Provider {
+		return NewOpenAIAdapter(baseURL, apiKey)
+	})
+}
+
+// OpenAIAdapter OpenAI 兼容适配器
+// 图片生成为同步接口,直接返回 data[].url / b64_json;不支持异步视频任务
+type OpenAIAdapter struct {
+	client *Client
+}
+
+// NewOpenAIAdapter 创建 OpenAI 兼容适配器
+func NewOpenAIAdapter(baseURL, apiKey string) *OpenAIAdapter {
+	return &OpenAIAdapter{
+		client: NewClient(baseURL, apiKey),
+	}
+}
+
+// ChatCompletion 文本对话(同步)
+func (a *OpenAIAdapter) ChatCompletion(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	logger.Info("OpenAI chat completion request",
+		zap.String("model", req.Model),
+		zap.Int("messages", len(req.Messages)),
+	)
+
+	resp, err := a.client.Do(ctx, &Request{
+		Method: http.MethodPost,
+		Path:   "/v1/chat/completions",
+		Body:   req,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp.StatusCode, resp.Body)
+	}
+
+	var chatResp ChatCompletionResponse
+	if err := json.Unmarshal(resp.Body, &chatResp); err != nil {
+		return nil, fmt.Errorf("unmarshal response: %w", err)
+	}
+
+	logger.Info("OpenAI chat completion success",
+		zap.String("model", chatResp.Model),
+		zap.Int("total_tokens", chatResp.Usage.TotalTokens),
+	)
+
+	return &chatResp, nil
+}
+
+// ChatCompletionStream 文本对话(流式)
+func (a *OpenAIAdapter) ChatCompletionStream(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionStream, error) {
+	logger.Info("OpenAI chat completion stream request",
+		zap.String("model", req.Model),
+		zap.Int("messages", len(req.Messages)),
+	)
+
+	streamReq := *req
+	streamReq.Stream = true
+	streamReq.StreamOptions = &StreamOptions{IncludeUsage: true}
+
+	resp, err := a.client.DoStream(ctx, &Request{
+		Method:  http.MethodPost,
+		Path:    "/v1/chat/completions",
+		Headers: map[string]string{"Accept": "text/event-stream"},
+		Body:    &streamReq,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, newAPIError(resp.StatusCode, body)
+	}
+
+	return NewChatCompletionStream(resp.Body), nil
+}
+
+// Embeddings 文本向量化
+func (a *OpenAIAdapter) Embeddings(ctx context.Context, req *EmbeddingRequest) (*EmbeddingResponse, error) {
+	logger.Info("OpenAI embeddings request",
+		zap.String("model", req.Model),
+		zap.Int("inputs", req.Input.Len()),
+	)
+
+	resp, err := a.client.Do(ctx, &Request{
+		Method: http.MethodPost,
+		Path:   "/v1/embeddings",
+		Body:   req,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp.StatusCode, resp.Body)
+	}
+
+	var embeddingResp EmbeddingResponse
+	if err := json.Unmarshal(resp.Body, &embeddingResp); err != nil {
+		return nil, fmt.Errorf("unmarshal response: %w", err)
+	}
+
+	logger.Info("OpenAI embeddings success",
+		zap.String("model", embeddingResp.Model),
+		zap.Int("prompt_tokens", embeddingResp.Usage.PromptTokens),
+	)
+
+	return &embeddingResp, nil
+}
+
+// ImageGeneration 图片生成(同步)
+// OpenAI 返回格式: {created: 0, data: [{url: "...", b64_json: "...", revised_prompt: "..."}]}
+func (a *OpenAIAdapter) ImageGeneration(ctx context.Context, req *ImageGenerationRequest) (*ImageGenerationResponse, error) {
+	logger.Info("OpenAI image generation request",
+		zap.String("model", req.Model),
+		zap.String("prompt", req.Prompt[:min(50, len(req.Prompt))]),
+	)
+
+	resp, err := a.client.Do(ctx, &Request{
+		Method: http.MethodPost,
+		Path:   "/v1/images/generations",
+		Body:   req,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp.StatusCode, resp.Body)
+	}
+
+	var apiResp struct {
+		Created int64       `json:"created"`
+		Data    []ImageData `json:"data"`
+	}
+	if err := json.Unmarshal(resp.Body, &apiResp); err != nil {
+		return nil, fmt.Errorf("unmarshal response: %w", err)
+	}
+	if len(apiResp.Data) == 0 {
+		return nil, fmt.Errorf("empty image response")
+	}
+
+	logger.Info("OpenAI image generation completed",
+		zap.String("model", req.Model),
+		zap.Int("images", len(apiResp.Data)),
+	)
+
+	return &ImageGenerationResponse{
+		Status: "completed",
+		Images: apiResp.Data,
+	}, nil
+}
+
+// VideoGeneration 视频生成(不支持)
+func (a *OpenAIAdapter) VideoGeneration(ctx context.Context, req *VideoGenerationRequest) (*VideoGenerationResponse, error) {
+	return nil, fmt.Errorf("video generation: %w", ErrUnsupportedOperation)
+}
+
+// GetTaskStatus 查询任务状态(不支持,OpenAI 兼容上游的结果均为同步返回)
+func (a *OpenAIAdapter) GetTaskStatus(ctx context.Context, taskID string) (*TaskStatusResponse, error) {
+	return nil, fmt.Errorf("get task status: %w", ErrUnsupportedOperation)
+}
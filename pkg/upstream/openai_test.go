@@ -0,0 +1,145 @@
+package upstream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/869413421/transit/pkg/logger"
+)
+
+func TestMain(m *testing.M) {
+	if err := logger.Init("production"); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// newOpenAIServer 创建 OpenAI 兼容测试服务,校验请求路径与密钥后由 handle 返回响应
+func newOpenAIServer(t *testing.T, path string, handle func(w http.ResponseWriter, body map[string]interface{})) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			t.Errorf("path = %s, want %s", r.URL.Path, path)
+		}
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		handle(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOpenAIAdapterChatCompletion(t *testing.T) {
+	server := newOpenAIServer(t, "/v1/chat/completions", func(w http.ResponseWriter, body map[string]interface{}) {
+		if body["model"] != "gpt-4o" {
+			t.Errorf("model = %v", body["model"])
+		}
+		io.WriteString(w, `{"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"hello"},"finish_reason":"stop"}],"usage":{"prompt_tokens":2,"completion_tokens":1,"total_tokens":3}}`)
+	})
+
+	resp, err := NewOpenAIAdapter(server.URL, "test-key").ChatCompletion(context.Background(), &ChatCompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []Message{{Role: "user", Content: NewTextContent("hi")}},
+	})
+	if err != nil {
+		t.Fatalf("ChatCompletion: %v", err)
+	}
+	if resp.Usage.TotalTokens != 3 || len(resp.Choices) != 1 || resp.Choices[0].Message.Role != "assistant" {
+		t.Fatalf("ChatCompletion() = %+v", resp)
+	}
+}
+
+func TestOpenAIAdapterAPIError(t *testing.T) {
+	server := newOpenAIServer(t, "/v1/chat/completions", func(w http.ResponseWriter, body map[string]interface{}) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		io.WriteString(w, `{"error":{"message":"Rate limit reached","type":"requests","code":"rate_limit_exceeded"}}`)
+	})
+
+	_, err := NewOpenAIAdapter(server.URL, "test-key").ChatCompletion(context.Background(), &ChatCompletionRequest{Model: "gpt-4o"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("ChatCompletion() error = %v, want *APIError", err)
+	}
+	if apiErr.StatusCode != http.StatusTooManyRequests || apiErr.Message != "Rate limit reached" || apiErr.Code != "rate_limit_exceeded" {
+		t.Fatalf("APIError = %+v", apiErr)
+	}
+}
+
+func TestOpenAIAdapterChatCompletionStream(t *testing.T) {
+	server := newOpenAIServer(t, "/v1/chat/completions", func(w http.ResponseWriter, body map[string]interface{}) {
+		// 流式请求总是要求上游返回 usage,用于计费
+		options, _ := body["stream_options"].(map[string]interface{})
+		if body["stream"] != true || options["include_usage"] != true {
+			t.Errorf("stream = %v, stream_options = %v", body["stream"], body["stream_options"])
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: {\"id\":\"1\",\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"hi\"}}]}\n\ndata: [DONE]\n\n")
+	})
+
+	req := &ChatCompletionRequest{Model: "gpt-4o", Stream: true}
+	stream, err := NewOpenAIAdapter(server.URL, "test-key").ChatCompletionStream(context.Background(), req)
+	if err != nil {
+		t.Fatalf("ChatCompletionStream: %v", err)
+	}
+	defer stream.Close()
+
+	if req.StreamOptions != nil {
+		t.Fatal("ChatCompletionStream modified the caller's request")
+	}
+	chunks, _, err := recvAll(t, stream)
+	if !errors.Is(err, io.EOF) || len(chunks) != 1 {
+		t.Fatalf("got %d chunks, err %v", len(chunks), err)
+	}
+}
+
+func TestOpenAIAdapterImageGeneration(t *testing.T) {
+	server := newOpenAIServer(t, "/v1/images/generations", func(w http.ResponseWriter, body map[string]interface{}) {
+		io.WriteString(w, `{"created":1700000000,"data":[{"url":"https://img.example.com/1.png","revised_prompt":"a cat"},{"b64_json":"aGVsbG8="}]}`)
+	})
+
+	resp, err := NewOpenAIAdapter(server.URL, "test-key").ImageGeneration(context.Background(), &ImageGenerationRequest{
+		Model:  "dall-e-3",
+		Prompt: "cat",
+	})
+	if err != nil {
+		t.Fatalf("ImageGeneration: %v", err)
+	}
+	// 同步上游直接返回图片,无需轮询任务
+	if resp.Status != "completed" || resp.TaskID != "" || len(resp.Images) != 2 {
+		t.Fatalf("ImageGeneration() = %+v", resp)
+	}
+	if resp.Images[0].URL != "https://img.example.com/1.png" || resp.Images[1].B64JSON != "aGVsbG8=" {
+		t.Fatalf("Images = %+v", resp.Images)
+	}
+}
+
+func TestOpenAIAdapterEmptyImageResponse(t *testing.T) {
+	server := newOpenAIServer(t, "/v1/images/generations", func(w http.ResponseWriter, body map[string]interface{}) {
+		io.WriteString(w, `{"created":1700000000,"data":[]}`)
+	})
+
+	if _, err := NewOpenAIAdapter(server.URL, "test-key").ImageGeneration(context.Background(), &ImageGenerationRequest{Prompt: "cat"}); err == nil {
+		t.Fatal("ImageGeneration() with no images returned no error")
+	}
+}
+
+func TestOpenAIAdapterUnsupported(t *testing.T) {
+	adapter := NewOpenAIAdapter("http://127.0.0.1:0", "test-key")
+	if _, err := adapter.VideoGeneration(context.Background(), &VideoGenerationRequest{}); !errors.Is(err, ErrUnsupportedOperation) {
+		t.Fatalf("VideoGeneration() error = %v, want ErrUnsupportedOperation", err)
+	}
+	if _, err := adapter.GetTaskStatus(context.Background(), "task-1"); !errors.Is(err, ErrUnsupportedOperation) {
+		t.Fatalf("GetTaskStatus() error = %v, want ErrUnsupportedOperation", err)
+	}
+}
@@ -0,0 +1,85 @@
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// 内置供应商类型
+const (
+	ProviderAPIMart = "apimart"
+
+	// DefaultProvider 渠道未指定供应商时使用的默认类型
+	DefaultProvider = ProviderAPIMart
+)
+
+// Provider 上游供应商适配器接口
+// 每种上游协议实现一个适配器,处理器和轮询器只依赖该接口
+type Provider interface {
+	// ChatCompletion 文本对话(同步)
+	ChatCompletion(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionResponse, error)
+	// ChatCompletionStream 文本对话(流式)
+	ChatCompletionStream(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionStream, error)
+	// Embeddings 文本向量化
+	Embeddings(ctx context.Context, req *EmbeddingRequest) (*EmbeddingResponse, error)
+	// ImageGeneration 图片生成
+	ImageGeneration(ctx context.Context, req *ImageGenerationRequest) (*ImageGenerationResponse, error)
+	// VideoGeneration 视频生成
+	VideoGeneration(ctx context.Context, req *VideoGenerationRequest) (*VideoGenerationResponse, error)
+	// GetTaskStatus 查询异步任务状态
+	GetTaskStatus(ctx context.Context, taskID string) (*TaskStatusResponse, error)
+}
+
+// ProviderFactory 根据渠道地址和密钥创建适配器
+type ProviderFactory func(baseURL, apiKey string) Provider
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]ProviderFactory)
+)
+
+// RegisterProvider 注册供应商适配器,重复注册同一类型会覆盖之前的实现
+func RegisterProvider(providerType string, factory ProviderFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[providerType] = factory
+}
+
+// NewProvider 根据供应商类型创建适配器,类型为空时使用默认供应商
+func NewProvider(providerType, baseURL, apiKey string) (Provider, error) {
+	if providerType == "" {
+		providerType = DefaultProvider
+	}
+
+	registryMu.RLock()
+	factory, ok := registry[providerType]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown provider: %s", providerType)
+	}
+
+	return factory(baseURL, apiKey), nil
+}
+
+// IsProviderRegistered 判断供应商类型是否已注册
+func IsProviderRegistered(providerType string) bool {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	_, ok := registry[providerType]
+	return ok
+}
+
+// ProviderTypes 返回所有已注册的供应商类型(按名称排序)
+func ProviderTypes() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	types := make([]string, 0, len(registry))
+	for t := range registry {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
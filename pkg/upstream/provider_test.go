@@ -0,0 +1,50 @@
+package upstream
+
+import (
+	"slices"
+	"testing"
+)
+
+// stubProvider 记录创建参数的测试适配器
+type stubProvider struct {
+	Provider
+	baseURL string
+	apiKey  string
+}
+
+func TestNewProvider(t *testing.T) {
+	RegisterProvider("stub", func(baseURL, apiKey string) Provider {
+		return &stubProvider{baseURL: baseURL, apiKey: apiKey}
+	})
+
+	provider, err := NewProvider("stub", "https://stub.example.com", "sk-test")
+	if err != nil {
+		t.Fatalf("NewProvider: %v", err)
+	}
+	stub, ok := provider.(*stubProvider)
+	if !ok || stub.baseURL != "https://stub.example.com" || stub.apiKey != "sk-test" {
+		t.Fatalf("NewProvider() = %#v, want stub created with the channel address and key", provider)
+	}
+
+	if !IsProviderRegistered("stub") || IsProviderRegistered("missing") {
+		t.Fatal("IsProviderRegistered() does not match the registry")
+	}
+	if types := ProviderTypes(); !slices.IsSorted(types) || !slices.Contains(types, "stub") || !slices.Contains(types, ProviderAPIMart) {
+		t.Fatalf("ProviderTypes() = %v, want sorted registered types", types)
+	}
+}
+
+func TestNewProviderDefaultsAndUnknown(t *testing.T) {
+	// 渠道未指定供应商时使用默认供应商
+	provider, err := NewProvider("", "https://api.example.com", "sk-test")
+	if err != nil {
+		t.Fatalf("NewProvider: %v", err)
+	}
+	if _, ok := provider.(*APIMartAdapter); !ok {
+		t.Fatalf("NewProvider(\"\") = %T, want the default provider", provider)
+	}
+
+	if _, err := NewProvider("missing", "https://api.example.com", "sk-test"); err == nil {
+		t.Fatal("NewProvider() with an unknown type returned no error")
+	}
+}
@@ -0,0 +1,115 @@
+package upstream
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimit 上游响应头中的限流信息
+// 取值为 -1 表示上游未返回对应的响应头
+type RateLimit struct {
+	StatusCode        int
+	LimitRequests     int
+	RemainingRequests int
+	ResetRequests     time.Duration // 请求数配额恢复所需时间
+	LimitTokens       int
+	RemainingTokens   int
+	ResetTokens       time.Duration // Token 配额恢复所需时间
+	RetryAfter        time.Duration // Retry-After 要求的等待时间
+}
+
+// ParseRateLimit 解析 x-ratelimit-* 与 Retry-After 响应头,没有任何限流信息时返回 nil
+func ParseRateLimit(statusCode int, header http.Header) *RateLimit {
+	rl := &RateLimit{
+		StatusCode:        statusCode,
+		LimitRequests:     headerInt(header, "x-ratelimit-limit-requests"),
+		RemainingRequests: headerInt(header, "x-ratelimit-remaining-requests"),
+		ResetRequests:     headerDuration(header, "x-ratelimit-reset-requests"),
+		LimitTokens:       headerInt(header, "x-ratelimit-limit-tokens"),
+		RemainingTokens:   headerInt(header, "x-ratelimit-remaining-tokens"),
+		ResetTokens:       headerDuration(header, "x-ratelimit-reset-tokens"),
+		RetryAfter:        retryAfter(header.Get("Retry-After")),
+	}
+
+	if statusCode != http.StatusTooManyRequests &&
+		rl.RemainingRequests < 0 && rl.RemainingTokens < 0 && rl.RetryAfter == 0 {
+		return nil
+	}
+	return rl
+}
+
+// headerInt 解析整数响应头,缺失或无法解析时返回 -1
+func headerInt(header http.Header, key string) int {
+	value, err := strconv.Atoi(header.Get(key))
+	if err != nil {
+		return -1
+	}
+	return value
+}
+
+// headerDuration 解析 OpenAI 格式的重置时间(如 1s、6m0s、20ms),纯数字按秒处理
+func headerDuration(header http.Header, key string) time.Duration {
+	value := header.Get(key)
+	if value == "" {
+		return 0
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return d
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	return 0
+}
+
+// retryAfter 解析 Retry-After,支持秒数与 HTTP 日期两种格式
+func retryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
+
+// RateLimitCapture 记录一次上游调用中最后收到的限流信息
+type RateLimitCapture struct {
+	mu   sync.Mutex
+	last *RateLimit
+}
+
+// Last 返回最后收到的限流信息,没有时返回 nil
+func (c *RateLimitCapture) Last() *RateLimit {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.last
+}
+
+type rateLimitCaptureKey struct{}
+
+// WithRateLimitCapture 返回携带限流信息记录器的上下文
+// 使用该上下文调用适配器时,上游响应中的限流响应头会被记录下来
+func WithRateLimitCapture(ctx context.Context) (context.Context, *RateLimitCapture) {
+	capture := &RateLimitCapture{}
+	return context.WithValue(ctx, rateLimitCaptureKey{}, capture), capture
+}
+
+// captureRateLimit 将响应头中的限流信息写入上下文中的记录器
+func captureRateLimit(ctx context.Context, statusCode int, header http.Header) {
+	capture, ok := ctx.Value(rateLimitCaptureKey{}).(*RateLimitCapture)
+	if !ok {
+		return
+	}
+	if rl := ParseRateLimit(statusCode, header); rl != nil {
+		capture.mu.Lock()
+		capture.last = rl
+		capture.mu.Unlock()
+	}
+}
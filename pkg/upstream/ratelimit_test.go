@@ -0,0 +1,106 @@
+package upstream
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	header := http.Header{}
+	header.Set("x-ratelimit-limit-requests", "500")
+	header.Set("x-ratelimit-remaining-requests", "499")
+	header.Set("x-ratelimit-reset-requests", "120ms")
+	header.Set("x-ratelimit-limit-tokens", "30000")
+	header.Set("x-ratelimit-remaining-tokens", "29000")
+	header.Set("x-ratelimit-reset-tokens", "6m0s")
+
+	rl := ParseRateLimit(http.StatusOK, header)
+	if rl == nil {
+		t.Fatal("ParseRateLimit() = nil")
+	}
+	want := RateLimit{
+		StatusCode:        http.StatusOK,
+		LimitRequests:     500,
+		RemainingRequests: 499,
+		ResetRequests:     120 * time.Millisecond,
+		LimitTokens:       30000,
+		RemainingTokens:   29000,
+		ResetTokens:       6 * time.Minute,
+	}
+	if *rl != want {
+		t.Fatalf("ParseRateLimit() = %+v, want %+v", *rl, want)
+	}
+}
+
+func TestParseRateLimitWithoutHeaders(t *testing.T) {
+	if rl := ParseRateLimit(http.StatusOK, http.Header{}); rl != nil {
+		t.Fatalf("ParseRateLimit() = %+v, want nil without rate limit headers", rl)
+	}
+
+	// 429 即使没有响应头也需要返回,以便冷却渠道
+	rl := ParseRateLimit(http.StatusTooManyRequests, http.Header{})
+	if rl == nil || rl.RemainingRequests != -1 || rl.LimitTokens != -1 || rl.RetryAfter != 0 {
+		t.Fatalf("ParseRateLimit() = %+v", rl)
+	}
+}
+
+func TestHeaderDuration(t *testing.T) {
+	tests := map[string]time.Duration{
+		"1s":    time.Second,
+		"6m0s":  6 * time.Minute,
+		"20ms":  20 * time.Millisecond,
+		"2":     2 * time.Second,
+		"0.5":   500 * time.Millisecond,
+		"":      0,
+		"later": 0,
+	}
+	for value, want := range tests {
+		header := http.Header{}
+		header.Set("x-ratelimit-reset-tokens", value)
+		if got := headerDuration(header, "x-ratelimit-reset-tokens"); got != want {
+			t.Errorf("headerDuration(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	if got := retryAfter("30"); got != 30*time.Second {
+		t.Fatalf("retryAfter(\"30\") = %v", got)
+	}
+	if got := retryAfter("-5"); got != 0 {
+		t.Fatalf("retryAfter(\"-5\") = %v, want 0", got)
+	}
+	if got := retryAfter("soon"); got != 0 {
+		t.Fatalf("retryAfter(\"soon\") = %v, want 0", got)
+	}
+
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if got := retryAfter(date); got < 55*time.Second || got > time.Minute {
+		t.Fatalf("retryAfter(%q) = %v, want about one minute", date, got)
+	}
+	past := time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)
+	if got := retryAfter(past); got != 0 {
+		t.Fatalf("retryAfter(past date) = %v, want 0", got)
+	}
+}
+
+func TestRateLimitCapture(t *testing.T) {
+	// 未携带记录器的上下文直接忽略
+	captureRateLimit(context.Background(), http.StatusTooManyRequests, http.Header{})
+
+	ctx, capture := WithRateLimitCapture(context.Background())
+	if capture.Last() != nil {
+		t.Fatal("new capture is not empty")
+	}
+
+	header := http.Header{}
+	header.Set("Retry-After", "7")
+	captureRateLimit(ctx, http.StatusTooManyRequests, header)
+	captureRateLimit(ctx, http.StatusOK, http.Header{}) // 没有限流信息的响应不覆盖
+
+	if rl := capture.Last(); rl == nil || rl.RetryAfter != 7*time.Second {
+		t.Fatalf("Last() = %+v, want the 429 rate limit", rl)
+	}
+}
@@ -0,0 +1,124 @@
+package upstream
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// sseDone OpenAI 流式响应结束标记
+const sseDone = "[DONE]"
+
+// ChunkDecoder 将一个 SSE 事件的 data 解码为内部数据块
+// 同时返回 OpenAI 格式的原始 JSON,供 OpenAI 入口直接透传
+type ChunkDecoder func(data []byte) (*ChatCompletionChunk, []byte, error)
+
+// ChatCompletionStream 流式对话读取器
+// 按 SSE 协议逐个读取上游事件,调用方负责调用 Close 释放连接
+type ChatCompletionStream struct {
+	body   io.ReadCloser
+	reader *bufio.Reader
+	decode ChunkDecoder
+}
+
+// NewChatCompletionStream 基于 OpenAI 格式的上游响应体创建流式读取器
+func NewChatCompletionStream(body io.ReadCloser) *ChatCompletionStream {
+	return NewChatCompletionStreamWithDecoder(body, decodeOpenAIChunk)
+}
+
+// NewChatCompletionStreamWithDecoder 基于非 OpenAI 格式的上游响应体创建流式读取器
+func NewChatCompletionStreamWithDecoder(body io.ReadCloser, decode ChunkDecoder) *ChatCompletionStream {
+	return &ChatCompletionStream{
+		body:   body,
+		reader: bufio.NewReader(body),
+		decode: decode,
+	}
+}
+
+// Recv 读取下一个数据块
+// 返回解析后的数据块及上游原始 JSON,收到 [DONE] 或上游关闭连接时返回 io.EOF
+func (s *ChatCompletionStream) Recv() (*ChatCompletionChunk, []byte, error) {
+	for {
+		data, err := s.readEvent()
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(data) == 0 {
+			continue
+		}
+		if string(data) == sseDone {
+			return nil, nil, io.EOF
+		}
+
+		return s.decode(data)
+	}
+}
+
+// decodeOpenAIChunk 解码 OpenAI 格式的数据块,原始 JSON 原样返回
+func decodeOpenAIChunk(data []byte) (*ChatCompletionChunk, []byte, error) {
+	var chunk ChatCompletionChunk
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return nil, nil, fmt.Errorf("unmarshal chunk: %w", err)
+	}
+	return &chunk, data, nil
+}
+
+// RewriteModel 将后续数据块(含原始 JSON)中的 model 字段改写为指定名称
+// 用于在上游使用映射后的模型名时,向客户端恢复对外模型名
+func (s *ChatCompletionStream) RewriteModel(model string) {
+	decode := s.decode
+	s.decode = func(data []byte) (*ChatCompletionChunk, []byte, error) {
+		chunk, raw, err := decode(data)
+		if err != nil || chunk.Model == model {
+			return chunk, raw, err
+		}
+		chunk.Model = model
+
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return nil, nil, fmt.Errorf("unmarshal chunk: %w", err)
+		}
+		fields["model"], _ = json.Marshal(model)
+		if raw, err = json.Marshal(fields); err != nil {
+			return nil, nil, fmt.Errorf("marshal chunk: %w", err)
+		}
+		return chunk, raw, nil
+	}
+}
+
+// Close 关闭上游连接
+func (s *ChatCompletionStream) Close() error {
+	return s.body.Close()
+}
+
+// readEvent 读取一个完整的 SSE 事件并返回其 data 字段
+// 多行 data 按协议以换行拼接,注释行与其他字段被忽略
+func (s *ChatCompletionStream) readEvent() ([]byte, error) {
+	var data [][]byte
+	for {
+		line, err := s.reader.ReadBytes('\n')
+		line = bytes.TrimRight(line, "\r\n")
+
+		if len(line) == 0 && err == nil {
+			// 空行表示事件结束
+			if len(data) > 0 {
+				return bytes.Join(data, []byte("\n")), nil
+			}
+			continue
+		}
+
+		if value, ok := bytes.CutPrefix(line, []byte("data:")); ok {
+			data = append(data, bytes.TrimPrefix(value, []byte(" ")))
+		}
+
+		if err != nil {
+			// 上游在最后一个事件后直接断开连接时,仍返回已读取的数据
+			if err == io.EOF && len(data) > 0 {
+				return bytes.Join(data, []byte("\n")), nil
+			}
+			return nil, err
+		}
+	}
+}
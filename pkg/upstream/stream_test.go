@@ -0,0 +1,105 @@
+package upstream
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// newTestStream 基于 SSE 文本创建 OpenAI 格式的流式读取器
+func newTestStream(body string) *ChatCompletionStream {
+	return NewChatCompletionStream(io.NopCloser(strings.NewReader(body)))
+}
+
+// recvAll 读取流中的全部数据块,返回数据块与结束时的错误
+func recvAll(t *testing.T, stream *ChatCompletionStream) ([]*ChatCompletionChunk, [][]byte, error) {
+	t.Helper()
+	var (
+		chunks []*ChatCompletionChunk
+		raws   [][]byte
+	)
+	for i := 0; i < 100; i++ {
+		chunk, raw, err := stream.Recv()
+		if err != nil {
+			return chunks, raws, err
+		}
+		chunks = append(chunks, chunk)
+		raws = append(raws, raw)
+	}
+	t.Fatal("stream did not terminate")
+	return nil, nil, nil
+}
+
+func TestChatCompletionStreamFraming(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		texts []string
+	}{
+		{
+			name:  "data events and done",
+			body:  "data: {\"id\":\"1\",\"model\":\"m\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hel\"}}]}\n\ndata: {\"id\":\"1\",\"model\":\"m\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"lo\"}}]}\n\ndata: [DONE]\n\n",
+			texts: []string{"Hel", "lo"},
+		},
+		{
+			name:  "crlf line endings",
+			body:  "data: {\"id\":\"1\",\"model\":\"m\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"a\"}}]}\r\n\r\ndata: [DONE]\r\n\r\n",
+			texts: []string{"a"},
+		},
+		{
+			name:  "comments and other fields ignored",
+			body:  ": keep-alive\n\nevent: message\nid: 7\ndata: {\"id\":\"1\",\"model\":\"m\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"x\"}}]}\nretry: 1000\n\ndata: [DONE]\n\n",
+			texts: []string{"x"},
+		},
+		{
+			name:  "multi-line data joined with newline",
+			body:  "data: {\"id\":\"1\",\"model\":\"m\",\ndata: \"choices\":[{\"index\":0,\"delta\":{\"content\":\"y\"}}]}\n\ndata: [DONE]\n\n",
+			texts: []string{"y"},
+		},
+		{
+			name:  "no space after colon",
+			body:  "data:{\"id\":\"1\",\"model\":\"m\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"z\"}}]}\n\ndata:[DONE]\n\n",
+			texts: []string{"z"},
+		},
+		{
+			name:  "connection closed without done or trailing blank line",
+			body:  "data: {\"id\":\"1\",\"model\":\"m\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"end\"}}]}",
+			texts: []string{"end"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks, _, err := recvAll(t, newTestStream(tt.body))
+			if !errors.Is(err, io.EOF) {
+				t.Fatalf("Recv() error = %v, want io.EOF", err)
+			}
+			if len(chunks) != len(tt.texts) {
+				t.Fatalf("got %d chunks, want %d", len(chunks), len(tt.texts))
+			}
+			for i, chunk := range chunks {
+				if got := chunk.Choices[0].Delta.Content.Text(); got != tt.texts[i] {
+					t.Fatalf("chunk %d text = %q, want %q", i, got, tt.texts[i])
+				}
+			}
+		})
+	}
+}
+
+func TestChatCompletionStreamRawPassthrough(t *testing.T) {
+	raw := `{"id":"1","model":"m","choices":[{"index":0,"delta":{"content":"hi"},"logprobs":null}],"system_fingerprint":"fp"}`
+	_, raws, err := recvAll(t, newTestStream("data: "+raw+"\n\ndata: [DONE]\n\n"))
+	if !errors.Is(err, io.EOF) {
+		t.Fatalf("Recv() error = %v", err)
+	}
+	if len(raws) != 1 || string(raws[0]) != raw {
+		t.Fatalf("raw chunk = %q, want upstream JSON unchanged", raws)
+	}
+}
+
+func TestChatCompletionStreamInvalidChunk(t *testing.T) {
+	_, _, err := newTestStream("data: {not json}\n\n").Recv()
+	if err == nil || errors.Is(err, io.EOF) {
+		t.Fatalf("Recv() error = %v, want decode error", err)
+	}
+}
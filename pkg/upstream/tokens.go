@@ -0,0 +1,29 @@
+package upstream
+
+import "unicode"
+
+// messageOverheadTokens 每条消息的格式开销(角色标记、分隔符等)
+const messageOverheadTokens = 4
+
+// EstimateTokens 粗略估算文本的 Token 数
+// 用于上游未返回 usage 时的兜底计费: CJK 字符按 1 Token/字,其余按 4 字符/Token
+func EstimateTokens(text string) int {
+	var cjk, others int
+	for _, r := range text {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			cjk++
+		} else {
+			others++
+		}
+	}
+	return cjk + (others+3)/4
+}
+
+// EstimatePromptTokens 估算请求消息的输入 Token 数
+func EstimatePromptTokens(messages []Message) int {
+	total := 0
+	for _, msg := range messages {
+		total += messageOverheadTokens + EstimateTokens(msg.Role) + EstimateTokens(msg.Content.Text())
+	}
+	return total
+}
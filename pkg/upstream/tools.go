@@ -0,0 +1,203 @@
+package upstream
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Tool 工具定义
+type Tool struct {
+	Type     string             `json:"type"` // function,或上游内置工具的类型
+	Function FunctionDefinition `json:"function"`
+
+	// Extra 未声明的字段(非函数工具的配置等),原样转发给上游
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON 解析已声明字段,其余字段保留到 Extra
+func (t *Tool) UnmarshalJSON(data []byte) error {
+	type alias Tool
+	if err := json.Unmarshal(data, (*alias)(t)); err != nil {
+		return err
+	}
+	extra, err := extractExtra(data, t)
+	t.Extra = extra
+	return err
+}
+
+// MarshalJSON 序列化时合并 Extra 字段,非函数工具不输出 function
+func (t Tool) MarshalJSON() ([]byte, error) {
+	if !t.IsFunction() {
+		return marshalWithExtra(struct {
+			Type string `json:"type"`
+		}{t.Type}, t.Extra)
+	}
+	type alias Tool
+	return marshalWithExtra(alias(t), t.Extra)
+}
+
+// IsFunction 是否为函数工具,其他类型的工具无法转换为 Anthropic/Gemini 的函数声明
+func (t Tool) IsFunction() bool {
+	return t.Type == "" || t.Type == "function"
+}
+
+// FunctionDefinition 函数定义
+type FunctionDefinition struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"` // JSON Schema
+	Strict      *bool           `json:"strict,omitempty"`
+
+	// Extra 未声明的字段,原样转发给上游
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON 解析已声明字段,其余字段保留到 Extra
+func (f *FunctionDefinition) UnmarshalJSON(data []byte) error {
+	type alias FunctionDefinition
+	if err := json.Unmarshal(data, (*alias)(f)); err != nil {
+		return err
+	}
+	extra, err := extractExtra(data, f)
+	f.Extra = extra
+	return err
+}
+
+// MarshalJSON 序列化时合并 Extra 字段
+func (f FunctionDefinition) MarshalJSON() ([]byte, error) {
+	type alias FunctionDefinition
+	return marshalWithExtra(alias(f), f.Extra)
+}
+
+// ToolChoice 工具选择策略,兼容字符串("none"/"auto"/"required")与对象写法
+// 对象写法中指定函数的解析到 Function,其余变体(allowed_tools 等)保留在 Extra 中原样转发
+type ToolChoice struct {
+	Mode     string // none, auto, required;对象写法时为空
+	Function string // 指定调用的函数名
+
+	// Extra 对象写法中未解析的字段
+	Extra map[string]json.RawMessage
+}
+
+// UnmarshalJSON 解析字符串或对象写法,如 {"type":"function","function":{"name":"..."}}
+func (t *ToolChoice) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(`"`)) {
+		return json.Unmarshal(data, &t.Mode)
+	}
+
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return err
+	}
+
+	var named struct {
+		Type     string `json:"type"`
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	}
+	if err := json.Unmarshal(data, &named); err != nil {
+		return err
+	}
+	if (named.Type == "" || named.Type == "function") && named.Function.Name != "" {
+		t.Function = named.Function.Name
+		delete(all, "type")
+		delete(all, "function")
+	}
+	if len(all) > 0 {
+		t.Extra = all
+	}
+	return nil
+}
+
+// MarshalJSON 按 OpenAI 格式序列化
+func (t ToolChoice) MarshalJSON() ([]byte, error) {
+	if t.Function != "" {
+		return marshalWithExtra(map[string]interface{}{
+			"type":     "function",
+			"function": map[string]string{"name": t.Function},
+		}, t.Extra)
+	}
+	if len(t.Extra) > 0 {
+		return json.Marshal(t.Extra)
+	}
+	return json.Marshal(t.Mode)
+}
+
+// ToolCall 工具调用
+// 流式响应中以增量形式返回: 首个增量包含 ID 与函数名,后续增量按 Index 追加 Arguments
+type ToolCall struct {
+	Index    *int         `json:"index,omitempty"`
+	ID       string       `json:"id,omitempty"`
+	Type     string       `json:"type,omitempty"` // function
+	Function FunctionCall `json:"function"`
+}
+
+// FunctionCall 函数调用
+type FunctionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"` // JSON 字符串
+}
+
+// ToolCallAccumulator 按 Index 拼接流式工具调用增量
+type ToolCallAccumulator struct {
+	calls map[int]*ToolCall
+}
+
+// Add 追加一组工具调用增量
+func (a *ToolCallAccumulator) Add(deltas []ToolCall) {
+	if a.calls == nil {
+		a.calls = make(map[int]*ToolCall)
+	}
+	for i, delta := range deltas {
+		index := i
+		if delta.Index != nil {
+			index = *delta.Index
+		}
+
+		call, ok := a.calls[index]
+		if !ok {
+			call = &ToolCall{Type: "function"}
+			a.calls[index] = call
+		}
+		if delta.ID != "" {
+			call.ID = delta.ID
+		}
+		if delta.Function.Name != "" {
+			call.Function.Name = delta.Function.Name
+		}
+		call.Function.Arguments += delta.Function.Arguments
+	}
+}
+
+// Calls 返回按 Index 排序的完整工具调用
+func (a *ToolCallAccumulator) Calls() []ToolCall {
+	indexes := make([]int, 0, len(a.calls))
+	for index := range a.calls {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	calls := make([]ToolCall, 0, len(indexes))
+	for _, index := range indexes {
+		calls = append(calls, *a.calls[index])
+	}
+	return calls
+}
+
+// argumentsJSON 将工具调用参数转换为 JSON 对象,参数为空或不合法时返回 {}
+func argumentsJSON(arguments string) json.RawMessage {
+	if arguments == "" || !json.Valid([]byte(arguments)) {
+		return json.RawMessage("{}")
+	}
+	return json.RawMessage(arguments)
+}
+
+// newToolCallID 生成 OpenAI 风格的工具调用 ID
+func newToolCallID() string {
+	return "call_" + strings.ReplaceAll(uuid.NewString(), "-", "")[:24]
+}
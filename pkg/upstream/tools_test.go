@@ -0,0 +1,286 @@
+package upstream
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func TestToolCallAccumulator(t *testing.T) {
+	var acc ToolCallAccumulator
+	acc.Add([]ToolCall{{Index: intPtr(1), ID: "call_b", Function: FunctionCall{Name: "second", Arguments: `{"b":`}}})
+	acc.Add([]ToolCall{{Index: intPtr(0), ID: "call_a", Function: FunctionCall{Name: "first", Arguments: `{}`}}})
+	acc.Add([]ToolCall{{Index: intPtr(1), Function: FunctionCall{Arguments: `2}`}}})
+
+	calls := acc.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("got %d calls, want 2", len(calls))
+	}
+	if c := calls[0]; c.ID != "call_a" || c.Type != "function" || c.Function.Name != "first" || c.Function.Arguments != `{}` {
+		t.Fatalf("call 0 = %+v", c)
+	}
+	if c := calls[1]; c.ID != "call_b" || c.Function.Name != "second" || c.Function.Arguments != `{"b":2}` {
+		t.Fatalf("call 1 = %+v", c)
+	}
+}
+
+func TestToolCallAccumulatorWithoutIndex(t *testing.T) {
+	var acc ToolCallAccumulator
+	// 未携带 index 的增量按在数组中的位置归属
+	acc.Add([]ToolCall{{ID: "call_a", Function: FunctionCall{Name: "a"}}, {ID: "call_b", Function: FunctionCall{Name: "b"}}})
+
+	calls := acc.Calls()
+	if len(calls) != 2 || calls[0].ID != "call_a" || calls[1].ID != "call_b" {
+		t.Fatalf("calls = %+v", calls)
+	}
+	if len((&ToolCallAccumulator{}).Calls()) != 0 {
+		t.Fatal("empty accumulator returned calls")
+	}
+}
+
+func TestArgumentsJSON(t *testing.T) {
+	tests := map[string]string{
+		``:                 `{}`,
+		`not json`:         `{}`,
+		`{"city":"Paris"}`: `{"city":"Paris"}`,
+		`{"partial":`:      `{}`,
+	}
+	for in, want := range tests {
+		if got := string(argumentsJSON(in)); got != want {
+			t.Errorf("argumentsJSON(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestLowerSchemaTypes(t *testing.T) {
+	got := lowerSchemaTypes(json.RawMessage(`{
+		"type": "OBJECT",
+		"properties": {
+			"city": {"type": "STRING", "description": "City TYPE"},
+			"days": {"type": "ARRAY", "items": {"type": "INTEGER"}},
+			"type": {"type": "STRING"}
+		},
+		"required": ["city"]
+	}`))
+	assertJSONEqual(t, got, `{
+		"type": "object",
+		"properties": {
+			"city": {"type": "string", "description": "City TYPE"},
+			"days": {"type": "array", "items": {"type": "integer"}},
+			"type": {"type": "string"}
+		},
+		"required": ["city"]
+	}`)
+
+	invalid := json.RawMessage(`{not json`)
+	if out := lowerSchemaTypes(invalid); string(out) != string(invalid) {
+		t.Fatalf("lowerSchemaTypes(invalid) = %s, want input unchanged", out)
+	}
+}
+
+func TestGeminiToolsToTools(t *testing.T) {
+	tools := geminiToolsToTools([]GeminiTool{{FunctionDeclarations: []GeminiFunctionDeclaration{
+		{Name: "openapi", Parameters: json.RawMessage(`{"type":"OBJECT"}`)},
+		{Name: "jsonschema", ParametersJSONSchema: json.RawMessage(`{"type":"object","additionalProperties":false}`)},
+		{Name: "noargs", Description: "no parameters"},
+	}}})
+
+	if len(tools) != 3 {
+		t.Fatalf("got %d tools, want 3", len(tools))
+	}
+	if string(tools[0].Function.Parameters) != `{"type":"object"}` {
+		t.Fatalf("OpenAPI parameters = %s", tools[0].Function.Parameters)
+	}
+	if string(tools[1].Function.Parameters) != `{"type":"object","additionalProperties":false}` {
+		t.Fatalf("JSON Schema parameters = %s", tools[1].Function.Parameters)
+	}
+	if tools[2].Function.Parameters != nil || tools[2].Function.Description != "no parameters" {
+		t.Fatalf("tool without parameters = %+v", tools[2])
+	}
+}
+
+func TestGeminiToolConfigMapping(t *testing.T) {
+	tests := []struct {
+		name      string
+		choice    *ToolChoice
+		mode      string
+		allowed   []string
+		roundTrip *ToolChoice
+	}{
+		{"auto", &ToolChoice{Mode: "auto"}, "AUTO", nil, &ToolChoice{Mode: "auto"}},
+		{"required", &ToolChoice{Mode: "required"}, "ANY", nil, &ToolChoice{Mode: "required"}},
+		{"none", &ToolChoice{Mode: "none"}, "NONE", nil, &ToolChoice{Mode: "none"}},
+		{"named function", &ToolChoice{Function: "f"}, "ANY", []string{"f"}, &ToolChoice{Function: "f"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newGeminiToolConfig(tt.choice)
+			fc := cfg.FunctionCallingConfig
+			if fc.Mode != tt.mode || strings.Join(fc.AllowedFunctionNames, ",") != strings.Join(tt.allowed, ",") {
+				t.Fatalf("FunctionCallingConfig = %+v, want mode %s allowed %v", fc, tt.mode, tt.allowed)
+			}
+			back := cfg.toToolChoice()
+			if back.Mode != tt.roundTrip.Mode || back.Function != tt.roundTrip.Function {
+				t.Fatalf("toToolChoice() = %+v, want %+v", back, tt.roundTrip)
+			}
+		})
+	}
+
+	if newGeminiToolConfig(nil) != nil {
+		t.Fatal("newGeminiToolConfig(nil) != nil")
+	}
+	multi := &GeminiToolConfig{FunctionCallingConfig: &GeminiFunctionCallingConfig{Mode: "ANY", AllowedFunctionNames: []string{"a", "b"}}}
+	if choice := multi.toToolChoice(); choice.Mode != "required" || choice.Function != "" {
+		t.Fatalf("toToolChoice() with several allowed functions = %+v, want required", choice)
+	}
+	if (&GeminiToolConfig{}).toToolChoice() != nil || (*GeminiToolConfig)(nil).toToolChoice() != nil {
+		t.Fatal("empty tool config produced a tool choice")
+	}
+}
+
+func TestNewGeminiToolsSkipsNonFunctionTools(t *testing.T) {
+	tools := newGeminiTools([]Tool{
+		{Type: "web_search_preview"},
+		{Type: "function", Function: FunctionDefinition{Name: "f", Parameters: json.RawMessage(`{"type":"object"}`)}},
+	})
+	if len(tools) != 1 || len(tools[0].FunctionDeclarations) != 1 || tools[0].FunctionDeclarations[0].Name != "f" {
+		t.Fatalf("newGeminiTools() = %+v", tools)
+	}
+	if tools := newGeminiTools([]Tool{{Type: "web_search_preview"}}); tools != nil {
+		t.Fatalf("newGeminiTools() = %+v, want nil without function tools", tools)
+	}
+}
+
+func TestGeminiFunctionResponsesMatchPendingCalls(t *testing.T) {
+	var req GeminiGenerateContentRequest
+	err := json.Unmarshal([]byte(`{
+		"contents": [
+			{"role": "user", "parts": [{"text": "weather in Paris and Rome?"}]},
+			{"role": "model", "parts": [
+				{"functionCall": {"name": "get_weather", "args": {"city":"Paris"}}},
+				{"functionCall": {"name": "get_weather", "args": {"city": "Rome"}}}
+			]},
+			{"role": "user", "parts": [
+				{"functionResponse": {"name": "get_weather", "response": {"temp":20}}},
+				{"functionResponse": {"name": "get_weather", "response": {"temp": 25}}}
+			]}
+		]
+	}`), &req)
+	if err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	msgs := req.ToChatCompletionRequest("gemini-2.0-flash").Messages
+	if len(msgs) != 4 {
+		t.Fatalf("got %d messages, want user, assistant and two tool results: %+v", len(msgs), msgs)
+	}
+	calls := msgs[1].ToolCalls
+	if msgs[1].Role != "assistant" || len(calls) != 2 || calls[0].ID == "" || calls[0].ID == calls[1].ID {
+		t.Fatalf("assistant message = %+v", msgs[1])
+	}
+	if calls[0].Function.Arguments != `{"city":"Paris"}` {
+		t.Fatalf("Arguments = %s", calls[0].Function.Arguments)
+	}
+	content, _ := json.Marshal(msgs[1].Content)
+	if string(content) != "null" {
+		t.Fatalf("assistant content = %s, want null", content)
+	}
+
+	// 未携带 ID 的函数结果按顺序关联到同名调用
+	for i, msg := range msgs[2:] {
+		if msg.Role != "tool" || msg.ToolCallID != calls[i].ID {
+			t.Fatalf("tool message %d = %+v, want tool_call_id %s", i, msg, calls[i].ID)
+		}
+	}
+	if msgs[2].Content.Text() != `{"temp":20}` {
+		t.Fatalf("tool result = %s", msgs[2].Content.Text())
+	}
+}
+
+func TestTakePendingCallByID(t *testing.T) {
+	pending := map[string][]string{"f": {"call_1", "call_2"}}
+	if got := takePendingCall(pending, "f", "call_2"); got != "call_2" {
+		t.Fatalf("takePendingCall() = %q, want call_2", got)
+	}
+	if got := takePendingCall(pending, "f", ""); got != "call_1" {
+		t.Fatalf("takePendingCall() = %q, want call_1", got)
+	}
+	if len(pending["f"]) != 0 {
+		t.Fatalf("pending = %v, want empty", pending)
+	}
+	// 没有待匹配的调用时沿用结果自带的 ID,否则生成新的 ID
+	if got := takePendingCall(pending, "f", "call_9"); got != "call_9" {
+		t.Fatalf("takePendingCall() = %q, want call_9", got)
+	}
+	if got := takePendingCall(pending, "g", ""); !strings.HasPrefix(got, "call_") {
+		t.Fatalf("takePendingCall() = %q, want generated ID", got)
+	}
+}
+
+func TestNewGeminiRequestMergesToolResults(t *testing.T) {
+	req := &ChatCompletionRequest{Messages: []Message{
+		{Role: "user", Content: NewTextContent("weather?")},
+		{Role: "assistant", Content: NullContent(), ToolCalls: []ToolCall{
+			{ID: "call_1", Type: "function", Function: FunctionCall{Name: "get_weather", Arguments: `{"city":"Paris"}`}},
+			{ID: "call_2", Type: "function", Function: FunctionCall{Name: "get_time", Arguments: ``}},
+		}},
+		{Role: "tool", ToolCallID: "call_1", Content: NewTextContent(`{"temp":20}`)},
+		{Role: "tool", ToolCallID: "call_2", Content: NewTextContent("12:00")},
+	}}
+
+	out := NewGeminiGenerateContentRequest(req)
+	if len(out.Contents) != 3 {
+		t.Fatalf("got %d contents, want user, model and one merged function response turn", len(out.Contents))
+	}
+
+	model := out.Contents[1]
+	if model.Role != "model" || len(model.Parts) != 2 {
+		t.Fatalf("model turn = %+v", model)
+	}
+	if fc := model.Parts[0].FunctionCall; fc == nil || fc.Name != "get_weather" || string(fc.Args) != `{"city":"Paris"}` {
+		t.Fatalf("function call = %+v", model.Parts[0])
+	}
+	if fc := model.Parts[1].FunctionCall; fc == nil || string(fc.Args) != `{}` {
+		t.Fatalf("function call without arguments = %+v", model.Parts[1])
+	}
+
+	results := out.Contents[2]
+	if results.Role != "user" || len(results.Parts) != 2 {
+		t.Fatalf("function response turn = %+v", results)
+	}
+	if fr := results.Parts[0].FunctionResponse; fr.Name != "get_weather" || string(fr.Response) != `{"temp":20}` {
+		t.Fatalf("function response 0 = %+v", fr)
+	}
+	// 非 JSON 对象的结果包装为 {"output": ...}
+	if fr := results.Parts[1].FunctionResponse; fr.Name != "get_time" || string(fr.Response) != `{"output":"12:00"}` {
+		t.Fatalf("function response 1 = %+v", fr)
+	}
+}
+
+func TestGeminiResponseToolCalls(t *testing.T) {
+	resp := (&GeminiGenerateContentResponse{Candidates: []GeminiCandidate{{
+		Content: GeminiContent{Role: "model", Parts: []GeminiPart{
+			{FunctionCall: &GeminiFunctionCall{ID: "fc_1", Name: "get_weather", Args: json.RawMessage(`{"city":"Paris"}`)}},
+		}},
+		FinishReason: "STOP",
+	}}}).ToChatCompletionResponse("chatcmpl-1", "m")
+
+	choice := resp.Choices[0]
+	if choice.FinishReason != "tool_calls" || len(choice.Message.ToolCalls) != 1 || choice.Message.ToolCalls[0].ID != "fc_1" {
+		t.Fatalf("choice = %+v", choice)
+	}
+	content, _ := json.Marshal(choice.Message.Content)
+	if string(content) != "null" {
+		t.Fatalf("content = %s, want null", content)
+	}
+
+	back := NewGeminiGenerateContentResponse(resp, "m")
+	parts := back.Candidates[0].Content.Parts
+	if len(parts) != 1 || parts[0].FunctionCall == nil || parts[0].FunctionCall.ID != "fc_1" {
+		t.Fatalf("Gemini parts = %+v, want only the function call with its ID", parts)
+	}
+}
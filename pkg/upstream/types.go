@@ -1,29 +1,223 @@
 package upstream
 
+import (
+	"bytes"
+	"encoding/json"
+)
+
 // ChatCompletionRequest 文本对话请求
 type ChatCompletionRequest struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
+	Model         string         `json:"model"`
+	Messages      []Message      `json:"messages"`
+	MaxTokens     *int           `json:"max_tokens,omitempty"`
+	Temperature   *float64       `json:"temperature,omitempty"`
+	TopP          *float64       `json:"top_p,omitempty"`
+	Stop          StopSequences  `json:"stop,omitempty"`
+	Tools         []Tool         `json:"tools,omitempty"`
+	ToolChoice    *ToolChoice    `json:"tool_choice,omitempty"`
+	Stream        bool           `json:"stream,omitempty"`
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
+
+	// Extra 中转站不解析的字段(response_format、seed 等),原样转发给上游
+	Extra map[string]json.RawMessage `json:"-"`
+
+	stopString bool // 客户端以单个字符串传入 stop,转发时保持原写法
+}
+
+// UnmarshalJSON 解析已声明字段,其余字段保留到 Extra
+func (r *ChatCompletionRequest) UnmarshalJSON(data []byte) error {
+	type alias ChatCompletionRequest
+	if err := json.Unmarshal(data, (*alias)(r)); err != nil {
+		return err
+	}
+
+	var stop struct {
+		Stop json.RawMessage `json:"stop"`
+	}
+	if err := json.Unmarshal(data, &stop); err != nil {
+		return err
+	}
+	r.stopString = bytes.HasPrefix(bytes.TrimSpace(stop.Stop), []byte(`"`))
+
+	extra, err := extractExtra(data, r)
+	r.Extra = extra
+	return err
+}
+
+// MarshalJSON 序列化时合并 Extra 字段
+func (r ChatCompletionRequest) MarshalJSON() ([]byte, error) {
+	type alias ChatCompletionRequest
+	if !r.stopString || len(r.Stop) != 1 {
+		return marshalWithExtra(alias(r), r.Extra)
+	}
+
+	// 单个字符串的 stop 按原写法输出
+	stop, err := json.Marshal(r.Stop[0])
+	if err != nil {
+		return nil, err
+	}
+	extra := make(map[string]json.RawMessage, len(r.Extra)+1)
+	for key, value := range r.Extra {
+		extra[key] = value
+	}
+	extra["stop"] = stop
+	out := alias(r)
+	out.Stop = nil
+	return marshalWithExtra(out, extra)
+}
+
+// StopSequences 停止序列,兼容 OpenAI 的字符串和字符串数组两种写法
+type StopSequences []string
+
+// UnmarshalJSON 解析字符串或字符串数组
+func (s *StopSequences) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*s = nil
+		return nil
+	}
+
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*s = StopSequences{single}
+		return nil
+	}
+
+	var multi []string
+	if err := json.Unmarshal(data, &multi); err != nil {
+		return err
+	}
+	*s = multi
+	return nil
+}
+
+// StreamOptions 流式选项
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 // Message 消息
 type Message struct {
-	Role    string `json:"role"` // system, user, assistant
-	Content string `json:"content"`
+	Role       string         `json:"role"` // system, user, assistant, tool
+	Content    MessageContent `json:"content"`
+	ToolCalls  []ToolCall     `json:"tool_calls,omitempty"`   // assistant 发起的工具调用
+	ToolCallID string         `json:"tool_call_id,omitempty"` // tool 消息对应的调用 ID
+
+	// Extra 未声明的字段(name、refusal、reasoning_content 等),原样透传
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON 解析已声明字段,其余字段保留到 Extra
+func (m *Message) UnmarshalJSON(data []byte) error {
+	type alias Message
+	if err := json.Unmarshal(data, (*alias)(m)); err != nil {
+		return err
+	}
+	extra, err := extractExtra(data, m)
+	m.Extra = extra
+	return err
+}
+
+// MarshalJSON 序列化时合并 Extra 字段
+func (m Message) MarshalJSON() ([]byte, error) {
+	type alias Message
+	return marshalWithExtra(alias(m), m.Extra)
 }
 
 // ChatCompletionResponse 文本对话响应
 type ChatCompletionResponse struct {
 	ID      string   `json:"id"`
+	Object  string   `json:"object,omitempty"` // chat.completion
+	Created int64    `json:"created,omitempty"`
 	Model   string   `json:"model"`
 	Choices []Choice `json:"choices"`
 	Usage   Usage    `json:"usage"`
+
+	// SystemFingerprint 上游后端配置指纹
+	SystemFingerprint string `json:"system_fingerprint,omitempty"`
+
+	// Extra 未声明的字段,原样返回给客户端
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON 解析已声明字段,其余字段保留到 Extra
+func (r *ChatCompletionResponse) UnmarshalJSON(data []byte) error {
+	type alias ChatCompletionResponse
+	if err := json.Unmarshal(data, (*alias)(r)); err != nil {
+		return err
+	}
+	extra, err := extractExtra(data, r)
+	r.Extra = extra
+	return err
+}
+
+// MarshalJSON 序列化时合并 Extra 字段
+func (r ChatCompletionResponse) MarshalJSON() ([]byte, error) {
+	type alias ChatCompletionResponse
+	return marshalWithExtra(alias(r), r.Extra)
 }
 
 // Choice 选择项
 type Choice struct {
-	Index   int     `json:"index"`
-	Message Message `json:"message"`
+	Index        int     `json:"index"`
+	Message      Message `json:"message"`
+	FinishReason string  `json:"finish_reason,omitempty"`
+
+	// Extra 未声明的字段(logprobs 等),原样返回给客户端
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON 解析已声明字段,其余字段保留到 Extra
+func (c *Choice) UnmarshalJSON(data []byte) error {
+	type alias Choice
+	if err := json.Unmarshal(data, (*alias)(c)); err != nil {
+		return err
+	}
+	extra, err := extractExtra(data, c)
+	c.Extra = extra
+	return err
+}
+
+// MarshalJSON 序列化时合并 Extra 字段
+func (c Choice) MarshalJSON() ([]byte, error) {
+	type alias Choice
+	return marshalWithExtra(alias(c), c.Extra)
+}
+
+// ChatCompletionChunk 流式对话数据块
+type ChatCompletionChunk struct {
+	ID      string        `json:"id"`
+	Object  string        `json:"object,omitempty"` // chat.completion.chunk
+	Created int64         `json:"created,omitempty"`
+	Model   string        `json:"model"`
+	Choices []ChunkChoice `json:"choices"`
+	Usage   *Usage        `json:"usage,omitempty"`
+}
+
+// ChunkChoice 流式选择项
+type ChunkChoice struct {
+	Index        int     `json:"index"`
+	Delta        Message `json:"delta"`
+	FinishReason string  `json:"finish_reason,omitempty"`
+
+	// Extra 未声明的字段(logprobs 等),原样返回给客户端
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON 解析已声明字段,其余字段保留到 Extra
+func (c *ChunkChoice) UnmarshalJSON(data []byte) error {
+	type alias ChunkChoice
+	if err := json.Unmarshal(data, (*alias)(c)); err != nil {
+		return err
+	}
+	extra, err := extractExtra(data, c)
+	c.Extra = extra
+	return err
+}
+
+// MarshalJSON 序列化时合并 Extra 字段
+func (c ChunkChoice) MarshalJSON() ([]byte, error) {
+	type alias ChunkChoice
+	return marshalWithExtra(alias(c), c.Extra)
 }
 
 // Usage Token使用量
@@ -31,6 +225,26 @@ type Usage struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
+
+	// Extra 未声明的字段(prompt_tokens_details 等),原样返回给客户端
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON 解析已声明字段,其余字段保留到 Extra
+func (u *Usage) UnmarshalJSON(data []byte) error {
+	type alias Usage
+	if err := json.Unmarshal(data, (*alias)(u)); err != nil {
+		return err
+	}
+	extra, err := extractExtra(data, u)
+	u.Extra = extra
+	return err
+}
+
+// MarshalJSON 序列化时合并 Extra 字段
+func (u Usage) MarshalJSON() ([]byte, error) {
+	type alias Usage
+	return marshalWithExtra(alias(u), u.Extra)
 }
 
 // ImageGenerationRequest 图片生成请求
@@ -41,10 +255,20 @@ type ImageGenerationRequest struct {
 	Size   string `json:"size,omitempty"` // 图片尺寸
 }
 
-// ImageGenerationResponse 图片生成响应(异步)
+// ImageGenerationResponse 图片生成响应
+// 异步上游返回 TaskID,同步上游(如 OpenAI)直接返回 Images 且 Status 为 completed
 type ImageGenerationResponse struct {
-	TaskID string `json:"task_id"`
-	Status string `json:"status"` // pending, processing, completed, failed
+	TaskID string      `json:"task_id"`
+	Status string      `json:"status"` // pending, processing, completed, failed
+	Images []ImageData `json:"images,omitempty"`
+}
+
+// ImageData 同步生成的图片
+type ImageData struct {
+	URL           string `json:"url,omitempty"`
+	B64JSON       string `json:"b64_json,omitempty"`
+	MimeType      string `json:"mime_type,omitempty"` // b64_json 的图片类型,缺省为 image/png
+	RevisedPrompt string `json:"revised_prompt,omitempty"`
 }
 
 // VideoGenerationRequest 视频生成请求
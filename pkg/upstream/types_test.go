@@ -0,0 +1,181 @@
+package upstream
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// assertJSONEqual 比较两段 JSON 是否语义相同(忽略字段顺序与空白)
+func assertJSONEqual(t *testing.T, got []byte, want string) {
+	t.Helper()
+	var g, w interface{}
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("invalid JSON %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("invalid expected JSON %s: %v", want, err)
+	}
+	if !reflect.DeepEqual(g, w) {
+		t.Fatalf("JSON mismatch\n got: %s\nwant: %s", got, want)
+	}
+}
+
+// roundTrip 解析 JSON 到 v 后重新序列化
+func roundTrip(t *testing.T, data string, v interface{}) []byte {
+	t.Helper()
+	if err := json.Unmarshal([]byte(data), v); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return out
+}
+
+func TestChatCompletionRequestPassthrough(t *testing.T) {
+	body := `{
+		"model": "gpt-4o",
+		"messages": [
+			{"role": "user", "name": "alice", "content": [{"type": "text", "text": "hi", "cache_control": {"type": "ephemeral"}}]},
+			{"role": "assistant", "content": null, "refusal": "no",
+			 "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "f", "arguments": "{}"}}]}
+		],
+		"response_format": {"type": "json_object"},
+		"seed": 42,
+		"logit_bias": {"50256": -100},
+		"tools": [
+			{"type": "function", "function": {"name": "f", "parameters": {"type": "object"}, "strict": true, "x-vendor": 1}},
+			{"type": "web_search_preview", "search_context_size": "low"}
+		],
+		"tool_choice": {"type": "allowed_tools", "mode": "auto", "tools": [{"type": "function", "name": "f"}]},
+		"stream_options": {"include_usage": true}
+	}`
+
+	var req ChatCompletionRequest
+	assertJSONEqual(t, roundTrip(t, body, &req), body)
+
+	if string(req.Extra["seed"]) != "42" {
+		t.Fatalf("Extra = %v, want seed preserved", req.Extra)
+	}
+	if string(req.Messages[0].Extra["name"]) != `"alice"` || string(req.Messages[1].Extra["refusal"]) != `"no"` {
+		t.Fatalf("message extras = %v, %v", req.Messages[0].Extra, req.Messages[1].Extra)
+	}
+	if req.Tools[1].IsFunction() || string(req.Tools[1].Extra["search_context_size"]) != `"low"` {
+		t.Fatalf("built-in tool = %+v", req.Tools[1])
+	}
+	if req.ToolChoice.Mode != "" || req.ToolChoice.Function != "" || len(req.ToolChoice.Extra) != 3 {
+		t.Fatalf("ToolChoice = %+v, want allowed_tools kept in Extra", req.ToolChoice)
+	}
+}
+
+func TestChatCompletionRequestKnownFieldsWin(t *testing.T) {
+	req := ChatCompletionRequest{
+		Model: "rewritten",
+		Extra: map[string]json.RawMessage{"model": json.RawMessage(`"original"`), "seed": json.RawMessage(`1`)},
+	}
+	out, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	assertJSONEqual(t, out, `{"model":"rewritten","messages":null,"seed":1}`)
+}
+
+func TestChatCompletionRequestStopShape(t *testing.T) {
+	tests := []struct {
+		name string
+		stop string
+		want string
+	}{
+		{"string stays string", `"END"`, `"END"`},
+		{"single element array stays array", `["END"]`, `["END"]`},
+		{"array stays array", `["a","b"]`, `["a","b"]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req ChatCompletionRequest
+			out := roundTrip(t, `{"model":"m","messages":[],"stop":`+tt.stop+`}`, &req)
+			assertJSONEqual(t, out, `{"model":"m","messages":[],"stop":`+tt.want+`}`)
+		})
+	}
+
+	// 转换后的请求(如 Anthropic stop_sequences)以数组输出
+	out, _ := json.Marshal(ChatCompletionRequest{Model: "m", Stop: StopSequences{"END"}})
+	assertJSONEqual(t, out, `{"model":"m","messages":null,"stop":["END"]}`)
+}
+
+func TestToolChoiceForms(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		mode     string
+		function string
+	}{
+		{"string mode", `"required"`, "required", ""},
+		{"named function", `{"type":"function","function":{"name":"f"}}`, "", "f"},
+		{"named function with extra", `{"type":"function","function":{"name":"f"},"x":1}`, "", "f"},
+		{"other variant", `{"type":"custom","custom":{"name":"grammar"}}`, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var choice ToolChoice
+			out := roundTrip(t, tt.data, &choice)
+			if choice.Mode != tt.mode || choice.Function != tt.function {
+				t.Fatalf("ToolChoice = %+v, want mode %q function %q", choice, tt.mode, tt.function)
+			}
+			assertJSONEqual(t, out, tt.data)
+		})
+	}
+}
+
+func TestChatCompletionResponsePassthrough(t *testing.T) {
+	body := `{
+		"id": "chatcmpl-1",
+		"object": "chat.completion",
+		"created": 1700000000,
+		"model": "gpt-4o",
+		"system_fingerprint": "fp_1",
+		"service_tier": "default",
+		"choices": [{
+			"index": 0,
+			"message": {"role": "assistant", "content": "hi", "annotations": []},
+			"finish_reason": "stop",
+			"logprobs": {"content": null}
+		}],
+		"usage": {"prompt_tokens": 1, "completion_tokens": 1, "total_tokens": 2, "prompt_tokens_details": {"cached_tokens": 0}}
+	}`
+
+	var resp ChatCompletionResponse
+	assertJSONEqual(t, roundTrip(t, body, &resp), body)
+	if _, ok := resp.Usage.Extra["prompt_tokens_details"]; !ok {
+		t.Fatalf("Usage.Extra = %v", resp.Usage.Extra)
+	}
+}
+
+func TestChatCompletionChunkPassthrough(t *testing.T) {
+	body := `{
+		"id": "chatcmpl-1",
+		"object": "chat.completion.chunk",
+		"created": 1700000000,
+		"model": "gpt-4o",
+		"choices": [{
+			"index": 0,
+			"delta": {"role": "assistant", "content": "hi", "reasoning_content": "thinking"},
+			"logprobs": null
+		}]
+	}`
+
+	var chunk ChatCompletionChunk
+	assertJSONEqual(t, roundTrip(t, body, &chunk), body)
+	if string(chunk.Choices[0].Delta.Extra["reasoning_content"]) != `"thinking"` {
+		t.Fatalf("Delta.Extra = %v", chunk.Choices[0].Delta.Extra)
+	}
+}
+
+func TestExtractExtraIgnoresNonObjects(t *testing.T) {
+	extra, err := extractExtra([]byte(`"text"`), &Message{})
+	if err != nil || extra != nil {
+		t.Fatalf("extractExtra() = %v, %v; want nil", extra, err)
+	}
+}